@@ -0,0 +1,291 @@
+package logrustash
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// amqpTestMessage is a message published to fakeAMQP.
+type amqpTestMessage struct {
+	exchange, routingKey string
+	deliveryMode         byte
+	body                 string
+}
+
+// fakeAMQP is a broker confirming the messages published to the exchanges other than "missing",
+// which closes the channel, and returning the mandatory messages of the routing key "unroutable".
+type fakeAMQP struct {
+	l net.Listener
+
+	mu       sync.Mutex
+	msgs     []amqpTestMessage
+	channels int
+	login    string
+	vhost    string
+}
+
+func newFakeAMQP(t *testing.T) *fakeAMQP {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	a := &fakeAMQP{l: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go a.serve(conn)
+		}
+	}()
+
+	return a
+}
+
+func (a *fakeAMQP) published() []amqpTestMessage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]amqpTestMessage(nil), a.msgs...)
+}
+
+func (a *fakeAMQP) serve(conn net.Conn) {
+	defer conn.Close()
+
+	// the fake broker reads the frames with the parsing of the writer
+	w := &AMQPWriter{conn: conn, r: bufio.NewReader(conn), frameMax: defaultAMQPFrameMax}
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(w.r, header); err != nil || string(header) != string(amqpProtocolHeader) {
+		return
+	}
+
+	start := []byte{0, 9}
+	start = amqpAppendTable(start, map[string]string{"product": "fake"})
+	start = amqpAppendLongString(start, "PLAIN")
+	start = amqpAppendLongString(start, "en_US")
+	if w.writeMethod(0, amqpConnectionStart, start) != nil {
+		return
+	}
+
+	confirms := map[uint16]bool{}
+	tags := map[uint16]uint64{}
+	var publishing *amqpTestMessage
+	var mandatory bool
+	var size uint64
+
+	for {
+		typ, channel, payload, err := w.readFrame()
+		if err != nil {
+			return
+		}
+
+		switch typ {
+		case amqpFrameHeader:
+			size = binary.BigEndian.Uint64(payload[4:])
+			publishing.deliveryMode = payload[14+int(payload[14])+1]
+			continue
+		case amqpFrameBody:
+			publishing.body += string(payload)
+			if uint64(len(publishing.body)) < size {
+				continue
+			}
+
+			a.mu.Lock()
+			a.msgs = append(a.msgs, *publishing)
+			a.mu.Unlock()
+
+			if publishing.routingKey == "unroutable" && mandatory {
+				ret := binary.BigEndian.AppendUint16(nil, 312)
+				ret = amqpAppendShortString(ret, "NO_ROUTE")
+				ret = amqpAppendShortString(ret, publishing.exchange)
+				ret = amqpAppendShortString(ret, publishing.routingKey)
+				header := binary.BigEndian.AppendUint16(nil, amqpClassBasic)
+				header = binary.BigEndian.AppendUint16(header, 0)
+				header = binary.BigEndian.AppendUint64(header, uint64(len(publishing.body)))
+				header = binary.BigEndian.AppendUint16(header, 0)
+				frames := amqpAppendMethod(nil, channel, amqpBasicReturn, ret)
+				frames = amqpAppendFrame(frames, amqpFrameHeader, channel, header)
+				frames = amqpAppendFrame(frames, amqpFrameBody, channel, []byte(publishing.body))
+				if _, err := conn.Write(frames); err != nil {
+					return
+				}
+			}
+
+			if confirms[channel] {
+				tags[channel]++
+				ack := binary.BigEndian.AppendUint64(nil, tags[channel])
+				if w.writeMethod(channel, amqpBasicAck, append(ack, 0)) != nil {
+					return
+				}
+			}
+			continue
+		}
+
+		method := amqpMethod{binary.BigEndian.Uint16(payload), binary.BigEndian.Uint16(payload[2:])}
+		args := payload[4:]
+
+		var reply amqpMethod
+		var replyArgs []byte
+		switch method {
+		case amqpConnectionStartOk:
+			tableSize := binary.BigEndian.Uint32(args)
+			args = args[4+tableSize:]
+			args = args[1+int(args[0]):] // mechanism
+			a.mu.Lock()
+			a.login = string(args[4 : 4+binary.BigEndian.Uint32(args)])
+			a.mu.Unlock()
+
+			reply = amqpConnectionTune
+			replyArgs = binary.BigEndian.AppendUint16(nil, 2047)
+			replyArgs = binary.BigEndian.AppendUint32(replyArgs, 4096)
+			replyArgs = binary.BigEndian.AppendUint16(replyArgs, 60)
+		case amqpConnectionTuneOk:
+			continue
+		case amqpConnectionOpen:
+			a.mu.Lock()
+			a.vhost = string(args[1 : 1+args[0]])
+			a.mu.Unlock()
+			reply = amqpConnectionOpenOk
+			replyArgs = []byte{0}
+		case amqpConnectionClose:
+			reply = amqpConnectionCloseOk
+		case amqpChannelOpen:
+			a.mu.Lock()
+			a.channels++
+			a.mu.Unlock()
+			reply = amqpChannelOpenOk
+			replyArgs = []byte{0, 0, 0, 0}
+		case amqpChannelCloseOk:
+			continue
+		case amqpConfirmSelect:
+			confirms[channel] = true
+			reply = amqpConfirmSelectOk
+		case amqpBasicPublish:
+			args = args[2:]
+			exchange := string(args[1 : 1+args[0]])
+			args = args[1+args[0]:]
+			publishing = &amqpTestMessage{exchange: exchange, routingKey: string(args[1 : 1+args[0]])}
+			mandatory = args[1+args[0]]&1 != 0
+
+			if exchange == "missing" {
+				reply = amqpChannelClose
+				replyArgs = binary.BigEndian.AppendUint16(nil, 404)
+				replyArgs = amqpAppendShortString(replyArgs, "NOT_FOUND - no exchange 'missing' in vhost '/'")
+				replyArgs = binary.BigEndian.AppendUint32(replyArgs, uint32(amqpClassBasic)<<16|40)
+				break
+			}
+			continue
+		default:
+			continue
+		}
+
+		if w.writeMethod(channel, reply, replyArgs) != nil {
+			return
+		}
+	}
+}
+
+func TestAMQPWriter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	a := newFakeAMQP(t)
+
+	w, err := NewAMQPWriter(AMQPOptions{
+		URL:        "amqp://user:pass@" + a.l.Addr().String() + "/logs",
+		Exchange:   "logstash",
+		RoutingKey: "app",
+		Confirms:   true,
+		Persistent: true,
+	})
+	require.NoError(err)
+
+	hook, err := NewWithWriter(w, WithFormatter(&logrus.JSONFormatter{}), WithSynchronous())
+	require.NoError(err)
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "published", Data: logrus.Fields{}}))
+
+	msgs := a.published()
+	require.Len(msgs, 1)
+	assert.Equal("logstash", msgs[0].exchange)
+	assert.Equal("app", msgs[0].routingKey)
+	assert.Equal(byte(2), msgs[0].deliveryMode)
+	assert.Contains(msgs[0].body, `"msg":"published"`)
+
+	a.mu.Lock()
+	assert.Equal("\x00user\x00pass", a.login)
+	assert.Equal("logs", a.vhost)
+	a.mu.Unlock()
+
+	// the bodies larger than the frame size negotiated are split
+	large := make([]byte, 10000)
+	for i := range large {
+		large[i] = 'a'
+	}
+	_, err = w.Write(append(large, []byte("\nsmall\n")...))
+	require.NoError(err)
+
+	msgs = a.published()
+	require.Len(msgs, 3)
+	assert.Equal(string(large), msgs[1].body)
+	assert.Equal("small", msgs[2].body)
+
+	require.NoError(hook.(*Hook).Close())
+}
+
+func TestAMQPWriterChannelRecovery(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	a := newFakeAMQP(t)
+
+	w, err := NewAMQPWriter(AMQPOptions{URL: "amqp://" + a.l.Addr().String(), Exchange: "missing", Confirms: true})
+	require.NoError(err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("lost\n"))
+	assert.Equal(&AMQPError{Code: 404, Text: "NOT_FOUND - no exchange 'missing' in vhost '/'"}, err)
+
+	// the channel is re-opened on the same connection
+	w.opts.Exchange = "logstash"
+	_, err = w.Write([]byte("recovered\n"))
+	require.NoError(err)
+
+	a.mu.Lock()
+	assert.Equal(2, a.channels)
+	assert.Equal("/", a.vhost)
+	a.mu.Unlock()
+}
+
+func TestAMQPWriterMandatory(t *testing.T) {
+	require := require.New(t)
+
+	a := newFakeAMQP(t)
+
+	w, err := NewAMQPWriter(AMQPOptions{URL: "amqp://" + a.l.Addr().String(), RoutingKey: "unroutable", Confirms: true, Mandatory: true})
+	require.NoError(err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("returned\n"))
+	require.ErrorIs(err, ErrAMQPUnroutable)
+
+	w.opts.RoutingKey = "logs"
+	_, err = w.Write([]byte("routed\n"))
+	require.NoError(err)
+
+	_, err = NewAMQPWriter(AMQPOptions{URL: "amqp://rabbitmq", Mandatory: true})
+	require.Error(err)
+
+	_, err = NewAMQPWriter(AMQPOptions{URL: "http://rabbitmq"})
+	require.Error(err)
+}
@@ -0,0 +1,57 @@
+package logrustash
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff returns the time to wait for after `attempt` failed reconnection attempts
+// before the next one, `attempt` starts at 1. The first attempt is made right away.
+type Backoff func(attempt int) time.Duration
+
+// DefaultBackoff is the Backoff used unless HookOptions.Backoff is set: the delay starts at
+// one second and doubles up to thirty seconds, randomized by 20% so that many instances
+// losing their connection at once do not reconnect in lock-step.
+var DefaultBackoff = ExponentialBackoff(time.Second, 2, 30*time.Second, 0.2)
+
+// ConstantBackoff returns a Backoff waiting for `delay` between all the attempts.
+func ConstantBackoff(delay time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		return delay
+	}
+}
+
+// ExponentialBackoff returns a Backoff waiting for `initial` before the first retry,
+// the delay being multiplied by `multiplier` for every further attempt up to `max`
+// (unbounded when zero). The delays are randomized by +/- `jitter` (between 0 and 1)
+// of their value. The delays are capped at the longest time.Duration.
+func ExponentialBackoff(initial time.Duration, multiplier float64, max time.Duration, jitter float64) Backoff {
+	return func(attempt int) time.Duration {
+		if initial <= 0 {
+			return 0
+		}
+
+		// the delay is capped before the jitter, it would be infinite after enough attempts otherwise
+		limit := float64(math.MaxInt64)
+		if max > 0 {
+			limit = float64(max)
+		}
+
+		delay := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+		if delay > limit {
+			delay = limit
+		}
+
+		if jitter > 0 {
+			delay += delay * jitter * (2*rand.Float64() - 1)
+		}
+
+		// float64(math.MaxInt64) rounds up to 2^63 which would overflow the conversion
+		if delay >= float64(math.MaxInt64) {
+			return time.Duration(math.MaxInt64)
+		}
+
+		return time.Duration(delay)
+	}
+}
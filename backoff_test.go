@@ -0,0 +1,59 @@
+package logrustash
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstantBackoff(t *testing.T) {
+	backoff := ConstantBackoff(time.Second)
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		assert.Equal(t, time.Second, backoff(attempt))
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	backoff := ExponentialBackoff(100*time.Millisecond, 2, time.Second, 0)
+
+	assert.Equal(100*time.Millisecond, backoff(1))
+	assert.Equal(200*time.Millisecond, backoff(2))
+	assert.Equal(400*time.Millisecond, backoff(3))
+	assert.Equal(800*time.Millisecond, backoff(4))
+	assert.Equal(time.Second, backoff(5))
+	assert.Equal(time.Second, backoff(50))
+}
+
+func TestExponentialBackoffUnbounded(t *testing.T) {
+	assert := assert.New(t)
+
+	backoff := ExponentialBackoff(time.Second, 2, 0, 0)
+	assert.Equal(time.Duration(math.MaxInt64), backoff(100))
+	assert.Equal(time.Duration(math.MaxInt64), backoff(10000))
+
+	jittered := ExponentialBackoff(time.Second, 2, 0, 0.2)
+	for i := 0; i < 100; i++ {
+		assert.GreaterOrEqual(jittered(10000), time.Duration(math.MaxInt64/10*8))
+	}
+
+	assert.Zero(ExponentialBackoff(0, 2, 0, 0)(10000))
+}
+
+func TestExponentialBackoffJitter(t *testing.T) {
+	backoff := ExponentialBackoff(time.Second, 2, 0, 0.5)
+
+	delays := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		delay := backoff(2)
+		assert.GreaterOrEqual(t, delay, time.Second)
+		assert.LessOrEqual(t, delay, 3*time.Second)
+		delays[delay] = true
+	}
+
+	assert.Greater(t, len(delays), 1, "the delays are expected to be randomized")
+}
@@ -0,0 +1,192 @@
+package logrustash
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// BalancePolicy is how a hook created with multiple addresses spreads the entries across them.
+type BalancePolicy int
+
+const (
+	// BalanceFailover sends all the entries to a single address, the hook switches to the next one
+	// whenever the connection breaks, it is the default.
+	BalanceFailover BalancePolicy = iota
+	// BalanceRoundRobin sends the entries to the healthy addresses in turn.
+	BalanceRoundRobin
+	// BalanceLeastPending sends every entry to the healthy address with the fewest entries waiting to be sent.
+	BalanceLeastPending
+)
+
+// balancer spreads the entries across endpoints which have their own connection and queue.
+type balancer struct {
+	policy  BalancePolicy
+	members []*Hook
+	next    atomic.Uint64
+}
+
+// balanceHook returns a new Hook spreading the entries across `addrs` according to HookOptions.LoadBalancing,
+// every address has its own connection and queue, or across HookOptions.Workers connections failing over
+// across `addrs`. It fails if none of the connections can be established, unless HookOptions.LazyConnect is set.
+func balanceHook(protocol string, addrs []string, f logrus.Formatter, opt HookOptions) (*Hook, error) {
+	h := &Hook{
+		protocol:  protocol,
+		addrs:     append([]string(nil), addrs...),
+		formatter: f,
+		opts:      opt,
+		balancer:  &balancer{policy: opt.LoadBalancing},
+	}
+
+	// the addresses of every member
+	var groups [][]string
+	workers := max(opt.Workers, 1)
+	if opt.LoadBalancing != BalanceFailover && len(addrs) > 1 {
+		for _, addr := range h.addrs {
+			for i := 0; i < workers; i++ {
+				groups = append(groups, []string{addr})
+			}
+		}
+	} else {
+		// the workers fail over on their own
+		h.balancer.policy = BalanceLeastPending
+		for i := 0; i < workers; i++ {
+			groups = append(groups, h.addrs)
+		}
+	}
+
+	memberOpt := opt
+	memberOpt.LoadBalancing = BalanceFailover
+	memberOpt.Workers = 0
+	memberOpt.Routes = nil
+	memberOpt.Route = nil
+	// the entries are sampled, rate limited and deduplicated before being balanced
+	memberOpt.MaxEntriesPerSecond = 0
+	memberOpt.SampleRate = 0
+	memberOpt.DedupWindow = 0
+	memberOpt.SuppressRepeats = false
+	// the members are dialed below, an unreachable one is reconnected in the background
+	memberOpt.LazyConnect = true
+
+	var dialErr error
+	for i, group := range groups {
+		// every member persists its entries in its own directory
+		if opt.QueueDir != "" {
+			memberOpt.QueueDir = filepath.Join(opt.QueueDir, strconv.Itoa(i))
+		}
+
+		m, err := dialHook(protocol, group, f, memberOpt)
+		if err != nil {
+			_ = h.closeRoutes()
+			return nil, err
+		}
+		m.opts.LazyConnect = opt.LazyConnect
+		h.balancer.members = append(h.balancer.members, m)
+
+		if opt.LazyConnect {
+			continue
+		}
+
+		// dial the first reachable address
+		for j, addr := range group {
+			conn, err := m.dial(addr)
+			if err != nil {
+				dialErr = errors.Join(dialErr, err)
+				continue
+			}
+
+			m.swapWriter(conn, j)
+			break
+		}
+	}
+
+	if !opt.LazyConnect && !h.IsConnected() {
+		_ = h.closeRoutes()
+		return nil, dialErr
+	}
+
+	return h, nil
+}
+
+// start starts the members, the unreachable ones are reconnected in the background.
+func (b *balancer) start(ctx context.Context) {
+	for _, m := range b.members {
+		m.start(ctx)
+		if !m.opts.LazyConnect && !m.IsConnected() {
+			m.probe()
+		}
+	}
+}
+
+// pick returns the member the next entry is sent to. The members which lost their connection
+// are skipped and reconnected in the background, if none is connected the next one is returned anyway,
+// the entry waits in its queue until it is reconnected.
+func (b *balancer) pick() *Hook {
+	n := uint64(len(b.members))
+	start := (b.next.Add(1) - 1) % n
+
+	var picked *Hook
+	pickedPending := 0
+	for i := uint64(0); i < n; i++ {
+		m := b.members[(start+i)%n]
+		if !m.IsConnected() {
+			m.probe()
+			continue
+		}
+
+		if b.policy == BalanceRoundRobin {
+			return m
+		}
+		if pending := m.pending(); picked == nil || pending < pickedPending {
+			picked, pickedPending = m, pending
+		}
+	}
+
+	if picked == nil {
+		return b.members[start]
+	}
+
+	return picked
+}
+
+// deliver sends the entry with the member picked for it.
+func (b *balancer) deliver(e *logrus.Entry) error {
+	m := b.pick()
+	if m.logrusEntryFireChannel != nil {
+		return m.enqueue(e)
+	}
+
+	m.inflight.Add(1)
+	defer m.inflight.Add(-1)
+
+	return m.fire(e)
+}
+
+// isConnected reports whether any member is connected.
+func (b *balancer) isConnected() bool {
+	for _, m := range b.members {
+		if m.IsConnected() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pending returns the number of entries waiting to be sent by the hook.
+func (h *Hook) pending() int {
+	return len(h.logrusEntryFireChannel) + int(h.inflight.Load())
+}
+
+// probe reconnects the hook in the background, unless a probe is already reconnecting it.
+func (h *Hook) probe() {
+	h.RLock()
+	gen := h.generation
+	h.RUnlock()
+
+	h.reconnectInBackground(gen)
+}
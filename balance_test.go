@@ -0,0 +1,226 @@
+package logrustash
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadBalancingRoundRobin(t *testing.T) {
+	require := require.New(t)
+
+	l1, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l1.Close()
+
+	l2, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l2.Close()
+
+	lines1, _ := acceptLines(t, l1)
+	lines2, _ := acceptLines(t, l2)
+
+	log := logrus.New()
+	log.Out = io.Discard
+
+	hook, err := NewWithOptions("tcp", l1.Addr().String(),
+		WithFailover(l2.Addr().String()),
+		WithLoadBalancing(BalanceRoundRobin),
+		WithFormatter(&logrus.JSONFormatter{}),
+	)
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+	log.Hooks.Add(hook)
+
+	for i := 0; i < 4; i++ {
+		log.Info("balanced")
+	}
+
+	for _, lines := range []<-chan string{lines1, lines1, lines2, lines2} {
+		select {
+		case line := <-lines:
+			assert.Contains(t, line, "balanced")
+		case <-time.After(time.Second):
+			require.FailNow("expected the entries to be spread across both listeners")
+		}
+	}
+
+	assert.True(t, hook.(*Hook).IsConnected())
+	assert.Eventually(t, func() bool {
+		return hook.(*Hook).Stats().Sent == 4
+	}, time.Second, time.Millisecond)
+}
+
+func TestLoadBalancingSkipsUnhealthy(t *testing.T) {
+	require := require.New(t)
+
+	// the second address is down at first
+	l2, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	addr2 := l2.Addr().String()
+	require.NoError(l2.Close())
+
+	l1, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l1.Close()
+
+	lines1, _ := acceptLines(t, l1)
+
+	log := logrus.New()
+	log.Out = io.Discard
+
+	hook, err := NewMulti("tcp", []string{l1.Addr().String(), addr2}, &logrus.JSONFormatter{}, HookOptions{
+		LoadBalancing: BalanceRoundRobin,
+		Synchronous:   true,
+		Backoff:       ConstantBackoff(5 * time.Millisecond),
+	})
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+	log.Hooks.Add(hook)
+
+	for i := 0; i < 3; i++ {
+		log.Info("healthy")
+		select {
+		case line := <-lines1:
+			assert.Contains(t, line, "healthy")
+		case <-time.After(time.Second):
+			require.FailNow("expected the entries on the healthy listener")
+		}
+	}
+
+	// the second address is back and reconnected in the background
+	l2, err = net.Listen("tcp", addr2)
+	require.NoError(err)
+	defer l2.Close()
+
+	lines2, _ := acceptLines(t, l2)
+
+	require.Eventually(func() bool {
+		return hook.(*Hook).balancer.members[1].IsConnected()
+	}, 5*time.Second, time.Millisecond)
+
+	log.Info("first")
+	log.Info("second")
+
+	got := map[string]bool{}
+	for _, lines := range []<-chan string{lines1, lines2} {
+		select {
+		case line := <-lines:
+			got[line] = true
+		case <-time.After(time.Second):
+			require.FailNow("expected an entry on each listener")
+		}
+	}
+	assert.Len(t, got, 2)
+}
+
+func TestLoadBalancingLeastPending(t *testing.T) {
+	busy := &Hook{connected: true, logrusEntryFireChannel: make(chan *logrus.Entry, 4)}
+	idle := &Hook{connected: true, logrusEntryFireChannel: make(chan *logrus.Entry, 4)}
+	busy.logrusEntryFireChannel <- &logrus.Entry{}
+	busy.logrusEntryFireChannel <- &logrus.Entry{}
+
+	b := &balancer{policy: BalanceLeastPending, members: []*Hook{busy, idle}}
+	for i := 0; i < 3; i++ {
+		assert.Same(t, idle, b.pick())
+	}
+
+	idle.inflight.Add(3)
+	assert.Same(t, busy, b.pick())
+}
+
+func TestLoadBalancingUnreachable(t *testing.T) {
+	l1, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr1 := l1.Addr().String()
+	require.NoError(t, l1.Close())
+
+	l2, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr2 := l2.Addr().String()
+	require.NoError(t, l2.Close())
+
+	_, err = NewMulti("tcp", []string{addr1, addr2}, &logrus.JSONFormatter{}, HookOptions{LoadBalancing: BalanceLeastPending})
+	assert.Error(t, err)
+}
+
+func TestWorkers(t *testing.T) {
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	lines1, _ := acceptLines(t, l)
+	lines2, _ := acceptLines(t, l)
+
+	log := logrus.New()
+	log.Out = io.Discard
+
+	hook, err := NewWithOptions("tcp", l.Addr().String(),
+		WithWorkers(2),
+		WithFormatter(&logrus.JSONFormatter{}),
+	)
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+	log.Hooks.Add(hook)
+
+	require.Len(hook.(*Hook).balancer.members, 2)
+	for _, m := range hook.(*Hook).balancer.members {
+		require.True(m.IsConnected())
+	}
+
+	const n = 100
+	for i := 0; i < n; i++ {
+		log.Info("worker")
+	}
+
+	received := 0
+	for received < n {
+		select {
+		case line := <-lines1:
+			assert.Contains(t, line, "worker")
+		case line := <-lines2:
+			assert.Contains(t, line, "worker")
+		case <-time.After(time.Second):
+			require.FailNow("expected all the entries to be sent", "received %d", received)
+		}
+		received++
+	}
+
+	assert.Eventually(t, func() bool {
+		return hook.(*Hook).Stats().Sent == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestWorkersFailover(t *testing.T) {
+	require := require.New(t)
+
+	// the first address is down
+	l1, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	addr1 := l1.Addr().String()
+	require.NoError(l1.Close())
+
+	l2, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l2.Close()
+
+	acceptLines(t, l2)
+	acceptLines(t, l2)
+	acceptLines(t, l2)
+
+	hook, err := NewMulti("tcp", []string{addr1, l2.Addr().String()}, &logrus.JSONFormatter{}, HookOptions{Workers: 3})
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	require.Len(hook.(*Hook).balancer.members, 3)
+	for _, m := range hook.(*Hook).balancer.members {
+		assert.Equal(t, l2.Addr().String(), m.Addr())
+	}
+}
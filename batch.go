@@ -0,0 +1,76 @@
+package logrustash
+
+import (
+	"fmt"
+	"sync"
+)
+
+// batch accumulates the formatted entries written at once, see HookOptions.MaxBatchSize.
+type batch struct {
+	mu      sync.Mutex
+	data    []byte
+	entries int
+}
+
+// batching reports whether the formatted entries are batched.
+func (h *Hook) batching() bool {
+	return h.opts.MaxBatchSize > 1
+}
+
+// sendOrBatch sends the formatted entry right away, or adds it to the batch when batching,
+// sending the batch once it holds HookOptions.MaxBatchSize entries.
+// When batching, the failures to send the batch are handled by flushBatch and nil is returned.
+func (h *Hook) sendOrBatch(data []byte) error {
+	if !h.batching() {
+		return h.sendGuarded(data)
+	}
+
+	h.batch.mu.Lock()
+	// the formatted data may be backed by a buffer re-used by the formatter, it is copied
+	h.batch.data = append(h.batch.data, data...)
+	h.batch.entries++
+	full := h.batch.entries >= h.opts.MaxBatchSize
+	h.batch.mu.Unlock()
+
+	if full {
+		h.flushBatch()
+	}
+
+	return nil
+}
+
+// flushBatch sends the entries batched so far, if any, in a single write.
+// A batch which fails to be sent is kept for retry as a whole if the retry buffer is enabled,
+// unless it was partially sent, see BulkError.
+func (h *Hook) flushBatch() {
+	h.batch.mu.Lock()
+	data, entries := h.batch.data, h.batch.entries
+	h.batch.data, h.batch.entries = nil, 0
+	h.batch.mu.Unlock()
+
+	if entries == 0 {
+		return
+	}
+
+	if err := h.sendGuarded(data); err != nil {
+		// the other entries of the batch were sent
+		if failed := h.bulkFailures(err); failed > 0 {
+			h.stats.sent.Add(uint64(max(entries-failed, 0)))
+			h.stats.dropped.Add(uint64(failed))
+			h.reportError(fmt.Errorf("failed to send %d entries of a batch of %d: %w", failed, entries, err), nil)
+			return
+		}
+		if h.keepForRetry(data) {
+			h.reportError(fmt.Errorf("%w, the batch of %d entries is kept for retry", err, entries), nil)
+			return
+		}
+
+		h.stats.dropped.Add(uint64(entries))
+		h.deadLetter(nil, data, err)
+		h.reportError(fmt.Errorf("failed to send a batch of %d entries: %w", entries, err), nil)
+		return
+	}
+
+	// send counts the batch as a single entry
+	h.stats.sent.Add(uint64(entries - 1))
+}
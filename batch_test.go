@@ -0,0 +1,93 @@
+package logrustash
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingWriter records every write separately.
+type recordingWriter struct {
+	mu     sync.Mutex
+	writes []string
+}
+
+func (w *recordingWriter) Write(d []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.writes = append(w.writes, string(d))
+	return len(d), nil
+}
+
+func (w *recordingWriter) Writes() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]string(nil), w.writes...)
+}
+
+func TestBatching(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	w := &recordingWriter{}
+	h := &Hook{
+		writer:    w,
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:      HookOptions{MaxBatchSize: 3, Framer: DelimiterFramer([]byte{0})},
+	}
+
+	for i := 1; i <= 7; i++ {
+		require.NoError(h.Fire(&logrus.Entry{Message: fmt.Sprintf("m%d", i), Data: logrus.Fields{}}))
+	}
+
+	assert.Equal([]string{
+		`{"level":"panic","msg":"m1"}` + "\x00" + `{"level":"panic","msg":"m2"}` + "\x00" + `{"level":"panic","msg":"m3"}` + "\x00",
+		`{"level":"panic","msg":"m4"}` + "\x00" + `{"level":"panic","msg":"m5"}` + "\x00" + `{"level":"panic","msg":"m6"}` + "\x00",
+	}, w.Writes())
+	assert.Equal(uint64(6), h.Stats().Sent)
+
+	h.flushBatch()
+	assert.Len(w.Writes(), 3)
+	assert.Equal(`{"level":"panic","msg":"m7"}`+"\x00", w.Writes()[2])
+	assert.Equal(uint64(7), h.Stats().Sent)
+}
+
+func TestBatchingFlushInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	w := &recordingWriter{}
+	hook, err := NewWithWriter(w,
+		WithFormatter(&logrus.JSONFormatter{DisableTimestamp: true}),
+		WithBatching(100, 20*time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer hook.(*Hook).Close()
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, hook.Fire(&logrus.Entry{Message: fmt.Sprintf("m%d", i), Data: logrus.Fields{}}))
+	}
+
+	require.Eventually(t, func() bool { return len(w.Writes()) > 0 }, time.Second, time.Millisecond)
+	assert.Equal(3, strings.Count(strings.Join(w.Writes(), ""), "\n"))
+	assert.Less(len(w.Writes()), 3, "the entries are expected to be written in batches")
+}
+
+func TestBatchingClose(t *testing.T) {
+	w := &recordingWriter{}
+	hook, err := NewWithWriter(w, WithBatching(100, time.Hour))
+	require.NoError(t, err)
+
+	require.NoError(t, hook.Fire(&logrus.Entry{Message: "batched", Data: logrus.Fields{}}))
+	require.NoError(t, hook.(*Hook).Close())
+
+	require.Len(t, w.Writes(), 1)
+	assert.Contains(t, w.Writes()[0], "batched")
+}
@@ -0,0 +1,122 @@
+package logrustash
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// settingsFromMap reads the settings from the key/value configuration `m`, see NewFromMap,
+// the unknown keys and the errors of all the invalid values are reported at once.
+func settingsFromMap(m map[string]interface{}) (*settings, error) {
+	flat := map[string]interface{}{}
+	flattenSettings(flat, "", m)
+
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	s := &settings{protocol: "tcp"}
+
+	var errs []error
+	var unknown []string
+	for _, key := range keys {
+		parse, ok := settingParsers[key]
+		if !ok {
+			unknown = append(unknown, key)
+			continue
+		}
+
+		value := settingString(flat[key])
+		if value == "" {
+			continue
+		}
+
+		if err := parse(s, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	if len(unknown) > 0 {
+		errs = append([]error{fmt.Errorf("unknown keys %s", strings.Join(unknown, ", "))}, errs...)
+	}
+
+	return s, errors.Join(errs...)
+}
+
+// flattenSettings adds the values of `m` to `flat` under their normalized keys prefixed by `prefix`,
+// the values of the nested maps being under the keys joined with an underscore.
+func flattenSettings(flat map[string]interface{}, prefix string, m map[string]interface{}) {
+	for key, value := range m {
+		key = prefix + strings.NewReplacer(".", "_", "-", "_").Replace(strings.ToLower(key))
+
+		switch value := value.(type) {
+		case map[string]interface{}:
+			flattenSettings(flat, key+"_", value)
+		case map[interface{}]interface{}:
+			nested := make(map[string]interface{}, len(value))
+			for k, v := range value {
+				nested[fmt.Sprint(k)] = v
+			}
+			flattenSettings(flat, key+"_", nested)
+		default:
+			flat[key] = value
+		}
+	}
+}
+
+// settingString returns the string the value `value` of a setting is parsed from,
+// the values of the lists being separated by commas, e.g. the addresses.
+func settingString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []string:
+		return strings.Join(value, ",")
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			values = append(values, fmt.Sprint(v))
+		}
+		return strings.Join(values, ",")
+	}
+
+	return fmt.Sprint(value)
+}
+
+// NewFromMap returns a new logrus.Hook for Logstash configured by the key/value configuration `m`,
+// e.g. the one of viper.AllSettings or koanf.All, so that the settings of the hook can be managed with
+// the other settings of the service.
+//
+// The keys are the ones of the environment variables of NewFromEnv without the EnvPrefix,
+// e.g. "addr", "level" or "buffer_size". They are case insensitive and dots and dashes stand
+// for underscores, so that {"tls": {"ca_file": ...}} and "tls.ca_file" set "tls_ca_file".
+// The values are given as strings, e.g. "5s" for the durations, or as Go values, and "addr"
+// may be a list of addresses. A configuration holding unknown keys is refused, so that a typo
+// does not go unnoticed.
+//
+// The settings which can not be given as values, e.g. the formatter, are given by `opts`,
+// which are applied after the ones of the configuration.
+func NewFromMap(m map[string]interface{}, opts ...Option) (logrus.Hook, error) {
+	s, err := settingsFromMap(m)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.addrs) == 0 {
+		return nil, fmt.Errorf("addr must be set")
+	}
+
+	all, err := s.options(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithOptions(s.protocol, s.addrs[0], all...)
+}
@@ -0,0 +1,69 @@
+package logrustash
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFromMap(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	lines, _ := acceptLines(t, l)
+
+	// the keys as written by the various configuration sources, e.g. viper or koanf
+	hook, err := NewFromMap(map[string]interface{}{
+		"addr":          []interface{}{l.Addr().String(), "127.0.0.1:1"},
+		"Level":         "warning",
+		"buffer-size":   42,
+		"write.timeout": 3 * time.Second,
+		"sample_rate":   nil,
+		"tls": map[string]interface{}{
+			"server_name": "",
+		},
+	}, WithFormatter(&logrus.JSONFormatter{}))
+	require.NoError(err)
+	h := hook.(*Hook)
+	defer h.Close()
+
+	assert.Equal([]string{l.Addr().String(), "127.0.0.1:1"}, h.addrs)
+	assert.NotContains(h.Levels(), logrus.InfoLevel)
+	assert.Equal(42, h.opts.FireChannelBufferSize)
+	assert.Equal(3*time.Second, h.opts.WriteTimeout)
+	assert.Nil(h.opts.TLSConfig)
+
+	require.NoError(h.Fire(&logrus.Entry{Message: "from map", Level: logrus.WarnLevel, Data: logrus.Fields{}}))
+
+	select {
+	case line := <-lines:
+		assert.Contains(line, `"msg":"from map"`)
+	case <-time.After(time.Second):
+		t.Fatal("entry not received")
+	}
+}
+
+func TestNewFromMapErrors(t *testing.T) {
+	_, err := NewFromMap(map[string]interface{}{"level": "info"})
+	assert.EqualError(t, err, "addr must be set")
+
+	_, err = NewFromMap(map[string]interface{}{
+		"addr":        "127.0.0.1:1",
+		"bufer_size":  10,
+		"tls":         map[interface{}]interface{}{"ca": "ca.pem"},
+		"workers":     -1,
+		"synchronous": "maybe",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown keys bufer_size, tls_ca")
+	assert.Contains(t, err.Error(), "synchronous:")
+	assert.Contains(t, err.Error(), "workers:")
+}
@@ -0,0 +1,48 @@
+package logrustash
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// breadcrumbs keeps the last formatted entries of low levels, oldest first.
+type breadcrumbs struct {
+	mu      sync.Mutex
+	entries [][]byte
+}
+
+// isBreadcrumb reports whether the entry is to be kept as a breadcrumb instead of being sent,
+// the warning and more severe entries never are since they flush the breadcrumbs.
+func (h *Hook) isBreadcrumb(e *logrus.Entry) bool {
+	return h.opts.BreadcrumbSize > 0 && e.Level > logrus.WarnLevel && e.Level >= h.opts.GetBreadcrumbLevel()
+}
+
+// keepBreadcrumb keeps the formatted entry, discarding the oldest one when there are
+// already HookOptions.BreadcrumbSize breadcrumbs.
+func (h *Hook) keepBreadcrumb(data []byte) {
+	h.breadcrumbs.mu.Lock()
+	defer h.breadcrumbs.mu.Unlock()
+
+	if len(h.breadcrumbs.entries) >= h.opts.BreadcrumbSize {
+		h.breadcrumbs.entries = h.breadcrumbs.entries[1:]
+	}
+
+	// the formatted data may be backed by a buffer re-used by the formatter
+	h.breadcrumbs.entries = append(h.breadcrumbs.entries, append([]byte(nil), data...))
+}
+
+// flushBreadcrumbs sends the kept breadcrumbs, oldest first.
+func (h *Hook) flushBreadcrumbs() {
+	h.breadcrumbs.mu.Lock()
+	entries := h.breadcrumbs.entries
+	h.breadcrumbs.entries = nil
+	h.breadcrumbs.mu.Unlock()
+
+	for _, data := range entries {
+		if err := h.sendOrBatch(data); err != nil && !h.keepForRetry(data) {
+			h.stats.dropped.Add(1)
+			h.reportError(err, nil)
+		}
+	}
+}
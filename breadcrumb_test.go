@@ -0,0 +1,98 @@
+package logrustash
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFireBreadcrumbs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := bytes.NewBuffer(nil)
+	h := &Hook{
+		writer:    buffer,
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:      HookOptions{BreadcrumbSize: 2, BreadcrumbLevel: logrus.DebugLevel},
+	}
+
+	fire := func(level logrus.Level, msg string) {
+		require.NoError(h.Fire(&logrus.Entry{Message: msg, Level: level, Data: logrus.Fields{}}))
+	}
+
+	fire(logrus.DebugLevel, "d1")
+	fire(logrus.TraceLevel, "t1")
+	fire(logrus.DebugLevel, "d2")
+	assert.Zero(buffer.Len(), "breadcrumbs must not be sent on their own")
+
+	fire(logrus.InfoLevel, "i1")
+	assert.Equal(`{"level":"info","msg":"i1"}`+"\n", buffer.String())
+
+	buffer.Reset()
+	fire(logrus.ErrorLevel, "e1")
+	expected := `{"level":"trace","msg":"t1"}
+{"level":"debug","msg":"d2"}
+{"level":"error","msg":"e1"}
+`
+	assert.Equal(expected, buffer.String())
+
+	buffer.Reset()
+	fire(logrus.WarnLevel, "w1")
+	assert.Equal(`{"level":"warning","msg":"w1"}`+"\n", buffer.String(), "breadcrumbs are sent only once")
+}
+
+func TestFireBreadcrumbsDefaultLevel(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := bytes.NewBuffer(nil)
+	h := &Hook{
+		writer:    buffer,
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:      HookOptions{BreadcrumbSize: 5},
+	}
+
+	fire := func(level logrus.Level, msg string) {
+		require.NoError(h.Fire(&logrus.Entry{Message: msg, Level: level, Data: logrus.Fields{}}))
+	}
+
+	// the breadcrumbs are the debug and trace entries by default
+	fire(logrus.DebugLevel, "d1")
+	fire(logrus.InfoLevel, "i1")
+	assert.Equal(`{"level":"info","msg":"i1"}`+"\n", buffer.String())
+
+	buffer.Reset()
+	fire(logrus.ErrorLevel, "e1")
+	assert.Equal(`{"level":"debug","msg":"d1"}`+"\n"+`{"level":"error","msg":"e1"}`+"\n", buffer.String())
+}
+
+func TestFireBreadcrumbsSevereLevel(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := bytes.NewBuffer(nil)
+	h := &Hook{
+		writer:    buffer,
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:      HookOptions{BreadcrumbSize: 5, BreadcrumbLevel: logrus.ErrorLevel},
+	}
+
+	fire := func(level logrus.Level, msg string) {
+		require.NoError(h.Fire(&logrus.Entry{Message: msg, Level: level, Data: logrus.Fields{}}))
+	}
+
+	// the warnings and the errors are never kept as breadcrumbs
+	fire(logrus.InfoLevel, "i1")
+	assert.Zero(buffer.Len())
+
+	fire(logrus.WarnLevel, "w1")
+	assert.Equal(`{"level":"info","msg":"i1"}`+"\n"+`{"level":"warning","msg":"w1"}`+"\n", buffer.String())
+
+	buffer.Reset()
+	fire(logrus.ErrorLevel, "e1")
+	assert.Equal(`{"level":"error","msg":"e1"}`+"\n", buffer.String())
+}
@@ -0,0 +1,100 @@
+package logrustash
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is reported when an entry is not sent since the circuit breaker is open,
+// see HookOptions.CircuitBreakerThreshold.
+var ErrCircuitOpen = errors.New("logstash circuit breaker is open")
+
+// breaker stops the sends after consecutive failures for a cool-down period,
+// then lets a single send through to probe whether Logstash recovered.
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+	now       func() time.Time
+}
+
+// allow reports whether a send may be attempted, when the cool-down period is over
+// a single send is allowed until its outcome is recorded.
+func (b *breaker) allow(threshold int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < threshold {
+		return true
+	}
+	if b.probing || b.clock().Before(b.openUntil) {
+		return false
+	}
+
+	b.probing = true
+	return true
+}
+
+// record records the outcome of a send, opening the breaker for `cooldown` when
+// the send fails for the `threshold`th consecutive time or while probing.
+func (b *breaker) record(err error, threshold int, cooldown time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= threshold {
+		b.openUntil = b.clock().Add(cooldown)
+	}
+}
+
+func (b *breaker) clock() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+
+	return time.Now()
+}
+
+// open reports whether the breaker is open, i.e. the cool-down period is not over.
+func (b *breaker) open(threshold int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.failures >= threshold && b.clock().Before(b.openUntil)
+}
+
+// tripped records the outcome `err` of a reconnection attempt in the circuit breaker, if enabled,
+// and reports whether it is open, in which case reconnecting is given up on.
+func (h *Hook) tripped(err error) bool {
+	threshold := h.opts.CircuitBreakerThreshold
+	if threshold <= 0 {
+		return false
+	}
+
+	h.breaker.record(err, threshold, h.opts.GetCircuitBreakerCooldown())
+	return h.breaker.open(threshold)
+}
+
+// sendGuarded sends the data unless the circuit breaker, if enabled, is open.
+func (h *Hook) sendGuarded(data []byte) error {
+	threshold := h.opts.CircuitBreakerThreshold
+	if threshold <= 0 {
+		return h.send(data)
+	}
+
+	if !h.breaker.allow(threshold) {
+		return ErrCircuitOpen
+	}
+
+	err := h.send(data)
+	h.breaker.record(err, threshold, h.opts.GetCircuitBreakerCooldown())
+	return err
+}
@@ -0,0 +1,98 @@
+package logrustash
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	w := &toggleWriter{down: true}
+	h := &Hook{
+		writer:    w,
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:      HookOptions{CircuitBreakerThreshold: 2, CircuitBreakerCooldown: time.Minute},
+		breaker:   breaker{now: func() time.Time { return now }},
+	}
+
+	fire := func(msg string) error {
+		return h.Fire(&logrus.Entry{Message: msg, Data: logrus.Fields{}})
+	}
+
+	assert.Error(fire("m1"))
+	assert.Error(fire("m2"))
+
+	// the breaker is open, nothing is sent
+	assert.ErrorIs(fire("m3"), ErrCircuitOpen)
+	assert.Equal(uint64(2), h.Stats().Failed)
+
+	// a failed probe opens the breaker again
+	now = now.Add(time.Minute)
+	assert.Error(fire("m4"))
+	assert.Equal(uint64(3), h.Stats().Failed)
+	assert.ErrorIs(fire("m5"), ErrCircuitOpen)
+
+	// a successful probe closes the breaker
+	now = now.Add(time.Minute)
+	w.down = false
+	assert.NoError(fire("m6"))
+	assert.NoError(fire("m7"))
+	assert.Equal(`{"level":"panic","msg":"m6"}`+"\n"+`{"level":"panic","msg":"m7"}`+"\n", w.String())
+}
+
+func TestCircuitBreakerReconnect(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// an address nothing listens on anymore
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	addr := l.Addr().String()
+	require.NoError(l.Close())
+
+	// the hook would try to reconnect until it succeeds without the breaker
+	hook, err := New("tcp", addr, &logrus.JSONFormatter{}, HookOptions{
+		LazyConnect:             true,
+		Synchronous:             true,
+		CircuitBreakerThreshold: 3,
+		Backoff:                 ConstantBackoff(time.Millisecond),
+	})
+	require.NoError(err)
+	h := hook.(*Hook)
+	defer h.Close()
+
+	fired := make(chan error, 1)
+	go func() {
+		fired <- h.Fire(&logrus.Entry{Message: "m1", Data: logrus.Fields{}})
+	}()
+
+	select {
+	case err := <-fired:
+		assert.Error(err)
+	case <-time.After(5 * time.Second):
+		require.FailNow("expected the breaker to stop reconnecting")
+	}
+	assert.Equal(uint64(3), h.Stats().Reconnects)
+
+	// the breaker is open, the hook does not try to reconnect
+	assert.ErrorIs(h.Fire(&logrus.Entry{Message: "m2", Data: logrus.Fields{}}), ErrCircuitOpen)
+	assert.Equal(uint64(3), h.Stats().Reconnects)
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	b := &breaker{}
+
+	b.record(assert.AnError, 1, 0)
+	assert.True(t, b.allow(1), "the cool-down is over, a probe is expected to be allowed")
+	assert.False(t, b.allow(1), "a single probe is expected to be allowed at once")
+
+	b.record(nil, 1, 0)
+	assert.True(t, b.allow(1))
+}
@@ -0,0 +1,76 @@
+package logrustash
+
+import (
+	"runtime/debug"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The fields BuildInfo is added under, next to MetadataKeyServiceVersion.
+const (
+	BuildInfoKeyVCSRevision = "vcs.revision"
+	BuildInfoKeyVCSModified = "vcs.modified"
+	BuildInfoKeyGoVersion   = "go.version"
+)
+
+// BuildInfo identifies the binary sending the entries, it is added to every entry
+// with WithBuildInfo or as one of HookOptions.Enrichers. The empty values are not added.
+type BuildInfo struct {
+	// ServiceVersion is the version of the main module, if built from a tagged module.
+	ServiceVersion string
+	// VCSRevision is the commit the binary was built from, VCSModified reports
+	// whether the working tree had uncommitted changes.
+	VCSRevision string
+	VCSModified bool
+	GoVersion   string
+}
+
+// DetectBuildInfo returns the build information embedded in the binary by the go command,
+// see debug.ReadBuildInfo. The VCS information is embedded by `go build` when building
+// from a repository, unless -buildvcs=false is given.
+func DetectBuildInfo() BuildInfo {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return BuildInfo{}
+	}
+
+	return newBuildInfo(info)
+}
+
+// newBuildInfo returns the BuildInfo of `info`.
+func newBuildInfo(info *debug.BuildInfo) BuildInfo {
+	b := BuildInfo{GoVersion: info.GoVersion}
+
+	if info.Main.Version != "(devel)" {
+		b.ServiceVersion = info.Main.Version
+	}
+
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			b.VCSRevision = setting.Value
+		case "vcs.modified":
+			b.VCSModified, _ = strconv.ParseBool(setting.Value)
+		}
+	}
+
+	return b
+}
+
+// Fields returns the build information as fields, without the empty values.
+func (b BuildInfo) Fields() logrus.Fields {
+	fields := logrus.Fields{}
+	if b.ServiceVersion != "" {
+		fields[MetadataKeyServiceVersion] = b.ServiceVersion
+	}
+	if b.VCSRevision != "" {
+		fields[BuildInfoKeyVCSRevision] = b.VCSRevision
+		fields[BuildInfoKeyVCSModified] = b.VCSModified
+	}
+	if b.GoVersion != "" {
+		fields[BuildInfoKeyGoVersion] = b.GoVersion
+	}
+
+	return fields
+}
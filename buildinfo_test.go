@@ -0,0 +1,54 @@
+package logrustash
+
+import (
+	"encoding/json"
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBuildInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	b := newBuildInfo(&debug.BuildInfo{
+		GoVersion: "go1.21.5",
+		Main:      debug.Module{Path: "example.com/checkout", Version: "v1.2.3"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs", Value: "git"},
+			{Key: "vcs.revision", Value: "4f2b1c9"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	})
+	assert.Equal(BuildInfo{ServiceVersion: "v1.2.3", VCSRevision: "4f2b1c9", VCSModified: true, GoVersion: "go1.21.5"}, b)
+	assert.Equal(logrus.Fields{
+		"service.version": "v1.2.3",
+		"vcs.revision":    "4f2b1c9",
+		"vcs.modified":    true,
+		"go.version":      "go1.21.5",
+	}, b.Fields())
+
+	// a binary built from a working tree has no version nor, with -buildvcs=false, revision
+	b = newBuildInfo(&debug.BuildInfo{GoVersion: "go1.21.5", Main: debug.Module{Version: "(devel)"}})
+	assert.Equal(logrus.Fields{"go.version": "go1.21.5"}, b.Fields())
+}
+
+func TestWithBuildInfo(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := &safeBuffer{}
+	hook, err := NewWithWriter(buffer, WithBuildInfo())
+	require.NoError(err)
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "msg1", Data: logrus.Fields{}}))
+	require.NoError(hook.(*Hook).Close())
+
+	var doc map[string]interface{}
+	require.NoError(json.Unmarshal([]byte(buffer.String()), &doc))
+
+	assert.Equal(runtime.Version(), doc["go.version"])
+}
@@ -0,0 +1,247 @@
+package logrustash
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The fields CloudMetadata is added under, following the Elastic Common Schema.
+const (
+	CloudKeyProvider         = "cloud.provider"
+	CloudKeyRegion           = "cloud.region"
+	CloudKeyAvailabilityZone = "cloud.availability_zone"
+	CloudKeyInstanceID       = "cloud.instance.id"
+	CloudKeyMachineType      = "cloud.machine.type"
+	CloudKeyAccountID        = "cloud.account.id"
+)
+
+// defaultCloudMetadataTimeout is the time the metadata services are queried for by WithCloudMetadata.
+const defaultCloudMetadataTimeout = time.Second
+
+// maxCloudMetadataBytes is the maximum size of the responses of the metadata services.
+const maxCloudMetadataBytes = 64 << 10
+
+// The base URLs of the metadata services.
+var (
+	ec2MetadataURL   = "http://169.254.169.254"
+	gceMetadataURL   = "http://metadata.google.internal"
+	azureMetadataURL = "http://169.254.169.254"
+)
+
+// cloudMetadataClient queries the metadata services, which are reached directly rather than
+// through the proxy of the environment.
+var cloudMetadataClient = &http.Client{Transport: &http.Transport{}}
+
+// CloudMetadata describes the cloud instance the process is running on, it is added to every entry
+// with WithCloudMetadata or as one of HookOptions.Enrichers. The empty values are not added.
+type CloudMetadata struct {
+	// Provider is "aws", "gcp" or "azure".
+	Provider         string
+	Region           string
+	AvailabilityZone string
+	InstanceID       string
+	MachineType      string
+	// AccountID is the AWS account, the GCP project or the Azure subscription of the instance.
+	AccountID string
+}
+
+// DetectCloudMetadata returns the metadata of the cloud instance the process is running on,
+// queried from the metadata services of EC2, Google Compute Engine and Azure concurrently until `ctx`
+// is done. The metadata is empty when the process is not running on any of them, it should be detected
+// once at startup with a timeout, e.g. a second, since the services are unreachable elsewhere.
+func DetectCloudMetadata(ctx context.Context) CloudMetadata {
+	// the other queries are cancelled and waited for once one of them succeeded
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	detectors := []func(ctx context.Context) (CloudMetadata, error){detectEC2, detectGCE, detectAzure}
+	results := make(chan CloudMetadata, len(detectors))
+	for _, detect := range detectors {
+		wg.Add(1)
+		go func(detect func(ctx context.Context) (CloudMetadata, error)) {
+			defer wg.Done()
+
+			m, err := detect(ctx)
+			if err != nil {
+				m = CloudMetadata{}
+			}
+			results <- m
+		}(detect)
+	}
+
+	for range detectors {
+		if m := <-results; m.Provider != "" {
+			return m
+		}
+	}
+
+	return CloudMetadata{}
+}
+
+// detectEC2 queries the instance identity document of EC2, with an IMDSv2 token if it can get one.
+func detectEC2(ctx context.Context) (CloudMetadata, error) {
+	header := http.Header{}
+
+	var token string
+	if err := queryCloudMetadata(ctx, http.MethodPut, ec2MetadataURL+"/latest/api/token",
+		http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"60"}}, &token); err == nil {
+		header.Set("X-Aws-Ec2-Metadata-Token", token)
+	}
+
+	var doc struct {
+		Region           string `json:"region"`
+		AvailabilityZone string `json:"availabilityZone"`
+		InstanceID       string `json:"instanceId"`
+		InstanceType     string `json:"instanceType"`
+		AccountID        string `json:"accountId"`
+	}
+	if err := queryCloudMetadata(ctx, http.MethodGet, ec2MetadataURL+"/latest/dynamic/instance-identity/document", header, &doc); err != nil {
+		return CloudMetadata{}, err
+	}
+	if doc.InstanceID == "" {
+		return CloudMetadata{}, fmt.Errorf("no instance ID in the EC2 instance identity document")
+	}
+
+	return CloudMetadata{
+		Provider:         "aws",
+		Region:           doc.Region,
+		AvailabilityZone: doc.AvailabilityZone,
+		InstanceID:       doc.InstanceID,
+		MachineType:      doc.InstanceType,
+		AccountID:        doc.AccountID,
+	}, nil
+}
+
+// detectGCE queries the instance and the project metadata of Google Compute Engine.
+func detectGCE(ctx context.Context) (CloudMetadata, error) {
+	header := http.Header{"Metadata-Flavor": {"Google"}}
+
+	var instance struct {
+		ID          json.Number `json:"id"`
+		Zone        string      `json:"zone"`
+		MachineType string      `json:"machineType"`
+	}
+	if err := queryCloudMetadata(ctx, http.MethodGet, gceMetadataURL+"/computeMetadata/v1/instance/?recursive=true", header, &instance); err != nil {
+		return CloudMetadata{}, err
+	}
+	if instance.ID == "" {
+		return CloudMetadata{}, fmt.Errorf("no instance ID in the GCE instance metadata")
+	}
+
+	var project string
+	if err := queryCloudMetadata(ctx, http.MethodGet, gceMetadataURL+"/computeMetadata/v1/project/project-id", header, &project); err != nil {
+		return CloudMetadata{}, err
+	}
+
+	// the zone and the machine type are given as "projects/<number>/zones/us-central1-a"
+	zone := instance.Zone[strings.LastIndex(instance.Zone, "/")+1:]
+	region := zone
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		region = zone[:i]
+	}
+
+	return CloudMetadata{
+		Provider:         "gcp",
+		Region:           region,
+		AvailabilityZone: zone,
+		InstanceID:       instance.ID.String(),
+		MachineType:      instance.MachineType[strings.LastIndex(instance.MachineType, "/")+1:],
+		AccountID:        project,
+	}, nil
+}
+
+// detectAzure queries the compute metadata of the Azure Instance Metadata Service.
+func detectAzure(ctx context.Context) (CloudMetadata, error) {
+	var compute struct {
+		VMID           string `json:"vmId"`
+		Location       string `json:"location"`
+		Zone           string `json:"zone"`
+		VMSize         string `json:"vmSize"`
+		SubscriptionID string `json:"subscriptionId"`
+	}
+	if err := queryCloudMetadata(ctx, http.MethodGet, azureMetadataURL+"/metadata/instance/compute?api-version=2021-02-01",
+		http.Header{"Metadata": {"true"}}, &compute); err != nil {
+		return CloudMetadata{}, err
+	}
+	if compute.VMID == "" {
+		return CloudMetadata{}, fmt.Errorf("no VM ID in the Azure compute metadata")
+	}
+
+	return CloudMetadata{
+		Provider:         "azure",
+		Region:           compute.Location,
+		AvailabilityZone: compute.Zone,
+		InstanceID:       compute.VMID,
+		MachineType:      compute.VMSize,
+		AccountID:        compute.SubscriptionID,
+	}, nil
+}
+
+// queryCloudMetadata sends a request to the metadata service at `url` and decodes the response
+// into `v`, as JSON unless `v` is a *string.
+func queryCloudMetadata(ctx context.Context, method, url string, header http.Header, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return err
+	}
+	for k, values := range header {
+		req.Header[k] = values
+	}
+
+	resp, err := cloudMetadataClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCloudMetadataBytes))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &HTTPError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	if s, ok := v.(*string); ok {
+		*s = strings.TrimSpace(string(body))
+		return nil
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// Fields returns the metadata as fields, without the empty values.
+func (m CloudMetadata) Fields() logrus.Fields {
+	fields := logrus.Fields{}
+	if m.Provider != "" {
+		fields[CloudKeyProvider] = m.Provider
+	}
+	if m.Region != "" {
+		fields[CloudKeyRegion] = m.Region
+	}
+	if m.AvailabilityZone != "" {
+		fields[CloudKeyAvailabilityZone] = m.AvailabilityZone
+	}
+	if m.InstanceID != "" {
+		fields[CloudKeyInstanceID] = m.InstanceID
+	}
+	if m.MachineType != "" {
+		fields[CloudKeyMachineType] = m.MachineType
+	}
+	if m.AccountID != "" {
+		fields[CloudKeyAccountID] = m.AccountID
+	}
+
+	return fields
+}
@@ -0,0 +1,142 @@
+package logrustash
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withCloudMetadataServer makes DetectCloudMetadata query `handler` for the three providers
+// for the duration of the test.
+func withCloudMetadataServer(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	prevEC2, prevGCE, prevAzure := ec2MetadataURL, gceMetadataURL, azureMetadataURL
+	ec2MetadataURL, gceMetadataURL, azureMetadataURL = ts.URL, ts.URL, ts.URL
+	t.Cleanup(func() {
+		ec2MetadataURL, gceMetadataURL, azureMetadataURL = prevEC2, prevGCE, prevAzure
+	})
+}
+
+func TestDetectCloudMetadata(t *testing.T) {
+	for provider, test := range map[string]struct {
+		handler  http.HandlerFunc
+		expected CloudMetadata
+	}{
+		"aws": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+					_, _ = w.Write([]byte("token"))
+				case r.URL.Path == "/latest/dynamic/instance-identity/document" && r.Header.Get("X-Aws-Ec2-Metadata-Token") == "token":
+					_, _ = w.Write([]byte(`{"region":"eu-west-1","availabilityZone":"eu-west-1a","instanceId":"i-0abc","instanceType":"t3.small","accountId":"123456789012"}`))
+				default:
+					http.NotFound(w, r)
+				}
+			},
+			expected: CloudMetadata{Provider: "aws", Region: "eu-west-1", AvailabilityZone: "eu-west-1a", InstanceID: "i-0abc", MachineType: "t3.small", AccountID: "123456789012"},
+		},
+		"gcp": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Header.Get("Metadata-Flavor") != "Google":
+					http.NotFound(w, r)
+				case r.URL.Path == "/computeMetadata/v1/instance/":
+					_, _ = w.Write([]byte(`{"id":4520031799277581759,"zone":"projects/123/zones/us-central1-a","machineType":"projects/123/machineTypes/e2-medium"}`))
+				case r.URL.Path == "/computeMetadata/v1/project/project-id":
+					_, _ = w.Write([]byte("shop-prod"))
+				default:
+					http.NotFound(w, r)
+				}
+			},
+			expected: CloudMetadata{Provider: "gcp", Region: "us-central1", AvailabilityZone: "us-central1-a", InstanceID: "4520031799277581759", MachineType: "e2-medium", AccountID: "shop-prod"},
+		},
+		"azure": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/metadata/instance/compute" || r.Header.Get("Metadata") != "true" {
+					http.NotFound(w, r)
+					return
+				}
+				_, _ = w.Write([]byte(`{"vmId":"02aab8a4-74ef-476e-8182-f6d2ba4166a6","location":"westeurope","zone":"1","vmSize":"Standard_B2s","subscriptionId":"8d10da13"}`))
+			},
+			expected: CloudMetadata{Provider: "azure", Region: "westeurope", AvailabilityZone: "1", InstanceID: "02aab8a4-74ef-476e-8182-f6d2ba4166a6", MachineType: "Standard_B2s", AccountID: "8d10da13"},
+		},
+		"none": {
+			handler: http.NotFound,
+		},
+	} {
+		withCloudMetadataServer(t, test.handler)
+		assert.Equal(t, test.expected, DetectCloudMetadata(context.Background()), provider)
+	}
+}
+
+func TestDetectCloudMetadataTimeout(t *testing.T) {
+	release := make(chan struct{})
+	withCloudMetadataServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	// the server is closed once the requests are released
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	assert.Equal(t, CloudMetadata{}, DetectCloudMetadata(ctx))
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestWithCloudMetadata(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var queries atomic.Int32
+	withCloudMetadataServer(t, func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		if r.URL.Path != "/metadata/instance/compute" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"vmId":"02aab8a4","location":"westeurope"}`))
+	})
+
+	// the metadata services are queried when the hook is created
+	opt := WithCloudMetadata(0)
+	assert.Zero(queries.Load())
+
+	buffer := &safeBuffer{}
+	hook, err := NewWithWriter(buffer, opt)
+	require.NoError(err)
+	assert.NotZero(queries.Load())
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "msg1", Data: logrus.Fields{}}))
+	require.NoError(hook.(*Hook).Close())
+
+	var doc map[string]interface{}
+	require.NoError(json.Unmarshal([]byte(buffer.String()), &doc))
+
+	assert.Equal("azure", doc["cloud.provider"])
+	assert.Equal("westeurope", doc["cloud.region"])
+	assert.Equal("02aab8a4", doc["cloud.instance.id"])
+	assert.NotContains(doc, "cloud.account.id")
+
+	// the context of the hook applies whatever the order of the options
+	queries.Store(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	o := newOptions(WithCloudMetadata(time.Minute), WithContext(ctx))
+	assert.Zero(queries.Load())
+	assert.Len(o.Enrichers, 1)
+}
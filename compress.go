@@ -0,0 +1,52 @@
+package logrustash
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// compress gzips the data written at once (a batch or a single entry) if HookOptions.Compress is set,
+// every write being a complete gzip member, the stream written can be read as a single gzip stream.
+// The data is kept uncompressed until it is written, e.g. for retries.
+func (h *Hook) compress(data []byte) ([]byte, error) {
+	if !h.opts.Compress {
+		return data, nil
+	}
+
+	return gzipBytes(data, h.opts.GetCompressionLevel())
+}
+
+// gzipBytes returns `data` compressed as a gzip member with the compression level `level`.
+func gzipBytes(data []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// checkCompress refuses HookOptions.Compress for the writers parsing the entries written,
+// which can not be given compressed data.
+func checkCompress(w io.Writer, opt HookOptions) error {
+	if !opt.Compress {
+		return nil
+	}
+
+	switch w.(type) {
+	case *LokiWriter, *ElasticsearchWriter, *KafkaWriter, *KinesisWriter, *RedisWriter, *NATSWriter, *AMQPWriter:
+		return fmt.Errorf("%T parses the entries written, they can not be compressed by the hook", w)
+	}
+
+	return nil
+}
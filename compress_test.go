@@ -0,0 +1,116 @@
+package logrustash
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressBatches(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := &bytes.Buffer{}
+	h := &Hook{
+		writer:    buffer,
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:      HookOptions{MaxBatchSize: 2, Compress: true, CompressionLevel: lo.ToPtr(gzip.BestSpeed)},
+	}
+
+	for i := 1; i <= 4; i++ {
+		require.NoError(h.Fire(&logrus.Entry{Message: fmt.Sprintf("m%d", i), Data: logrus.Fields{}}))
+	}
+
+	// the batches are gzip members of a single stream
+	zr, err := gzip.NewReader(bytes.NewReader(buffer.Bytes()))
+	require.NoError(err)
+
+	uncompressed, err := io.ReadAll(zr)
+	require.NoError(err)
+
+	expected := `{"level":"panic","msg":"m1"}
+{"level":"panic","msg":"m2"}
+{"level":"panic","msg":"m3"}
+{"level":"panic","msg":"m4"}
+`
+	assert.Equal(expected, string(uncompressed))
+	assert.Equal(uint64(4), h.Stats().Sent)
+}
+
+func TestCompressInvalidLevel(t *testing.T) {
+	h := &Hook{
+		writer:    &bytes.Buffer{},
+		formatter: &logrus.JSONFormatter{},
+		opts:      HookOptions{Compress: true, CompressionLevel: lo.ToPtr(42)},
+	}
+
+	assert.Error(t, h.Fire(&logrus.Entry{Data: logrus.Fields{}}))
+}
+
+func TestCompressionLevel(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	assert.Equal(gzip.DefaultCompression, HookOptions{}.GetCompressionLevel())
+
+	// the entries are stored in gzip members, uncompressed
+	buffer := &safeBuffer{}
+	hook, err := NewWithWriter(buffer, WithFormatter(&logrus.JSONFormatter{DisableTimestamp: true}), WithCompression(gzip.NoCompression), WithSynchronous())
+	require.NoError(err)
+	assert.Equal(gzip.NoCompression, hook.(*Hook).opts.GetCompressionLevel())
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "m1", Data: logrus.Fields{}}))
+	require.NoError(hook.(*Hook).Close())
+	assert.Contains(buffer.String(), `{"level":"panic","msg":"m1"}`)
+
+	zr, err := gzip.NewReader(bytes.NewReader([]byte(buffer.String())))
+	require.NoError(err)
+
+	uncompressed, err := io.ReadAll(zr)
+	require.NoError(err)
+	assert.Equal(`{"level":"panic","msg":"m1"}`+"\n", string(uncompressed))
+}
+
+func TestCompressRetries(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	w := &toggleWriter{down: true}
+	h := &Hook{
+		writer:    w,
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:      HookOptions{Compress: true, RetryBufferSize: 10},
+	}
+
+	require.NoError(h.Fire(&logrus.Entry{Message: "m1", Data: logrus.Fields{}}))
+	w.down = false
+	require.NoError(h.Fire(&logrus.Entry{Message: "m2", Data: logrus.Fields{}}))
+
+	// the entry kept for retry is compressed as well
+	zr, err := gzip.NewReader(bytes.NewReader(w.Bytes()))
+	require.NoError(err)
+
+	uncompressed, err := io.ReadAll(zr)
+	require.NoError(err)
+	assert.Equal(`{"level":"panic","msg":"m1"}`+"\n"+`{"level":"panic","msg":"m2"}`+"\n", string(uncompressed))
+}
+
+func TestCompressParsingWriters(t *testing.T) {
+	w, err := NewElasticsearchWriter("http://127.0.0.1:9200", HTTPOptions{})
+	require.NoError(t, err)
+
+	// the writer splits the data written into documents
+	_, err = NewWithWriter(w, WithCompression(gzip.DefaultCompression))
+	assert.ErrorContains(t, err, "*logrustash.ElasticsearchWriter parses the entries written")
+
+	hook, err := NewWithWriter(w)
+	require.NoError(t, err)
+	assert.NoError(t, hook.(*Hook).Close())
+}
@@ -0,0 +1,327 @@
+package logrustash
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration written in the configuration files as the strings
+// parsed by time.ParseDuration, e.g. "5s" or "100ms".
+type Duration time.Duration
+
+// MarshalText formats the duration as time.Duration.String does.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText parses the duration with time.ParseDuration.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+// TLSConfig configures the TLS connections of a Config.
+type TLSConfig struct {
+	// Enabled connects with TLS, it is implied by the other settings.
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// CAFile is the PEM file of the certificate authorities Logstash is verified with,
+	// the ones of the system by default.
+	CAFile string `json:"ca_file,omitempty" yaml:"ca_file,omitempty"`
+	// CertFile and KeyFile are the PEM files of the client certificate and of its key.
+	CertFile string `json:"cert_file,omitempty" yaml:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty" yaml:"key_file,omitempty"`
+	// ServerName is the name the certificate of Logstash is verified for, the host of the address by default.
+	ServerName string `json:"server_name,omitempty" yaml:"server_name,omitempty"`
+	// InsecureSkipVerify does not verify the certificate of Logstash.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty"`
+}
+
+// FormatterConfig configures the LogstashFormatter of a Config, see DefaultFormatterWithOptions
+// and LogstashFormatter.
+type FormatterConfig struct {
+	// Fields are added to the entries, next to the "@version" and "type" ones.
+	Fields map[string]interface{} `json:"fields,omitempty" yaml:"fields,omitempty"`
+	// FieldMap renames the keys of logrus, e.g. "level" to "log.level".
+	FieldMap map[string]string `json:"field_map,omitempty" yaml:"field_map,omitempty"`
+	// TimestampFormat is the layout of the time of the entries, time.RFC3339Nano by default.
+	TimestampFormat string `json:"timestamp_format,omitempty" yaml:"timestamp_format,omitempty"`
+
+	StructuredFields         bool     `json:"structured_fields,omitempty" yaml:"structured_fields,omitempty"`
+	FieldsNamespace          string   `json:"fields_namespace,omitempty" yaml:"fields_namespace,omitempty"`
+	PreserveTypes            bool     `json:"preserve_types,omitempty" yaml:"preserve_types,omitempty"`
+	StructuredErrors         bool     `json:"structured_errors,omitempty" yaml:"structured_errors,omitempty"`
+	CompactMessageWhitespace bool     `json:"compact_message_whitespace,omitempty" yaml:"compact_message_whitespace,omitempty"`
+	MaxFieldValueBytes       int      `json:"max_field_value_bytes,omitempty" yaml:"max_field_value_bytes,omitempty"`
+	FingerprintFields        []string `json:"fingerprint_fields,omitempty" yaml:"fingerprint_fields,omitempty"`
+	TimestampAliases         []string `json:"timestamp_aliases,omitempty" yaml:"timestamp_aliases,omitempty"`
+	BufferKey                string   `json:"buffer_key,omitempty" yaml:"buffer_key,omitempty"`
+	CallerFunctionKey        string   `json:"caller_function_key,omitempty" yaml:"caller_function_key,omitempty"`
+	CallerFileKey            string   `json:"caller_file_key,omitempty" yaml:"caller_file_key,omitempty"`
+	CallerTrimPrefix         string   `json:"caller_trim_prefix,omitempty" yaml:"caller_trim_prefix,omitempty"`
+}
+
+// Config is the configuration of a hook which can be stored in a JSON or YAML file, see LoadConfig,
+// so that the log shipping setup lives in the configuration of the service. The settings which can not
+// be serialized, e.g. the callbacks, are given as options to NewFromConfig.
+//
+// The zero values stand for the defaults of HookOptions, the durations are written as "5s".
+type Config struct {
+	// Protocol is the network of the addresses, "tcp" by default.
+	Protocol string `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+	// Addrs are the addresses of Logstash, the hook fails over from the first one to the others,
+	// or spreads the entries across them according to LoadBalancing.
+	Addrs []string `json:"addrs" yaml:"addrs"`
+	// LoadBalancing is "failover" (the default), "round_robin" or "least_pending", see BalancePolicy.
+	LoadBalancing string `json:"load_balancing,omitempty" yaml:"load_balancing,omitempty"`
+	// Level is the minimum level of the entries sent, e.g. "warning", all the levels by default.
+	Level string `json:"level,omitempty" yaml:"level,omitempty"`
+
+	BufferSize int `json:"buffer_size,omitempty" yaml:"buffer_size,omitempty"`
+	// OverflowPolicy is "block" (the default), "drop_newest" or "drop_oldest", see OverflowPolicy.
+	OverflowPolicy string `json:"overflow_policy,omitempty" yaml:"overflow_policy,omitempty"`
+	Synchronous    bool   `json:"synchronous,omitempty" yaml:"synchronous,omitempty"`
+	LazyConnect    bool   `json:"lazy_connect,omitempty" yaml:"lazy_connect,omitempty"`
+	Workers        int    `json:"workers,omitempty" yaml:"workers,omitempty"`
+
+	BatchSize     int      `json:"batch_size,omitempty" yaml:"batch_size,omitempty"`
+	FlushInterval Duration `json:"flush_interval,omitempty" yaml:"flush_interval,omitempty"`
+	// CompressionLevel gzips the data written with the given level, if set, e.g. -1 for the default level.
+	CompressionLevel *int `json:"compression_level,omitempty" yaml:"compression_level,omitempty"`
+
+	RetryBufferSize   int    `json:"retry_buffer_size,omitempty" yaml:"retry_buffer_size,omitempty"`
+	QueueDir          string `json:"queue_dir,omitempty" yaml:"queue_dir,omitempty"`
+	QueueMaxBytes     int64  `json:"queue_max_bytes,omitempty" yaml:"queue_max_bytes,omitempty"`
+	QueueSegmentBytes int64  `json:"queue_segment_bytes,omitempty" yaml:"queue_segment_bytes,omitempty"`
+
+	MaxMessageBytes     int      `json:"max_message_bytes,omitempty" yaml:"max_message_bytes,omitempty"`
+	MaxEntriesPerSecond int      `json:"max_entries_per_second,omitempty" yaml:"max_entries_per_second,omitempty"`
+	MaxEntriesBurst     int      `json:"max_entries_burst,omitempty" yaml:"max_entries_burst,omitempty"`
+	SampleRate          float64  `json:"sample_rate,omitempty" yaml:"sample_rate,omitempty"`
+	IncludeFields       []string `json:"include_fields,omitempty" yaml:"include_fields,omitempty"`
+	ExcludeFields       []string `json:"exclude_fields,omitempty" yaml:"exclude_fields,omitempty"`
+	SentAtKey           string   `json:"sent_at_key,omitempty" yaml:"sent_at_key,omitempty"`
+	StackTrace          bool     `json:"stack_trace,omitempty" yaml:"stack_trace,omitempty"`
+
+	// KeepAlive enables TCP keepalive with the given period, if set.
+	KeepAlive            Duration `json:"keepalive,omitempty" yaml:"keepalive,omitempty"`
+	DialTimeout          Duration `json:"dial_timeout,omitempty" yaml:"dial_timeout,omitempty"`
+	WriteTimeout         Duration `json:"write_timeout,omitempty" yaml:"write_timeout,omitempty"`
+	ReconnectTimeout     Duration `json:"reconnect_timeout,omitempty" yaml:"reconnect_timeout,omitempty"`
+	MaxReconnectAttempts int      `json:"max_reconnect_attempts,omitempty" yaml:"max_reconnect_attempts,omitempty"`
+	FailbackInterval     Duration `json:"failback_interval,omitempty" yaml:"failback_interval,omitempty"`
+
+	TLS       TLSConfig       `json:"tls,omitempty" yaml:"tls,omitempty"`
+	Formatter FormatterConfig `json:"formatter,omitempty" yaml:"formatter,omitempty"`
+}
+
+// balancePolicies are the balance policies by name.
+var balancePolicies = map[string]BalancePolicy{
+	"failover":      BalanceFailover,
+	"round_robin":   BalanceRoundRobin,
+	"least_pending": BalanceLeastPending,
+}
+
+// LoadConfig reads the Config of the file `path`, in YAML unless its extension is ".json".
+// The unknown settings are refused, so that a typo does not go unnoticed.
+func LoadConfig(path string) (Config, error) {
+	var c Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&c)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&c)
+	}
+	if err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// NewFromConfig returns a new logrus.Hook for Logstash configured by `c`, the entries are formatted
+// by the LogstashFormatter of c.Formatter. The settings which can not be serialized are given by `opts`,
+// which are applied after the ones of the configuration.
+func NewFromConfig(c Config, opts ...Option) (logrus.Hook, error) {
+	s, err := c.settings()
+	if err != nil {
+		return nil, err
+	}
+	if len(s.addrs) == 0 {
+		return nil, fmt.Errorf("addrs must be set")
+	}
+
+	all, err := s.options(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithOptions(s.protocol, s.addrs[0], all...)
+}
+
+// settings returns the settings of the configuration.
+func (c Config) settings() (*settings, error) {
+	s := &settings{
+		protocol:      c.Protocol,
+		addrs:         c.Addrs,
+		tls:           c.TLS.Enabled,
+		tlsCAFile:     c.TLS.CAFile,
+		tlsCertFile:   c.TLS.CertFile,
+		tlsKeyFile:    c.TLS.KeyFile,
+		tlsServerName: c.TLS.ServerName,
+		tlsInsecure:   c.TLS.InsecureSkipVerify,
+	}
+	if s.protocol == "" {
+		s.protocol = "tcp"
+	}
+
+	f, err := c.Formatter.formatter()
+	if err != nil {
+		return nil, err
+	}
+	s.opts = append(s.opts, WithFormatter(f))
+
+	if c.Level != "" {
+		level, err := logrus.ParseLevel(c.Level)
+		if err != nil {
+			return nil, err
+		}
+		s.opts = append(s.opts, WithMinLevel(level))
+	}
+
+	if c.LoadBalancing != "" {
+		policy, ok := balancePolicies[strings.ToLower(c.LoadBalancing)]
+		if !ok {
+			return nil, fmt.Errorf("unknown load balancing policy %q", c.LoadBalancing)
+		}
+		s.opts = append(s.opts, WithLoadBalancing(policy))
+	}
+
+	if c.OverflowPolicy != "" {
+		if err := overflowPolicySetting(s, c.OverflowPolicy); err != nil {
+			return nil, err
+		}
+	}
+
+	s.opts = append(s.opts, func(o *options) {
+		o.FireChannelBufferSize = c.BufferSize
+		o.Synchronous = c.Synchronous
+		o.LazyConnect = c.LazyConnect
+		o.Workers = c.Workers
+		o.MaxBatchSize = c.BatchSize
+		o.FlushInterval = time.Duration(c.FlushInterval)
+		o.Compress = c.CompressionLevel != nil
+		o.CompressionLevel = c.CompressionLevel
+		o.RetryBufferSize = c.RetryBufferSize
+		o.QueueDir = c.QueueDir
+		o.QueueMaxBytes = c.QueueMaxBytes
+		o.QueueSegmentBytes = c.QueueSegmentBytes
+		o.MaxMessageBytes = c.MaxMessageBytes
+		o.MaxEntriesPerSecond = c.MaxEntriesPerSecond
+		o.MaxEntriesBurst = c.MaxEntriesBurst
+		o.SampleRate = c.SampleRate
+		o.IncludeFields = c.IncludeFields
+		o.ExcludeFields = c.ExcludeFields
+		o.SentAtKey = c.SentAtKey
+		o.StackTrace = c.StackTrace
+		o.KeepAlive = c.KeepAlive != 0
+		o.KeepAlivePeriod = time.Duration(c.KeepAlive)
+		o.DialTimeout = time.Duration(c.DialTimeout)
+		o.WriteTimeout = time.Duration(c.WriteTimeout)
+		o.ReconnectTimeout = time.Duration(c.ReconnectTimeout)
+		o.MaxReconnectAttempts = c.MaxReconnectAttempts
+		o.FailbackInterval = time.Duration(c.FailbackInterval)
+	})
+
+	return s, nil
+}
+
+// formatter returns the LogstashFormatter of the configuration.
+func (c FormatterConfig) formatter() (logrus.Formatter, error) {
+	fm, err := fieldMap(c.FieldMap)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := logrus.Fields{}
+	for k, v := range c.Fields {
+		fields[k] = v
+	}
+
+	f := DefaultFormatterWithOptions(fields, fm, c.TimestampFormat).(LogstashFormatter)
+	f.StructuredFields = c.StructuredFields
+	f.FieldsNamespace = c.FieldsNamespace
+	f.PreserveTypes = c.PreserveTypes
+	f.StructuredErrors = c.StructuredErrors
+	f.CompactMessageWhitespace = c.CompactMessageWhitespace
+	f.MaxFieldValueBytes = c.MaxFieldValueBytes
+	f.FingerprintFields = c.FingerprintFields
+	f.TimestampAliases = c.TimestampAliases
+	f.BufferKey = c.BufferKey
+	f.CallerFunctionKey = c.CallerFunctionKey
+	f.CallerFileKey = c.CallerFileKey
+	f.CallerTrimPrefix = c.CallerTrimPrefix
+
+	return f, nil
+}
+
+// fieldMap returns the logrus.FieldMap renaming the keys of logrus as `renames` does.
+func fieldMap(renames map[string]string) (logrus.FieldMap, error) {
+	fm := logrus.FieldMap{
+		logrus.FieldKeyMsg:         "",
+		logrus.FieldKeyLevel:       "",
+		logrus.FieldKeyTime:        "",
+		logrus.FieldKeyLogrusError: "",
+		logrus.FieldKeyFunc:        "",
+		logrus.FieldKeyFile:        "",
+	}
+
+	for k := range fm {
+		if v, ok := renames[string(k)]; ok {
+			fm[k] = v
+		} else {
+			delete(fm, k)
+		}
+	}
+
+	if len(fm) != len(renames) {
+		known := map[string]bool{}
+		for k := range fm {
+			known[string(k)] = true
+		}
+
+		var unknown []string
+		for k := range renames {
+			if !known[k] {
+				unknown = append(unknown, k)
+			}
+		}
+		sort.Strings(unknown)
+
+		return nil, fmt.Errorf("unknown field map keys %v", unknown)
+	}
+
+	return fm, nil
+}
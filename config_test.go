@@ -0,0 +1,125 @@
+package logrustash
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+
+	yamlPath := filepath.Join(dir, "logstash.yaml")
+	require.NoError(os.WriteFile(yamlPath, []byte(`
+addrs: [logstash:5000, logstash-backup:5000]
+level: warning
+buffer_size: 1024
+overflow_policy: drop_oldest
+write_timeout: 3s
+tls:
+  server_name: logstash.example.com
+formatter:
+  fields:
+    service: api
+  field_map:
+    level: log.level
+  structured_fields: true
+`), 0o600))
+
+	c, err := LoadConfig(yamlPath)
+	require.NoError(err)
+	assert.Equal([]string{"logstash:5000", "logstash-backup:5000"}, c.Addrs)
+	assert.Equal("warning", c.Level)
+	assert.Equal(1024, c.BufferSize)
+	assert.Equal(Duration(3*time.Second), c.WriteTimeout)
+	assert.Equal("logstash.example.com", c.TLS.ServerName)
+	assert.Equal(map[string]interface{}{"service": "api"}, c.Formatter.Fields)
+	assert.True(c.Formatter.StructuredFields)
+
+	// the JSON configuration is equivalent
+	data, err := json.Marshal(c)
+	require.NoError(err)
+	jsonPath := filepath.Join(dir, "logstash.json")
+	require.NoError(os.WriteFile(jsonPath, data, 0o600))
+
+	fromJSON, err := LoadConfig(jsonPath)
+	require.NoError(err)
+	assert.Equal(c, fromJSON)
+
+	// a typo is refused
+	require.NoError(os.WriteFile(yamlPath, []byte("addrs: [logstash:5000]\nbufer_size: 10\n"), 0o600))
+	_, err = LoadConfig(yamlPath)
+	assert.ErrorContains(err, "bufer_size")
+
+	require.NoError(os.WriteFile(jsonPath, []byte(`{"addrs": ["logstash:5000"], "write_timeout": "soon"}`), 0o600))
+	_, err = LoadConfig(jsonPath)
+	assert.Error(err)
+}
+
+func TestNewFromConfig(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	lines, _ := acceptLines(t, l)
+
+	hook, err := NewFromConfig(Config{
+		Addrs:          []string{l.Addr().String()},
+		Level:          "info",
+		OverflowPolicy: "drop_newest",
+		KeepAlive:      Duration(time.Minute),
+		Formatter: FormatterConfig{
+			Fields:   map[string]interface{}{"service": "api"},
+			FieldMap: map[string]string{"level": "log.level"},
+		},
+	}, WithSentAt("sent_at"))
+	require.NoError(err)
+	h := hook.(*Hook)
+	defer h.Close()
+
+	assert.NotContains(h.Levels(), logrus.DebugLevel)
+	assert.Equal(OverflowDropNewest, h.opts.OverflowPolicy)
+	assert.True(h.opts.KeepAlive)
+	assert.Equal(time.Minute, h.opts.KeepAlivePeriod)
+
+	require.NoError(h.Fire(&logrus.Entry{Message: "from config", Level: logrus.InfoLevel, Data: logrus.Fields{}}))
+
+	select {
+	case line := <-lines:
+		assert.Contains(line, `"message":"from config"`)
+		assert.Contains(line, `"log.level":"info"`)
+		assert.Contains(line, `"service":"api"`)
+		assert.Contains(line, `"sent_at"`)
+	case <-time.After(time.Second):
+		t.Fatal("entry not received")
+	}
+}
+
+func TestNewFromConfigErrors(t *testing.T) {
+	for name, c := range map[string]Config{
+		"no address":       {},
+		"unknown level":    {Addrs: []string{"127.0.0.1:1"}, Level: "loud"},
+		"unknown policy":   {Addrs: []string{"127.0.0.1:1"}, LoadBalancing: "random"},
+		"unknown overflow": {Addrs: []string{"127.0.0.1:1"}, OverflowPolicy: "spill"},
+		"unknown key":      {Addrs: []string{"127.0.0.1:1"}, Formatter: FormatterConfig{FieldMap: map[string]string{"lvl": "log.level"}}},
+		"missing CA file":  {Addrs: []string{"127.0.0.1:1"}, TLS: TLSConfig{CAFile: filepath.Join(t.TempDir(), "ca.pem")}},
+	} {
+		// the hook does not connect, so that the errors are the ones of the configuration
+		c.LazyConnect = true
+		_, err := NewFromConfig(c)
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,127 @@
+package logrustash
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The fields ContainerMetadata is added under, following the Elastic Common Schema.
+const (
+	ContainerKeyID        = "container.id"
+	ContainerKeyImageName = "container.image.name"
+	ContainerKeyImageTag  = "container.image.tag"
+	ContainerKeyRuntime   = "container.runtime"
+)
+
+// The files the container ID is detected from.
+var (
+	cgroupFile    = "/proc/self/cgroup"
+	mountInfoFile = "/proc/self/mountinfo"
+)
+
+var (
+	// cgroupContainerID matches the container ID of a cgroup v1 path, e.g. "/docker/<id>" or
+	// "/system.slice/cri-containerd-<id>.scope", the runtime being the first group if it is known.
+	cgroupContainerID = regexp.MustCompile(`(?:(docker|cri-containerd|crio|libpod)[-/])?([0-9a-f]{64})(?:\.scope)?$`)
+	// mountContainerID matches the container ID of the files the runtime mounts into the container
+	// with cgroup v2, e.g. "/var/lib/docker/containers/<id>/hostname".
+	mountContainerID = regexp.MustCompile(`/(docker/containers|overlay-containers)/([0-9a-f]{64})/`)
+)
+
+// containerRuntimes are the names of the runtimes by the names they use in the cgroup and mount paths.
+var containerRuntimes = map[string]string{
+	"docker":             "docker",
+	"docker/containers":  "docker",
+	"cri-containerd":     "containerd",
+	"crio":               "cri-o",
+	"libpod":             "podman",
+	"overlay-containers": "podman",
+}
+
+// ContainerMetadata describes the container the process is running in, it is added to every entry
+// with WithContainerMetadata or as one of HookOptions.Enrichers. The empty values are not added.
+type ContainerMetadata struct {
+	ID        string
+	ImageName string
+	ImageTag  string
+	// Runtime is "docker", "containerd", "cri-o" or "podman", if it can be told.
+	Runtime string
+}
+
+// DetectContainerMetadata returns the metadata of the container the process is running in:
+//   - the container ID from the CONTAINER_ID variable, detected from the cgroup of the process
+//     or from the files mounted by the runtime otherwise
+//   - the image from the CONTAINER_IMAGE variable, e.g. "registry:5000/checkout:1.2.3",
+//     which the runtimes do not expose and is set by the image or the deployment
+//
+// The metadata is empty when the process is not running in a container.
+func DetectContainerMetadata() ContainerMetadata {
+	var m ContainerMetadata
+
+	m.ID = os.Getenv("CONTAINER_ID")
+	if m.ID == "" {
+		m.ID, m.Runtime = detectContainerID()
+	}
+
+	m.ImageName, m.ImageTag = splitImage(os.Getenv("CONTAINER_IMAGE"))
+
+	return m
+}
+
+// detectContainerID returns the ID of the container the process is running in and its runtime,
+// empty strings if it can not be told.
+func detectContainerID() (id, runtime string) {
+	if data, err := os.ReadFile(cgroupFile); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if match := cgroupContainerID.FindStringSubmatch(line); match != nil {
+				return match[2], containerRuntimes[match[1]]
+			}
+		}
+	}
+
+	if data, err := os.ReadFile(mountInfoFile); err == nil {
+		if match := mountContainerID.FindStringSubmatch(string(data)); match != nil {
+			return match[2], containerRuntimes[match[1]]
+		}
+	}
+
+	return "", ""
+}
+
+// splitImage returns the name and the tag of the image reference `image`, e.g. "registry:5000/checkout"
+// and "1.2.3" for "registry:5000/checkout:1.2.3". The digest of the references pinned by digest is kept
+// in the name.
+func splitImage(image string) (name, tag string) {
+	if strings.Contains(image, "@") {
+		return image, ""
+	}
+
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i+1:], "/") {
+		return image, ""
+	}
+
+	return image[:i], image[i+1:]
+}
+
+// Fields returns the metadata as fields, without the empty values.
+func (m ContainerMetadata) Fields() logrus.Fields {
+	fields := logrus.Fields{}
+	if m.ID != "" {
+		fields[ContainerKeyID] = m.ID
+	}
+	if m.ImageName != "" {
+		fields[ContainerKeyImageName] = m.ImageName
+	}
+	if m.ImageTag != "" {
+		fields[ContainerKeyImageTag] = m.ImageTag
+	}
+	if m.Runtime != "" {
+		fields[ContainerKeyRuntime] = m.Runtime
+	}
+
+	return fields
+}
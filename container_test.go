@@ -0,0 +1,105 @@
+package logrustash
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withContainerFiles makes DetectContainerMetadata read the cgroup and the mounts of the process
+// from `cgroup` and `mountInfo` for the duration of the test.
+func withContainerFiles(t *testing.T, cgroup, mountInfo string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	cgroupPath, mountInfoPath := filepath.Join(dir, "cgroup"), filepath.Join(dir, "mountinfo")
+	require.NoError(t, os.WriteFile(cgroupPath, []byte(cgroup), 0o600))
+	require.NoError(t, os.WriteFile(mountInfoPath, []byte(mountInfo), 0o600))
+
+	prevCgroup, prevMountInfo := cgroupFile, mountInfoFile
+	cgroupFile, mountInfoFile = cgroupPath, mountInfoPath
+	t.Cleanup(func() {
+		cgroupFile, mountInfoFile = prevCgroup, prevMountInfo
+	})
+}
+
+func TestDetectContainerMetadata(t *testing.T) {
+	id := strings.Repeat("0123456789abcdef", 4)
+
+	t.Setenv("CONTAINER_ID", "")
+	t.Setenv("CONTAINER_IMAGE", "")
+
+	for name, test := range map[string]struct {
+		cgroup, mountInfo string
+		expected          ContainerMetadata
+	}{
+		"docker": {
+			cgroup:   "12:pids:/docker/" + id + "\n11:memory:/docker/" + id + "\n",
+			expected: ContainerMetadata{ID: id, Runtime: "docker"},
+		},
+		"containerd": {
+			cgroup:   "0::/kubepods.slice/kubepods-burstable.slice/cri-containerd-" + id + ".scope\n",
+			expected: ContainerMetadata{ID: id, Runtime: "containerd"},
+		},
+		"kubepods": {
+			cgroup:   "1:name=systemd:/kubepods/burstable/pod1b2c/" + id + "\n",
+			expected: ContainerMetadata{ID: id},
+		},
+		"cgroup v2": {
+			cgroup:    "0::/\n",
+			mountInfo: "1203 1194 254:1 /var/lib/docker/containers/" + id + "/hostname /etc/hostname rw,relatime - ext4 /dev/vda1 rw\n",
+			expected:  ContainerMetadata{ID: id, Runtime: "docker"},
+		},
+		"host": {
+			cgroup:    "0::/user.slice/user-1000.slice/session-2.scope\n",
+			mountInfo: "22 1 254:1 / / rw,relatime - ext4 /dev/vda1 rw\n",
+		},
+	} {
+		withContainerFiles(t, test.cgroup, test.mountInfo)
+		assert.Equal(t, test.expected, DetectContainerMetadata(), name)
+	}
+
+	t.Setenv("CONTAINER_ID", "abc123")
+	t.Setenv("CONTAINER_IMAGE", "registry:5000/shop/checkout:1.2.3")
+	assert.Equal(t, ContainerMetadata{ID: "abc123", ImageName: "registry:5000/shop/checkout", ImageTag: "1.2.3"}, DetectContainerMetadata())
+}
+
+func TestSplitImage(t *testing.T) {
+	for image, expected := range map[string][2]string{
+		"checkout":                       {"checkout", ""},
+		"checkout:1.2.3":                 {"checkout", "1.2.3"},
+		"registry:5000/checkout":         {"registry:5000/checkout", ""},
+		"checkout@sha256:0123456789abcd": {"checkout@sha256:0123456789abcd", ""},
+	} {
+		name, tag := splitImage(image)
+		assert.Equal(t, expected, [2]string{name, tag}, image)
+	}
+}
+
+func TestWithContainerMetadata(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	t.Setenv("CONTAINER_ID", "abc123")
+	t.Setenv("CONTAINER_IMAGE", "checkout:1.2.3")
+
+	buffer := &safeBuffer{}
+	hook, err := NewWithWriter(buffer, WithContainerMetadata())
+	require.NoError(err)
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "msg1", Data: logrus.Fields{}}))
+	require.NoError(hook.(*Hook).Close())
+
+	var doc map[string]interface{}
+	require.NoError(json.Unmarshal([]byte(buffer.String()), &doc))
+
+	assert.Equal("abc123", doc["container.id"])
+	assert.Equal("checkout", doc["container.image.name"])
+	assert.Equal("1.2.3", doc["container.image.tag"])
+}
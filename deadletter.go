@@ -0,0 +1,61 @@
+package logrustash
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DeadLetter is the record of an entry given up on, written as a line of JSON to HookOptions.DeadLetter.
+type DeadLetter struct {
+	// Time is the time the entry was given up on.
+	Time time.Time `json:"time"`
+	// Reason is the error the entry was given up on for.
+	Reason string `json:"reason"`
+	// Payload is the formatted entry as it would have been written to Logstash, unless it failed to be formatted.
+	// It is base64 encoded in JSON, the formatted entries are not necessarily text, e.g. when framed.
+	Payload []byte `json:"payload,omitempty"`
+	// Level, Message and Fields are the ones of the entry when it failed to be formatted.
+	Level   string            `json:"level,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// deadLetters serializes the writes to HookOptions.DeadLetter.
+type deadLetters struct {
+	mu sync.Mutex
+}
+
+// deadLetter writes the record of the entry given up on for `reason` to the dead-letter writer, if any.
+// `data` is the formatted entry, `e` the entry itself if it failed to be formatted.
+func (h *Hook) deadLetter(e *logrus.Entry, data []byte, reason error) {
+	if h.opts.DeadLetter == nil {
+		return
+	}
+
+	letter := DeadLetter{Time: time.Now(), Reason: reason.Error(), Payload: data}
+	if data == nil && e != nil {
+		letter.Level = e.Level.String()
+		letter.Message = e.Message
+		letter.Fields = make(map[string]string, len(e.Data))
+		for k, v := range e.Data {
+			letter.Fields[k] = fmt.Sprintf("%v", v)
+		}
+	}
+
+	line, err := json.Marshal(letter)
+	if err != nil {
+		h.diagnosef("failed to marshal dead letter, error: %v\n", err)
+		return
+	}
+
+	h.deadLetters.mu.Lock()
+	defer h.deadLetters.mu.Unlock()
+
+	if _, err = h.opts.DeadLetter.Write(append(line, '\n')); err != nil {
+		h.diagnosef("failed to write dead letter, error: %v\n", err)
+	}
+}
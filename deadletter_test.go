@@ -0,0 +1,97 @@
+package logrustash
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readDeadLetters decodes the dead letters written to `b`.
+func readDeadLetters(t *testing.T, b *bytes.Buffer) []DeadLetter {
+	t.Helper()
+
+	var letters []DeadLetter
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		var letter DeadLetter
+		require.NoError(t, json.Unmarshal([]byte(line), &letter))
+		letters = append(letters, letter)
+	}
+
+	return letters
+}
+
+func TestDeadLetterFormatError(t *testing.T) {
+	assert := assert.New(t)
+
+	deadLetters := &bytes.Buffer{}
+	h := &Hook{
+		writer:    &bytes.Buffer{},
+		formatter: FailFmt{},
+		opts:      HookOptions{DeadLetter: deadLetters},
+	}
+
+	assert.Error(h.Fire(&logrus.Entry{Message: "unformattable", Level: logrus.ErrorLevel, Data: logrus.Fields{"user": 42}}))
+
+	letters := readDeadLetters(t, deadLetters)
+	require.Len(t, letters, 1)
+	assert.Equal("unformattable", letters[0].Message)
+	assert.Equal("error", letters[0].Level)
+	assert.Equal(map[string]string{"user": "42"}, letters[0].Fields)
+	assert.Empty(letters[0].Payload)
+}
+
+func TestDeadLetterSendError(t *testing.T) {
+	assert := assert.New(t)
+
+	deadLetters := &bytes.Buffer{}
+	h := &Hook{
+		writer:    &toggleWriter{down: true},
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:      HookOptions{DeadLetter: deadLetters},
+	}
+
+	assert.Error(h.Fire(&logrus.Entry{Message: "undeliverable", Data: logrus.Fields{}}))
+
+	letters := readDeadLetters(t, deadLetters)
+	require.Len(t, letters, 1)
+	assert.Equal(`{"level":"panic","msg":"undeliverable"}`+"\n", string(letters[0].Payload))
+	assert.Equal("connection refused", letters[0].Reason)
+}
+
+func TestDeadLetterRetryBufferOverflow(t *testing.T) {
+	assert := assert.New(t)
+
+	deadLetters := &bytes.Buffer{}
+	h := &Hook{
+		writer:    &toggleWriter{down: true},
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:      HookOptions{RetryBufferSize: 1, DeadLetter: deadLetters},
+	}
+
+	for _, msg := range []string{"m1", "m2"} {
+		require.NoError(t, h.Fire(&logrus.Entry{Message: msg, Data: logrus.Fields{}}))
+	}
+
+	letters := readDeadLetters(t, deadLetters)
+	require.Len(t, letters, 1)
+	assert.Equal(`{"level":"panic","msg":"m1"}`+"\n", string(letters[0].Payload))
+	assert.Equal(errRetryBufferFull.Error(), letters[0].Reason)
+}
+
+func TestDeadLetterBinaryPayload(t *testing.T) {
+	deadLetters := &bytes.Buffer{}
+	h := &Hook{opts: HookOptions{DeadLetter: deadLetters}}
+
+	// e.g. a length-prefixed frame, which is not valid UTF-8
+	payload := []byte{0x00, 0x00, 0x00, 0x02, 0xff, 0xfe}
+	h.deadLetter(nil, payload, errRetryBufferFull)
+
+	letters := readDeadLetters(t, deadLetters)
+	require.Len(t, letters, 1)
+	assert.Equal(t, payload, letters[0].Payload)
+}
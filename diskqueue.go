@@ -0,0 +1,334 @@
+package logrustash
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// errQueueOverflow is returned when an entry which overflowed the queue of entries to be sent
+// could not be persisted.
+var errQueueOverflow = errors.New("the queue is full and the entry could not be persisted")
+
+const (
+	defaultQueueMaxBytes     = 100 << 20
+	defaultQueueSegmentBytes = 4 << 20
+
+	segmentExt = ".seg"
+)
+
+// diskQueue is a queue of formatted entries persisted in segment files of a directory,
+// so that the entries which could not be sent survive the restarts of the process.
+// The entries of a segment partially sent before a restart are sent again.
+// Every record of a segment is the length of the entry as a 4-byte big-endian unsigned
+// integer followed by the entry. It is safe for concurrent use, entries can be pushed
+// while it is replayed.
+type diskQueue struct {
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+
+	mu sync.Mutex
+
+	// segments are ordered oldest first, new records are appended to the last one
+	segments []*segment
+	size     int64
+	next     uint64
+}
+
+// segment is a file of records, the records before offset were already sent.
+type segment struct {
+	path    string
+	size    int64
+	entries int
+	offset  int64
+	sent    int
+}
+
+// openDiskQueue opens the queue persisted in `dir`, creating the directory if needed.
+// The entries left by a previous run are kept to be sent first.
+func openDiskQueue(dir string, maxBytes, segmentBytes int64) (*diskQueue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create the queue directory: %w", err)
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	q := &diskQueue{dir: dir, maxBytes: maxBytes, segmentBytes: segmentBytes}
+	for _, name := range names {
+		seg, err := loadSegment(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the queue segment %s: %w", name, err)
+		}
+
+		seq, _ := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), segmentExt), 10, 64)
+		if seq >= q.next {
+			q.next = seq + 1
+		}
+
+		q.segments = append(q.segments, seg)
+		q.size += seg.size
+	}
+
+	return q, nil
+}
+
+// loadSegment counts the records of the segment file at `path`, a truncated last record,
+// e.g. if the process crashed while writing it, is discarded.
+func loadSegment(path string) (*segment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	seg := &segment{path: path}
+	for {
+		n, err := readRecord(f, nil)
+		if err != nil {
+			break
+		}
+
+		seg.size += n
+		seg.entries++
+	}
+
+	if err := os.Truncate(path, seg.size); err != nil {
+		return nil, err
+	}
+
+	return seg, nil
+}
+
+// readRecord reads the next record of `r`, passing it to `fn` if not nil, and returns its size.
+func readRecord(r io.Reader, fn func([]byte) error) (int64, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, err
+	}
+
+	data := make([]byte, binary.BigEndian.Uint32(header[:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, err
+	}
+
+	if fn != nil {
+		if err := fn(data); err != nil {
+			return 0, err
+		}
+	}
+
+	return int64(len(header) + len(data)), nil
+}
+
+// len returns the number of entries waiting to be sent.
+func (q *diskQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := 0
+	for _, seg := range q.segments {
+		n += seg.entries - seg.sent
+	}
+
+	return n
+}
+
+// push appends the data to the queue, rotating to a new segment when the last one is full.
+// It returns the number of entries dropped from the oldest segments to stay within
+// the maximum size of the queue.
+func (q *diskQueue) push(data []byte) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.segments) == 0 || q.segments[len(q.segments)-1].size >= q.segmentBytes {
+		q.segments = append(q.segments, &segment{path: filepath.Join(q.dir, fmt.Sprintf("%020d%s", q.next, segmentExt))})
+		q.next++
+	}
+
+	seg := q.segments[len(q.segments)-1]
+	f, err := os.OpenFile(seg.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return 0, err
+	}
+
+	record := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(record, uint32(len(data)))
+	record = append(record, data...)
+
+	_, err = f.Write(record)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	seg.size += int64(len(record))
+	seg.entries++
+	q.size += int64(len(record))
+
+	// drop the oldest segments, except the one just written to
+	dropped := 0
+	for q.size > q.maxBytes && len(q.segments) > 1 {
+		dropped += q.segments[0].entries - q.segments[0].sent
+		q.removeOldest()
+	}
+
+	return dropped, nil
+}
+
+// replay passes the queued entries to `send`, oldest first, removing the segments once
+// all their entries are sent. It stops at the first error, the entry which failed
+// is passed to `send` again on the next replay. The queue is not locked while `send`
+// runs, the entries pushed meanwhile are replayed too.
+func (q *diskQueue) replay(send func([]byte) error) error {
+	var (
+		f    *os.File
+		open *segment
+	)
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	for {
+		q.mu.Lock()
+		if len(q.segments) == 0 {
+			q.mu.Unlock()
+			return nil
+		}
+
+		seg := q.segments[0]
+		if seg.sent == seg.entries {
+			q.removeOldest()
+			q.mu.Unlock()
+			continue
+		}
+		offset := seg.offset
+		q.mu.Unlock()
+
+		if open != seg {
+			if f != nil {
+				f.Close()
+			}
+
+			var err error
+			if f, err = os.Open(seg.path); err != nil {
+				f = nil
+				return err
+			}
+			if _, err = f.Seek(offset, io.SeekStart); err != nil {
+				return err
+			}
+			open = seg
+		}
+
+		n, err := readRecord(f, send)
+		if err != nil {
+			return err
+		}
+
+		q.mu.Lock()
+		// the segment may have been dropped by push to stay within the maximum size
+		if len(q.segments) > 0 && q.segments[0] == seg {
+			seg.offset += n
+			seg.sent++
+		}
+		q.mu.Unlock()
+	}
+}
+
+// removeOldest removes the oldest segment and its file.
+func (q *diskQueue) removeOldest() {
+	seg := q.segments[0]
+	q.segments = q.segments[1:]
+	q.size -= seg.size
+
+	// the entries of a segment which failed to be removed are sent again by the next run at worst
+	_ = os.Remove(seg.path)
+}
+
+// queueDirName returns the name of the directory of the queue of the route `name`, e.g. an address,
+// as a single path component: the characters which are not safe in file names are replaced and
+// a hash of the name is appended so that the names differing by these characters do not collide.
+func queueDirName(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+
+		return '_'
+	}, name)
+
+	sum := sha256.Sum256([]byte(name))
+	return safe + "-" + hex.EncodeToString(sum[:4])
+}
+
+// openQueue opens the queue of the entries which failed to be sent if HookOptions.QueueDir is set.
+func (h *Hook) openQueue() error {
+	if h.opts.QueueDir == "" {
+		return nil
+	}
+
+	q, err := openDiskQueue(h.opts.QueueDir, h.opts.GetQueueMaxBytes(), h.opts.GetQueueSegmentBytes())
+	if err != nil {
+		return err
+	}
+
+	h.queue = q
+	return nil
+}
+
+// keepOnDisk persists the data which failed to be sent in the queue,
+// it is replayed before anything else once sending succeeds again.
+// It returns false if the data could not be persisted.
+func (h *Hook) keepOnDisk(data []byte) bool {
+	dropped, err := h.queue.push(data)
+
+	h.stats.dropped.Add(uint64(dropped))
+	if err != nil {
+		h.reportError(fmt.Errorf("failed to persist the entry: %w", err), nil)
+		return false
+	}
+
+	return true
+}
+
+// spill persists the entry `e` which overflowed the queue of entries to be sent in the queue on disk,
+// if HookOptions.QueueDir is set, it is sent with the other entries kept for retry.
+// It reports whether the entry was persisted.
+func (h *Hook) spill(e *logrus.Entry) bool {
+	if h.queue == nil {
+		return false
+	}
+
+	err := h.deliverWith(e, func(e *logrus.Entry, dataBytes []byte) error {
+		if h.opts.Framer != nil {
+			dataBytes = h.opts.Framer(dataBytes)
+		}
+		if !h.keepOnDisk(dataBytes) {
+			return errQueueOverflow
+		}
+
+		return nil
+	})
+
+	return err == nil
+}
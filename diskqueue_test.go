@@ -0,0 +1,291 @@
+package logrustash
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskQueue(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	// every entry gets its own segment
+	q, err := openDiskQueue(dir, 1<<20, 1)
+	require.NoError(err)
+
+	for _, data := range []string{"e1", "e2", "e3"} {
+		dropped, err := q.push([]byte(data))
+		require.NoError(err)
+		assert.Zero(dropped)
+	}
+	assert.Equal(3, q.len())
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	assert.Len(segments, 3)
+
+	var sent []string
+	failing := errors.New("connection refused")
+	err = q.replay(func(data []byte) error {
+		if string(data) == "e2" {
+			return failing
+		}
+
+		sent = append(sent, string(data))
+		return nil
+	})
+	assert.ErrorIs(err, failing)
+	assert.Equal(2, q.len())
+
+	require.NoError(q.replay(func(data []byte) error {
+		sent = append(sent, string(data))
+		return nil
+	}))
+	assert.Equal([]string{"e1", "e2", "e3"}, sent)
+	assert.Zero(q.len())
+
+	segments, _ = filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	assert.Empty(segments)
+}
+
+func TestDiskQueueMaxBytes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// a record of "eN" is 6 bytes, two segments of two records fit
+	q, err := openDiskQueue(t.TempDir(), 24, 12)
+	require.NoError(err)
+
+	dropped := 0
+	for i := 1; i <= 5; i++ {
+		n, err := q.push([]byte(fmt.Sprintf("e%d", i)))
+		require.NoError(err)
+		dropped += n
+	}
+	assert.Equal(2, dropped)
+
+	var sent []string
+	require.NoError(q.replay(func(data []byte) error {
+		sent = append(sent, string(data))
+		return nil
+	}))
+	assert.Equal([]string{"e3", "e4", "e5"}, sent)
+}
+
+func TestDiskQueueReopen(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	q, err := openDiskQueue(dir, 1<<20, 1<<20)
+	require.NoError(err)
+
+	for _, data := range []string{"e1", "e2"} {
+		_, err := q.push([]byte(data))
+		require.NoError(err)
+	}
+
+	// a record partially written by a crash is discarded
+	f, err := os.OpenFile(q.segments[0].path, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(err)
+	_, err = f.Write([]byte{0, 0, 0, 9, 'e'})
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	q, err = openDiskQueue(dir, 1<<20, 1<<20)
+	require.NoError(err)
+	assert.Equal(2, q.len())
+
+	_, err = q.push([]byte("e3"))
+	require.NoError(err)
+
+	var sent []string
+	require.NoError(q.replay(func(data []byte) error {
+		sent = append(sent, string(data))
+		return nil
+	}))
+	assert.Equal([]string{"e1", "e2", "e3"}, sent)
+}
+
+func TestFireDiskQueue(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+
+	w := &toggleWriter{down: true}
+	h := &Hook{
+		writer:    w,
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:      HookOptions{QueueDir: dir},
+	}
+	require.NoError(h.openQueue())
+
+	for _, msg := range []string{"m1", "m2", "m3"} {
+		require.NoError(h.Fire(&logrus.Entry{Message: msg, Data: logrus.Fields{}}))
+	}
+	assert.Zero(w.Len())
+
+	// the entries persisted by the previous run are sent first
+	w.down = false
+	restarted := &Hook{
+		writer:    w,
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:      HookOptions{QueueDir: dir},
+	}
+	require.NoError(restarted.openQueue())
+	require.NoError(restarted.Fire(&logrus.Entry{Message: "m4", Data: logrus.Fields{}}))
+
+	expected := `{"level":"panic","msg":"m1"}
+{"level":"panic","msg":"m2"}
+{"level":"panic","msg":"m3"}
+{"level":"panic","msg":"m4"}
+`
+	assert.Equal(expected, w.String())
+	assert.Zero(restarted.queue.len())
+}
+
+func TestDiskQueueReconnect(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	addr := l.Addr().String()
+
+	_, conns := acceptLines(t, l)
+
+	// the hook tries to reconnect until it succeeds
+	opts := HookOptions{QueueDir: dir, Backoff: ConstantBackoff(10 * time.Millisecond)}
+	hook, err := New("tcp", addr, &logrus.JSONFormatter{}, opts)
+	require.NoError(err)
+	h := hook.(*Hook)
+
+	// kill the listener and the established connection
+	require.NoError(l.Close())
+	(<-conns).Close()
+
+	require.Eventually(func() bool {
+		require.NoError(h.Fire(&logrus.Entry{Message: "are you there?", Data: logrus.Fields{}}))
+		return !h.IsConnected()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the queued entries are persisted while reconnecting and survive the restart
+	for _, msg := range []string{"m1", "m2", "m3"} {
+		require.NoError(h.Fire(&logrus.Entry{Message: msg, Data: logrus.Fields{}}))
+	}
+	require.NoError(h.Close())
+
+	l, err = net.Listen("tcp", addr)
+	require.NoError(err)
+	defer l.Close()
+
+	lines, _ := acceptLines(t, l)
+
+	// the entries left by the previous run are sent on startup, without waiting for the next one
+	restarted, err := New("tcp", addr, &logrus.JSONFormatter{}, opts)
+	require.NoError(err)
+	defer restarted.(*Hook).Close()
+
+	var received []string
+	for len(received) < 3 {
+		select {
+		case line := <-lines:
+			if !strings.Contains(line, "are you there?") {
+				received = append(received, line)
+			}
+		case <-time.After(5 * time.Second):
+			require.FailNow("expected the persisted entries to be sent on startup", "received %v", received)
+		}
+	}
+
+	for i, msg := range []string{"m1", "m2", "m3"} {
+		assert.Contains(received[i], fmt.Sprintf(`"msg":"%s"`, msg))
+	}
+}
+
+func TestDiskQueueOverflow(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	h := &Hook{
+		formatter:              &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:                   HookOptions{QueueDir: t.TempDir(), OverflowPolicy: OverflowDropNewest},
+		logrusEntryFireChannel: make(chan *logrus.Entry, 1),
+	}
+	require.NoError(h.openQueue())
+
+	// the entry which does not fit in the queue is persisted instead of being dropped
+	require.NoError(h.enqueue(&logrus.Entry{Message: "queued", Data: logrus.Fields{}}))
+	require.NoError(h.enqueue(&logrus.Entry{Message: "spilled", Data: logrus.Fields{}}))
+
+	assert.Equal(1, h.queue.len())
+	assert.Zero(h.Stats().Dropped)
+
+	var sent []string
+	require.NoError(h.queue.replay(func(data []byte) error {
+		sent = append(sent, string(data))
+		return nil
+	}))
+	assert.Equal([]string{`{"level":"panic","msg":"spilled"}` + "\n"}, sent)
+}
+
+func TestDiskQueueOverflowStalledWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	w := &gatedWriter{release: make(chan struct{})}
+	hook, err := NewWithWriter(w,
+		WithFormatter(&logrus.JSONFormatter{DisableTimestamp: true}),
+		WithBufferSize(2),
+		WithOverflowPolicy(OverflowDropNewest),
+		WithDiskQueue(t.TempDir(), 0, 0),
+	)
+	require.NoError(t, err)
+
+	// persisting the entries which overflow the queue must not wait for the stalled writer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fillQueue(t, hook.(*Hook), 2)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		close(w.release)
+		require.FailNow(t, "Fire blocked on the stalled writer")
+	}
+	assert.Equal(2, hook.(*Hook).queue.len())
+	assert.Zero(hook.(*Hook).Stats().Dropped)
+
+	close(w.release)
+	require.NoError(t, hook.(*Hook).Close())
+
+	for i := 0; i <= 4; i++ {
+		assert.Contains(w.String(), fmt.Sprintf(`"msg":"m%d"`, i))
+	}
+}
+
+func TestQueueDirName(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, name := range []string{"127.0.0.1:5000", "[::1]:5000", "..", "../../etc", "a/b", `c:\logs`, ""} {
+		dir := queueDirName(name)
+		assert.Equal(filepath.Base(dir), dir, "%q is expected to be a single path component", name)
+		assert.NotContains([]string{".", ".."}, dir)
+	}
+
+	assert.True(strings.HasPrefix(queueDirName("priority"), "priority-"))
+	assert.NotEqual(queueDirName("a/b"), queueDirName("a:b"))
+}
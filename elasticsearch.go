@@ -0,0 +1,240 @@
+package logrustash
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// elasticsearchIndexLayout matches the time layouts of the index templates, e.g. "{2006.01.02}".
+var elasticsearchIndexLayout = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// ElasticsearchBulkFormatter formats the entries as the action and the document of a request
+// to the bulk API of Elasticsearch or OpenSearch, to be sent by NewElasticsearchWriter
+// without going through Logstash.
+type ElasticsearchBulkFormatter struct {
+	// Formatter formats the documents, DefaultFormatter by default.
+	Formatter logrus.Formatter
+	// Index is the index template of the documents, the time layouts between braces being
+	// replaced by the time of the entry in UTC, e.g. "logs-{2006.01.02}" for daily indices.
+	Index string
+	// IndexFunc, if set, returns the index of the entry instead of Index.
+	IndexFunc func(*logrus.Entry) string
+	// Action is the bulk action, "index" by default, "create" is required by data streams.
+	Action string
+}
+
+// Format formats the entry as a bulk action followed by the document.
+func (f ElasticsearchBulkFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	formatter := f.Formatter
+	if formatter == nil {
+		formatter = DefaultFormatter(logrus.Fields{})
+	}
+
+	doc, err := formatter.Format(e)
+	if err != nil {
+		return nil, err
+	}
+
+	index := f.indexOf(e)
+	if index == "" {
+		return nil, fmt.Errorf("no elasticsearch index for the entry")
+	}
+
+	action := f.Action
+	if action == "" {
+		action = "index"
+	}
+
+	meta, err := json.Marshal(map[string]map[string]string{action: {"_index": index}})
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.Grow(len(meta) + len(doc) + 2)
+	b.Write(meta)
+	b.WriteByte('\n')
+	// the bulk API requires every document on a single line
+	b.Write(bytes.TrimSpace(doc))
+	b.WriteByte('\n')
+
+	return b.Bytes(), nil
+}
+
+// indexOf returns the index of the entry.
+func (f ElasticsearchBulkFormatter) indexOf(e *logrus.Entry) string {
+	if f.IndexFunc != nil {
+		return f.IndexFunc(e)
+	}
+
+	t := e.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	return elasticsearchIndexLayout.ReplaceAllStringFunc(f.Index, func(layout string) string {
+		return t.UTC().Format(strings.Trim(layout, "{}"))
+	})
+}
+
+// BulkItemError is the failure of a document of a bulk request.
+type BulkItemError struct {
+	Status int
+	Type   string
+	Reason string
+	// Document is the action and the document which failed.
+	Document []byte
+}
+
+// BulkError is returned by the writer of NewElasticsearchWriter when some of the documents
+// of a bulk request failed, the others were indexed.
+type BulkError struct {
+	Items []BulkItemError
+}
+
+func (e *BulkError) Error() string {
+	first := e.Items[0]
+	return fmt.Sprintf("%d documents of the bulk request failed, first: %d %s: %s", len(e.Items), first.Status, first.Type, first.Reason)
+}
+
+// bulkFailures writes the documents which failed of the BulkError `err`, if it is one, to the dead-letter
+// writer and returns their number. The other documents of the bulk request were indexed, so it is not
+// to be retried: only the documents which failed are given up on.
+func (h *Hook) bulkFailures(err error) int {
+	var bulkErr *BulkError
+	if !errors.As(err, &bulkErr) {
+		return 0
+	}
+
+	for _, item := range bulkErr.Items {
+		h.deadLetter(nil, item.Document, fmt.Errorf("%d %s: %s", item.Status, item.Type, item.Reason))
+	}
+
+	return len(bulkErr.Items)
+}
+
+// ElasticsearchWriter sends the bulk requests formatted by ElasticsearchBulkFormatter,
+// retrying the documents rejected with 429 Too Many Requests.
+type ElasticsearchWriter struct {
+	*HTTPWriter
+}
+
+// NewElasticsearchWriter returns a writer sending the entries formatted by ElasticsearchBulkFormatter
+// to the bulk API of the Elasticsearch or OpenSearch cluster at `endpoint`, e.g. "https://es:9200".
+// The requests, or the documents of a request, rejected with 429 Too Many Requests are retried
+// HTTPOptions.MaxRetries times, the documents which failed otherwise are reported by a BulkError.
+// Since the other documents of the write were indexed, the hook does not keep it for retry, it writes
+// the documents which failed to HookOptions.DeadLetter instead.
+func NewElasticsearchWriter(endpoint string, opts HTTPOptions) (*ElasticsearchWriter, error) {
+	opts.ContentType = "application/x-ndjson"
+
+	w, err := NewHTTPWriter(strings.TrimSuffix(endpoint, "/")+"/_bulk", opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ElasticsearchWriter{HTTPWriter: w}, nil
+}
+
+type bulkResponse struct {
+	Errors bool                          `json:"errors"`
+	Items  []map[string]bulkResponseItem `json:"items"`
+}
+
+type bulkResponseItem struct {
+	Status int `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// Write sends the bulk request `data`.
+func (w *ElasticsearchWriter) Write(data []byte) (int, error) {
+	ctx, cancel := w.writeContext()
+	defer cancel()
+
+	var failed []BulkItemError
+	pending := data
+	for attempt := 0; ; attempt++ {
+		body, err := w.postWithRetries(ctx, pending)
+		if err != nil {
+			return 0, err
+		}
+
+		rejected, itemsFailed, err := parseBulkResponse(body, pending)
+		if err != nil {
+			return 0, err
+		}
+		failed = append(failed, itemsFailed...)
+
+		if len(rejected) == 0 {
+			break
+		}
+		if attempt >= w.opts.MaxRetries || ctx.Err() != nil {
+			for _, doc := range rejected {
+				failed = append(failed, BulkItemError{Status: http.StatusTooManyRequests, Type: "rejected", Reason: "too many requests", Document: doc})
+			}
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(w.backoff()(attempt + 1)):
+		}
+		pending = bytes.Join(rejected, nil)
+	}
+
+	if len(failed) > 0 {
+		return 0, &BulkError{Items: failed}
+	}
+
+	return len(data), nil
+}
+
+// parseBulkResponse returns the documents of the bulk request `data` rejected with 429 Too Many Requests
+// and the documents which failed otherwise according to the response `body`.
+func parseBulkResponse(body, data []byte) (rejected [][]byte, failed []BulkItemError, err error) {
+	var resp bulkResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, nil, fmt.Errorf("invalid bulk response: %w", err)
+	}
+	if !resp.Errors {
+		return nil, nil, nil
+	}
+
+	// every document is an action line followed by the document line
+	lines := bytes.SplitAfter(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+	for i, item := range resp.Items {
+		var doc []byte
+		if 2*i+1 < len(lines) {
+			doc = append(append([]byte(nil), lines[2*i]...), lines[2*i+1]...)
+			if !bytes.HasSuffix(doc, []byte("\n")) {
+				doc = append(doc, '\n')
+			}
+		}
+
+		for _, result := range item {
+			switch {
+			case result.Status == http.StatusTooManyRequests:
+				rejected = append(rejected, doc)
+			case result.Status >= 300:
+				itemErr := BulkItemError{Status: result.Status, Document: doc}
+				if result.Error != nil {
+					itemErr.Type, itemErr.Reason = result.Error.Type, result.Error.Reason
+				}
+				failed = append(failed, itemErr)
+			}
+		}
+	}
+
+	return rejected, failed, nil
+}
@@ -0,0 +1,180 @@
+package logrustash
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestElasticsearchBulkFormatter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	entry := &logrus.Entry{Message: "msg1\nwith lines", Time: time.Date(2024, 1, 2, 23, 0, 0, 0, time.FixedZone("UTC-2", -2*3600)), Data: logrus.Fields{}}
+
+	res, err := ElasticsearchBulkFormatter{Index: "logs-{2006.01.02}"}.Format(entry)
+	require.NoError(err)
+
+	lines := strings.Split(strings.TrimSuffix(string(res), "\n"), "\n")
+	require.Len(lines, 2)
+	assert.JSONEq(`{"index":{"_index":"logs-2024.01.03"}}`, lines[0])
+
+	var doc map[string]interface{}
+	require.NoError(json.Unmarshal([]byte(lines[1]), &doc))
+	assert.Equal("msg1\nwith lines", doc["message"])
+
+	res, err = ElasticsearchBulkFormatter{
+		Action:    "create",
+		IndexFunc: func(*logrus.Entry) string { return "logs-app" },
+	}.Format(entry)
+	require.NoError(err)
+	assert.True(strings.HasPrefix(string(res), `{"create":{"_index":"logs-app"}}`+"\n"))
+
+	_, err = ElasticsearchBulkFormatter{}.Format(entry)
+	assert.Error(err)
+}
+
+func TestElasticsearchWriter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var mu sync.Mutex
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/_bulk", r.URL.Path)
+		assert.Equal("application/x-ndjson", r.Header.Get("Content-Type"))
+
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, string(body))
+		attempt := len(requests)
+		mu.Unlock()
+
+		// the first document is rejected once, the second one is invalid
+		var items []string
+		for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+			switch {
+			case strings.HasPrefix(line, `{"index"`):
+				continue
+			case strings.Contains(line, "rejected") && attempt == 1:
+				items = append(items, `{"index":{"status":429,"error":{"type":"es_rejected_execution_exception","reason":"queue full"}}}`)
+			case strings.Contains(line, "invalid"):
+				items = append(items, `{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}`)
+			default:
+				items = append(items, `{"index":{"status":201}}`)
+			}
+		}
+
+		fmt.Fprintf(w, `{"errors":%t,"items":[%s]}`, strings.Contains(strings.Join(items, ""), "error"), strings.Join(items, ","))
+	}))
+	defer ts.Close()
+
+	w, err := NewElasticsearchWriter(ts.URL, HTTPOptions{MaxRetries: 1, Backoff: ConstantBackoff(time.Millisecond)})
+	require.NoError(err)
+
+	formatter := ElasticsearchBulkFormatter{Formatter: &logrus.JSONFormatter{}, Index: "logs"}
+
+	var batch bytes.Buffer
+	for _, msg := range []string{"rejected", "indexed"} {
+		doc, err := formatter.Format(&logrus.Entry{Message: msg, Data: logrus.Fields{}})
+		require.NoError(err)
+		batch.Write(doc)
+	}
+
+	n, err := w.Write(batch.Bytes())
+	require.NoError(err)
+	assert.Equal(batch.Len(), n)
+
+	mu.Lock()
+	require.Len(requests, 2)
+	assert.Contains(requests[1], "rejected", "only the rejected document is retried")
+	assert.NotContains(requests[1], "indexed")
+	mu.Unlock()
+
+	doc, err := formatter.Format(&logrus.Entry{Message: "invalid", Data: logrus.Fields{}})
+	require.NoError(err)
+
+	_, err = w.Write(doc)
+
+	var bulkErr *BulkError
+	require.ErrorAs(err, &bulkErr)
+	require.Len(bulkErr.Items, 1)
+	assert.Equal(http.StatusBadRequest, bulkErr.Items[0].Status)
+	assert.Equal("mapper_parsing_exception", bulkErr.Items[0].Type)
+	assert.Equal(doc, bulkErr.Items[0].Document)
+}
+
+func TestElasticsearchWriterPartialFailure(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var mu sync.Mutex
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, string(body))
+		mu.Unlock()
+
+		var items []string
+		for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+			switch {
+			case strings.HasPrefix(line, `{"index"`):
+				continue
+			case strings.Contains(line, "invalid"):
+				items = append(items, `{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}`)
+			default:
+				items = append(items, `{"index":{"status":201}}`)
+			}
+		}
+
+		fmt.Fprintf(w, `{"errors":%t,"items":[%s]}`, strings.Contains(strings.Join(items, ""), "error"), strings.Join(items, ","))
+	}))
+	defer ts.Close()
+
+	w, err := NewElasticsearchWriter(ts.URL, HTTPOptions{})
+	require.NoError(err)
+
+	deadLetters := &safeBuffer{}
+	hook, err := NewWithWriter(w,
+		WithFormatter(ElasticsearchBulkFormatter{Formatter: &logrus.JSONFormatter{}, Index: "logs"}),
+		WithBatching(2, time.Hour),
+		WithRetryBuffer(10),
+		WithDeadLetter(deadLetters),
+		WithSynchronous(),
+	)
+	require.NoError(err)
+
+	for _, msg := range []string{"invalid", "indexed", "next"} {
+		require.NoError(hook.Fire(&logrus.Entry{Message: msg, Data: logrus.Fields{}}))
+	}
+	require.NoError(hook.(*Hook).Close())
+
+	// the batch partially indexed is not sent again, the document which failed is given up on
+	mu.Lock()
+	require.Len(requests, 2)
+	assert.NotContains(requests[1], "invalid")
+	assert.NotContains(requests[1], "indexed")
+	assert.Contains(requests[1], "next")
+	mu.Unlock()
+
+	letters := readDeadLetters(t, bytes.NewBufferString(deadLetters.String()))
+	require.Len(letters, 1)
+	assert.Contains(string(letters[0].Payload), `"msg":"invalid"`)
+	assert.Equal("400 mapper_parsing_exception: failed to parse", letters[0].Reason)
+
+	stats := hook.(*Hook).Stats()
+	assert.Equal(uint64(2), stats.Sent)
+	assert.Equal(uint64(1), stats.Dropped)
+}
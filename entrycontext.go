@@ -0,0 +1,48 @@
+package logrustash
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// entryDone returns the done channel of the entry's context if HookOptions.ContextAwareFire
+// is set, nil otherwise.
+func (h *Hook) entryDone(e *logrus.Entry) <-chan struct{} {
+	if !h.opts.ContextAwareFire || e.Context == nil {
+		return nil
+	}
+
+	return e.Context.Done()
+}
+
+// fireWithin sends the entry, returning early with the error of its context once `done`
+// is closed, the entry keeps being sent in the background then and its delivery error
+// is reported to the error handler.
+func (h *Hook) fireWithin(e *logrus.Entry, done <-chan struct{}) error {
+	// the entry may be sent after Fire returned while logrus re-uses it once the hooks are fired
+	e = cloneEntry(e)
+
+	result := make(chan error, 1)
+	h.sending.Add(1)
+	go func() {
+		defer h.sending.Done()
+
+		err := h.fire(e)
+		if err != nil {
+			h.stats.dropped.Add(1)
+		}
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-done:
+		go func() {
+			if err := <-result; err != nil {
+				h.reportError(err, e)
+			}
+		}()
+
+		return e.Context.Err()
+	}
+}
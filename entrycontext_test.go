@@ -0,0 +1,78 @@
+package logrustash
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextAwareFireFullQueue(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	w := &gatedWriter{release: make(chan struct{})}
+	hook, err := NewWithWriter(w,
+		WithFormatter(&logrus.JSONFormatter{DisableTimestamp: true}),
+		WithBufferSize(2),
+		WithContextAwareFire(),
+	)
+	require.NoError(err)
+
+	fillQueue(t, hook.(*Hook), 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// the queue is full, Fire gives up once the deadline of the entry is exceeded
+	err = hook.Fire(&logrus.Entry{Message: "request scoped", Context: ctx, Data: logrus.Fields{}})
+	assert.ErrorIs(err, context.DeadlineExceeded)
+	assert.Equal(uint64(1), hook.(*Hook).Stats().Dropped)
+
+	// an entry whose context is done is still queued if there is room
+	close(w.release)
+	require.Eventually(func() bool { return len(hook.(*Hook).logrusEntryFireChannel) == 0 }, time.Second, time.Millisecond)
+	require.NoError(hook.Fire(&logrus.Entry{Message: "late", Context: ctx, Data: logrus.Fields{}}))
+
+	require.NoError(hook.(*Hook).Close())
+	assert.NotContains(w.String(), "request scoped")
+	assert.Contains(w.String(), "late")
+}
+
+func TestContextAwareFireSynchronous(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	w := &gatedWriter{release: make(chan struct{})}
+	hook, err := NewWithWriter(w,
+		WithFormatter(&logrus.JSONFormatter{DisableTimestamp: true}),
+		WithSynchronous(),
+		WithContextAwareFire(),
+	)
+	require.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	err = hook.Fire(&logrus.Entry{Message: "slow write", Context: ctx, Data: logrus.Fields{}})
+	assert.ErrorIs(err, context.Canceled)
+	assert.Less(time.Since(start), time.Second)
+
+	// the entry keeps being sent in the background, Close waits for it
+	close(w.release)
+	require.NoError(hook.(*Hook).Close())
+	assert.Contains(w.String(), "slow write")
+
+	// without a context, Fire waits for the entry to be sent
+	buffer := &safeBuffer{}
+	hook, err = NewWithWriter(buffer, WithSynchronous(), WithContextAwareFire())
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "no context", Data: logrus.Fields{}}))
+	assert.Contains(buffer.String(), "no context")
+}
@@ -0,0 +1,298 @@
+package logrustash
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// EnvPrefix is the prefix of the environment variables read by NewFromEnv,
+// e.g. LOGSTASH_HOOK_ADDR for the "addr" setting.
+const EnvPrefix = "LOGSTASH_HOOK_"
+
+// settings are the settings of a hook which can be configured by strings, e.g. environment variables.
+type settings struct {
+	protocol string
+	addrs    []string
+	opts     []Option
+
+	tls           bool
+	tlsCAFile     string
+	tlsCertFile   string
+	tlsKeyFile    string
+	tlsServerName string
+	tlsInsecure   bool
+}
+
+// setting parses `value` into the settings `s`.
+type setting func(s *settings, value string) error
+
+// settingParsers are the settings which can be configured by strings, by name.
+var settingParsers = map[string]setting{
+	"protocol": func(s *settings, value string) error {
+		s.protocol = value
+		return nil
+	},
+	"addr": func(s *settings, value string) error {
+		s.addrs = nil
+		for _, addr := range strings.Split(value, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				s.addrs = append(s.addrs, addr)
+			}
+		}
+		return nil
+	},
+	"level": func(s *settings, value string) error {
+		level, err := logrus.ParseLevel(value)
+		if err != nil {
+			return err
+		}
+		s.opts = append(s.opts, WithMinLevel(level))
+		return nil
+	},
+	"buffer_size":            intSetting(func(o *options, n int) { o.FireChannelBufferSize = n }),
+	"overflow_policy":        overflowPolicySetting,
+	"synchronous":            boolSetting(func(o *options, b bool) { o.Synchronous = b }),
+	"lazy_connect":           boolSetting(func(o *options, b bool) { o.LazyConnect = b }),
+	"workers":                intSetting(func(o *options, n int) { o.Workers = n }),
+	"batch_size":             intSetting(func(o *options, n int) { o.MaxBatchSize = n }),
+	"flush_interval":         durationSetting(func(o *options, d time.Duration) { o.FlushInterval = d }),
+	"compression_level":      intSetting(func(o *options, n int) { o.Compress, o.CompressionLevel = true, &n }),
+	"retry_buffer_size":      intSetting(func(o *options, n int) { o.RetryBufferSize = n }),
+	"queue_dir":              stringSetting(func(o *options, v string) { o.QueueDir = v }),
+	"queue_max_bytes":        intSetting(func(o *options, n int) { o.QueueMaxBytes = int64(n) }),
+	"max_message_bytes":      intSetting(func(o *options, n int) { o.MaxMessageBytes = n }),
+	"max_entries_per_second": intSetting(func(o *options, n int) { o.MaxEntriesPerSecond = n }),
+	"sample_rate":            floatSetting(func(o *options, f float64) { o.SampleRate = f }),
+	"keepalive":              durationSetting(func(o *options, d time.Duration) { o.KeepAlive, o.KeepAlivePeriod = true, d }),
+	"dial_timeout":           durationSetting(func(o *options, d time.Duration) { o.DialTimeout = d }),
+	"write_timeout":          durationSetting(func(o *options, d time.Duration) { o.WriteTimeout = d }),
+	"reconnect_timeout":      durationSetting(func(o *options, d time.Duration) { o.ReconnectTimeout = d }),
+	"max_reconnect_attempts": intSetting(func(o *options, n int) { o.MaxReconnectAttempts = n }),
+	"failback_interval":      durationSetting(func(o *options, d time.Duration) { o.FailbackInterval = d }),
+	"tls": func(s *settings, value string) (err error) {
+		s.tls, err = strconv.ParseBool(value)
+		return err
+	},
+	"tls_ca_file": func(s *settings, value string) error {
+		s.tlsCAFile = value
+		return nil
+	},
+	"tls_cert_file": func(s *settings, value string) error {
+		s.tlsCertFile = value
+		return nil
+	},
+	"tls_key_file": func(s *settings, value string) error {
+		s.tlsKeyFile = value
+		return nil
+	},
+	"tls_server_name": func(s *settings, value string) error {
+		s.tlsServerName = value
+		return nil
+	},
+	"tls_insecure_skip_verify": func(s *settings, value string) (err error) {
+		s.tlsInsecure, err = strconv.ParseBool(value)
+		return err
+	},
+}
+
+// overflowPolicies are the overflow policies by name.
+var overflowPolicies = map[string]OverflowPolicy{
+	"block":       OverflowBlock,
+	"drop_newest": OverflowDropNewest,
+	"drop_oldest": OverflowDropOldest,
+}
+
+func overflowPolicySetting(s *settings, value string) error {
+	policy, ok := overflowPolicies[strings.ToLower(value)]
+	if !ok {
+		return fmt.Errorf("unknown overflow policy %q", value)
+	}
+	s.opts = append(s.opts, WithOverflowPolicy(policy))
+	return nil
+}
+
+func stringSetting(set func(o *options, v string)) setting {
+	return func(s *settings, value string) error {
+		s.opts = append(s.opts, func(o *options) { set(o, value) })
+		return nil
+	}
+}
+
+func intSetting(set func(o *options, n int)) setting {
+	return func(s *settings, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return fmt.Errorf("negative value %d", n)
+		}
+		s.opts = append(s.opts, func(o *options) { set(o, n) })
+		return nil
+	}
+}
+
+func floatSetting(set func(o *options, f float64)) setting {
+	return func(s *settings, value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		s.opts = append(s.opts, func(o *options) { set(o, f) })
+		return nil
+	}
+}
+
+func boolSetting(set func(o *options, b bool)) setting {
+	return func(s *settings, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		s.opts = append(s.opts, func(o *options) { set(o, b) })
+		return nil
+	}
+}
+
+func durationSetting(set func(o *options, d time.Duration)) setting {
+	return func(s *settings, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		if d < 0 {
+			return fmt.Errorf("negative duration %s", d)
+		}
+		s.opts = append(s.opts, func(o *options) { set(o, d) })
+		return nil
+	}
+}
+
+// tlsConfig returns the TLS configuration of the settings, nil if TLS is not enabled.
+// TLS is enabled by the "tls" setting or by any of the other TLS settings.
+func (s *settings) tlsConfig() (*tls.Config, error) {
+	if !s.tls && s.tlsCAFile == "" && s.tlsCertFile == "" && s.tlsKeyFile == "" &&
+		s.tlsServerName == "" && !s.tlsInsecure {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		ServerName:         s.tlsServerName,
+		InsecureSkipVerify: s.tlsInsecure,
+	}
+
+	if s.tlsCAFile != "" {
+		pem, err := os.ReadFile(s.tlsCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", s.tlsCAFile)
+		}
+	}
+
+	if s.tlsCertFile != "" || s.tlsKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.tlsCertFile, s.tlsKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// options returns the options of the settings, followed by `opts`.
+func (s *settings) options(opts []Option) ([]Option, error) {
+	config, err := s.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	all := append([]Option(nil), s.opts...)
+	if config != nil {
+		all = append(all, WithTLS(config))
+	}
+	if len(s.addrs) > 1 {
+		all = append(all, WithFailover(s.addrs[1:]...))
+	}
+
+	return append(all, opts...), nil
+}
+
+// settingsFromEnv reads the settings from the environment variables prefixed by EnvPrefix,
+// the errors of all the invalid variables are reported at once.
+func settingsFromEnv() (*settings, error) {
+	s := &settings{protocol: "tcp"}
+
+	names := make([]string, 0, len(settingParsers))
+	for name := range settingParsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		env := EnvPrefix + strings.ToUpper(name)
+		value, ok := os.LookupEnv(env)
+		if !ok || value == "" {
+			continue
+		}
+
+		if err := settingParsers[name](s, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", env, err))
+		}
+	}
+
+	return s, errors.Join(errs...)
+}
+
+// NewFromEnv returns a new logrus.Hook for Logstash configured by the environment variables,
+// so that it can be reconfigured without changing the code:
+//
+//	LOGSTASH_HOOK_ADDR           the address of Logstash, required, e.g. "logstash:5000",
+//	                             the other comma separated addresses are failed over to
+//	LOGSTASH_HOOK_PROTOCOL       "tcp" by default, "udp", "unix"...
+//	LOGSTASH_HOOK_LEVEL          the minimum level of the entries sent, e.g. "warning"
+//	LOGSTASH_HOOK_BUFFER_SIZE    see HookOptions.FireChannelBufferSize
+//	LOGSTASH_HOOK_TLS            "true" to connect with TLS, also enabled by the other TLS variables
+//	LOGSTASH_HOOK_TLS_CA_FILE    the PEM file of the certificate authorities Logstash is verified with
+//	LOGSTASH_HOOK_TLS_CERT_FILE  the PEM files of the client certificate
+//	LOGSTASH_HOOK_TLS_KEY_FILE   and of its key
+//
+// as well as LOGSTASH_HOOK_OVERFLOW_POLICY ("block", "drop_newest" or "drop_oldest"), _SYNCHRONOUS,
+// _LAZY_CONNECT, _WORKERS, _BATCH_SIZE, _FLUSH_INTERVAL, _COMPRESSION_LEVEL, _RETRY_BUFFER_SIZE,
+// _QUEUE_DIR, _QUEUE_MAX_BYTES, _MAX_MESSAGE_BYTES, _MAX_ENTRIES_PER_SECOND, _SAMPLE_RATE,
+// _KEEPALIVE, _DIAL_TIMEOUT, _WRITE_TIMEOUT, _RECONNECT_TIMEOUT, _MAX_RECONNECT_ATTEMPTS,
+// _FAILBACK_INTERVAL, _TLS_SERVER_NAME and _TLS_INSECURE_SKIP_VERIFY. The durations are parsed
+// by time.ParseDuration, e.g. "5s", and the booleans by strconv.ParseBool.
+//
+// The settings which can not be given as strings, e.g. the formatter, are given by `opts`,
+// which are applied after the ones of the environment variables.
+func NewFromEnv(opts ...Option) (logrus.Hook, error) {
+	s, err := settingsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if len(s.addrs) == 0 {
+		return nil, fmt.Errorf("%sADDR must be set", EnvPrefix)
+	}
+
+	all, err := s.options(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithOptions(s.protocol, s.addrs[0], all...)
+}
@@ -0,0 +1,103 @@
+package logrustash
+
+import (
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFromEnv(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	lines, _ := acceptLines(t, l)
+
+	t.Setenv("LOGSTASH_HOOK_ADDR", l.Addr().String()+", 127.0.0.1:1")
+	t.Setenv("LOGSTASH_HOOK_LEVEL", "warning")
+	t.Setenv("LOGSTASH_HOOK_BUFFER_SIZE", "42")
+	t.Setenv("LOGSTASH_HOOK_OVERFLOW_POLICY", "drop_newest")
+	t.Setenv("LOGSTASH_HOOK_WRITE_TIMEOUT", "3s")
+	t.Setenv("LOGSTASH_HOOK_SAMPLE_RATE", "")
+
+	hook, err := NewFromEnv(WithFormatter(&logrus.JSONFormatter{}), WithBufferSize(7))
+	require.NoError(err)
+	h := hook.(*Hook)
+	defer h.Close()
+
+	assert.Equal([]string{l.Addr().String(), "127.0.0.1:1"}, h.addrs)
+	assert.Equal([]logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel}, h.Levels())
+	assert.Equal(OverflowDropNewest, h.opts.OverflowPolicy)
+	assert.Equal(3*time.Second, h.opts.WriteTimeout)
+	assert.Zero(h.opts.SampleRate, "empty variables are ignored")
+	// the options given override the environment variables
+	assert.Equal(7, h.opts.FireChannelBufferSize)
+
+	require.NoError(h.Fire(&logrus.Entry{Message: "from env", Level: logrus.WarnLevel, Data: logrus.Fields{}}))
+
+	select {
+	case line := <-lines:
+		assert.Contains(line, `"msg":"from env"`)
+	case <-time.After(time.Second):
+		t.Fatal("entry not received")
+	}
+}
+
+func TestNewFromEnvErrors(t *testing.T) {
+	_, err := NewFromEnv()
+	assert.EqualError(t, err, "LOGSTASH_HOOK_ADDR must be set")
+
+	t.Setenv("LOGSTASH_HOOK_ADDR", "127.0.0.1:1")
+	t.Setenv("LOGSTASH_HOOK_LEVEL", "loud")
+	t.Setenv("LOGSTASH_HOOK_DIAL_TIMEOUT", "soon")
+	t.Setenv("LOGSTASH_HOOK_WORKERS", "-1")
+
+	// every invalid variable is reported
+	_, err = NewFromEnv()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "LOGSTASH_HOOK_LEVEL")
+	assert.Contains(t, err.Error(), "LOGSTASH_HOOK_DIAL_TIMEOUT")
+	assert.Contains(t, err.Error(), "LOGSTASH_HOOK_WORKERS")
+}
+
+func TestNewFromEnvTLS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// borrow the certificate of a TLS test server, it is valid for 127.0.0.1
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0o600))
+
+	t.Setenv("LOGSTASH_HOOK_ADDR", "127.0.0.1:1")
+	t.Setenv("LOGSTASH_HOOK_LAZY_CONNECT", "true")
+	t.Setenv("LOGSTASH_HOOK_TLS_CA_FILE", ca)
+	t.Setenv("LOGSTASH_HOOK_TLS_SERVER_NAME", "logstash.example.com")
+
+	hook, err := NewFromEnv()
+	require.NoError(err)
+	h := hook.(*Hook)
+	defer h.Close()
+
+	require.NotNil(h.opts.TLSConfig)
+	assert.Equal("logstash.example.com", h.opts.TLSConfig.ServerName)
+	assert.NotNil(h.opts.TLSConfig.RootCAs)
+
+	t.Setenv("LOGSTASH_HOOK_TLS_CA_FILE", filepath.Join(t.TempDir(), "missing.pem"))
+	_, err = NewFromEnv()
+	assert.Error(err)
+}
@@ -0,0 +1,79 @@
+package logrustash
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// EnvironmentKey is the field the detected environment is stored in.
+const EnvironmentKey = "environment"
+
+// EnvironmentSource detects the environment the process is running in.
+// It returns false if it can not tell.
+type EnvironmentSource func() (string, bool)
+
+// EnvVarEnvironment returns an EnvironmentSource which reads the environment
+// from the environment variable `name`.
+func EnvVarEnvironment(name string) EnvironmentSource {
+	return func() (string, bool) {
+		env := os.Getenv(name)
+		return env, env != ""
+	}
+}
+
+// KubernetesEnvironment returns an EnvironmentSource which reports `env`
+// when the process is running in a Kubernetes pod.
+func KubernetesEnvironment(env string) EnvironmentSource {
+	return func() (string, bool) {
+		_, ok := os.LookupEnv("KUBERNETES_SERVICE_HOST")
+		return env, ok
+	}
+}
+
+// DefaultEnvironmentSources is the chain of sources used by DetectEnvironment
+// when no sources are given: the DEPLOY_ENV, ENVIRONMENT and APP_ENV variables,
+// then "kubernetes" when running in a Kubernetes pod.
+var DefaultEnvironmentSources = []EnvironmentSource{
+	EnvVarEnvironment("DEPLOY_ENV"),
+	EnvVarEnvironment("ENVIRONMENT"),
+	EnvVarEnvironment("APP_ENV"),
+	KubernetesEnvironment("kubernetes"),
+}
+
+// DetectEnvironment returns the environment reported by the first of `sources`
+// able to tell, or an empty string if none of them can.
+// DefaultEnvironmentSources are used if no sources are given.
+func DetectEnvironment(sources ...EnvironmentSource) string {
+	if len(sources) == 0 {
+		sources = DefaultEnvironmentSources
+	}
+
+	for _, source := range sources {
+		if env, ok := source(); ok {
+			return env
+		}
+	}
+
+	return ""
+}
+
+// EnvironmentFields returns a copy of `fields` with the "environment" field detected by DetectEnvironment,
+// so that it can be passed to `DefaultFormatter`. `fields` is not modified.
+// An "environment" field already set in `fields` is kept as is, nothing is added if
+// the environment can not be detected.
+func EnvironmentFields(fields logrus.Fields, sources ...EnvironmentSource) logrus.Fields {
+	copied := make(logrus.Fields, len(fields)+1)
+	for k, v := range fields {
+		copied[k] = v
+	}
+	if _, ok := copied[EnvironmentKey]; ok {
+		return copied
+	}
+
+	if env := DetectEnvironment(sources...); env != "" {
+		copied[EnvironmentKey] = env
+	}
+
+	return copied
+}
@@ -0,0 +1,44 @@
+package logrustash
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectEnvironment(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Setenv("DEPLOY_ENV", "")
+	t.Setenv("ENVIRONMENT", "")
+	t.Setenv("APP_ENV", "")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+
+	assert.Equal("kubernetes", DetectEnvironment())
+
+	t.Setenv("APP_ENV", "staging")
+	assert.Equal("staging", DetectEnvironment())
+
+	t.Setenv("DEPLOY_ENV", "production")
+	assert.Equal("production", DetectEnvironment())
+
+	assert.Equal("", DetectEnvironment(EnvVarEnvironment("UNSET_ENVIRONMENT_VARIABLE")))
+}
+
+func TestEnvironmentFields(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Setenv("DEPLOY_ENV", "production")
+
+	base := logrus.Fields{"type": "log"}
+	fields := EnvironmentFields(base)
+	assert.Equal(logrus.Fields{"type": "log", "environment": "production"}, fields)
+	assert.Equal(logrus.Fields{"type": "log"}, base, "the fields given must not be modified")
+
+	fields = EnvironmentFields(logrus.Fields{"environment": "dev"})
+	assert.Equal(logrus.Fields{"environment": "dev"}, fields, "explicit environment must not be overridden")
+
+	fields = EnvironmentFields(nil, EnvVarEnvironment("UNSET_ENVIRONMENT_VARIABLE"))
+	assert.Equal(logrus.Fields{}, fields)
+}
@@ -0,0 +1,78 @@
+package logrustash
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The suffixes of the keys of the fields LogstashFormatter.StructuredErrors turns an error into,
+// e.g. "error.message" for the logrus.ErrorKey field.
+const (
+	// FieldKeySuffixErrorMessage is the suffix of the message of the error.
+	FieldKeySuffixErrorMessage = ".message"
+	// FieldKeySuffixErrorType is the suffix of the Go type of the error, e.g. "*fs.PathError".
+	FieldKeySuffixErrorType = ".type"
+	// FieldKeySuffixErrorCauses is the suffix of the messages of the errors it wraps, outermost first.
+	FieldKeySuffixErrorCauses = ".causes"
+)
+
+// maxErrorCauses is the maximum number of causes of an error which are formatted.
+const maxErrorCauses = 32
+
+// errorFields returns the fields the error `err` of the field `key` is formatted as.
+func (f LogstashFormatter) errorFields(key string, err error) logrus.Fields {
+	fields := logrus.Fields{
+		key + FieldKeySuffixErrorMessage: truncate(err.Error(), f.MaxFieldValueBytes),
+		key + FieldKeySuffixErrorType:    fmt.Sprintf("%T", err),
+	}
+
+	if causes := errorCauses(err); len(causes) > 0 {
+		for i, cause := range causes {
+			causes[i] = truncate(cause, f.MaxFieldValueBytes)
+		}
+		fields[key+FieldKeySuffixErrorCauses] = causes
+	}
+
+	return fields
+}
+
+// errorCauses returns the messages of the errors `err` wraps, as unwrapped by errors.Unwrap
+// or by errors.Join, depth first.
+func errorCauses(err error) []string {
+	var causes []string
+
+	var walk func(err error)
+	walk = func(err error) {
+		var wrapped []error
+		switch err := err.(type) {
+		case interface{ Unwrap() error }:
+			wrapped = []error{err.Unwrap()}
+		case interface{ Unwrap() []error }:
+			wrapped = err.Unwrap()
+		}
+
+		for _, cause := range wrapped {
+			if isNilError(cause) || len(causes) >= maxErrorCauses {
+				continue
+			}
+
+			causes = append(causes, cause.Error())
+			walk(cause)
+		}
+	}
+	walk(err)
+
+	return causes
+}
+
+// isNilError reports whether `err` is nil or a nil pointer, whose Error method may panic.
+func isNilError(err error) bool {
+	if err == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(err)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
@@ -0,0 +1,71 @@
+package logrustash
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nilPointerError struct{}
+
+func (*nilPointerError) Error() string { return "nil pointer error" }
+
+func TestStructuredErrors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	f := LogstashFormatter{Formatter: &logrus.JSONFormatter{}, StructuredErrors: true}
+
+	pathErr := &fs.PathError{Op: "open", Path: "/etc/app.yaml", Err: fs.ErrNotExist}
+	err := fmt.Errorf("load config: %w", errors.Join(pathErr, io.EOF))
+
+	var nilErr *nilPointerError
+	b, ferr := f.Format(&logrus.Entry{Message: "msg", Data: logrus.Fields{
+		logrus.ErrorKey: err,
+		"cleanup":       io.ErrClosedPipe,
+		"nil":           nilErr,
+		"user":          "jane",
+	}})
+	require.NoError(ferr)
+
+	var doc map[string]interface{}
+	require.NoError(json.Unmarshal(b, &doc))
+
+	assert.Equal(err.Error(), doc["error.message"])
+	assert.Equal("*fmt.wrapError", doc["error.type"])
+	assert.Equal([]interface{}{
+		errors.Join(pathErr, io.EOF).Error(),
+		pathErr.Error(),
+		fs.ErrNotExist.Error(),
+		io.EOF.Error(),
+	}, doc["error.causes"])
+
+	assert.Equal(io.ErrClosedPipe.Error(), doc["cleanup.message"])
+	assert.Equal("*errors.errorString", doc["cleanup.type"])
+	assert.NotContains(doc, "cleanup.causes")
+
+	assert.NotContains(doc["fields"], "error=")
+	assert.NotContains(doc["fields"], "cleanup=")
+	assert.Contains(doc["fields"], "user=jane")
+	// a nil pointer is formatted as is
+	assert.Contains(doc["fields"], "nil=")
+}
+
+func TestStructuredErrorsDisabled(t *testing.T) {
+	f := LogstashFormatter{Formatter: &logrus.JSONFormatter{}}
+
+	b, err := f.Format(&logrus.Entry{Message: "msg", Data: logrus.Fields{logrus.ErrorKey: io.EOF}})
+	require.NoError(t, err)
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &doc))
+	assert.Equal(t, "error=EOF", doc["fields"])
+	assert.NotContains(t, doc, "error.message")
+}
@@ -0,0 +1,66 @@
+package logrustash
+
+import (
+	"expvar"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// ExpvarPrefix is the prefix of the names the statistics of the hooks are published under by PublishExpvar.
+const ExpvarPrefix = "logstash_hook."
+
+// expvarMu serializes the checks of the names published by PublishExpvar with their publication.
+var expvarMu sync.Mutex
+
+// PublishExpvar publishes the statistics of the hook with expvar as ExpvarPrefix followed by `name`,
+// served at /debug/vars along with the other variables. It fails if the name is already published,
+// a hook can not be unpublished.
+func PublishExpvar(name string, h *Hook) error {
+	// expvar.Publish panics on a name already published
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+
+	name = ExpvarPrefix + name
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("expvar %q already published", name)
+	}
+
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return expvarStats(h)
+	}))
+
+	return nil
+}
+
+// expvarStats returns the statistics of the hook as published by PublishExpvar.
+func expvarStats(h *Hook) map[string]interface{} {
+	s := h.Stats()
+
+	// the buckets are cumulative, as in the Prometheus histograms
+	buckets := make(map[string]uint64, len(s.SendLatency.Buckets)+1)
+	var cumulative uint64
+	for i, le := range s.SendLatency.Buckets {
+		cumulative += s.SendLatency.Counts[i]
+		buckets[strconv.FormatFloat(le, 'g', -1, 64)] = cumulative
+	}
+	buckets["+Inf"] = s.SendLatency.Count
+
+	return map[string]interface{}{
+		"enqueued":       s.Enqueued,
+		"sent":           s.Sent,
+		"failed":         s.Failed,
+		"dropped":        s.Dropped,
+		"suppressed":     s.Suppressed,
+		"reconnects":     s.Reconnects,
+		"bytes_written":  s.BytesWritten,
+		"queue_depth":    s.QueueDepth,
+		"queue_capacity": s.QueueCapacity,
+		"connected":      h.IsConnected(),
+		"send_duration_seconds": map[string]interface{}{
+			"buckets": buckets,
+			"count":   s.SendLatency.Count,
+			"sum":     s.SendLatency.Sum.Seconds(),
+		},
+	}
+}
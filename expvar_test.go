@@ -0,0 +1,51 @@
+package logrustash
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expvarTests numbers the runs of the tests publishing a hook.
+var expvarTests atomic.Int32
+
+func TestPublishExpvar(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	h := &Hook{writer: bytes.NewBuffer(nil), formatter: &logrus.JSONFormatter{}, connected: true}
+	// the names stay published across the runs of the test, e.g. with -count
+	name := fmt.Sprintf("%s_%d", t.Name(), expvarTests.Add(1))
+	require.NoError(PublishExpvar(name, h))
+	require.Error(PublishExpvar(name, h))
+
+	require.NoError(h.Fire(&logrus.Entry{Message: "msg", Data: logrus.Fields{}}))
+
+	v := expvar.Get(ExpvarPrefix + name)
+	require.NotNil(v)
+
+	var got struct {
+		Enqueued  uint64 `json:"enqueued"`
+		Sent      uint64 `json:"sent"`
+		Connected bool   `json:"connected"`
+		Latency   struct {
+			Buckets map[string]uint64 `json:"buckets"`
+			Count   uint64            `json:"count"`
+		} `json:"send_duration_seconds"`
+	}
+	require.NoError(json.Unmarshal([]byte(v.String()), &got))
+
+	assert.Equal(uint64(1), got.Enqueued)
+	assert.Equal(uint64(1), got.Sent)
+	assert.True(got.Connected)
+	assert.Equal(uint64(1), got.Latency.Count)
+	assert.Equal(uint64(1), got.Latency.Buckets["+Inf"])
+	assert.Equal(uint64(1), got.Latency.Buckets["10"])
+}
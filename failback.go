@@ -0,0 +1,91 @@
+package logrustash
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// startFailback calls failback in a goroutine, dialing the preferred address must not hold back
+// the entries, unless an attempt is already in progress.
+func (h *Hook) startFailback() {
+	if !h.failingBack.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer h.failingBack.Store(false)
+		h.failback()
+	}()
+}
+
+// failback reconnects to the preferred address, the first one, if the hook failed over
+// to another address and the preferred one is reachable again.
+func (h *Hook) failback() {
+	if len(h.addrs) < 2 {
+		return
+	}
+
+	h.RLock()
+	index, gen := h.addrIndex, h.generation
+	h.RUnlock()
+	if index == 0 {
+		return
+	}
+
+	// still unreachable, the next attempt is made after FailbackInterval
+	if h.redial(0, gen) {
+		h.diagnosef("failed back to logstash at %s\n", h.addrs[0])
+	}
+}
+
+// redial connects to the address at `index` and replaces the writer of generation `gen` by the new
+// connection, unless it was replaced in the meantime. It reports whether the writer was replaced.
+func (h *Hook) redial(index int, gen uint64) bool {
+	conn, err := h.dial(h.addrs[index])
+	if err != nil {
+		return false
+	}
+
+	h.reconnectMu.Lock()
+	defer h.reconnectMu.Unlock()
+
+	h.RLock()
+	changed := h.generation != gen
+	h.RUnlock()
+	if changed {
+		// the connection was replaced in the meantime
+		_ = conn.Close()
+		return false
+	}
+
+	// no write is in progress on the connection replaced
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	return h.swapWriter(conn, index)
+}
+
+// failbackIfDue starts failing back if FailbackInterval elapsed since the last attempt,
+// for the synchronous hooks which have no goroutine to attempt it periodically.
+func (h *Hook) failbackIfDue() {
+	if h.opts.FailbackInterval <= 0 || len(h.addrs) < 2 {
+		return
+	}
+
+	if due(&h.nextFailback, h.opts.FailbackInterval) {
+		h.startFailback()
+	}
+}
+
+// due reports whether `interval` elapsed since the time `next` was last moved forward,
+// in which case it is moved forward again. The first call only starts the interval.
+func due(next *atomic.Int64, interval time.Duration) bool {
+	now := time.Now().UnixNano()
+	last := next.Load()
+	if last == 0 {
+		next.CompareAndSwap(0, now+int64(interval))
+		return false
+	}
+
+	return now >= last && next.CompareAndSwap(last, now+int64(interval))
+}
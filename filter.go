@@ -0,0 +1,68 @@
+package logrustash
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// IncludeFields returns a FieldProcessor keeping only the fields of the given keys,
+// the keys are case-insensitive.
+func IncludeFields(keys ...string) FieldProcessor {
+	set := keySet(keys)
+
+	return FieldProcessorFunc(func(fields logrus.Fields) logrus.Fields {
+		for k := range fields {
+			if !set[strings.ToLower(k)] {
+				delete(fields, k)
+			}
+		}
+
+		return fields
+	})
+}
+
+// ExcludeFields returns a FieldProcessor removing the fields of the given keys,
+// e.g. "password" or "authorization", the keys are case-insensitive.
+func ExcludeFields(keys ...string) FieldProcessor {
+	set := keySet(keys)
+
+	return FieldProcessorFunc(func(fields logrus.Fields) logrus.Fields {
+		for k := range fields {
+			if set[strings.ToLower(k)] {
+				delete(fields, k)
+			}
+		}
+
+		return fields
+	})
+}
+
+// keySet returns the set of the lower-cased keys.
+func keySet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[strings.ToLower(k)] = true
+	}
+
+	return set
+}
+
+// filterFields returns a copy of the entry `e` whose data only has the fields of `include`,
+// if not empty, without the fields of `exclude`.
+func filterFields(e *logrus.Entry, include, exclude []string) *logrus.Entry {
+	ne := *e
+	ne.Data = make(logrus.Fields, len(e.Data))
+	for k, v := range e.Data {
+		ne.Data[k] = v
+	}
+
+	if len(include) > 0 {
+		ne.Data = IncludeFields(include...).Process(ne.Data)
+	}
+	if len(exclude) > 0 {
+		ne.Data = ExcludeFields(exclude...).Process(ne.Data)
+	}
+
+	return &ne
+}
@@ -0,0 +1,53 @@
+package logrustash
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncludeExcludeFields(t *testing.T) {
+	assert := assert.New(t)
+
+	fields := logrus.Fields{"user": "alice", "Password": "secret", "attempt": 1}
+	assert.Equal(logrus.Fields{"user": "alice", "attempt": 1}, ExcludeFields("password").Process(fields))
+
+	fields = logrus.Fields{"user": "alice", "Password": "secret", "attempt": 1}
+	assert.Equal(logrus.Fields{"user": "alice"}, IncludeFields("USER").Process(fields))
+}
+
+func TestLogstashFormatterExcludeFields(t *testing.T) {
+	require := require.New(t)
+
+	formatter := DefaultFormatter(logrus.Fields{}).(LogstashFormatter)
+	formatter.FieldProcessor = ExcludeFields("authorization")
+
+	res, err := formatter.Format(&logrus.Entry{Message: "msg1", Data: logrus.Fields{"authorization": "Bearer token", "path": "/"}})
+	require.NoError(err)
+	assert.NotContains(t, string(res), "Bearer")
+	assert.Contains(t, string(res), "path=/")
+}
+
+func TestFireIncludeExcludeFields(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := bytes.NewBuffer(nil)
+	h := &Hook{
+		writer:    buffer,
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts: HookOptions{
+			IncludeFields: []string{"user", "password", "path"},
+			ExcludeFields: []string{"password"},
+		},
+	}
+
+	entry := &logrus.Entry{Message: "login", Level: logrus.InfoLevel, Data: logrus.Fields{"user": "alice", "password": "secret", "path": "/", "debug": true}}
+	require.NoError(h.Fire(entry))
+
+	assert.Equal(`{"level":"info","msg":"login","path":"/","user":"alice"}`+"\n", buffer.String())
+	assert.Len(entry.Data, 4, "the fields of the fired entry are left untouched")
+}
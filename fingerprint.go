@@ -0,0 +1,33 @@
+package logrustash
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FieldKeyFingerprint is the field the fingerprint computed by LogstashFormatter is stored in.
+const FieldKeyFingerprint = "fingerprint"
+
+// fingerprint returns a stable hash of the `fields` of the entry, logrus.FieldKeyMsg standing
+// for the message. Error values contribute their type rather than their message, which
+// usually carries variable data.
+func fingerprint(e *logrus.Entry, fields []string) string {
+	h := fnv.New64a()
+
+	for _, name := range fields {
+		var value string
+		if name == logrus.FieldKeyMsg {
+			value = e.Message
+		} else if err, ok := e.Data[name].(error); ok {
+			value = fmt.Sprintf("%T", err)
+		} else if v, ok := e.Data[name]; ok {
+			value = fmt.Sprintf("%v", v)
+		}
+
+		_, _ = fmt.Fprintf(h, "%s=%s\x00", name, value)
+	}
+
+	return fmt.Sprintf("%016x", h.Sum64())
+}
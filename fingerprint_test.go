@@ -0,0 +1,60 @@
+package logrustash
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogstashFormatterFingerprint(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	formatter := LogstashFormatter{
+		Formatter:         &logrus.JSONFormatter{},
+		FingerprintFields: []string{logrus.FieldKeyMsg, logrus.ErrorKey},
+	}
+
+	fingerprintOf := func(e *logrus.Entry) string {
+		res, err := formatter.Format(e)
+		require.NoError(err)
+
+		var doc map[string]interface{}
+		require.NoError(json.Unmarshal(res, &doc))
+		require.Contains(doc, FieldKeyFingerprint)
+
+		return doc[FieldKeyFingerprint].(string)
+	}
+
+	notFound1 := fingerprintOf(&logrus.Entry{
+		Message: "failed to open file",
+		Data:    logrus.Fields{logrus.ErrorKey: &os.PathError{Op: "open", Path: "/a", Err: os.ErrNotExist}, "user": 1},
+	})
+	notFound2 := fingerprintOf(&logrus.Entry{
+		Message: "failed to open file",
+		Data:    logrus.Fields{logrus.ErrorKey: &os.PathError{Op: "open", Path: "/b", Err: os.ErrPermission}, "user": 2},
+	})
+	other := fingerprintOf(&logrus.Entry{
+		Message: "failed to open file",
+		Data:    logrus.Fields{logrus.ErrorKey: errors.New("boom")},
+	})
+
+	assert.Equal(notFound1, notFound2, "variable data must not change the fingerprint")
+	assert.NotEqual(notFound1, other, "a different error type must change the fingerprint")
+}
+
+func TestLogstashFormatterFingerprintFunc(t *testing.T) {
+	formatter := LogstashFormatter{
+		Formatter:   &logrus.JSONFormatter{},
+		Fingerprint: func(e *logrus.Entry) string { return "custom" },
+	}
+
+	res, err := formatter.Format(&logrus.Entry{Message: "msg1", Data: logrus.Fields{}})
+	require.NoError(t, err)
+	assert.Contains(t, string(res), `"fingerprint":"custom"`)
+}
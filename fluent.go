@@ -0,0 +1,215 @@
+package logrustash
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultFluentAckTimeout = 10 * time.Second
+
+	// fluentEventTimeExt is the MessagePack extension type of the Fluentd EventTime.
+	fluentEventTimeExt = 0
+)
+
+// ErrFluentAck is returned when Fluentd does not acknowledge a chunk as expected.
+var ErrFluentAck = errors.New("fluentd chunk not acknowledged")
+
+// FluentFormatter formats the entries as MessagePack [time, record] events of the Fluentd forward
+// protocol, the record holding the message, the level and the fields of the entry. The events are
+// sent in chunks of the PackedForward mode over the connections wrapped when HookOptions.FluentTag is set.
+type FluentFormatter struct {
+	// MessageKey and LevelKey are the keys of the message and the level, "message" and "level" by default.
+	MessageKey string
+	LevelKey   string
+	// Fields are added to every record unless given in the entry data.
+	Fields logrus.Fields
+}
+
+// Format formats the entry as a Fluentd event.
+func (f FluentFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	messageKey, levelKey := f.MessageKey, f.LevelKey
+	if messageKey == "" {
+		messageKey = "message"
+	}
+	if levelKey == "" {
+		levelKey = "level"
+	}
+
+	record := make(logrus.Fields, len(f.Fields)+len(e.Data)+2)
+	for k, v := range f.Fields {
+		record[k] = v
+	}
+	for k, v := range e.Data {
+		record[k] = v
+	}
+	record[messageKey] = e.Message
+	record[levelKey] = e.Level.String()
+
+	t := e.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	eventTime := binary.BigEndian.AppendUint32(nil, uint32(t.Unix()))
+	eventTime = binary.BigEndian.AppendUint32(eventTime, uint32(t.Nanosecond()))
+
+	b := msgpackAppendArrayHeader(nil, 2)
+	b = msgpackAppendExt(b, fluentEventTimeExt, eventTime)
+	return msgpackAppendMap(b, record), nil
+}
+
+// fluentConn sends every write, the events formatted by FluentFormatter, as a chunk of the
+// PackedForward mode of the Fluentd forward protocol with the tag `tag`. If `ack` is set,
+// the writes return once Fluentd acknowledged the chunk.
+type fluentConn struct {
+	net.Conn
+
+	tag        string
+	ack        bool
+	ackTimeout time.Duration
+	reader     *bufio.Reader
+}
+
+// Write sends `data` as a single chunk.
+func (c *fluentConn) Write(data []byte) (int, error) {
+	option := map[string]interface{}{}
+
+	var chunk string
+	if c.ack {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return 0, err
+		}
+
+		chunk = base64.StdEncoding.EncodeToString(id)
+		option["chunk"] = chunk
+	}
+
+	msg := msgpackAppendArrayHeader(make([]byte, 0, len(data)+64), 3)
+	msg = msgpackAppendString(msg, c.tag)
+	msg = msgpackAppendBinary(msg, data)
+	msg = msgpackAppendMap(msg, option)
+
+	if _, err := c.Conn.Write(msg); err != nil {
+		return 0, err
+	}
+
+	if c.ack {
+		if err := c.waitAck(chunk); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// waitAck reads the acknowledgment of the chunk `chunk`.
+func (c *fluentConn) waitAck(chunk string) error {
+	if c.reader == nil {
+		c.reader = bufio.NewReader(c.Conn)
+	}
+
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.ackTimeout)); err != nil {
+		return err
+	}
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	resp, err := msgpackReadStringMap(c.reader)
+	if err != nil {
+		return fmt.Errorf("failed to read the fluentd ack: %w", err)
+	}
+	if resp["ack"] != chunk {
+		return fmt.Errorf("%w: expected %s, got %s", ErrFluentAck, chunk, resp["ack"])
+	}
+
+	return nil
+}
+
+// msgpackReadStringMap reads a MessagePack map of strings, e.g. the acknowledgments of Fluentd.
+func msgpackReadStringMap(r *bufio.Reader) (map[string]string, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	var n int
+	switch {
+	case header&0xf0 == 0x80:
+		n = int(header & 0x0f)
+	case header == 0xde:
+		var size [2]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return nil, err
+		}
+		n = int(binary.BigEndian.Uint16(size[:]))
+	default:
+		return nil, fmt.Errorf("unexpected msgpack type 0x%x, expected a map", header)
+	}
+
+	m := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		k, err := msgpackReadString(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := msgpackReadString(r)
+		if err != nil {
+			return nil, err
+		}
+
+		m[k] = v
+	}
+
+	return m, nil
+}
+
+// msgpackReadString reads a MessagePack string or binary.
+func msgpackReadString(r *bufio.Reader) (string, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+
+	var n int
+	switch {
+	case header&0xe0 == 0xa0:
+		n = int(header & 0x1f)
+	case header == 0xd9 || header == 0xc4:
+		size, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		n = int(size)
+	case header == 0xda || header == 0xc5:
+		var size [2]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return "", err
+		}
+		n = int(binary.BigEndian.Uint16(size[:]))
+	case header == 0xdb || header == 0xc6:
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return "", err
+		}
+		n = int(binary.BigEndian.Uint32(size[:]))
+	default:
+		return "", fmt.Errorf("unexpected msgpack type 0x%x, expected a string", header)
+	}
+
+	s := make([]byte, n)
+	if _, err := io.ReadFull(r, s); err != nil {
+		return "", err
+	}
+
+	return string(s), nil
+}
@@ -0,0 +1,169 @@
+package logrustash
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFluentFormatter(t *testing.T) {
+	assert := assert.New(t)
+
+	f := FluentFormatter{Fields: logrus.Fields{"app": "api", "user": "default"}}
+	b, err := f.Format(&logrus.Entry{
+		Message: "msg",
+		Level:   logrus.WarnLevel,
+		Time:    time.Unix(1700000000, 123),
+		Data:    logrus.Fields{"user": "alice", "attempt": 3},
+	})
+	require.NoError(t, err)
+
+	event := msgpackUnmarshal(t, b).([]interface{})
+	require.Len(t, event, 2)
+
+	eventTime := event[0].(msgpackExt)
+	assert.Equal(int8(0), eventTime.Type)
+	assert.Equal(uint32(1700000000), binary.BigEndian.Uint32(eventTime.Data[:4]))
+	assert.Equal(uint32(123), binary.BigEndian.Uint32(eventTime.Data[4:]))
+
+	assert.Equal(map[string]interface{}{
+		"message": "msg",
+		"level":   "warning",
+		"app":     "api",
+		"user":    "alice",
+		"attempt": int64(3),
+	}, event[1])
+}
+
+// fluentChunk is a chunk received by a fluentd test server.
+type fluentChunk struct {
+	tag    string
+	events []interface{}
+	option map[string]interface{}
+}
+
+// acceptFluent accepts a connection on `l`, decodes the chunks sent in the PackedForward
+// mode and acknowledges them by answering `ack` with their chunk ID.
+func acceptFluent(t *testing.T, l net.Listener, ack func(chunk string) string) <-chan fluentChunk {
+	chunks := make(chan fluentChunk, 16)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		for {
+			msg, err := msgpackDecode(r)
+			if err != nil {
+				return
+			}
+
+			forward := msg.([]interface{})
+			chunk := fluentChunk{tag: forward[0].(string), option: forward[2].(map[string]interface{})}
+
+			events := bufio.NewReader(bytes.NewReader(forward[1].([]byte)))
+			for {
+				event, err := msgpackDecode(events)
+				if err != nil {
+					break
+				}
+				chunk.events = append(chunk.events, event)
+			}
+
+			if id, ok := chunk.option["chunk"].(string); ok {
+				if _, err := conn.Write(msgpackAppendMap(nil, map[string]interface{}{"ack": ack(id)})); err != nil {
+					return
+				}
+			}
+
+			chunks <- chunk
+		}
+	}()
+
+	return chunks
+}
+
+func TestFluent(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	chunks := acceptFluent(t, l, func(chunk string) string { return chunk })
+
+	hook, err := NewWithOptions("tcp", l.Addr().String(), WithFluent("app.logs", true), WithSynchronous())
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "forwarded", Level: logrus.InfoLevel, Data: logrus.Fields{"k": "v"}}))
+
+	select {
+	case chunk := <-chunks:
+		assert.Equal("app.logs", chunk.tag)
+		assert.NotEmpty(chunk.option["chunk"])
+		require.Len(chunk.events, 1)
+
+		record := chunk.events[0].([]interface{})[1].(map[string]interface{})
+		assert.Equal("forwarded", record["message"])
+		assert.Equal("info", record["level"])
+		assert.Equal("v", record["k"])
+	case <-time.After(time.Second):
+		t.Fatal("chunk not received")
+	}
+}
+
+func TestFluentBatch(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	chunks := acceptFluent(t, l, func(chunk string) string { return chunk })
+
+	hook, err := NewWithOptions("tcp", l.Addr().String(), WithFluent("app.logs", false), WithBatching(3, time.Minute))
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	for _, msg := range []string{"first", "second", "third"} {
+		require.NoError(hook.Fire(&logrus.Entry{Message: msg, Data: logrus.Fields{}}))
+	}
+
+	select {
+	case chunk := <-chunks:
+		assert.Empty(chunk.option)
+		require.Len(chunk.events, 3)
+		assert.Equal("third", chunk.events[2].([]interface{})[1].(map[string]interface{})["message"])
+	case <-time.After(time.Second):
+		t.Fatal("chunk not received")
+	}
+}
+
+func TestFluentAckMismatch(t *testing.T) {
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	acceptFluent(t, l, func(string) string { return "another chunk" })
+
+	hook, err := NewWithOptions("tcp", l.Addr().String(), WithFluent("app.logs", true), WithSynchronous())
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	err = hook.(*Hook).send([]byte{0x90})
+	require.ErrorIs(err, ErrFluentAck)
+}
@@ -0,0 +1,73 @@
+package logrustash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"strconv"
+)
+
+// Framer re-frames a formatted entry into the bytes written to Logstash,
+// e.g. to match the codec of the Logstash input.
+type Framer func(data []byte) []byte
+
+// DelimiterFramer returns a Framer terminating every entry with `delim` instead of
+// the newline appended by the logrus formatters, e.g. []byte{0} for null-byte framing.
+func DelimiterFramer(delim []byte) Framer {
+	return func(data []byte) []byte {
+		data = bytes.TrimSuffix(data, []byte("\n"))
+
+		framed := make([]byte, 0, len(data)+len(delim))
+		framed = append(framed, data...)
+		return append(framed, delim...)
+	}
+}
+
+// NewlineFramer is a Framer terminating every entry with a single newline whatever the formatter,
+// for the json_lines codec: the newline is appended if the formatter did not, and an entry formatted
+// over multiple lines, e.g. indented JSON, is compacted into a single line.
+func NewlineFramer(data []byte) []byte {
+	data = bytes.TrimRight(data, "\r\n")
+	if bytes.IndexByte(data, '\n') >= 0 {
+		compacted := bytes.NewBuffer(make([]byte, 0, len(data)+1))
+		if json.Compact(compacted, data) == nil {
+			return append(compacted.Bytes(), '\n')
+		}
+	}
+
+	framed := make([]byte, 0, len(data)+1)
+	framed = append(framed, data...)
+	return append(framed, '\n')
+}
+
+// NULFramer is a Framer terminating every entry with a null byte instead of the newline
+// appended by the logrus formatters, for the Logstash inputs using a codec such as
+// `line { delimiter => "\u0000" }`.
+var NULFramer = DelimiterFramer([]byte{0})
+
+// RawFramer is a Framer writing every entry without any delimiter, the newline appended
+// by the logrus formatters being removed, e.g. over UDP where every datagram is an entry.
+func RawFramer(data []byte) []byte {
+	return bytes.TrimSuffix(data, []byte("\n"))
+}
+
+// LengthPrefixFramer is a Framer prefixing every entry, without the newline appended
+// by the logrus formatters, with its length as a 4-byte big-endian unsigned integer.
+func LengthPrefixFramer(data []byte) []byte {
+	data = bytes.TrimSuffix(data, []byte("\n"))
+
+	framed := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(framed, uint32(len(data)))
+	return append(framed, data...)
+}
+
+// OctetCountingFramer is a Framer prefixing every entry, without the newline appended
+// by the logrus formatters, with its length in decimal followed by a space, the octet-counting
+// framing of syslog over TCP (RFC 6587).
+func OctetCountingFramer(data []byte) []byte {
+	data = bytes.TrimSuffix(data, []byte("\n"))
+
+	framed := strconv.AppendInt(make([]byte, 0, len(data)+8), int64(len(data)), 10)
+	framed = append(framed, ' ')
+	return append(framed, data...)
+}
@@ -0,0 +1,127 @@
+package logrustash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFraming(t *testing.T) {
+	doc := `{"level":"info","msg":"msg1"}`
+
+	lengthPrefix := make([]byte, 4)
+	binary.BigEndian.PutUint32(lengthPrefix, uint32(len(doc)))
+
+	testCases := []struct {
+		name     string
+		framer   Framer
+		expected []byte
+	}{
+		{
+			name:     "newline by default",
+			expected: []byte(doc + "\n"),
+		},
+		{
+			name:     "null byte",
+			framer:   DelimiterFramer([]byte{0}),
+			expected: []byte(doc + "\x00"),
+		},
+		{
+			name:     "nul",
+			framer:   NULFramer,
+			expected: []byte(doc + "\x00"),
+		},
+		{
+			name:     "raw",
+			framer:   RawFramer,
+			expected: []byte(doc),
+		},
+		{
+			name:     "length prefix",
+			framer:   LengthPrefixFramer,
+			expected: append(lengthPrefix, doc...),
+		},
+		{
+			name:     "octet counting",
+			framer:   OctetCountingFramer,
+			expected: []byte("29 " + doc),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+			h := &Hook{
+				writer:    buffer,
+				formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+				opts:      HookOptions{Framer: tc.framer},
+			}
+
+			require.NoError(t, h.Fire(&logrus.Entry{Message: "msg1", Level: logrus.InfoLevel, Data: logrus.Fields{}}))
+			require.NoError(t, h.Fire(&logrus.Entry{Message: "msg1", Level: logrus.InfoLevel, Data: logrus.Fields{}}))
+
+			assert.Equal(t, append(append([]byte(nil), tc.expected...), tc.expected...), buffer.Bytes())
+		})
+	}
+}
+
+// unterminatedFormatter formats the entries as JSON without the trailing newline.
+type unterminatedFormatter struct{}
+
+func (unterminatedFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	return []byte(`{"msg":"` + e.Message + `"}`), nil
+}
+
+func TestNewlineFramer(t *testing.T) {
+	testCases := []struct {
+		name      string
+		formatter logrus.Formatter
+	}{
+		{
+			name:      "missing newline",
+			formatter: unterminatedFormatter{},
+		},
+		{
+			name:      "newline",
+			formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		},
+		{
+			name:      "indented",
+			formatter: &logrus.JSONFormatter{DisableTimestamp: true, PrettyPrint: true},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+			h := &Hook{
+				writer:    buffer,
+				formatter: tc.formatter,
+				opts:      HookOptions{Framer: NewlineFramer},
+			}
+
+			require.NoError(t, h.Fire(&logrus.Entry{Message: "msg1", Level: logrus.InfoLevel, Data: logrus.Fields{}}))
+			require.NoError(t, h.Fire(&logrus.Entry{Message: "msg2", Level: logrus.InfoLevel, Data: logrus.Fields{}}))
+
+			lines := strings.Split(buffer.String(), "\n")
+			require.Len(t, lines, 3)
+			for i, line := range lines[:2] {
+				var doc map[string]interface{}
+				require.NoError(t, json.Unmarshal([]byte(line), &doc))
+				assert.Equal(t, fmt.Sprintf("msg%d", i+1), doc["msg"])
+			}
+			assert.Empty(t, lines[2])
+		})
+	}
+}
+
+func TestNewlineFramerNotJSON(t *testing.T) {
+	assert.Equal(t, []byte("line one\nline two\n"), NewlineFramer([]byte("line one\nline two\r\n\n")))
+}
@@ -1,10 +1,16 @@
 package logrustash
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
-	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -13,25 +19,63 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// safeBuffer is a bytes.Buffer guarded by a mutex, so that it can be written by
+// the hook's sending goroutine while being read by the test.
+type safeBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *safeBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *safeBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func (b *safeBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Len()
+}
+
+func (b *safeBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf.Reset()
+}
+
+// waitForWrite waits until the entries fired to the hook have been written to b.
+func waitForWrite(t *testing.T, b *safeBuffer) {
+	t.Helper()
+
+	require.Eventually(t, func() bool { return b.Len() > 0 }, time.Second, time.Millisecond)
+}
+
 func TestEntryIsNotChangedByLogstashFormatter(t *testing.T) {
 	assert := assert.New(t)
 
-	buffer := bytes.NewBufferString("")
+	buffer := &safeBuffer{}
 	bufferOut := bytes.NewBufferString("")
 
 	log := logrus.New()
 	log.Out = bufferOut
 
-	l, err := net.ListenTCP("tcp", net.TCPAddrFromAddrPort(netip.MustParseAddrPort("127.0.0.1:8989")))
+	hook, err := NewWithWriter(buffer, WithFormatter(DefaultFormatter(logrus.Fields{"NICKNAME": ""})))
 	require.NoError(t, err)
-	defer l.Close()
-
-	hook, err := New("tcp", "127.0.0.1:8989", DefaultFormatter(logrus.Fields{"NICKNAME": ""}))
-	require.NoError(t, err)
-	hook.(*Hook).conn = buffer
 
 	log.Hooks.Add(hook)
 	log.Info("hello world")
+	waitForWrite(t, buffer)
 
 	assert.Contains(buffer.String(), `NICKNAME":`, fmt.Sprintf("expected logstash message to have '%s': %v", `NICKNAME":`, buffer.String()))
 	assert.NotContains(bufferOut.String(), `NICKNAME":`, fmt.Sprintf("expected main logrus message to not have '%s': %v", `NICKNAME":`, buffer.String()))
@@ -41,13 +85,9 @@ func TestTimestampFormatKitchen(t *testing.T) {
 	assert := assert.New(t)
 
 	log := logrus.New()
-	buffer := bytes.NewBufferString("")
+	buffer := &safeBuffer{}
 
-	l, err := net.ListenTCP("tcp", net.TCPAddrFromAddrPort(netip.MustParseAddrPort("127.0.0.1:8989")))
-	require.NoError(t, err)
-	defer l.Close()
-
-	hook, err := New("tcp", "127.0.0.1:8989", LogstashFormatter{
+	hook, err := NewWithWriter(buffer, WithFormatter(LogstashFormatter{
 		Formatter: &logrus.JSONFormatter{
 			FieldMap: logrus.FieldMap{
 				logrus.FieldKeyTime: "@timestamp",
@@ -56,12 +96,12 @@ func TestTimestampFormatKitchen(t *testing.T) {
 			TimestampFormat: time.Kitchen,
 		},
 		Fields: logrus.Fields{"HOSTNAME": "localhost", "USERNAME": "root"},
-	})
+	}))
 	require.NoError(t, err)
-	hook.(*Hook).conn = buffer
 
 	log.Hooks.Add(hook)
 	log.Error("this is an error message!")
+	waitForWrite(t, buffer)
 
 	mTime := time.Now()
 	expected := fmt.Sprintf(`{"@timestamp":"%s","HOSTNAME":"localhost","USERNAME":"root","level":"error","message":"this is an error message!"}`+"\n", mTime.Format(time.Kitchen))
@@ -72,23 +112,19 @@ func TestTextFormatLogstash(t *testing.T) {
 	assert := assert.New(t)
 
 	log := logrus.New()
-	buffer := bytes.NewBufferString("")
-
-	l, err := net.ListenTCP("tcp", net.TCPAddrFromAddrPort(netip.MustParseAddrPort("127.0.0.1:8989")))
-	require.NoError(t, err)
-	defer l.Close()
+	buffer := &safeBuffer{}
 
-	hook, err := New("tcp", "127.0.0.1:8989", LogstashFormatter{
+	hook, err := NewWithWriter(buffer, WithFormatter(LogstashFormatter{
 		Formatter: &logrus.TextFormatter{
 			TimestampFormat: time.Kitchen,
 		},
 		Fields: logrus.Fields{"HOSTNAME": "localhost", "USERNAME": "root"},
-	})
+	}))
 	require.NoError(t, err)
-	hook.(*Hook).conn = buffer
 
 	log.Hooks.Add(hook)
 	log.Warning("this is a warning message!")
+	waitForWrite(t, buffer)
 
 	mTime := time.Now()
 	expected := fmt.Sprintf(`time="%s" level=warning msg="this is a warning message!" HOSTNAME=localhost USERNAME=root
@@ -101,27 +137,24 @@ func TestLogWithFieldsDoesNotOverrideHookFields(t *testing.T) {
 	assert := assert.New(t)
 
 	log := logrus.New()
-	buffer := bytes.NewBufferString("")
-
-	l, err := net.ListenTCP("tcp", net.TCPAddrFromAddrPort(netip.MustParseAddrPort("127.0.0.1:8989")))
-	require.NoError(t, err)
-	defer l.Close()
+	buffer := &safeBuffer{}
 
-	hook, err := New("tcp", "127.0.0.1:8989", LogstashFormatter{
+	hook, err := NewWithWriter(buffer, WithFormatter(LogstashFormatter{
 		Formatter: &logrus.JSONFormatter{},
 		Fields:    logrus.Fields{},
-	})
+	}))
 	require.NoError(t, err)
-	hook.(*Hook).conn = buffer
 
 	log.Hooks.Add(hook)
 	log.WithField("animal", "walrus").Info("bla")
+	waitForWrite(t, buffer)
 
 	attr := `fields":"animal=walrus`
 	assert.Contains(buffer.String(), attr, fmt.Sprintf("expected to have '%s' in '%s'", attr, buffer.String()))
 
 	buffer.Reset()
 	log.Info("hahaha")
+	waitForWrite(t, buffer)
 	assert.NotContains(buffer.String(), attr, fmt.Sprintf("expected not to have '%s' in '%s'", attr, buffer.String()))
 }
 
@@ -174,3 +207,822 @@ func TestUDPWritter(t *testing.T) {
 	log.Hooks.Add(hook)
 	log.Info("this is an information message")
 }
+
+// acceptLines accepts a single connection on l and sends every line read from it to the returned channel.
+// The accepted connection is sent to conns so the test can close it.
+func acceptLines(t *testing.T, l net.Listener) (<-chan string, <-chan net.Conn) {
+	t.Helper()
+
+	lines := make(chan string, 100)
+	conns := make(chan net.Conn, 1)
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conns <- conn
+
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	return lines, conns
+}
+
+func TestNewMultiFailover(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l1, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l1.Close()
+
+	l2, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l2.Close()
+
+	lines1, conns1 := acceptLines(t, l1)
+	lines2, _ := acceptLines(t, l2)
+
+	log := logrus.New()
+	log.Out = io.Discard
+
+	hook, err := NewMulti("tcp", []string{l1.Addr().String(), l2.Addr().String()}, &logrus.JSONFormatter{})
+	require.NoError(err)
+	log.Hooks.Add(hook)
+
+	assert.Equal(l1.Addr().String(), hook.(*Hook).Addr())
+
+	log.Info("first")
+	select {
+	case line := <-lines1:
+		assert.Contains(line, "first")
+	case <-time.After(time.Second):
+		require.FailNow("expected the first entry on the first listener")
+	}
+
+	// kill the first endpoint
+	require.NoError(l1.Close())
+	(<-conns1).Close()
+
+	require.Eventually(func() bool {
+		log.Info("second")
+
+		select {
+		case line := <-lines2:
+			return assert.Contains(line, "second")
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, time.Millisecond)
+
+	assert.Equal(l2.Addr().String(), hook.(*Hook).Addr())
+}
+
+func TestNewMultiFailback(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// reserve an address for the preferred endpoint, down at first
+	l1, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	addr1 := l1.Addr().String()
+	require.NoError(l1.Close())
+
+	l2, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l2.Close()
+
+	lines2, _ := acceptLines(t, l2)
+
+	log := logrus.New()
+	log.Out = io.Discard
+
+	hook, err := NewMulti("tcp", []string{addr1, l2.Addr().String()}, &logrus.JSONFormatter{}, HookOptions{
+		FailbackInterval: 10 * time.Millisecond,
+	})
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+	log.Hooks.Add(hook)
+
+	assert.Equal(l2.Addr().String(), hook.(*Hook).Addr())
+
+	log.Info("first")
+	select {
+	case line := <-lines2:
+		assert.Contains(line, "first")
+	case <-time.After(time.Second):
+		require.FailNow("expected the first entry on the second listener")
+	}
+
+	// the preferred endpoint is back
+	l1, err = net.Listen("tcp", addr1)
+	require.NoError(err)
+	defer l1.Close()
+
+	lines1, _ := acceptLines(t, l1)
+
+	require.Eventually(func() bool {
+		return hook.(*Hook).Addr() == addr1
+	}, 5*time.Second, time.Millisecond)
+
+	log.Info("second")
+	select {
+	case line := <-lines1:
+		assert.Contains(line, "second")
+	case <-time.After(time.Second):
+		require.FailNow("expected the second entry on the preferred listener")
+	}
+}
+
+func TestNewMultiRequiresAddrs(t *testing.T) {
+	_, err := NewMulti("tcp", nil, &logrus.JSONFormatter{})
+	assert.Error(t, err)
+
+	_, err = NewMulti("tcp", []string{"127.0.0.1:8989", ""}, &logrus.JSONFormatter{})
+	assert.Error(t, err)
+}
+
+func TestIsConnected(t *testing.T) {
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+
+	_, conns := acceptLines(t, l)
+
+	log := logrus.New()
+	log.Out = io.Discard
+
+	hook, err := New("tcp", l.Addr().String(), &logrus.JSONFormatter{})
+	require.NoError(err)
+	log.Hooks.Add(hook)
+
+	require.True(hook.(*Hook).IsConnected())
+
+	// kill the listener and the established connection
+	require.NoError(l.Close())
+	(<-conns).Close()
+
+	require.Eventually(func() bool {
+		log.Info("are you there?")
+		return !hook.(*Hook).IsConnected()
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestConnectionCallbacks(t *testing.T) {
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+	addr := l.Addr().String()
+
+	_, conns := acceptLines(t, l)
+
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+	recorded := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), events...)
+	}
+
+	log := logrus.New()
+	log.Out = io.Discard
+
+	hook, err := NewWithOptions("tcp", addr,
+		WithSynchronous(),
+		WithFormatter(&logrus.JSONFormatter{}),
+		WithConnectionCallbacks(
+			func(addr string) { record("connect " + addr) },
+			func(addr string, err error) {
+				if err != nil {
+					record("disconnect " + addr)
+				}
+			},
+			func(addr string, attempts int) { record(fmt.Sprintf("reconnect %s %d", addr, attempts)) },
+		),
+	)
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+	log.Hooks.Add(hook)
+
+	require.Equal([]string{"connect " + addr}, recorded())
+
+	// Logstash closes the connection, the hook reconnects once writing fails
+	_, reconnected := acceptLines(t, l)
+	require.NoError((<-conns).Close())
+	require.Eventually(func() bool {
+		log.Info("are you there?")
+		return len(recorded()) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	<-reconnected
+
+	require.Equal([]string{
+		"connect " + addr,
+		"disconnect " + addr,
+		"connect " + addr,
+		"reconnect " + addr + " 1",
+	}, recorded())
+}
+
+func TestFireWithNilConnReconnects(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	lines, _ := acceptLines(t, l)
+
+	h := &Hook{
+		protocol:  "tcp",
+		addrs:     []string{l.Addr().String()},
+		formatter: &logrus.JSONFormatter{},
+	}
+
+	require.NotPanics(func() {
+		err = h.Fire(&logrus.Entry{Message: "hello again", Data: logrus.Fields{}})
+	})
+	require.NoError(err)
+	assert.True(h.IsConnected())
+
+	select {
+	case line := <-lines:
+		assert.Contains(line, "hello again")
+	case <-time.After(time.Second):
+		require.FailNow("expected the entry to be sent after reconnecting")
+	}
+}
+
+func TestRoute(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	appListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer appListener.Close()
+
+	auditListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer auditListener.Close()
+
+	appLines, _ := acceptLines(t, appListener)
+	auditLines, _ := acceptLines(t, auditListener)
+
+	log := logrus.New()
+	log.Out = io.Discard
+
+	hook, err := New("tcp", appListener.Addr().String(), &logrus.JSONFormatter{}, HookOptions{
+		Routes: map[string]string{"audit": auditListener.Addr().String()},
+		Route: func(e *logrus.Entry) string {
+			if e.Data["audit"] == true {
+				return "audit"
+			}
+
+			return ""
+		},
+	})
+	require.NoError(err)
+	log.Hooks.Add(hook)
+
+	log.WithField("audit", true).Info("user logged in")
+	log.Info("request served")
+
+	select {
+	case line := <-auditLines:
+		assert.Contains(line, "user logged in")
+	case <-time.After(time.Second):
+		require.FailNow("expected the audit entry on the audit listener")
+	}
+
+	select {
+	case line := <-appLines:
+		assert.Contains(line, "request served")
+	case <-time.After(time.Second):
+		require.FailNow("expected the application entry on the default listener")
+	}
+
+	require.Eventually(func() bool { return hook.(*Hook).Stats().Sent == 2 }, time.Second, time.Millisecond)
+}
+
+func TestRefuseDuplicateHook(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	other, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer other.Close()
+
+	log := logrus.New()
+	log.Out = io.Discard
+
+	opts := HookOptions{TargetLogger: log, RefuseDuplicate: true}
+
+	hook, err := New("tcp", l.Addr().String(), &logrus.JSONFormatter{}, opts)
+	require.NoError(err)
+	log.Hooks.Add(hook)
+
+	_, err = New("tcp", l.Addr().String(), &logrus.JSONFormatter{}, opts)
+	assert.ErrorIs(err, ErrDuplicateHook)
+
+	_, err = New("tcp", other.Addr().String(), &logrus.JSONFormatter{}, opts)
+	assert.NoError(err)
+}
+
+func TestCountHooks(t *testing.T) {
+	assert := assert.New(t)
+
+	log := logrus.New()
+	h := &Hook{protocol: "tcp", addrs: []string{"127.0.0.1:8989"}}
+	log.Hooks.Add(h)
+	log.Hooks.Add(&Hook{protocol: "udp", addrs: []string{"127.0.0.1:8989"}})
+
+	hooks, duplicates := countHooks(log, "tcp", []string{"127.0.0.1:8989"})
+	assert.Equal(2, hooks)
+	assert.Equal(1, duplicates)
+}
+
+func TestNewWithContextCancel(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	lines, _ := acceptLines(t, l)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hook, err := NewWithContext(ctx, "tcp", l.Addr().String(), &logrus.JSONFormatter{})
+	require.NoError(err)
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "before cancel", Data: logrus.Fields{}}))
+	select {
+	case line := <-lines:
+		assert.Contains(line, "before cancel")
+	case <-time.After(time.Second):
+		require.FailNow("expected the entry to be sent before cancelling")
+	}
+
+	cancel()
+
+	select {
+	case <-hook.(*Hook).stopped:
+	case <-time.After(time.Second):
+		require.FailNow("expected the sending goroutine to stop")
+	}
+
+	assert.ErrorIs(hook.Fire(&logrus.Entry{Message: "after cancel", Data: logrus.Fields{}}), ErrClosed)
+}
+
+// panicFmt panics when formatting the entry with the "panic" message.
+type panicFmt struct {
+	logrus.JSONFormatter
+}
+
+func (f *panicFmt) Format(e *logrus.Entry) ([]byte, error) {
+	if e.Message == "panic" {
+		panic("bad entry")
+	}
+
+	return f.JSONFormatter.Format(e)
+}
+
+func TestDrainSurvivesPanic(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	lines, _ := acceptLines(t, l)
+
+	hook, err := New("tcp", l.Addr().String(), &panicFmt{})
+	require.NoError(err)
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "panic", Data: logrus.Fields{}}))
+	require.NoError(hook.Fire(&logrus.Entry{Message: "still alive", Data: logrus.Fields{}}))
+
+	select {
+	case line := <-lines:
+		assert.Contains(line, "still alive")
+	case <-time.After(time.Second):
+		require.FailNow("expected the entry after the panic to be sent")
+	}
+	assert.Equal(uint64(1), hook.(*Hook).Stats().Dropped)
+}
+
+// TestConcurrentFireWithReconnects fires entries from several goroutines while the
+// connections are killed over and over, it is meant to be run with -race.
+func TestConcurrentFireWithReconnects(t *testing.T) {
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	var mu sync.Mutex
+	var conns []net.Conn
+	done := make(chan struct{}, 1)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+
+			go func() {
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					if strings.Contains(scanner.Text(), "done") {
+						select {
+						case done <- struct{}{}:
+						default:
+						}
+					}
+				}
+			}()
+		}
+	}()
+
+	log := logrus.New()
+	log.Out = io.Discard
+
+	hook, err := New("tcp", l.Addr().String(), &logrus.JSONFormatter{})
+	require.NoError(err)
+	log.Hooks.Add(hook)
+
+	// kill the connections while the entries are fired
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(5 * time.Millisecond):
+				mu.Lock()
+				for _, conn := range conns {
+					conn.Close()
+				}
+				conns = nil
+				mu.Unlock()
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 200; j++ {
+				log.WithField("goroutine", i).Info("concurrent")
+				_ = hook.(*Hook).IsConnected()
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(stop)
+
+	require.Eventually(func() bool {
+		log.Info("done")
+
+		select {
+		case <-done:
+			return true
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}, 10*time.Second, time.Millisecond)
+}
+
+func TestNewFromConn(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := &safeBuffer{}
+
+	log := logrus.New()
+	log.Out = io.Discard
+
+	hook, err := NewFromConn(buffer, &logrus.JSONFormatter{})
+	require.NoError(err)
+	log.Hooks.Add(hook)
+
+	log.Info("hello from an established connection")
+	waitForWrite(t, buffer)
+
+	assert.Contains(buffer.String(), "hello from an established connection")
+	assert.True(hook.(*Hook).IsConnected())
+
+	_, err = NewFromConn(nil, &logrus.JSONFormatter{})
+	assert.Error(err)
+}
+
+// brokenConn is an io.Writer failing like a connection reset by the peer.
+type brokenConn struct{}
+
+func (brokenConn) Write(d []byte) (int, error) {
+	return 0, &net.OpError{Op: "write", Net: "tcp", Err: errors.New("connection reset by peer")}
+}
+
+func TestNewFromConnRedial(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := &safeBuffer{}
+
+	hook, err := NewFromConn(brokenConn{}, &logrus.JSONFormatter{}, HookOptions{
+		Redial: func() (io.Writer, error) { return buffer, nil },
+	})
+	require.NoError(err)
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "resent after redial", Data: logrus.Fields{}}))
+	waitForWrite(t, buffer)
+
+	assert.Contains(buffer.String(), "resent after redial")
+	assert.Equal(uint64(1), hook.(*Hook).Stats().Reconnects)
+}
+
+// blockingWriter blocks every write until it is released.
+type blockingWriter struct {
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(d []byte) (int, error) {
+	<-w.release
+	return len(d), nil
+}
+
+func TestOnBackpressure(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	w := &blockingWriter{release: make(chan struct{})}
+	defer close(w.release)
+
+	var mu sync.Mutex
+	var calls [][2]int
+
+	hook, err := NewFromConn(w, &logrus.JSONFormatter{}, HookOptions{
+		FireChannelBufferSize:     4,
+		BackpressureHighWaterMark: 3,
+		OnBackpressure: func(queueLen, queueCap int) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			calls = append(calls, [2]int{queueLen, queueCap})
+		},
+	})
+	require.NoError(err)
+
+	// the first entry is blocked in the writer, the next ones fill the queue
+	require.NoError(hook.Fire(&logrus.Entry{Data: logrus.Fields{}}))
+	require.Eventually(func() bool { return len(hook.(*Hook).logrusEntryFireChannel) == 0 }, time.Second, time.Millisecond)
+	for i := 0; i < 4; i++ {
+		require.NoError(hook.Fire(&logrus.Entry{Data: logrus.Fields{}}))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal([][2]int{{3, 4}}, calls)
+}
+
+func TestLazyConnect(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// reserve an address nobody listens on yet
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	addr := l.Addr().String()
+	require.NoError(l.Close())
+
+	// connecting with the first entry is not a failure to send it
+	var reported atomic.Int32
+	hook, err := New("tcp", addr, &logrus.JSONFormatter{}, HookOptions{
+		LazyConnect:     true,
+		RetryBufferSize: 10,
+		ErrorHandler:    func(error, *logrus.Entry) { reported.Add(1) },
+	})
+	require.NoError(err, "a lazy hook must not dial on construction")
+	assert.False(hook.(*Hook).IsConnected())
+
+	l, err = net.Listen("tcp", addr)
+	require.NoError(err)
+	defer l.Close()
+
+	lines, _ := acceptLines(t, l)
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "first entry", Data: logrus.Fields{}}))
+
+	select {
+	case line := <-lines:
+		assert.Contains(line, "first entry")
+	case <-time.After(time.Second):
+		require.FailNow("expected the first entry to establish the connection")
+	}
+	assert.True(hook.(*Hook).IsConnected())
+	assert.Zero(reported.Load())
+	assert.Zero(hook.(*Hook).Stats().Failed)
+	assert.Zero(hook.(*Hook).Stats().Reconnects)
+}
+
+func TestClose(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	lines, _ := acceptLines(t, l)
+
+	hook, err := New("tcp", l.Addr().String(), &logrus.JSONFormatter{})
+	require.NoError(err)
+
+	for i := 0; i < 100; i++ {
+		require.NoError(hook.Fire(&logrus.Entry{Message: fmt.Sprintf("entry %d", i), Data: logrus.Fields{}}))
+	}
+	require.NoError(hook.(*Hook).Close())
+
+	assert.ErrorIs(hook.Fire(&logrus.Entry{Message: "after close", Data: logrus.Fields{}}), ErrClosed)
+	assert.NoError(hook.(*Hook).Close(), "closing twice must be harmless")
+
+	// every queued entry is sent before the connection is closed
+	for i := 0; i < 100; i++ {
+		select {
+		case line := <-lines:
+			assert.Contains(line, fmt.Sprintf(`"entry %d"`, i))
+		case <-time.After(time.Second):
+			require.FailNow("expected every queued entry to be sent", "missing entry %d", i)
+		}
+	}
+	assert.Equal(uint64(100), hook.(*Hook).Stats().Sent)
+}
+
+func TestSynchronous(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := &safeBuffer{}
+	hook, err := NewWithWriter(buffer, WithFormatter(&logrus.JSONFormatter{}), WithSynchronous(), WithBatching(10, 0))
+	require.NoError(err)
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "batched", Data: logrus.Fields{}}))
+	assert.Empty(buffer.String())
+	assert.Zero(hook.(*Hook).Stats().QueueCapacity)
+
+	// the batched entries are written on close
+	require.NoError(hook.(*Hook).Close())
+	assert.Contains(buffer.String(), `"msg":"batched"`)
+	assert.ErrorIs(hook.Fire(&logrus.Entry{Message: "after close", Data: logrus.Fields{}}), ErrClosed)
+
+	// the entry is written before Fire returns
+	buffer = &safeBuffer{}
+	hook, err = NewWithWriter(buffer, WithFormatter(&logrus.JSONFormatter{}), WithSynchronous())
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "written inline", Data: logrus.Fields{}}))
+	assert.Contains(buffer.String(), `"msg":"written inline"`)
+}
+
+func TestSynchronousDeliveryError(t *testing.T) {
+	assert := assert.New(t)
+
+	hook, err := NewWithWriter(FailWrite{}, WithSynchronous())
+	require.NoError(t, err)
+	defer hook.(*Hook).Close()
+
+	assert.Error(hook.Fire(&logrus.Entry{Message: "lost", Data: logrus.Fields{}}))
+	assert.Equal(uint64(1), hook.(*Hook).Stats().Dropped)
+}
+
+func TestReconnectTimeout(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// an address nothing listens on anymore
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	addr := l.Addr().String()
+	require.NoError(l.Close())
+
+	h := &Hook{
+		writer:    brokenConn{},
+		protocol:  "tcp",
+		addrs:     []string{addr},
+		formatter: &logrus.JSONFormatter{},
+		opts:      HookOptions{ReconnectTimeout: 100 * time.Millisecond},
+	}
+
+	start := time.Now()
+	err = h.Fire(&logrus.Entry{Message: "lost", Data: logrus.Fields{}})
+	assert.Error(err)
+	assert.Less(time.Since(start), time.Second)
+	assert.Equal(uint64(2), h.Stats().Reconnects)
+}
+
+func TestMaxReconnectAttempts(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// an address nothing listens on anymore
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	addr := l.Addr().String()
+	require.NoError(l.Close())
+
+	h := &Hook{
+		writer:    brokenConn{},
+		protocol:  "tcp",
+		addrs:     []string{addr},
+		formatter: &logrus.JSONFormatter{},
+		opts:      HookOptions{MaxReconnectAttempts: 3, Backoff: ConstantBackoff(time.Millisecond)},
+	}
+
+	assert.Error(h.Fire(&logrus.Entry{Message: "lost", Data: logrus.Fields{}}))
+	assert.Equal(uint64(3), h.Stats().Reconnects)
+
+	// the entries are written to the fallback writer once the attempts are exhausted
+	fallback := &bytes.Buffer{}
+	h.opts.FallbackWriter = fallback
+
+	assert.NoError(h.Fire(&logrus.Entry{Message: "kept aside", Data: logrus.Fields{}}))
+	assert.Contains(fallback.String(), `"msg":"kept aside"`)
+	assert.Equal(uint64(6), h.Stats().Reconnects)
+}
+
+func TestErrorHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	failed := make(chan *logrus.Entry, 1)
+	var handled error
+
+	hook, err := NewWithWriter(FailWrite{}, WithErrorHandler(func(err error, e *logrus.Entry) {
+		handled = err
+		failed <- e
+	}))
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "not delivered", Data: logrus.Fields{}}))
+
+	select {
+	case e := <-failed:
+		require.NotNil(e)
+		assert.Equal("not delivered", e.Message)
+		assert.Error(handled)
+	case <-time.After(time.Second):
+		t.Fatal("error not handled")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// an address nothing listens on anymore
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	addr := l.Addr().String()
+	require.NoError(l.Close())
+
+	diagnostics := &bytes.Buffer{}
+	h := &Hook{
+		writer:    brokenConn{},
+		protocol:  "tcp",
+		addrs:     []string{addr},
+		formatter: &logrus.JSONFormatter{},
+		opts:      HookOptions{MaxReconnectAttempts: 1, Diagnostics: diagnostics},
+	}
+
+	assert.Error(h.Fire(&logrus.Entry{Message: "lost", Data: logrus.Fields{}}))
+	assert.Contains(diagnostics.String(), "logrus entry fire channel is not initialized or closed")
+	assert.Contains(diagnostics.String(), "reconnecting...")
+	assert.Contains(diagnostics.String(), "giving up after 1 attempts")
+}
@@ -0,0 +1,173 @@
+package logrustash
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultGELFChunkSize is the default size of the GELF chunks sent over UDP,
+	// small enough to fit the MTU of most networks.
+	DefaultGELFChunkSize = 1420
+
+	gelfChunkHeaderSize = 12
+	gelfMaxChunks       = 128
+)
+
+var (
+	gelfChunkMagic = []byte{0x1e, 0x0f}
+	gelfInvalidKey = regexp.MustCompile(`[^\w.\-]`)
+
+	// ErrGELFMessageTooLarge is returned when a message does not fit the 128 chunks allowed by GELF.
+	ErrGELFMessageTooLarge = errors.New("gelf message too large")
+)
+
+// GELFFormatter formats the entries as GELF 1.1 messages for Graylog:
+// the first line of the message is the "short_message", the whole message is the
+// "full_message" if it has several lines, the level is mapped to a syslog severity
+// and the fields are added as additional fields prefixed with "_".
+//
+// The entries are terminated by a newline like the logrus formatters, use
+// DelimiterFramer([]byte{0}) for the GELF TCP input.
+type GELFFormatter struct {
+	// Host is the "host" of the messages, the host name reported by the kernel by default.
+	Host string
+	// Fields are added to every message unless given in the entry data.
+	Fields logrus.Fields
+}
+
+// Format formats the entry as a GELF message.
+func (f GELFFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	host := f.Host
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+
+	short, _, multiline := strings.Cut(strings.TrimSpace(e.Message), "\n")
+	if short == "" {
+		// GELF requires a short message
+		short = "-"
+	}
+
+	t := e.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	msg := map[string]interface{}{
+		"version":       "1.1",
+		"host":          host,
+		"short_message": short,
+		"timestamp":     float64(t.Unix()) + float64(t.Nanosecond())/float64(time.Second),
+		"level":         syslogSeverities[e.Level],
+	}
+	if multiline {
+		msg["full_message"] = e.Message
+	}
+
+	for k, v := range f.Fields {
+		msg[gelfKey(k)] = gelfValue(v)
+	}
+	for k, v := range e.Data {
+		msg[gelfKey(k)] = gelfValue(v)
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the gelf message: %w", err)
+	}
+
+	return append(data, '\n'), nil
+}
+
+// gelfKey returns the key of the additional field `k`, prefixed with "_" and
+// with the characters GELF does not allow replaced by "_". The reserved "_id" becomes "_id_".
+func gelfKey(k string) string {
+	k = "_" + gelfInvalidKey.ReplaceAllString(k, "_")
+	if k == "_id" {
+		return "_id_"
+	}
+
+	return k
+}
+
+// gelfValue returns the value of an additional field, GELF only allows strings and numbers.
+func gelfValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case error:
+		return v.Error()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// gelfConn sends every write as a GELF message over UDP, compressed with zlib if `compress`
+// is set and split into chunks if it does not fit a single datagram of `chunkSize` bytes.
+type gelfConn struct {
+	net.Conn
+
+	chunkSize int
+	compress  bool
+}
+
+// Write sends `data` as a single GELF message.
+func (c *gelfConn) Write(data []byte) (int, error) {
+	msg := data
+	if c.compress {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return 0, err
+		}
+		if err := zw.Close(); err != nil {
+			return 0, err
+		}
+
+		msg = buf.Bytes()
+	}
+
+	if len(msg) <= c.chunkSize {
+		if _, err := c.Conn.Write(msg); err != nil {
+			return 0, err
+		}
+
+		return len(data), nil
+	}
+
+	payloadSize := c.chunkSize - gelfChunkHeaderSize
+	count := (len(msg) + payloadSize - 1) / payloadSize
+	if count > gelfMaxChunks {
+		return 0, fmt.Errorf("%w: %d bytes", ErrGELFMessageTooLarge, len(msg))
+	}
+
+	chunk := make([]byte, 0, c.chunkSize)
+	id := rand.Uint64()
+	for seq := 0; seq < count; seq++ {
+		chunk = append(chunk[:0], gelfChunkMagic...)
+		chunk = binary.BigEndian.AppendUint64(chunk, id)
+		chunk = append(chunk, byte(seq), byte(count))
+		chunk = append(chunk, msg[seq*payloadSize:min((seq+1)*payloadSize, len(msg))]...)
+
+		if _, err := c.Conn.Write(chunk); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(data), nil
+}
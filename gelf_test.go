@@ -0,0 +1,175 @@
+package logrustash
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGELFFormatter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	entry := &logrus.Entry{
+		Message: "request failed\ngoroutine 1 [running]:",
+		Level:   logrus.ErrorLevel,
+		Time:    time.Unix(1700000000, 500000000),
+		Data: logrus.Fields{
+			"id":          "abc",
+			"status":      500,
+			"err":         errors.New("boom"),
+			"user name":   "alice",
+			"cached":      true,
+			"environment": "staging",
+		},
+	}
+
+	res, err := GELFFormatter{Host: "web-1", Fields: logrus.Fields{"environment": "production", "app": "checkout"}}.Format(entry)
+	require.NoError(err)
+	assert.True(bytes.HasSuffix(res, []byte("\n")))
+
+	var msg map[string]interface{}
+	require.NoError(json.Unmarshal(res, &msg))
+
+	assert.Equal("1.1", msg["version"])
+	assert.Equal("web-1", msg["host"])
+	assert.Equal("request failed", msg["short_message"])
+	assert.Equal(entry.Message, msg["full_message"])
+	assert.Equal(1700000000.5, msg["timestamp"])
+	assert.Equal(float64(3), msg["level"])
+	assert.Equal("abc", msg["_id_"])
+	assert.Equal(float64(500), msg["_status"])
+	assert.Equal("boom", msg["_err"])
+	assert.Equal("alice", msg["_user_name"])
+	assert.Equal("true", msg["_cached"])
+	assert.Equal("staging", msg["_environment"], "the fields of the entry are not overridden by the defaults")
+	assert.Equal("checkout", msg["_app"])
+
+	res, err = GELFFormatter{}.Format(&logrus.Entry{Level: logrus.InfoLevel})
+	require.NoError(err)
+
+	msg = nil
+	require.NoError(json.Unmarshal(res, &msg))
+	assert.Equal("-", msg["short_message"])
+	assert.NotContains(msg, "full_message")
+	assert.NotEmpty(msg["host"])
+	assert.Equal(float64(6), msg["level"])
+}
+
+// datagramConn records the datagrams written to it.
+type datagramConn struct {
+	net.Conn
+	datagrams [][]byte
+}
+
+func (c *datagramConn) Write(d []byte) (int, error) {
+	c.datagrams = append(c.datagrams, append([]byte(nil), d...))
+	return len(d), nil
+}
+
+// reassembleGELF returns the message sent in the GELF chunks `datagrams`.
+func reassembleGELF(t *testing.T, datagrams [][]byte) []byte {
+	t.Helper()
+
+	var msg []byte
+	for i, d := range datagrams {
+		require.Equal(t, gelfChunkMagic, d[:2])
+		require.Equal(t, binary.BigEndian.Uint64(datagrams[0][2:10]), binary.BigEndian.Uint64(d[2:10]))
+		require.Equal(t, byte(i), d[10])
+		require.Equal(t, byte(len(datagrams)), d[11])
+
+		msg = append(msg, d[gelfChunkHeaderSize:]...)
+	}
+
+	return msg
+}
+
+func TestGELFConnChunks(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conn := &datagramConn{}
+	c := &gelfConn{Conn: conn, chunkSize: 100}
+
+	n, err := c.Write([]byte("small"))
+	require.NoError(err)
+	assert.Equal(5, n)
+	assert.Equal([][]byte{[]byte("small")}, conn.datagrams)
+
+	large := []byte(strings.Repeat("0123456789", 100))
+	conn.datagrams = nil
+	n, err = c.Write(large)
+	require.NoError(err)
+	assert.Equal(len(large), n)
+	assert.Len(conn.datagrams, 12)
+	for _, d := range conn.datagrams {
+		assert.LessOrEqual(len(d), 100)
+	}
+	assert.Equal(large, reassembleGELF(t, conn.datagrams))
+
+	_, err = c.Write(make([]byte, 129*88))
+	assert.ErrorIs(err, ErrGELFMessageTooLarge)
+}
+
+func TestGELFConnCompress(t *testing.T) {
+	require := require.New(t)
+
+	conn := &datagramConn{}
+	c := &gelfConn{Conn: conn, chunkSize: DefaultGELFChunkSize, compress: true}
+
+	data := []byte(strings.Repeat("compressible ", 1000))
+	_, err := c.Write(data)
+	require.NoError(err)
+	require.Len(conn.datagrams, 1)
+
+	zr, err := zlib.NewReader(bytes.NewReader(conn.datagrams[0]))
+	require.NoError(err)
+	decompressed, err := io.ReadAll(zr)
+	require.NoError(err)
+	require.Equal(data, decompressed)
+}
+
+func TestWithGELF(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(err)
+	defer pc.Close()
+
+	hook, err := NewWithOptions("udp", pc.LocalAddr().String(), WithGELF(64, false))
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "sent to graylog", Level: logrus.WarnLevel, Data: logrus.Fields{"attempt": 1}}))
+
+	var datagrams [][]byte
+	buf := make([]byte, 65536)
+	require.NoError(pc.SetReadDeadline(time.Now().Add(time.Second)))
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		require.NoError(err)
+
+		datagrams = append(datagrams, append([]byte(nil), buf[:n]...))
+		if int(datagrams[0][11]) == len(datagrams) {
+			break
+		}
+	}
+
+	var msg map[string]interface{}
+	require.NoError(json.Unmarshal(reassembleGELF(t, datagrams), &msg))
+	assert.Equal("sent to graylog", msg["short_message"])
+	assert.Equal(float64(4), msg["level"])
+	assert.Equal(float64(1), msg["_attempt"])
+}
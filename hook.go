@@ -1,15 +1,25 @@
 package logrustash
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
 	"os"
+	"path/filepath"
+	"reflect"
 	"runtime"
 	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/samber/lo"
 	"github.com/sirupsen/logrus"
@@ -19,23 +29,76 @@ const (
 	defaultLogrusEntryFireChannelBufferSize = 8192
 )
 
+// ErrClosed is returned when an entry is fired to a hook which has been shut down.
+var ErrClosed = errors.New("logstash hook is closed")
+
+// ErrDuplicateHook is returned when HookOptions.RefuseDuplicate is set and a hook
+// sending to the same address is already registered on HookOptions.TargetLogger.
+var ErrDuplicateHook = errors.New("a logstash hook sending to the same address is already registered")
+
+// errRetryBufferFull is the reason the oldest entries kept for retry are dropped for.
+var errRetryBufferFull = errors.New("the retry buffer is full")
+
+// FieldKeyFormatDegraded marks the entries formatted by HookOptions.FallbackFormatter.
+const FieldKeyFormatDegraded = "_format_degraded"
+
+// ErrNotConnected is reported when an entry is sent while the hook has no connection to Logstash.
+var ErrNotConnected = errors.New("not connected to logstash")
+
 type ContextKey string
 
 const (
 	ContextKeyRuntimeCaller ContextKey = "context.key.runtime.caller"
+	// ContextKeyFields holds logrus.Fields which LogstashFormatter adds at the top level
+	// of the document instead of merging them into the "fields" field.
+	ContextKeyFields ContextKey = "context.key.fields"
 )
 
 // Hook represents a Logstash hook.
 // It has two fields: writer to write the entry to Logstash and
 // formatter to format the entry to a Logstash format before sending.
 //
-// To initialize it use the `New` function.
+// To initialize it use the `New` or `NewMulti` function.
 type Hook struct {
 	sync.RWMutex
 
-	conn                   io.Writer
+	writer                 io.Writer
+	generation             uint64
+	writeMu                sync.Mutex
+	reconnectMu            sync.Mutex
 	protocol               string
-	addr                   string
+	addrs                  []string
+	addrIndex              int
+	nextFailback           atomic.Int64
+	failingBack            atomic.Bool
+	probing                atomic.Bool
+	resolving              atomic.Bool
+	nextResolve            atomic.Int64
+	inflight               atomic.Int64
+	connsClosed            bool
+	connected              bool
+	stats                  stats
+	retryBuffer            [][]byte
+	queue                  *diskQueue
+	routes                 map[string]*Hook
+	balancer               *balancer
+	limiter                *rateLimiter
+	limiterOnce            sync.Once
+	breadcrumbs            breadcrumbs
+	repeats                repeats
+	dedup                  dedup
+	batch                  batch
+	deadLetters            deadLetters
+	breaker                breaker
+	ctx                    context.Context
+	fireMu                 sync.RWMutex
+	closed                 bool
+	closing                chan struct{}
+	stopped                chan struct{}
+	syncs                  chan chan struct{}
+	sending                sync.WaitGroup
+	closeErr               error
+	opts                   HookOptions
 	logrusEntryFireChannel chan *logrus.Entry
 	formatter              logrus.Formatter
 }
@@ -47,150 +110,1675 @@ type HookOptions struct {
 	KeepAlivePeriod time.Duration
 	// FireChannelBufferSize sets the size of the logrus entry fire channel.
 	FireChannelBufferSize int
+	// Levels, if set, are the levels of the entries sent to Logstash, e.g. logrus.AllLevels[:logrus.WarnLevel+1]
+	// for warnings and more severe entries only. By default the entries of all levels are sent.
+	Levels []logrus.Level
+	// Filter, if set, reports whether an entry is sent to Logstash, it is called by Fire before the entry
+	// is queued, e.g. to skip the logs of the health check requests. Like the entries of the other levels,
+	// the entries filtered out are not counted in the Stats.
+	Filter func(*logrus.Entry) bool
+	// StackTrace adds the stack trace of the goroutine logging the error, fatal and panic entries
+	// under FieldKeyStackTrace, unless they have one. It is captured by Fire from the function which
+	// logged the entry, skipping the frames of logrus, slog and of the hook.
+	StackTrace bool
+	// StackTraceSkip is the number of frames skipped at the top of the stack traces, besides the ones
+	// of logrus and of the hook, e.g. 1 if the entries are logged by a helper function.
+	StackTraceSkip int
+	// SentAtKey, if set, adds the time the entry is handed to the connection under this key
+	// (e.g. "sent_at"), comparing it with "@timestamp" reveals the queueing and processing delay.
+	SentAtKey string
+	// Metadata, if set, is added to every entry at the top level, e.g. DetectMetadata().
+	Metadata *Metadata
+	// Enrichers, if set, describe the environment the process is running in, e.g. KubernetesMetadata,
+	// their fields are added to every entry at the top level.
+	Enrichers []Enricher
+	// DynamicFields, if set, are fields computed for every entry right before it is formatted,
+	// e.g. the request ID from the entry context or the number of goroutines, they are added
+	// at the top level of the entry by their key.
+	DynamicFields map[string]func(*logrus.Entry) interface{}
+	// TraceContext, if set, returns the trace context of the entry context (entry.Context), e.g. of its
+	// OpenTelemetry span, added to the entries as FieldKeyTraceID, FieldKeySpanID and FieldKeyTraceFlags
+	// so the logs can be correlated with the traces. It reports false if there is none.
+	TraceContext func(ctx context.Context) (TraceContext, bool)
+	// Middleware, if set, are the transformations applied in turn to every entry right before it is
+	// formatted, once the other fields were added, e.g. renaming fields, adding defaults or rewriting
+	// messages. They are given a copy of the entry they may modify, an entry is dropped if one returns nil.
+	Middleware []func(*logrus.Entry) *logrus.Entry
+	// IncludeFields, if set, are the only fields of the entry data sent, the others are removed
+	// before the entry is formatted, whatever the formatter. The keys are case-insensitive.
+	IncludeFields []string
+	// ExcludeFields, if set, are the fields of the entry data removed before the entry is formatted,
+	// e.g. "password" or "authorization", so that they never leave the process. The keys are case-insensitive.
+	ExcludeFields []string
+	// Redactor, if set, masks the sensitive values of the message and the entry data, e.g. emails
+	// or tokens, before the entry is formatted, whatever the formatter.
+	Redactor *Redactor
+	// RetryBufferSize sets how many entries which failed to be sent are kept in memory,
+	// they are replayed oldest first once sending succeeds again. When the connection is lost,
+	// the hook reconnects in the background and the entries are kept meanwhile, instead of waiting
+	// for it, then replayed once it is reconnected.
+	// When the buffer is full the oldest entry is dropped. Disabled when zero.
+	RetryBufferSize int
+	// QueueDir, if set, is the directory the entries which failed to be sent are persisted in,
+	// instead of the memory (see RetryBufferSize), so that they survive long outages and restarts.
+	// They are sent first once reconnected, the ones left by a previous run as soon as the hook is
+	// connected. The entries which overflow the queue of entries to be sent with OverflowDropNewest
+	// or OverflowDropOldest are persisted as well, instead of being dropped.
+	// Every hook needs its own directory.
+	QueueDir string
+	// QueueMaxBytes is the maximum size of the persisted entries, the oldest segment of entries is
+	// dropped when it is exceeded, defaults to 100MiB.
+	QueueMaxBytes int64
+	// QueueSegmentBytes is the size of the segment files the entries are persisted in, defaults to 4MiB.
+	QueueSegmentBytes int64
+	// DeadLetter, if set, receives the entries given up on, e.g. which failed to be formatted
+	// or sent and could not be kept for retry, as lines of JSON (see DeadLetter) holding
+	// the reason, so they can be replayed later.
+	DeadLetter io.Writer
+	// FallbackFormatter, if set, formats the entries the hook's formatter fails to format,
+	// so they are still delivered in a degraded form. Such entries are marked with
+	// a "_format_degraded" field set to true.
+	FallbackFormatter logrus.Formatter
+	// Routes maps endpoint names to Logstash addresses entries can be routed to by Route.
+	Routes map[string]string
+	// Route selects the endpoint of Routes an entry is sent to, the entries Route
+	// returns an unknown name for are sent to the hook's own address, e.g. RouteByLevel.
+	// Every endpoint has its own queue and connection.
+	Route func(*logrus.Entry) string
+	// MaxEntriesPerSecond, if set, limits the rate of the entries sent to Logstash,
+	// the entries beyond the limit are dropped by Fire before being queued.
+	// Fatal and panic entries are never dropped.
+	MaxEntriesPerSecond int
+	// MaxEntriesBurst is the number of entries which can be sent at once beyond MaxEntriesPerSecond,
+	// defaults to MaxEntriesPerSecond.
+	MaxEntriesBurst int
+	// SampleRate, if set between 0 and 1, is the probability an entry is sent with, the other
+	// entries are dropped by Fire before being queued. Fatal and panic entries are never dropped.
+	SampleRate float64
+	// BreadcrumbSize, if set, keeps the last BreadcrumbSize entries of BreadcrumbLevel
+	// or less severe in memory instead of sending them. They are sent, oldest first,
+	// right before the next warning or more severe entry to give context around failures.
+	BreadcrumbSize int
+	// BreadcrumbLevel is the most severe level of the entries kept as breadcrumbs, defaults to logrus.DebugLevel.
+	// The warning and more severe entries are never kept as breadcrumbs.
+	BreadcrumbLevel logrus.Level
+	// SuppressRepeats suppresses the entries identical to the previous one (same level, message
+	// and fields), the last of them is sent with the number of repeats in the "repeated" field
+	// once a different entry is fired, or every RepeatSummaryInterval.
+	SuppressRepeats bool
+	// RepeatSummaryInterval, if set, is the interval the summary of the suppressed repeats is sent at.
+	RepeatSummaryInterval time.Duration
+	// DedupWindow, if set, collapses the identical consecutive entries (same level, message
+	// and fields) fired within this window into a single entry sent once the window is over
+	// or a different entry is fired, with the number of occurrences in the "repeat_count" field.
+	// Unlike SuppressRepeats, the entry is held back until then. It takes precedence over SuppressRepeats.
+	DedupWindow time.Duration
+	// Synchronous, if set, makes Fire format and write the entry itself instead of queueing it,
+	// returning the delivery error to logrus, so that no entry is lost when the process exits
+	// right after logging, e.g. a short-lived CLI tool. The entries kept for retry, batched
+	// or held back are sent on Close, the periodic flushes are not done in this mode.
+	Synchronous bool
+	// ContextAwareFire, if set, makes Fire stop waiting for an entry once its context (entry.Context)
+	// is done and return the context's error: when the queue is full, the entry is dropped instead of
+	// blocking, and in Synchronous mode, the entry keeps being sent in the background.
+	ContextAwareFire bool
+	// GELF, if set, sends every entry over UDP as a GELF message, split into chunks of
+	// GELFChunkSize bytes when it does not fit a single datagram, e.g. for Graylog.
+	// It is meant to be used with GELFFormatter and without batching, every write being a message.
+	GELF bool
+	// GELFChunkSize is the size of the GELF chunks, DefaultGELFChunkSize if zero.
+	GELFChunkSize int
+	// GELFCompress compresses the GELF messages sent over UDP with zlib.
+	GELFCompress bool
+	// FluentTag, if set, sends the entries over the Fluentd forward protocol with this tag, every
+	// write being a chunk of events, e.g. to Fluentd or Fluent Bit. It is meant to be used with FluentFormatter.
+	FluentTag string
+	// FluentAck waits for Fluentd to acknowledge every chunk, for at-least-once delivery.
+	FluentAck bool
+	// FluentAckTimeout is the time waited for an acknowledgment, defaults to 10 seconds.
+	FluentAckTimeout time.Duration
+	// Framer, if set, re-frames the formatted entries before they are written,
+	// by default the entries are written as formatted, e.g. newline-delimited JSON.
+	Framer Framer
+	// MaxMessageBytes, if set, is the maximum size of a formatted entry, before it is framed,
+	// e.g. the maximum frame size of the Logstash input. The larger entries are handled
+	// according to OversizePolicy.
+	MaxMessageBytes int
+	// OversizePolicy is what is done with the entries larger than MaxMessageBytes,
+	// by default their message is truncated, see OversizeTruncate. The entries written
+	// with a WriteSyncer are dropped whatever the policy, they are not formatted by the hook.
+	OversizePolicy OversizePolicy
+	// OnBackpressure, if set, is called by Fire when the number of queued entries reaches
+	// BackpressureHighWaterMark, so the application can shed load before entries are lost.
+	OnBackpressure func(queueLen, queueCap int)
+	// BackpressureHighWaterMark is the number of queued entries OnBackpressure is called from,
+	// defaults to the capacity of the queue, i.e. when it is full.
+	BackpressureHighWaterMark int
+	// OnConnect, if set, is called whenever the hook establishes a connection to Logstash at `addr`,
+	// the reconnections included. `addr` is empty for the connections returned by Redial.
+	OnConnect func(addr string)
+	// OnDisconnect, if set, is called when the connection to Logstash at `addr` is lost,
+	// with the error it was lost with.
+	OnDisconnect func(addr string, err error)
+	// OnReconnect, if set, is called when the hook reconnected to Logstash at `addr` after losing
+	// its connection, `attempts` being the number of attempts it took.
+	OnReconnect func(addr string, attempts int)
+	// ErrorHandler, if set, is called with the errors which can not be returned to the caller
+	// instead of printing them to stderr, e.g. the failures to send the queued entries,
+	// with the entry concerned if any, which may be fired again.
+	ErrorHandler func(err error, e *logrus.Entry)
+	// Diagnostics, if set, receives the hook's own diagnostic messages (reconnections,
+	// recovered panics, send failures not handled by ErrorHandler) instead of stderr,
+	// e.g. io.Discard to silence them. Beware of writing them to a logger the hook is added to.
+	Diagnostics io.Writer
+	// MaxBatchSize, if greater than 1, batches the formatted entries, they are written at once
+	// when MaxBatchSize of them are batched or every FlushInterval, saving writes under load.
+	MaxBatchSize int
+	// FlushInterval is the interval the batched entries are written at, defaults to one second.
+	FlushInterval time.Duration
+	// Compress gzips the data written, i.e. every batch (see MaxBatchSize) or every entry
+	// when not batching, for the inputs and codecs accepting a gzip stream, e.g. the gzip_lines codec.
+	// HTTPWriter posts the compressed data with the Content-Encoding header. The writers parsing
+	// the entries written, e.g. LokiWriter or KafkaWriter, are refused, see HTTPOptions.Compress.
+	Compress bool
+	// CompressionLevel, if set, is the gzip compression level, from gzip.NoCompression to
+	// gzip.BestCompression, defaults to gzip.DefaultCompression.
+	CompressionLevel *int
+	// OverflowPolicy is what Fire does when the queue of entries is full,
+	// by default it blocks until there is room, see OverflowPolicy.
+	OverflowPolicy OverflowPolicy
+	// LazyConnect makes the constructors return without dialing, the connection is established
+	// when the first entry is sent, retrying in the background until Logstash is reachable.
+	LazyConnect bool
+	// Redial, if set, re-establishes the connection of a hook created by NewFromConn
+	// when writing to it fails.
+	Redial func() (io.Writer, error)
+	// TargetLogger, if set, is the logger the hook is going to be added to,
+	// the number of hooks already registered on it is reported on construction.
+	TargetLogger *logrus.Logger
+	// RefuseDuplicate makes the construction fail with ErrDuplicateHook when a hook
+	// sending to the same address is already registered on TargetLogger.
+	RefuseDuplicate bool
+	// DialFunc, if set, establishes the connections to Logstash instead of net.Dial,
+	// e.g. to choose the source address, the resolver or to go through a tunnel.
+	DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+	// DialTimeout, if set, is the time establishing a connection may take,
+	// both on construction and when reconnecting. By default the OS limit applies.
+	DialTimeout time.Duration
+	// LookupHost, if set, resolves the host of the addresses to IP addresses, they are dialed in turn.
+	// By default the host is resolved by the dialer. Either way, it is resolved again on every reconnection.
+	LookupHost func(ctx context.Context, host string) ([]string, error)
+	// ResolveInterval, if set, is the interval at which the host of the address in use is resolved again,
+	// the hook reconnects if the IP address it is connected to is no longer among the ones resolved,
+	// e.g. the Logstash pod behind a Kubernetes Service was replaced. It should be about the TTL of the records.
+	ResolveInterval time.Duration
+	// Backoff, if set, computes the time waited for between the reconnection attempts,
+	// defaults to DefaultBackoff.
+	Backoff Backoff
+	// MaxReconnectAttempts, if set, is the number of attempts made to reconnect once the connection
+	// is lost, the entry being sent fails when they are exhausted (it is written to FallbackWriter
+	// if set), the next entry starts over. By default the hook tries to reconnect until it succeeds.
+	MaxReconnectAttempts int
+	// FailbackInterval, if set, is the interval at which the hook tries to reconnect to the first of its
+	// addresses, the preferred one, after it failed over to another one. It goes back to it as soon as
+	// it is reachable again. In Synchronous mode, the attempts are made by Fire once the interval elapsed.
+	FailbackInterval time.Duration
+	// LoadBalancing is how the entries are spread across the addresses of a hook created with multiple
+	// addresses, by default they are all sent to a single one, see BalanceFailover. With BalanceRoundRobin
+	// or BalanceLeastPending every address has its own connection and queue, the addresses which lost
+	// their connection are skipped while they are reconnected in the background.
+	LoadBalancing BalancePolicy
+	// Workers, if greater than 1, is the number of connections the entries are sent over concurrently,
+	// when a single connection can not keep up. Every worker has its own connection, failing over
+	// across the addresses on its own, and its own queue, the entries are given to the worker with
+	// the fewest waiting, so their order is not preserved. With LoadBalancing, every address has
+	// Workers connections. In Synchronous mode, the concurrent calls to Fire use different connections.
+	Workers int
+	// FallbackWriter, if set, receives the entries which could not be sent since reconnecting
+	// failed, see MaxReconnectAttempts and ReconnectTimeout, e.g. a local file.
+	FallbackWriter io.Writer
+	// CircuitBreakerThreshold, if set, is the number of consecutive failures to send or to reconnect
+	// after which the hook stops trying to send for CircuitBreakerCooldown, giving up reconnecting
+	// even when MaxReconnectAttempts and ReconnectTimeout are not set. The entries are kept for retry
+	// or given up on meanwhile, then a single entry is sent to probe whether Logstash recovered
+	// before resuming.
+	CircuitBreakerThreshold int
+	// CircuitBreakerCooldown is the time the hook stops trying to send for, defaults to 30 seconds.
+	CircuitBreakerCooldown time.Duration
+	// ReconnectTimeout, if set, is the time the hook keeps trying to reconnect for
+	// once the connection is lost, the entry being sent fails when it is exceeded.
+	// By default the hook tries to reconnect until it succeeds.
+	ReconnectTimeout time.Duration
+	// WriteTimeout, if set, is the time a write to the connection may take, so a stalled
+	// Logstash can not block the hook forever. The connection is re-established when
+	// a write times out since it may hold a partially written entry.
+	WriteTimeout time.Duration
+	// TLSConfig, if set, wraps the connections in TLS. The server name defaults to
+	// the host of the address dialed when not set.
+	TLSConfig *tls.Config
+}
+
+// GetKeepAlivePeriod returns the keep alive period, defaults to 30 seconds.
+func (h HookOptions) GetKeepAlivePeriod() time.Duration {
+	if h.KeepAlivePeriod > 0 {
+		return h.KeepAlivePeriod
+	}
+
+	return time.Second * 30
+}
+
+// GetFireChannelBufferSize returns the fire channel buffer size, defaults to 8192.
+func (h HookOptions) GetFireChannelBufferSize() int {
+	if h.FireChannelBufferSize > 0 {
+		return h.FireChannelBufferSize
+	}
+
+	return defaultLogrusEntryFireChannelBufferSize
+}
+
+// GetBackpressureHighWaterMark returns the backpressure high-water mark, defaults to `queueCap`.
+func (h HookOptions) GetBackpressureHighWaterMark(queueCap int) int {
+	if h.BackpressureHighWaterMark > 0 && h.BackpressureHighWaterMark < queueCap {
+		return h.BackpressureHighWaterMark
+	}
+
+	return queueCap
+}
+
+// GetBackoff returns the reconnection backoff, defaults to DefaultBackoff.
+func (h HookOptions) GetBackoff() Backoff {
+	if h.Backoff != nil {
+		return h.Backoff
+	}
+
+	return DefaultBackoff
+}
+
+// GetFlushInterval returns the interval the batched entries are written at, defaults to one second.
+func (h HookOptions) GetFlushInterval() time.Duration {
+	if h.FlushInterval > 0 {
+		return h.FlushInterval
+	}
+
+	return time.Second
+}
+
+// GetGELFChunkSize returns the size of the GELF chunks, defaults to DefaultGELFChunkSize.
+func (h HookOptions) GetGELFChunkSize() int {
+	if h.GELFChunkSize > gelfChunkHeaderSize {
+		return h.GELFChunkSize
+	}
+
+	return DefaultGELFChunkSize
+}
+
+// GetFluentAckTimeout returns the time waited for Fluentd to acknowledge a chunk, defaults to 10 seconds.
+func (h HookOptions) GetFluentAckTimeout() time.Duration {
+	if h.FluentAckTimeout > 0 {
+		return h.FluentAckTimeout
+	}
+
+	return defaultFluentAckTimeout
+}
+
+// GetCompressionLevel returns the gzip compression level, defaults to gzip.DefaultCompression.
+func (h HookOptions) GetCompressionLevel() int {
+	if h.CompressionLevel != nil {
+		return *h.CompressionLevel
+	}
+
+	return gzip.DefaultCompression
+}
+
+// GetBreadcrumbLevel returns the most severe level of the breadcrumbs, defaults to logrus.DebugLevel
+// when BreadcrumbLevel is unset (logrus.PanicLevel).
+func (h HookOptions) GetBreadcrumbLevel() logrus.Level {
+	if h.BreadcrumbLevel != logrus.PanicLevel {
+		return h.BreadcrumbLevel
+	}
+
+	return logrus.DebugLevel
+}
+
+// GetQueueMaxBytes returns the maximum size of the persisted entries, defaults to 100MiB.
+func (h HookOptions) GetQueueMaxBytes() int64 {
+	if h.QueueMaxBytes > 0 {
+		return h.QueueMaxBytes
+	}
+
+	return defaultQueueMaxBytes
+}
+
+// GetQueueSegmentBytes returns the size of the segment files of the persisted entries, defaults to 4MiB.
+func (h HookOptions) GetQueueSegmentBytes() int64 {
+	if h.QueueSegmentBytes > 0 {
+		return h.QueueSegmentBytes
+	}
+
+	return defaultQueueSegmentBytes
+}
+
+// GetCircuitBreakerCooldown returns the time the circuit breaker stays open for, defaults to 30 seconds.
+func (h HookOptions) GetCircuitBreakerCooldown() time.Duration {
+	if h.CircuitBreakerCooldown > 0 {
+		return h.CircuitBreakerCooldown
+	}
+
+	return 30 * time.Second
 }
 
-// GetKeepAlivePeriod returns the keep alive period, defaults to 30 seconds.
-func (h HookOptions) GetKeepAlivePeriod() time.Duration {
-	if h.KeepAlivePeriod > 0 {
-		return h.KeepAlivePeriod
+// GetDiagnostics returns the writer of the diagnostic messages, defaults to os.Stderr.
+func (h HookOptions) GetDiagnostics() io.Writer {
+	if h.Diagnostics != nil {
+		return h.Diagnostics
+	}
+
+	return os.Stderr
+}
+
+// New returns a new logrus.Hook for Logstash
+func New(protocol, addr string, f logrus.Formatter, opts ...HookOptions) (logrus.Hook, error) {
+	if protocol == "" || addr == "" {
+		return nil, fmt.Errorf("protocol and addr must be set")
+	}
+
+	return NewMulti(protocol, []string{addr}, f, opts...)
+}
+
+// NewWithContext returns a new logrus.Hook for Logstash which stops sending entries once `ctx` is done.
+//
+// Cancelling `ctx` is equivalent to calling Close, except that the entries still queued
+// are not sent: the goroutine sending the entries stops, the connection is closed and
+// further calls to Fire return ErrClosed.
+func NewWithContext(ctx context.Context, protocol, addr string, f logrus.Formatter, opts ...HookOptions) (logrus.Hook, error) {
+	if protocol == "" || addr == "" {
+		return nil, fmt.Errorf("protocol and addr must be set")
+	}
+
+	h, err := newHook(ctx, protocol, []string{addr}, f, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// NewMulti returns a new logrus.Hook for Logstash which fails over across
+// multiple Logstash addresses.
+// The first reachable address of `addrs` is used initially, whenever the
+// connection to the active address fails, the hook rotates to the next one.
+func NewMulti(protocol string, addrs []string, f logrus.Formatter, opts ...HookOptions) (logrus.Hook, error) {
+	h, err := newHook(context.Background(), protocol, addrs, f, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// newHook returns a new Hook connected to one of `addrs`, sending the fired entries until `ctx` is done.
+func newHook(ctx context.Context, protocol string, addrs []string, f logrus.Formatter, opts ...HookOptions) (*Hook, error) {
+	if protocol == "" || len(addrs) == 0 || lo.Contains(addrs, "") {
+		return nil, fmt.Errorf("protocol and addrs must be set")
+	}
+
+	var opt HookOptions
+	// apply options
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	// diagnose the hooks already registered on the target logger
+	if opt.TargetLogger != nil {
+		hooks, duplicates := countHooks(opt.TargetLogger, protocol, addrs)
+		fmt.Fprintf(opt.GetDiagnostics(), "%d hooks already registered on the logger, %d of them sending to %s\n", hooks, duplicates, strings.Join(addrs, ","))
+
+		if opt.RefuseDuplicate && duplicates > 0 {
+			return nil, ErrDuplicateHook
+		}
+	}
+
+	var h *Hook
+	var err error
+	if (opt.LoadBalancing != BalanceFailover && len(addrs) > 1) || opt.Workers > 1 {
+		h, err = balanceHook(protocol, addrs, f, opt)
+	} else {
+		h, err = dialHook(protocol, addrs, f, opt)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// dial the named endpoints entries can be routed to
+	if opt.Route != nil && len(opt.Routes) > 0 {
+		routeOpt := opt
+		routeOpt.Routes = nil
+		routeOpt.Route = nil
+		// the entries are sampled and rate limited before being routed
+		routeOpt.MaxEntriesPerSecond = 0
+		routeOpt.SampleRate = 0
+
+		h.routes = make(map[string]*Hook, len(opt.Routes))
+		for name, addr := range opt.Routes {
+			// every route persists its entries in its own directory
+			if opt.QueueDir != "" {
+				routeOpt.QueueDir = filepath.Join(opt.QueueDir, queueDirName(name))
+			}
+
+			route, err := dialHook(protocol, []string{addr}, f, routeOpt)
+			if err != nil {
+				_ = h.closeConns()
+				_ = h.closeRoutes()
+				return nil, fmt.Errorf("failed to dial route %s: %w", name, err)
+			}
+
+			h.routes[name] = route
+		}
+	}
+
+	// every route has its own queue, a slow endpoint does not hold back the others
+	for _, route := range h.routes {
+		route.start(ctx)
+	}
+	if h.balancer != nil {
+		h.balancer.start(ctx)
+	}
+
+	h.start(ctx)
+	return h, nil
+}
+
+// NewFromConn returns a new logrus.Hook for Logstash which writes the entries to `conn`,
+// an already established connection (or any other io.Writer), instead of dialing by itself.
+//
+// Since the hook did not dial `conn`, it does not reconnect when writing fails
+// unless HookOptions.Redial is set. HookOptions.Routes are not supported.
+func NewFromConn(conn io.Writer, f logrus.Formatter, opts ...HookOptions) (logrus.Hook, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("conn must be set")
+	}
+
+	var opt HookOptions
+	// apply options
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	h, err := newWriterHook(context.Background(), conn, f, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// newWriterHook returns a new Hook writing to `w`, sending the fired entries until `ctx` is done.
+func newWriterHook(ctx context.Context, w io.Writer, f logrus.Formatter, opt HookOptions) (*Hook, error) {
+	if err := checkCompress(w, opt); err != nil {
+		return nil, err
+	}
+	// the data written is gzipped by the hook, it is posted with the Content-Encoding header
+	if hw, ok := w.(*HTTPWriter); ok && opt.Compress {
+		hw.gzipped = true
+	}
+
+	h := &Hook{
+		writer:    w,
+		formatter: f,
+		connected: true,
+		opts:      opt,
+	}
+
+	if err := h.openQueue(); err != nil {
+		return nil, err
+	}
+
+	h.start(ctx)
+	return h, nil
+}
+
+// start creates the fire channel and starts the goroutine handling it until `ctx` is done.
+func (h *Hook) start(ctx context.Context) {
+	h.ctx = ctx
+
+	// the entries left on disk by a previous run are sent right away, not with the next entry
+	if h.queue != nil && h.queue.len() > 0 && h.IsConnected() {
+		go h.replayRetries()
+	}
+
+	if h.opts.Synchronous {
+		// Fire sends the entries by itself
+		return
+	}
+
+	// create the fire channel
+	h.closing = make(chan struct{})
+	h.stopped = make(chan struct{})
+	h.syncs = make(chan chan struct{})
+	h.logrusEntryFireChannel = make(chan *logrus.Entry, h.opts.GetFireChannelBufferSize())
+
+	// split a goroutine to handle logrus entry fire channel
+	go h.drain()
+}
+
+// drain handles the logrus entry fire channel until the hook's context is done.
+// A panic while handling an entry drops the entry and restarts draining.
+func (h *Hook) drain() {
+	// defer recover
+	defer func() {
+		if r := recover(); r != nil {
+			h.stats.dropped.Add(1)
+			h.diagnosef("panic in logrus entry fire channel: %v\n%s", r, debug.Stack())
+
+			// keep draining, a single bad entry must not stop the logs from being sent
+			go h.drain()
+		}
+	}()
+
+	// send the summary of the suppressed repeats periodically
+	var repeatSummaryTick <-chan time.Time
+	if h.opts.SuppressRepeats && h.opts.RepeatSummaryInterval > 0 {
+		ticker := time.NewTicker(h.opts.RepeatSummaryInterval)
+		defer ticker.Stop()
+
+		repeatSummaryTick = ticker.C
+	}
+
+	// send the entries held back by the dedup window once it is over
+	var dedupTick <-chan time.Time
+	if h.opts.DedupWindow > 0 {
+		ticker := time.NewTicker(h.opts.DedupWindow)
+		defer ticker.Stop()
+
+		dedupTick = ticker.C
+	}
+
+	// go back to the preferred address periodically
+	var failbackTick <-chan time.Time
+	if h.opts.FailbackInterval > 0 && len(h.addrs) > 1 {
+		ticker := time.NewTicker(h.opts.FailbackInterval)
+		defer ticker.Stop()
+
+		failbackTick = ticker.C
+	}
+
+	// check periodically that the address in use still resolves to the IP address connected to
+	var resolveTick <-chan time.Time
+	if h.opts.ResolveInterval > 0 && len(h.addrs) > 0 {
+		ticker := time.NewTicker(h.opts.ResolveInterval)
+		defer ticker.Stop()
+
+		resolveTick = ticker.C
+	}
+
+	// write the batched entries periodically
+	var batchFlushTick <-chan time.Time
+	if h.batching() {
+		ticker := time.NewTicker(h.opts.GetFlushInterval())
+		defer ticker.Stop()
+
+		batchFlushTick = ticker.C
+	}
+
+	// handle logrus entry fire channel
+	for {
+		select {
+		case <-repeatSummaryTick:
+			h.flushRepeats()
+		case <-dedupTick:
+			h.flushDedup(false)
+		case <-batchFlushTick:
+			h.flushBatch()
+		case <-failbackTick:
+			h.startFailback()
+		case <-resolveTick:
+			h.startResolve()
+		case <-h.ctx.Done():
+			h.closeErr = h.closeConns()
+			close(h.stopped)
+			return
+		case <-h.closing:
+			h.flush()
+			// the routes send the entries routed to them before being closed
+			routesErr := h.closeRoutes()
+			h.closeErr = h.closeConns()
+			if h.closeErr == nil {
+				h.closeErr = routesErr
+			}
+			close(h.stopped)
+			return
+		case done := <-h.syncs:
+			h.flushQueued()
+			close(done)
+		case e := <-h.logrusEntryFireChannel:
+			h.handle(e)
+		}
+	}
+}
+
+// handle fires the entry taken from the fire channel.
+func (h *Hook) handle(e *logrus.Entry) {
+	if err := h.fire(e); err != nil {
+		h.stats.dropped.Add(1)
+		h.reportError(err, e)
+	}
+}
+
+// flush sends the entries still queued in the fire channel, the summary of the suppressed
+// repeats, the entry held back by the dedup window and the entries kept for retry.
+func (h *Hook) flush() {
+	for {
+		select {
+		case e := <-h.logrusEntryFireChannel:
+			h.handle(e)
+		default:
+			h.flushRepeats()
+			h.flushDedup(true)
+			h.flushBatch()
+			h.flushRetries()
+			return
+		}
+	}
+}
+
+// flushQueued sends the entries queued in the fire channel so far and the batched entries.
+func (h *Hook) flushQueued() {
+	for n := len(h.logrusEntryFireChannel); n > 0; n-- {
+		h.handle(<-h.logrusEntryFireChannel)
+	}
+	h.flushBatch()
+}
+
+// sync waits for the entries fired so far to be sent, the batched ones included, by the hook,
+// its routes and the addresses it balances the entries across, or for `ctx` to be done.
+// The entries are written by the time the writes return, the writers have nothing left to flush.
+func (h *Hook) sync(ctx context.Context) error {
+	if h.syncs != nil {
+		done := make(chan struct{})
+		select {
+		case h.syncs <- done:
+		case <-h.stopped:
+			// Close sent the entries still queued
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	} else {
+		h.flushBatch()
+	}
+
+	for _, route := range h.routes {
+		if err := route.sync(ctx); err != nil {
+			return err
+		}
+	}
+	if h.balancer != nil {
+		for _, m := range h.balancer.members {
+			if err := m.sync(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// flushRetries makes a last attempt to send the entries kept for retry,
+// the ones which can't be sent are dropped.
+func (h *Hook) flushRetries() {
+	h.RLock()
+	w := h.writer
+	h.RUnlock()
+
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	// the connection which failed is being replaced, the entries persisted on disk are sent by the next run
+	if w != nil && !h.probing.Load() {
+		if err := h.flushRetryBuffer(w); err != nil {
+			h.reportError(err, nil)
+		}
+	}
+
+	for _, data := range h.retryBuffer {
+		h.deadLetter(nil, data, ErrClosed)
+	}
+	h.stats.dropped.Add(uint64(len(h.retryBuffer)))
+	h.retryBuffer = nil
+}
+
+// Close stops accepting new entries, sends the entries still queued and closes the connection,
+// the goroutine sending the entries is stopped. Further calls to Fire return ErrClosed.
+func (h *Hook) Close() error {
+	h.fireMu.Lock()
+	alreadyClosed := h.closed
+	h.closed = true
+	h.fireMu.Unlock()
+
+	if h.stopped == nil {
+		// the hook has no goroutine sending the entries
+		if h.opts.Synchronous && !alreadyClosed {
+			// the entries still being sent after their context was done
+			h.sending.Wait()
+			h.flush()
+			routesErr := h.closeRoutes()
+			if err := h.closeConns(); err != nil {
+				return err
+			}
+
+			return routesErr
+		}
+
+		return h.closeConns()
+	}
+
+	if !alreadyClosed {
+		close(h.closing)
+	}
+	<-h.stopped
+
+	return h.closeErr
+}
+
+// countHooks returns the number of distinct hooks registered on the logger,
+// and how many of them are Logstash hooks sending to one of `addrs` with `protocol`.
+func countHooks(logger *logrus.Logger, protocol string, addrs []string) (hooks int, duplicates int) {
+	seen := make([]logrus.Hook, 0)
+	for _, levelHooks := range logger.Hooks {
+		for _, hook := range levelHooks {
+			if lo.ContainsBy(seen, func(h logrus.Hook) bool { return sameHook(h, hook) }) {
+				continue
+			}
+
+			seen = append(seen, hook)
+			if h, ok := hook.(*Hook); ok && h.protocol == protocol && len(lo.Intersect(h.addrs, addrs)) > 0 {
+				duplicates++
+			}
+		}
+	}
+
+	return len(seen), duplicates
+}
+
+// sameHook reports whether a and b are the same hook, hooks which can't be compared are never the same.
+func sameHook(a, b logrus.Hook) bool {
+	if !reflect.TypeOf(a).Comparable() || !reflect.TypeOf(b).Comparable() {
+		return false
+	}
+
+	return a == b
+}
+
+// dialHook returns a new Hook connected to the first reachable address of `addrs`,
+// without the goroutine handling the fire channel.
+func dialHook(protocol string, addrs []string, f logrus.Formatter, opt HookOptions) (*Hook, error) {
+	h := &Hook{
+		protocol:  protocol,
+		addrs:     append([]string(nil), addrs...),
+		formatter: f,
+		opts:      opt,
+	}
+
+	if err := h.openQueue(); err != nil {
+		return nil, err
+	}
+
+	// the connection is established when the first entry is sent
+	if opt.LazyConnect {
+		return h, nil
+	}
+
+	// dial the first reachable address
+	var err error
+	for i, addr := range h.addrs {
+		var conn net.Conn
+		conn, err = h.dial(addr)
+		if err == nil {
+			h.writer = conn
+			h.addrIndex = i
+			h.connected = true
+			if opt.OnConnect != nil {
+				opt.OnConnect(addr)
+			}
+			return h, nil
+		}
+	}
+
+	return nil, err
+}
+
+// closeConns closes the connection of the hook.
+func (h *Hook) closeConns() error {
+	h.Lock()
+	defer h.Unlock()
+
+	h.connsClosed = true
+	if c, ok := h.writer.(io.Closer); ok && c != nil {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// closeRoutes closes the routes of the hook and the addresses it balances the entries across,
+// sending the entries queued for them.
+func (h *Hook) closeRoutes() error {
+	var err error
+	for _, route := range h.routes {
+		if routeErr := route.Close(); err == nil {
+			err = routeErr
+		}
+	}
+	if h.balancer != nil {
+		for _, m := range h.balancer.members {
+			if memberErr := m.Close(); err == nil {
+				err = memberErr
+			}
+		}
+	}
+
+	return err
+}
+
+// dial connects to the given address and applies the connection related options.
+func (h *Hook) dial(addr string) (net.Conn, error) {
+	dial := h.opts.DialFunc
+	switch {
+	case dial != nil:
+	case strings.HasPrefix(h.protocol, "sctp"):
+		dial = dialSCTP
+	default:
+		dial = (&net.Dialer{}).DialContext
+	}
+	if h.opts.LookupHost != nil && !strings.HasPrefix(h.protocol, "sctp") {
+		dial = h.dialResolved(dial)
+	}
+
+	ctx := h.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if h.opts.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.opts.DialTimeout)
+		defer cancel()
+	}
+
+	conn, err := dial(ctx, h.protocol, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err = h.applyConnOptions(ctx, conn, addr)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// applyConnOptions applies the keep alive and TLS options to a freshly dialed connection.
+func (h *Hook) applyConnOptions(ctx context.Context, conn net.Conn, addr string) (net.Conn, error) {
+	var err error
+
+	// apply keep alive options, the SCTP associations having their own heartbeats
+	if h.opts.KeepAlive && !strings.HasPrefix(h.protocol, "sctp") {
+		if c, ok := conn.(*net.TCPConn); ok && c != nil {
+			err = c.SetKeepAlive(true)
+			if err != nil {
+				return conn, err
+			}
+
+			err = c.SetKeepAlivePeriod(h.opts.GetKeepAlivePeriod())
+			if err != nil {
+				return conn, err
+			}
+		}
+	}
+
+	if h.opts.TLSConfig != nil {
+		config := h.opts.TLSConfig.Clone()
+		if config.ServerName == "" {
+			host, _, splitErr := net.SplitHostPort(addr)
+			if splitErr != nil {
+				host = addr
+			}
+			config.ServerName = host
+		}
+
+		tlsConn := tls.Client(conn, config)
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			return conn, err
+		}
+
+		conn = tlsConn
+	}
+
+	if h.opts.FluentTag != "" && !strings.HasPrefix(h.protocol, "udp") {
+		conn = &fluentConn{Conn: conn, tag: h.opts.FluentTag, ack: h.opts.FluentAck, ackTimeout: h.opts.GetFluentAckTimeout()}
+	}
+
+	if h.opts.GELF && strings.HasPrefix(h.protocol, "udp") {
+		conn = &gelfConn{Conn: conn, chunkSize: h.opts.GetGELFChunkSize(), compress: h.opts.GELFCompress}
+	}
+
+	return conn, nil
+}
+
+// Addr returns the address of the Logstash endpoint currently in use.
+func (h *Hook) Addr() string {
+	h.RLock()
+	defer h.RUnlock()
+
+	return h.addr()
+}
+
+// addr returns the address currently in use, the lock of h must be held.
+func (h *Hook) addr() string {
+	if len(h.addrs) == 0 {
+		return ""
+	}
+
+	return h.addrs[h.addrIndex]
+}
+
+// IsConnected reports whether the hook currently has a live connection to Logstash.
+// It turns false as soon as sending fails with a connection error and turns true again
+// once reconnecting succeeds. A hook balancing the entries is connected as long as any of its addresses is.
+func (h *Hook) IsConnected() bool {
+	if h.balancer != nil {
+		return h.balancer.isConnected()
+	}
+
+	h.RLock()
+	defer h.RUnlock()
+
+	return h.connected
+}
+
+// reportError reports an error which can not be returned to the caller to the ErrorHandler,
+// `e` is the entry concerned if any.
+func (h *Hook) reportError(err error, e *logrus.Entry) {
+	if h.opts.ErrorHandler != nil {
+		h.opts.ErrorHandler(err, e)
+		return
+	}
+
+	h.diagnosef("failed to send log to logstash, error: %v\n", err)
+}
+
+// diagnosef writes a diagnostic message to the Diagnostics writer.
+func (h *Hook) diagnosef(format string, args ...interface{}) {
+	fmt.Fprintf(h.opts.GetDiagnostics(), format, args...)
+}
+
+// reconnect reconnects to the logstash server, unless the writer of generation `gen`
+// which failed has already been replaced in the meantime.
+// Every attempt rotates to the next address, so a dead endpoint is not retried
+// over and over while another one is available.
+// It reports whether the hook is connected again.
+func (h *Hook) reconnect(gen uint64) bool {
+	if !h.canReconnect() {
+		return false
+	}
+
+	// only one goroutine reconnects at a time
+	h.reconnectMu.Lock()
+	defer h.reconnectMu.Unlock()
+
+	h.RLock()
+	start := h.addrIndex
+	current := h.generation
+	// rotate to the next address unless the hook never connected
+	offset := 1
+	if h.writer == nil {
+		offset = 0
+	}
+	h.RUnlock()
+	if current != gen {
+		// another goroutine reconnected already
+		return true
+	}
+
+	h.diagnosef("failed to send log entry to logstash, reconnecting...\n")
+
+	var deadline time.Time
+	if h.opts.ReconnectTimeout > 0 {
+		deadline = time.Now().Add(h.opts.ReconnectTimeout)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if h.opts.MaxReconnectAttempts > 0 && attempt >= h.opts.MaxReconnectAttempts {
+			h.diagnosef("failed to reconnect to logstash, giving up after %d attempts\n", attempt)
+			return false
+		}
+
+		// sleep between the attempts
+		if attempt > 0 {
+			delay := h.opts.GetBackoff()(attempt)
+			if !deadline.IsZero() {
+				remaining := time.Until(deadline)
+				if remaining <= 0 {
+					h.diagnosef("failed to reconnect to logstash within %s, giving up after %d attempts\n", h.opts.ReconnectTimeout, attempt)
+					return false
+				}
+
+				delay = min(delay, remaining)
+			}
+
+			time.Sleep(delay)
+		}
+
+		h.RLock()
+		closed := h.connsClosed
+		h.RUnlock()
+		if closed {
+			return false
+		}
+
+		err := h.reconnectAttempt(start, offset, attempt)
+		if h.tripped(err) {
+			h.diagnosef("failed to reconnect to logstash, the circuit breaker is open after %d attempts\n", attempt+1)
+			return false
+		}
+		if err == nil {
+			// the hook which never connected is not reconnected
+			if offset == 1 && h.opts.OnReconnect != nil {
+				h.opts.OnReconnect(h.Addr(), attempt+1)
+			}
+			return true
+		}
+	}
+}
+
+// connect dials the first reachable address for the hook which never connected, the writer being
+// of generation `gen`. It reports whether the hook is connected, by this call or by another goroutine.
+func (h *Hook) connect(gen uint64) bool {
+	if !h.canReconnect() {
+		return false
+	}
+
+	h.reconnectMu.Lock()
+	defer h.reconnectMu.Unlock()
+
+	h.RLock()
+	current := h.generation
+	h.RUnlock()
+	if current != gen {
+		return true
+	}
+
+	if len(h.addrs) == 0 {
+		conn, err := h.opts.Redial()
+		return err == nil && h.swapWriter(conn, 0)
+	}
+
+	for i, addr := range h.addrs {
+		if conn, err := h.dial(addr); err == nil {
+			return h.swapWriter(conn, i)
+		}
+	}
+
+	return false
+}
+
+// reconnectInBackground reconnects the writer of generation `gen` which failed in a goroutine, unless
+// it is already being reconnected, then replays the entries kept for retry meanwhile.
+func (h *Hook) reconnectInBackground(gen uint64) {
+	if !h.probing.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		reconnected := h.reconnect(gen)
+		h.probing.Store(false)
+
+		if reconnected {
+			h.replayRetries()
+		}
+	}()
+}
+
+// reconnectAttempt makes the attempt number `index` to re-establish the connection,
+// dialing the address `offset + index` positions after the address at `start`.
+func (h *Hook) reconnectAttempt(start, offset, index int) error {
+	h.stats.reconnects.Add(1)
+
+	// the hook was given its connection, it is re-established by the Redial option
+	if len(h.addrs) == 0 {
+		conn, err := h.opts.Redial()
+		if err != nil {
+			h.diagnosef("failed to reconnect to logstash, error: %s (current attempt %d)\n", err, index+1)
+			return err
+		}
+
+		if !h.swapWriter(conn, start) {
+			return ErrClosed
+		}
+		return nil
+	}
+
+	next := (start + offset + index) % len(h.addrs)
+	conn, err := h.dial(h.addrs[next])
+	if err != nil {
+		h.diagnosef("failed to reconnect to logstash at %s, error: %s (current attempt %d)\n", h.addrs[next], err, index+1)
+		return err
+	}
+
+	if !h.swapWriter(conn, next) {
+		return ErrClosed
+	}
+	return nil
+}
+
+// canReconnect reports whether the hook is able to re-establish its connection.
+func (h *Hook) canReconnect() bool {
+	return len(h.addrs) > 0 || h.opts.Redial != nil
+}
+
+// swapWriter replaces the writer of the hook by the new connection to the address at `addrIndex`,
+// and closes the previous one. The new connection is closed instead if the hook closed its connections,
+// it reports whether the writer was replaced.
+func (h *Hook) swapWriter(conn io.Writer, addrIndex int) bool {
+	h.Lock()
+	if h.connsClosed {
+		h.Unlock()
+		if c, ok := conn.(io.Closer); ok {
+			_ = c.Close()
+		}
+		return false
+	}
+
+	old := h.writer
+	h.writer = conn
+	h.generation++
+	h.addrIndex = addrIndex
+	h.connected = true
+	addr := h.addr()
+	h.Unlock()
+
+	// close the old connection outside the lock, it may be slow to close
+	if c, ok := old.(io.Closer); ok && c != nil {
+		_ = c.Close()
+	}
+
+	if h.opts.OnConnect != nil {
+		h.opts.OnConnect(addr)
+	}
+
+	return true
+}
+
+// disconnected marks the hook as not connected if its writer is still of generation `gen`,
+// calling OnDisconnect with `err` if it was connected.
+func (h *Hook) disconnected(gen uint64, err error) {
+	h.Lock()
+	lost := h.generation == gen && h.connected
+	if lost {
+		h.connected = false
+	}
+	addr := h.addr()
+	h.Unlock()
+
+	if lost && h.opts.OnDisconnect != nil {
+		h.opts.OnDisconnect(addr, err)
+	}
+}
+
+// processSendError processes the error returned by the send function
+// writing with the writer of generation `gen`.
+func (h *Hook) processSendError(err error, data []byte, gen uint64) error {
+	// there is no connection at all, reconnect and try to resend the data
+	if errors.Is(err, ErrNotConnected) {
+		if !h.canReconnect() {
+			// there is nothing to reconnect to
+			return err
+		}
+
+		h.reportError(err, nil)
+		if h.keepsForRetry() {
+			// the entries are kept for retry until reconnected, instead of waiting for it
+			h.reconnectInBackground(gen)
+			return err
+		}
+		if !h.reconnect(gen) {
+			return h.sendToFallback(data, err)
+		}
+
+		return h.send(data)
+	}
+
+	netErr, ok := err.(net.Error)
+	if !ok {
+		// return if its not net.Error
+		return err
+	}
+
+	h.disconnected(gen, err)
+
+	if h.keepsForRetry() {
+		h.reconnectInBackground(gen)
+		return err
+	}
+
+	// if its a timeout error Logstash is stalled, the entry is not resent so that
+	// the hook does not stall as well, the connection is replaced for the next ones
+	if netErr.Timeout() {
+		h.reconnect(gen)
+		return err
+	}
+
+	// otherwise reconnect and try to resend the data
+	if !h.reconnect(gen) {
+		return h.sendToFallback(data, err)
+	}
+
+	return h.send(data)
+}
+
+// sendToFallback writes the data which failed to be sent with `err` since reconnecting
+// failed to the fallback writer, `err` is returned if there is none.
+func (h *Hook) sendToFallback(data []byte, err error) error {
+	if h.opts.FallbackWriter == nil || !h.canReconnect() {
+		return err
+	}
+
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	if _, fallbackErr := h.opts.FallbackWriter.Write(data); fallbackErr != nil {
+		return fmt.Errorf("%w, writing to the fallback writer failed as well: %v", err, fallbackErr)
+	}
+
+	return nil
+}
+
+// send sends the data to the logstash server.
+// The lock of h is only held to read the current writer, so that a slow write
+// never blocks reconnecting, the writes themselves are serialized by writeMu.
+func (h *Hook) send(data []byte) error {
+	// the entries are kept for retry while reconnecting in the background rather than
+	// being written to the connection which failed
+	if h.probing.Load() && h.keepsForRetry() {
+		h.stats.failed.Add(1)
+		return ErrNotConnected
+	}
+
+	h.RLock()
+	w, gen := h.writer, h.generation
+	h.RUnlock()
+
+	if w == nil {
+		// the hook connects with the first entry, see HookOptions.LazyConnect, it only fails
+		// to send the entry if none of the addresses can be dialed
+		if h.connect(gen) {
+			return h.send(data)
+		}
+
+		h.Lock()
+		h.connected = false
+		h.Unlock()
+		h.stats.failed.Add(1)
+		return h.processSendError(ErrNotConnected, data, gen)
+	}
+
+	h.writeMu.Lock()
+	// replay the entries kept for retry before sending the new one, so the order is preserved
+	err := h.flushRetryBuffer(w)
+	if err == nil {
+		err = h.write(w, data)
+	}
+	h.writeMu.Unlock()
+	if err != nil {
+		h.stats.failed.Add(1)
+		return h.processSendError(err, data, gen)
+	}
+
+	return nil
+}
+
+// write writes the data with the writer w, writeMu must be locked.
+func (h *Hook) write(w io.Writer, data []byte) error {
+	data, err := h.compress(data)
+	if err != nil {
+		return err
+	}
+
+	if h.opts.WriteTimeout > 0 {
+		if c, ok := w.(interface{ SetWriteDeadline(time.Time) error }); ok {
+			_ = c.SetWriteDeadline(time.Now().Add(h.opts.WriteTimeout))
+		}
+	}
+
+	start := time.Now()
+	n, err := w.Write(data)
+	h.stats.sendLatency.observe(time.Since(start))
+	h.stats.bytesWritten.Add(uint64(n))
+	if err != nil {
+		return err
+	}
+
+	h.stats.sent.Add(1)
+	return nil
+}
+
+// keepsForRetry reports whether the data which failed to be sent is kept for retry,
+// in the retry buffer or in the queue on disk.
+func (h *Hook) keepsForRetry() bool {
+	return h.queue != nil || h.opts.RetryBufferSize > 0
+}
+
+// keepForRetry keeps the data which failed to be sent in the retry buffer,
+// it is replayed before anything else once sending succeeds again.
+// When the buffer is full the oldest data is dropped.
+// It returns false if the retry buffer is disabled.
+func (h *Hook) keepForRetry(data []byte) bool {
+	if h.queue != nil {
+		return h.keepOnDisk(data)
+	}
+
+	if h.opts.RetryBufferSize <= 0 {
+		return false
+	}
+
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	if len(h.retryBuffer) >= h.opts.RetryBufferSize {
+		h.deadLetter(nil, h.retryBuffer[0], errRetryBufferFull)
+		h.retryBuffer = h.retryBuffer[1:]
+		h.stats.dropped.Add(1)
+	}
+
+	// the formatted data may be backed by a buffer re-used by the formatter
+	h.retryBuffer = append(h.retryBuffer, append([]byte(nil), data...))
+	return true
+}
+
+// flushRetryBuffer sends the data kept in the retry buffer with the writer w, oldest first,
+// writeMu must be locked. The data which could not be sent stays in the buffer.
+func (h *Hook) flushRetryBuffer(w io.Writer) error {
+	for len(h.retryBuffer) > 0 {
+		if err := h.replayWrite(w, h.retryBuffer[0]); err != nil {
+			return err
+		}
+
+		h.retryBuffer = h.retryBuffer[1:]
 	}
 
-	return time.Second * 30
+	if h.queue != nil {
+		return h.queue.replay(func(data []byte) error { return h.replayWrite(w, data) })
+	}
+
+	return nil
 }
 
-// GetFireChannelBufferSize returns the fire channel buffer size, defaults to 8192.
-func (h HookOptions) GetFireChannelBufferSize() int {
-	if h.FireChannelBufferSize > 0 {
-		return h.FireChannelBufferSize
+// replayWrite writes the data kept for retry with the writer w, writeMu must be locked.
+// The data partially written, see BulkError, is not kept for retry again.
+func (h *Hook) replayWrite(w io.Writer, data []byte) error {
+	err := h.write(w, data)
+	if failed := h.bulkFailures(err); failed > 0 {
+		h.stats.dropped.Add(uint64(failed))
+		return nil
 	}
 
-	return defaultLogrusEntryFireChannelBufferSize
+	return err
 }
 
-// New returns a new logrus.Hook for Logstash
-func New(protocol, addr string, f logrus.Formatter, opts ...HookOptions) (logrus.Hook, error) {
-	if protocol == "" || addr == "" {
-		return nil, fmt.Errorf("protocol and addr must be set")
+// replayRetries sends the entries kept for retry once connected, instead of waiting
+// for the next entry to be sent. The hook reconnects in the background if it fails.
+func (h *Hook) replayRetries() {
+	h.RLock()
+	w, gen := h.writer, h.generation
+	h.RUnlock()
+	if w == nil {
+		return
 	}
 
-	// dial the connection
-	conn, err := net.Dial(protocol, addr)
-	if err != nil {
-		return nil, err
+	h.writeMu.Lock()
+	err := h.flushRetryBuffer(w)
+	h.writeMu.Unlock()
+	if err == nil {
+		return
 	}
 
-	h := &Hook{
-		protocol:  protocol,
-		addr:      addr,
-		conn:      conn,
-		formatter: f,
+	h.stats.failed.Add(1)
+	h.reportError(fmt.Errorf("failed to replay the entries kept for retry: %w", err), nil)
+	if _, ok := err.(net.Error); ok {
+		h.disconnected(gen, err)
+		h.reconnectInBackground(gen)
 	}
-	// apply options
-	if len(opts) > 0 {
-		opt := opts[0]
-		// apply keep alive options
-		if opt.KeepAlive {
-			if c, ok := conn.(*net.TCPConn); ok && c != nil {
-				err = c.SetKeepAlive(true)
-				if err != nil {
-					return nil, err
-				}
+}
 
-				err = c.SetKeepAlivePeriod(opt.GetKeepAlivePeriod())
-				if err != nil {
-					return nil, err
-				}
+// withFields returns a copy of the entry `e` with `fields` added at the top level of the entry formatted by `f`.
+// LogstashFormatter merges the entry data into the "fields" field, so the fields are passed
+// through the entry context for it, other formatters get them in the entry data.
+func withFields(e *logrus.Entry, f logrus.Formatter, fields logrus.Fields) *logrus.Entry {
+	ne := *e
+
+	switch f.(type) {
+	case LogstashFormatter, *LogstashFormatter:
+		ctx := e.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		merged := logrus.Fields{}
+		if existing, ok := ctx.Value(ContextKeyFields).(logrus.Fields); ok {
+			for k, v := range existing {
+				merged[k] = v
 			}
 		}
+		for k, v := range fields {
+			merged[k] = v
+		}
 
-		// apply fire channel buffer size
-		h.logrusEntryFireChannel = make(chan *logrus.Entry, opt.GetFireChannelBufferSize())
+		ne.Context = context.WithValue(ctx, ContextKeyFields, merged)
+	default:
+		ne.Data = make(logrus.Fields, len(e.Data)+len(fields))
+		for k, v := range e.Data {
+			ne.Data[k] = v
+		}
+		for k, v := range fields {
+			ne.Data[k] = v
+		}
 	}
 
-	// if fire channel is not set, create a default one
-	if h.logrusEntryFireChannel == nil {
-		h.logrusEntryFireChannel = make(chan *logrus.Entry, defaultLogrusEntryFireChannelBufferSize)
+	return &ne
+}
+
+// allow reports whether the entry is allowed to be sent by the sampling and the rate limit.
+func (h *Hook) allow(e *logrus.Entry) bool {
+	// crash information always gets through
+	if e.Level <= logrus.FatalLevel {
+		return true
 	}
 
-	// split a goroutine to handle logrus entry fire channel
-	go func() {
-		// defer recover
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Fprintf(os.Stderr, "panic in logrus entry fire channel: %v\n", r)
-				debug.PrintStack()
+	if h.opts.SampleRate > 0 && h.opts.SampleRate < 1 && rand.Float64() >= h.opts.SampleRate {
+		return false
+	}
+
+	if h.opts.MaxEntriesPerSecond <= 0 {
+		return true
+	}
+
+	h.limiterOnce.Do(func() {
+		burst := h.opts.MaxEntriesBurst
+		if burst <= 0 {
+			burst = h.opts.MaxEntriesPerSecond
+		}
+
+		h.limiter = newRateLimiter(float64(h.opts.MaxEntriesPerSecond), burst)
+	})
+
+	return h.limiter.allow()
+}
+
+// fire wraps the fire function to handle the logrus entry fire channel.
+func (h *Hook) fire(e *logrus.Entry) error {
+	if h.opts.Route != nil {
+		if route, ok := h.routes[h.opts.Route(e)]; ok {
+			if route.opts.Synchronous {
+				return route.fire(e)
 			}
-		}()
 
-		// handle logrus entry fire channel
-		for e := range h.logrusEntryFireChannel {
-			if err := h.fire(e); err != nil {
-				fmt.Fprintf(os.Stderr, "failed to send log to logstash, error: %v\n", err)
+			return route.enqueue(e)
+		}
+	}
+
+	if h.opts.DedupWindow > 0 {
+		held := h.dedupEntry(e)
+		if held == nil {
+			return nil
+		}
+
+		return h.deliver(held)
+	}
+
+	if h.opts.SuppressRepeats {
+		summary, suppressed := h.suppressRepeat(e)
+		if summary != nil {
+			if err := h.deliver(summary); err != nil {
+				h.stats.dropped.Add(1)
+				h.reportError(err, summary)
 			}
 		}
-	}()
+		if suppressed {
+			return nil
+		}
+	}
 
-	return h, nil
+	return h.deliver(e)
 }
 
-// reconnect reconnects to the logstash server.
-func (h *Hook) reconnect() {
-	fmt.Fprintln(os.Stderr, "failed to send log entry to logstash, reconnecting...")
+// deliver formats and sends the entry.
+func (h *Hook) deliver(e *logrus.Entry) error {
+	if h.balancer != nil {
+		return h.balancer.deliver(e)
+	}
+
+	return h.deliverWith(e, h.sendFormatted)
+}
+
+// deliverWith formats the entry and passes it to `send`, in parts if it exceeds MaxMessageBytes.
+func (h *Hook) deliverWith(e *logrus.Entry, send func(e *logrus.Entry, dataBytes []byte) error) error {
+	if len(h.opts.IncludeFields) > 0 || len(h.opts.ExcludeFields) > 0 {
+		e = filterFields(e, h.opts.IncludeFields, h.opts.ExcludeFields)
+	}
+	if h.opts.Redactor != nil {
+		e = h.opts.Redactor.Redact(e)
+	}
+
+	if h.opts.Metadata != nil {
+		e = withFields(e, h.formatter, h.opts.Metadata.Fields())
+	}
+	for _, enricher := range h.opts.Enrichers {
+		e = withFields(e, h.formatter, enricher.Fields())
+	}
+
+	if len(h.opts.DynamicFields) > 0 {
+		fields := make(logrus.Fields, len(h.opts.DynamicFields))
+		for k, fn := range h.opts.DynamicFields {
+			fields[k] = fn(e)
+		}
+		e = withFields(e, h.formatter, fields)
+	}
+
+	if fields := h.traceFields(e); fields != nil {
+		e = withFields(e, h.formatter, fields)
+	}
+
+	if h.opts.SentAtKey != "" {
+		e = withFields(e, h.formatter, logrus.Fields{h.opts.SentAtKey: time.Now()})
+	}
 
-	// Sleep before reconnect.
-	_, _, _ = lo.AttemptWithDelay(0, time.Second*5, func(index int, duration time.Duration) error {
-		conn, err := net.Dial(h.protocol, h.addr)
+	if len(h.opts.Middleware) > 0 {
+		e = cloneEntry(e)
+		for _, mw := range h.opts.Middleware {
+			if e = mw(e); e == nil {
+				h.stats.dropped.Add(1)
+				h.stats.suppressed.Add(1)
+				return nil
+			}
+		}
+	}
+
+	dataBytes, err := h.format(e)
+	if err != nil {
+		h.deadLetter(e, nil, err)
+		return err
+	}
+
+	if h.opts.MaxMessageBytes > 0 && len(dataBytes) > h.opts.MaxMessageBytes {
+		parts, err := h.fitMessage(e, dataBytes)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to reconnect to logstash, error: %s (current attempt %d)\n", err, index+1)
+			h.deadLetter(e, dataBytes, err)
 			return err
 		}
 
-		h.Lock()
-		h.conn = conn
-		h.Unlock()
-		return nil
-	})
-}
+		for _, part := range parts {
+			if partErr := send(e, part); err == nil {
+				err = partErr
+			}
+		}
 
-// processSendError processes the error returned by the send function.
-func (h *Hook) processSendError(err error, data []byte) error {
-	netErr, ok := err.(net.Error)
-	if !ok {
-		// return if its not net.Error
 		return err
 	}
 
-	// if its a timeout error, try to resend the data
-	if netErr.Timeout() {
-		fmt.Fprintf(os.Stderr, "failed to send log entry to logstash, error: %s, resending...\n", err)
-		return h.send(data)
+	return send(e, dataBytes)
+}
+
+// format formats the entry with the hook's formatter, or HookOptions.FallbackFormatter if it fails,
+// unless it is already formatted, see WriteSyncer.
+func (h *Hook) format(e *logrus.Entry) ([]byte, error) {
+	if data, ok := preformatted(e); ok {
+		return data, nil
 	}
 
-	// otherwise reconnect and try to resend the data
-	h.reconnect()
-	return h.send(data)
+	dataBytes, err := h.formatter.Format(e)
+	if err != nil && h.opts.FallbackFormatter != nil {
+		h.reportError(fmt.Errorf("failed to format entry, using the fallback formatter: %w", err), e)
+		dataBytes, err = h.opts.FallbackFormatter.Format(withFields(e, h.opts.FallbackFormatter, logrus.Fields{FieldKeyFormatDegraded: true}))
+	}
+
+	return dataBytes, err
 }
 
-// send sends the data to the logstash server.
-func (h *Hook) send(data []byte) error {
-	h.Lock()
-	_, err := h.conn.Write(data)
-	h.Unlock()
-	if err != nil {
-		return h.processSendError(err, data)
+// sendFormatted frames and sends the formatted entry `e`, or keeps it as a breadcrumb.
+func (h *Hook) sendFormatted(e *logrus.Entry, dataBytes []byte) error {
+	if h.opts.Framer != nil {
+		dataBytes = h.opts.Framer(dataBytes)
 	}
 
-	return nil
-}
+	if h.isBreadcrumb(e) {
+		h.keepBreadcrumb(dataBytes)
+		return nil
+	}
+	if h.opts.BreadcrumbSize > 0 && e.Level <= logrus.WarnLevel {
+		h.flushBreadcrumbs()
+	}
 
-// fire wraps the fire function to handle the logrus entry fire channel.
-func (h *Hook) fire(e *logrus.Entry) error {
-	dataBytes, err := h.formatter.Format(e)
+	err := h.sendOrBatch(dataBytes)
 	if err != nil {
-		return err
+		if h.bulkFailures(err) > 0 {
+			return err
+		}
+		if h.keepForRetry(dataBytes) {
+			h.reportError(fmt.Errorf("%w, the entry is kept for retry", err), e)
+			return nil
+		}
+
+		h.deadLetter(e, dataBytes, err)
 	}
 
-	err = h.send(dataBytes)
 	return err
 }
 
@@ -198,18 +1786,93 @@ func (h *Hook) fire(e *logrus.Entry) error {
 // Hook's formatter is used to format the entry into Logstash format
 // and Hook's writer is used to write the formatted entry to the Logstash instance.
 func (h *Hook) Fire(e *logrus.Entry) error {
-	if h.logrusEntryFireChannel != nil {
-		h.logrusEntryFireChannel <- e
+	if h.opts.Filter != nil && !h.opts.Filter(e) {
+		return nil
+	}
+
+	// shed the entries before they take room in the queue
+	if !h.allow(e) {
+		h.stats.dropped.Add(1)
+		h.stats.suppressed.Add(1)
 		return nil
+	}
+	h.stats.enqueued.Add(1)
+
+	// the stack trace is captured by the goroutine which logged the entry
+	if h.opts.StackTrace && e.Level <= logrus.ErrorLevel {
+		e = h.withStackTrace(e)
+	}
+
+	if h.logrusEntryFireChannel != nil {
+		// Close waits for the entries being enqueued
+		h.fireMu.RLock()
+		defer h.fireMu.RUnlock()
+
+		if h.closed || h.ctx.Err() != nil {
+			return ErrClosed
+		}
+
+		// the entry is sent asynchronously while logrus re-uses it once the hooks are fired
+		e = cloneEntry(e)
+
+		if h.opts.OnBackpressure != nil {
+			queueLen, queueCap := len(h.logrusEntryFireChannel), cap(h.logrusEntryFireChannel)
+			if queueLen >= h.opts.GetBackpressureHighWaterMark(queueCap) {
+				h.opts.OnBackpressure(queueLen, queueCap)
+			}
+		}
+
+		return h.enqueue(e)
+	} else if h.opts.Synchronous {
+		// Close waits for the entries being sent
+		h.fireMu.RLock()
+		defer h.fireMu.RUnlock()
+
+		if h.closed || (h.ctx != nil && h.ctx.Err() != nil) {
+			return ErrClosed
+		}
+
+		h.failbackIfDue()
+		h.resolveIfDue()
+
+		if done := h.entryDone(e); done != nil {
+			return h.fireWithin(e, done)
+		}
+
+		err := h.fire(e)
+		if err != nil {
+			h.stats.dropped.Add(1)
+		}
+
+		return err
 	} else {
-		fmt.Fprintln(os.Stderr, "logrus entry fire channel is not initialized or closed")
+		h.diagnosef("logrus entry fire channel is not initialized or closed\n")
 	}
 
 	return h.fire(e)
 }
 
-// Levels returns all logrus levels.
+// cloneEntry returns a copy of the entry `e` which does not share its data or buffer.
+func cloneEntry(e *logrus.Entry) *logrus.Entry {
+	ne := *e
+	ne.Data = make(logrus.Fields, len(e.Data))
+	for k, v := range e.Data {
+		ne.Data[k] = v
+	}
+	if e.Buffer != nil {
+		ne.Buffer = bytes.NewBuffer(append([]byte(nil), e.Buffer.Bytes()...))
+	}
+
+	return &ne
+}
+
+// Levels returns the levels of the entries sent to Logstash, HookOptions.Levels if set,
+// all logrus levels otherwise.
 func (h *Hook) Levels() []logrus.Level {
+	if len(h.opts.Levels) > 0 {
+		return h.opts.Levels
+	}
+
 	return logrus.AllLevels
 }
 
@@ -221,45 +1884,131 @@ var entryPool = sync.Pool{
 	},
 }
 
-// copyEntry copies the entry `e` to a new entry and then adds all the fields in `fields` that are missing in the new entry data.
+// copyEntry copies the entry `e` to a new entry and then adds all the fields in `f.Fields` that are missing in the new entry data.
+// The entry data is passed through `f.FieldProcessor` (if any) before it is merged into the "fields" field.
 // It uses `entryPool` to re-use allocated entries.
-func copyEntry(e *logrus.Entry, fields logrus.Fields) *logrus.Entry {
+func copyEntry(e *logrus.Entry, f LogstashFormatter) *logrus.Entry {
 	ne := entryPool.Get().(*logrus.Entry)
 	ne.Message = e.Message
 	ne.Level = e.Level
 	ne.Time = e.Time
 	ne.Data = logrus.Fields{}
 
-	if e.Logger.ReportCaller && e.Context != nil {
-		caller, _ := e.Context.Value(ContextKeyRuntimeCaller).(*runtime.Frame)
-		if caller != nil {
-			ne.Data["function"] = caller.Function
-			ne.Data["file"] = fmt.Sprintf("%s:%d", caller.File, caller.Line)
+	if e.Buffer != nil && e.Buffer.Len() > 0 {
+		rendered := e.Buffer.String()
+		if f.AppendBuffer {
+			ne.Message = strings.TrimSpace(ne.Message + " " + rendered)
+		}
+		if f.BufferKey != "" {
+			ne.Data[f.BufferKey] = rendered
 		}
 	}
 
-	if e.Logger.ReportCaller && e.Data["file"] != nil {
-		ne.Data["file"] = e.Data["file"]
-		delete(e.Data, "file")
+	if f.CompactMessageWhitespace {
+		ne.Message = strings.Join(strings.Fields(ne.Message), " ")
 	}
-	if e.Logger.ReportCaller && e.Data["function"] != nil {
-		ne.Data["function"] = e.Data["function"]
-		delete(e.Data, "function")
+
+	if len(f.TimestampAliases) > 0 {
+		formatted := e.Time.Format(timestampFormat(f.Formatter))
+		for _, key := range f.TimestampAliases {
+			ne.Data[key] = formatted
+		}
 	}
 
-	if len(e.Data) > 0 {
-		fieldsStrings := make([]string, 0)
-		for k, v := range e.Data {
-			fieldsStrings = append(fieldsStrings, fmt.Sprintf("%s=%v", k, v))
-			delete(e.Data, k)
+	if f.Fingerprint != nil {
+		ne.Data[FieldKeyFingerprint] = f.Fingerprint(e)
+	} else if len(f.FingerprintFields) > 0 {
+		ne.Data[FieldKeyFingerprint] = fingerprint(e, f.FingerprintFields)
+	}
+
+	reportCaller := e.Logger != nil && e.Logger.ReportCaller
+
+	data := make(logrus.Fields, len(e.Data))
+	for k, v := range e.Data {
+		data[k] = v
+	}
+
+	functionKey, fileKey := f.callerKeys()
+
+	// the caller of the context, or the one logrus reports
+	var caller *runtime.Frame
+	if reportCaller && e.Context != nil && !(f.SkipCancelledContext && e.Context.Err() != nil) {
+		caller, _ = e.Context.Value(ContextKeyRuntimeCaller).(*runtime.Frame)
+	}
+	if reportCaller && caller == nil {
+		caller = e.Caller
+	}
+	if caller != nil {
+		function, file := f.callerValues(caller)
+		if function != "" {
+			ne.Data[functionKey] = function
+		}
+		if file != "" {
+			ne.Data[fileKey] = file
+		}
+	}
+
+	if reportCaller && data[fileKey] != nil {
+		ne.Data[fileKey] = data[fileKey]
+		delete(data, fileKey)
+	}
+	if reportCaller && data[functionKey] != nil {
+		ne.Data[functionKey] = data[functionKey]
+		delete(data, functionKey)
+	}
+
+	if f.FieldProcessor != nil {
+		data = f.FieldProcessor.Process(data)
+	}
+
+	if f.StructuredErrors {
+		for k, v := range data {
+			if err, ok := v.(error); ok && !isNilError(err) {
+				for ek, ev := range f.errorFields(k, err) {
+					ne.Data[ek] = ev
+				}
+				delete(data, k)
+			}
+		}
+	}
+
+	if len(data) > 0 {
+		switch {
+		case f.structuredFields() && f.FieldsNamespace != "":
+			fields := make(logrus.Fields, len(data))
+			for k, v := range data {
+				fields[k] = f.fieldValue(v)
+			}
+			ne.Data[f.FieldsNamespace] = fields
+		case f.structuredFields():
+			for k, v := range data {
+				ne.Data[k] = f.fieldValue(v)
+			}
+		default:
+			fieldsStrings := make([]string, 0, len(data))
+			for k, v := range data {
+				fieldsStrings = append(fieldsStrings, k+"="+f.fieldString(v))
+			}
+			ne.Data["fields"] = strings.Join(fieldsStrings, " ")
 		}
-		ne.Data["fields"] = strings.Join(fieldsStrings, " ")
 	}
 
-	for k, v := range fields {
+	for k, v := range f.Fields {
+		// the fields at the top level are not overridden by the defaults
+		if _, ok := data[k]; ok && f.structuredFields() && f.FieldsNamespace == "" {
+			continue
+		}
+
 		ne.Data[k] = v
 	}
 
+	if e.Context != nil {
+		fields, _ := e.Context.Value(ContextKeyFields).(logrus.Fields)
+		for k, v := range fields {
+			ne.Data[k] = v
+		}
+	}
+
 	return ne
 }
 
@@ -276,6 +2025,181 @@ func releaseEntry(e *logrus.Entry) {
 type LogstashFormatter struct {
 	logrus.Formatter
 	logrus.Fields
+
+	// FieldProcessor, if set, transforms the entry data before it is merged
+	// into the "fields" field, independently of the underlying Formatter.
+	FieldProcessor FieldProcessor
+
+	// BufferKey, if set, adds the pre-rendered content of the entry's Buffer (when not empty)
+	// at the top level under this key, e.g. "rendered".
+	BufferKey string
+	// AppendBuffer appends the pre-rendered content of the entry's Buffer (when not empty)
+	// to the message.
+	AppendBuffer bool
+
+	// CompactMessageWhitespace collapses the runs of whitespace (including newlines)
+	// of the message into single spaces, so multiline messages become a single line.
+	CompactMessageWhitespace bool
+
+	// StructuredFields emits every field of the entry data under its own key instead of
+	// merging them into the "fields" field as a single "key=value" string, so that they can be
+	// filtered on. The fields are added at the top level, or under FieldsNamespace if set.
+	StructuredFields bool
+	// FieldsNamespace, if set with StructuredFields, is the key of the object holding the fields
+	// of the entry data, e.g. "fields" for Logstash to index them as "fields.*".
+	FieldsNamespace string
+	// PreserveTypes keeps the types of the field values emitted by StructuredFields, which it implies,
+	// instead of formatting them as strings, see typedValue for how each type is handled.
+	PreserveTypes bool
+
+	// StructuredErrors formats every field of the entry data holding an error, e.g. logrus.ErrorKey,
+	// as the fields at the top level "<key>.message", "<key>.type" and "<key>.causes", the messages of
+	// the errors it wraps, instead of its message only, e.g. "error.message" and "error.type".
+	StructuredErrors bool
+
+	// MaxFieldValueBytes, if set, truncates the string representation of the field values
+	// longer than MaxFieldValueBytes bytes, appending TruncationMarker to them.
+	MaxFieldValueBytes int
+
+	// FingerprintFields, if set, adds a "fingerprint" field holding a stable hash of these fields
+	// of the entry, logrus.FieldKeyMsg standing for the message, so that recurring events can be
+	// grouped even though their other fields differ. Error values contribute their type only.
+	FingerprintFields []string
+	// Fingerprint, if set, computes the "fingerprint" field instead of FingerprintFields.
+	Fingerprint func(*logrus.Entry) string
+
+	// TimestampAliases, if set, adds the time of the entry under each of these keys as well,
+	// e.g. "timestamp" next to "@timestamp", formatted the same way the Formatter formats it.
+	TimestampAliases []string
+
+	// SkipCancelledContext skips extracting the caller from the entry context
+	// (see ContextKeyRuntimeCaller) when the context is already cancelled.
+	// By default the caller is extracted regardless of the context state.
+	// The fields of ContextKeyFields are always added.
+	SkipCancelledContext bool
+
+	// CallerFunctionKey and CallerFileKey are the keys of the function and of the "file:line" of the caller
+	// of the entries logged with ReportCaller, the one of ContextKeyRuntimeCaller or else entry.Caller,
+	// default to "function" and "file", e.g. "log.origin.function" and "log.origin.file.name".
+	CallerFunctionKey string
+	CallerFileKey     string
+	// CallerTrimPrefix, if set, is trimmed from the file paths of the callers, e.g. the module path.
+	CallerTrimPrefix string
+	// CallerPrettyfier, if set, returns the function and the file of the callers instead,
+	// like logrus.JSONFormatter.CallerPrettyfier, an empty value is not added.
+	CallerPrettyfier func(*runtime.Frame) (function string, file string)
+}
+
+// callerKeys returns the keys of the function and of the file of the caller.
+func (f LogstashFormatter) callerKeys() (functionKey, fileKey string) {
+	functionKey, fileKey = f.CallerFunctionKey, f.CallerFileKey
+	if functionKey == "" {
+		functionKey = "function"
+	}
+	if fileKey == "" {
+		fileKey = "file"
+	}
+
+	return functionKey, fileKey
+}
+
+// callerValues returns the function and the file of the caller `frame`.
+func (f LogstashFormatter) callerValues(frame *runtime.Frame) (function, file string) {
+	if f.CallerPrettyfier != nil {
+		return f.CallerPrettyfier(frame)
+	}
+
+	return frame.Function, fmt.Sprintf("%s:%d", strings.TrimPrefix(frame.File, f.CallerTrimPrefix), frame.Line)
+}
+
+// timestampFormat returns the layout the logrus formatter `f` formats the time with.
+func timestampFormat(f logrus.Formatter) string {
+	var layout string
+	switch f := f.(type) {
+	case *logrus.JSONFormatter:
+		layout = f.TimestampFormat
+	case *logrus.TextFormatter:
+		layout = f.TimestampFormat
+	case *MsgpackFormatter:
+		layout = f.TimestampFormat
+	}
+
+	if layout == "" {
+		// logrus' default timestamp format
+		return time.RFC3339
+	}
+
+	return layout
+}
+
+// structuredFields reports whether every field of the entry data is emitted under its own key.
+func (f LogstashFormatter) structuredFields() bool {
+	return f.StructuredFields || f.PreserveTypes
+}
+
+// fieldValue returns the value of a field of the entry data as it is formatted under its own key.
+func (f LogstashFormatter) fieldValue(v interface{}) interface{} {
+	if f.PreserveTypes {
+		return typedValue(v, f.MaxFieldValueBytes)
+	}
+
+	return f.fieldString(v)
+}
+
+// fieldString returns the value of a field of the entry data formatted as a string.
+func (f LogstashFormatter) fieldString(v interface{}) string {
+	return truncate(fmt.Sprintf("%v", v), f.MaxFieldValueBytes)
+}
+
+// TruncationMarker is appended to the values truncated by LogstashFormatter.MaxFieldValueBytes.
+const TruncationMarker = "...(truncated)"
+
+// truncate truncates s to max bytes (without splitting a UTF-8 character) and appends
+// TruncationMarker if s is longer than max bytes, s is returned as is if max is not positive.
+func truncate(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+
+	return s[:max] + TruncationMarker
+}
+
+// FieldProcessor transforms the fields of an entry before they are formatted.
+// Implementations receive a copy of the entry data and may modify and return it
+// or return a new logrus.Fields altogether.
+type FieldProcessor interface {
+	Process(fields logrus.Fields) logrus.Fields
+}
+
+// FieldProcessorFunc is an adapter to allow the use of ordinary functions as a FieldProcessor.
+type FieldProcessorFunc func(fields logrus.Fields) logrus.Fields
+
+// Process calls f(fields).
+func (f FieldProcessorFunc) Process(fields logrus.Fields) logrus.Fields {
+	return f(fields)
+}
+
+// ChainFieldProcessors returns a FieldProcessor that applies the given processors in order,
+// passing the output of each one to the next.
+func ChainFieldProcessors(processors ...FieldProcessor) FieldProcessor {
+	return FieldProcessorFunc(func(fields logrus.Fields) logrus.Fields {
+		for _, p := range processors {
+			if p == nil {
+				continue
+			}
+
+			fields = p.Process(fields)
+			if fields == nil {
+				fields = logrus.Fields{}
+			}
+		}
+
+		return fields
+	})
 }
 
 var (
@@ -291,18 +2215,44 @@ var (
 // "type" to "log" (unless set differently in `fields`),
 // "@timestamp" to the log time and "message" to the log message.
 //
-// Note: to set a different configuration use the `LogstashFormatter` structure.
+// Note: to set a different configuration use the `DefaultFormatterWithOptions` function
+// or the `LogstashFormatter` structure.
 func DefaultFormatter(fields logrus.Fields) logrus.Formatter {
+	return DefaultFormatterWithOptions(fields, nil, "")
+}
+
+// DefaultFormatterWithOptions returns a default Logstash formatter like `DefaultFormatter` does,
+// with the keys of `fieldMap` overriding the default field mapping (time to "@timestamp" and
+// msg to "message"), e.g. logrus.FieldMap{logrus.FieldKeyLevel: "log.level"},
+// and the time formatted with `timestampFormat` instead of time.RFC3339Nano.
+//
+// An empty `fieldMap` or `timestampFormat` falls back to the defaults.
+func DefaultFormatterWithOptions(fields logrus.Fields, fieldMap logrus.FieldMap, timestampFormat string) logrus.Formatter {
+	if fields == nil {
+		fields = logrus.Fields{}
+	}
 	for k, v := range logstashFields {
 		if _, ok := fields[k]; !ok {
 			fields[k] = v
 		}
 	}
 
+	fm := logrus.FieldMap{}
+	for k, v := range logstashFieldMap {
+		fm[k] = v
+	}
+	for k, v := range fieldMap {
+		fm[k] = v
+	}
+
+	if timestampFormat == "" {
+		timestampFormat = time.RFC3339Nano
+	}
+
 	return LogstashFormatter{
 		Formatter: &logrus.JSONFormatter{
-			TimestampFormat: time.RFC3339Nano,
-			FieldMap:        logstashFieldMap,
+			TimestampFormat: timestampFormat,
+			FieldMap:        fm,
 		},
 		Fields: fields,
 	}
@@ -312,7 +2262,7 @@ func DefaultFormatter(fields logrus.Fields) logrus.Formatter {
 //
 // Note: the given entry is copied and not changed during the formatting process.
 func (f LogstashFormatter) Format(e *logrus.Entry) ([]byte, error) {
-	ne := copyEntry(e, f.Fields)
+	ne := copyEntry(e, f)
 	dataBytes, err := f.Formatter.Format(ne)
 	releaseEntry(ne)
 	return dataBytes, err
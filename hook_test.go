@@ -3,9 +3,14 @@ package logrustash
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -26,7 +31,7 @@ func TestFire(t *testing.T) {
 
 	buffer := bytes.NewBuffer(nil)
 	h := Hook{
-		conn:      buffer,
+		writer:    buffer,
 		formatter: simpleFmter{},
 	}
 
@@ -53,7 +58,7 @@ func TestFireFormatError(t *testing.T) {
 
 	buffer := bytes.NewBuffer(nil)
 	h := Hook{
-		conn:      buffer,
+		writer:    buffer,
 		formatter: FailFmt{},
 	}
 
@@ -71,7 +76,7 @@ func TestFireWriteError(t *testing.T) {
 	assert := assert.New(t)
 
 	h := Hook{
-		conn:    FailWrite{},
+		writer:    FailWrite{},
 		formatter: &logrus.JSONFormatter{},
 	}
 
@@ -141,6 +146,64 @@ func TestDefaultFormatterWithCaller(t *testing.T) {
 	}
 }
 
+func TestDefaultFormatterWithEntryCaller(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := &safeBuffer{}
+	hook, err := NewWithWriter(buffer, WithSynchronous())
+	require.NoError(err)
+
+	log := logrus.New()
+	log.Out = io.Discard
+	log.ReportCaller = true
+	log.Hooks.Add(hook)
+
+	_, file, line, _ := runtime.Caller(0)
+	log.Info("msg1")
+
+	var doc map[string]interface{}
+	require.NoError(json.Unmarshal([]byte(buffer.String()), &doc))
+	assert.Equal(fmt.Sprintf("%s:%d", file, line+1), doc["file"])
+	assert.Equal("github.com/nekomeowww/logrus-logstash-hook.TestDefaultFormatterWithEntryCaller", doc["function"])
+
+	// the field names and the paths are configurable
+	entry := &logrus.Entry{
+		Message: "msg1",
+		Logger:  log,
+		Caller:  &runtime.Frame{File: "/src/app/handler.go", Line: 42, Function: "app.handle"},
+	}
+
+	formatter := DefaultFormatter(logrus.Fields{}).(LogstashFormatter)
+	formatter.CallerFunctionKey = "log.origin.function"
+	formatter.CallerFileKey = "log.origin.file"
+	formatter.CallerTrimPrefix = "/src/"
+
+	res, err := formatter.Format(entry)
+	require.NoError(err)
+	doc = nil
+	require.NoError(json.Unmarshal(res, &doc))
+	assert.Equal("app/handler.go:42", doc["log.origin.file"])
+	assert.Equal("app.handle", doc["log.origin.function"])
+	assert.NotContains(doc, "file")
+
+	formatter.CallerPrettyfier = func(f *runtime.Frame) (string, string) {
+		return "", filepath.Base(f.File)
+	}
+	res, err = formatter.Format(entry)
+	require.NoError(err)
+	doc = nil
+	require.NoError(json.Unmarshal(res, &doc))
+	assert.Equal("handler.go", doc["log.origin.file"])
+	assert.NotContains(doc, "log.origin.function")
+
+	// the caller is reported with ReportCaller only
+	log.ReportCaller = false
+	res, err = formatter.Format(entry)
+	require.NoError(err)
+	assert.NotContains(string(res), "handler.go")
+}
+
 func TestDefaultFormatterWithFileAndFunctionFieldOverride(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -201,7 +264,7 @@ func TestDefaultFormatterWithEmptyFields(t *testing.T) {
 		"\"fields\":\"Key1=Value1\"",
 		"\"@version\":\"1\"",
 		"\"type\":\"log\"",
-		fmt.Sprintf("\"@timestamp\":\"%s\"", now.Format(time.RFC3339)),
+		fmt.Sprintf("\"@timestamp\":\"%s\"", now.Format(time.RFC3339Nano)),
 	}
 
 	for _, exp := range expected {
@@ -217,3 +280,545 @@ func TestLogstashFieldsNotOverridden(t *testing.T) {
 	_, ok := logstashFields["user1"]
 	assert.False(ok)
 }
+
+func TestFieldProcessor(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	rename := FieldProcessorFunc(func(fields logrus.Fields) logrus.Fields {
+		fields["user_id"] = fields["uid"]
+		delete(fields, "uid")
+		return fields
+	})
+	drop := FieldProcessorFunc(func(fields logrus.Fields) logrus.Fields {
+		delete(fields, "secret")
+		return fields
+	})
+
+	formatter := LogstashFormatter{
+		Formatter:      &logrus.JSONFormatter{},
+		Fields:         logrus.Fields{},
+		FieldProcessor: ChainFieldProcessors(rename, drop),
+	}
+
+	entry := &logrus.Entry{
+		Message: "msg1",
+		Data:    logrus.Fields{"uid": 42, "secret": "s3cr3t"},
+	}
+
+	res, err := formatter.Format(entry)
+	require.NoError(err)
+
+	assert.Contains(string(res), `"fields":"user_id=42"`)
+	assert.NotContains(string(res), "s3cr3t")
+	assert.Equal(logrus.Fields{"uid": 42, "secret": "s3cr3t"}, entry.Data, "the original entry must not be changed")
+}
+
+func TestFireSentAt(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	for _, formatter := range []logrus.Formatter{DefaultFormatter(logrus.Fields{}), &logrus.JSONFormatter{}} {
+		buffer := bytes.NewBuffer(nil)
+		h := Hook{
+			writer:    buffer,
+			formatter: formatter,
+			opts:      HookOptions{SentAtKey: "sent_at"},
+		}
+
+		eventTime := time.Now().Add(-time.Minute)
+		err := h.Fire(&logrus.Entry{Message: "msg1", Time: eventTime, Data: logrus.Fields{"f1": "bla"}})
+		require.NoError(err)
+
+		var doc map[string]interface{}
+		require.NoError(json.Unmarshal(buffer.Bytes(), &doc))
+		require.Contains(doc, "sent_at")
+
+		sentAt, err := time.Parse(time.RFC3339Nano, doc["sent_at"].(string))
+		require.NoError(err)
+		assert.True(sentAt.After(eventTime))
+	}
+}
+
+func TestFireDynamicFields(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	type requestIDKey struct{}
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-42")
+
+	var opts options
+	WithDynamicField("request_id", func(e *logrus.Entry) interface{} {
+		if e.Context == nil {
+			return nil
+		}
+
+		return e.Context.Value(requestIDKey{})
+	})(&opts)
+	WithDynamicField("calls", func(*logrus.Entry) interface{} { return 1 })(&opts)
+
+	for _, formatter := range []logrus.Formatter{DefaultFormatter(logrus.Fields{}), &logrus.JSONFormatter{}} {
+		buffer := bytes.NewBuffer(nil)
+		h := Hook{
+			writer:    buffer,
+			formatter: formatter,
+			opts:      opts.HookOptions,
+		}
+
+		require.NoError(h.Fire(&logrus.Entry{Message: "msg1", Context: ctx, Data: logrus.Fields{}}))
+
+		var doc map[string]interface{}
+		require.NoError(json.Unmarshal(buffer.Bytes(), &doc))
+		assert.Equal("req-42", doc["request_id"])
+		assert.Equal(float64(1), doc["calls"])
+	}
+}
+
+func TestFireMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var opts options
+	WithMiddleware(func(e *logrus.Entry) *logrus.Entry {
+		// rename a field
+		if v, ok := e.Data["usr"]; ok {
+			e.Data["user"] = v
+			delete(e.Data, "usr")
+		}
+		return e
+	})(&opts)
+	WithMiddleware(func(e *logrus.Entry) *logrus.Entry {
+		if e.Message == "noise" {
+			return nil
+		}
+		e.Message = strings.ToUpper(e.Message)
+		return e
+	})(&opts)
+
+	buffer := bytes.NewBuffer(nil)
+	h := Hook{
+		writer:    buffer,
+		formatter: &logrus.JSONFormatter{},
+		opts:      opts.HookOptions,
+	}
+
+	entry := &logrus.Entry{Message: "msg1", Data: logrus.Fields{"usr": "jane"}}
+	require.NoError(h.Fire(entry))
+	require.NoError(h.Fire(&logrus.Entry{Message: "noise", Data: logrus.Fields{}}))
+
+	var doc map[string]interface{}
+	require.NoError(json.Unmarshal(buffer.Bytes(), &doc))
+	assert.Equal("MSG1", doc["msg"])
+	assert.Equal("jane", doc["user"])
+	assert.NotContains(doc, "usr")
+
+	// the entry fired is left untouched for the other hooks
+	assert.Equal("msg1", entry.Message)
+	assert.Equal(logrus.Fields{"usr": "jane"}, entry.Data)
+
+	stats := h.Stats()
+	assert.Equal(uint64(1), stats.Sent)
+	assert.Equal(uint64(1), stats.Dropped)
+}
+
+func TestDefaultFormatterWithContextFields(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	entry := &logrus.Entry{
+		Message: "msg1",
+		Data:    logrus.Fields{"f1": "bla"},
+		Context: context.WithValue(context.Background(), ContextKeyFields, logrus.Fields{"top": "level"}),
+	}
+
+	res, err := DefaultFormatter(logrus.Fields{}).Format(entry)
+	require.NoError(err)
+
+	assert.Contains(string(res), `"top":"level"`)
+	assert.Contains(string(res), `"fields":"f1=bla"`)
+}
+
+func TestFireWithoutConnError(t *testing.T) {
+	h := Hook{
+		formatter: &logrus.JSONFormatter{},
+	}
+
+	var err error
+	require.NotPanics(t, func() {
+		err = h.Fire(&logrus.Entry{Data: logrus.Fields{}})
+	})
+	assert.ErrorIs(t, err, ErrNotConnected)
+}
+
+// toggleWriter is an io.Writer which fails while it is down.
+type toggleWriter struct {
+	bytes.Buffer
+	down bool
+}
+
+func (w *toggleWriter) Write(d []byte) (int, error) {
+	if w.down {
+		return 0, errors.New("connection refused")
+	}
+
+	return w.Buffer.Write(d)
+}
+
+func TestFireRetryBuffer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	w := &toggleWriter{down: true}
+	h := &Hook{
+		writer:    w,
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:      HookOptions{RetryBufferSize: 10},
+	}
+
+	for _, msg := range []string{"m1", "m2", "m3"} {
+		require.NoError(h.Fire(&logrus.Entry{Message: msg, Data: logrus.Fields{}}))
+	}
+	assert.Zero(w.Len())
+
+	w.down = false
+	require.NoError(h.Fire(&logrus.Entry{Message: "m4", Data: logrus.Fields{}}))
+
+	expected := `{"level":"panic","msg":"m1"}
+{"level":"panic","msg":"m2"}
+{"level":"panic","msg":"m3"}
+{"level":"panic","msg":"m4"}
+`
+	assert.Equal(expected, w.String())
+	assert.Equal(uint64(4), h.Stats().Sent)
+	assert.Zero(h.Stats().Dropped)
+}
+
+func TestFireRetryBufferOverflow(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	w := &toggleWriter{down: true}
+	h := &Hook{
+		writer:    w,
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:      HookOptions{RetryBufferSize: 2},
+	}
+
+	for _, msg := range []string{"m1", "m2", "m3"} {
+		require.NoError(h.Fire(&logrus.Entry{Message: msg, Data: logrus.Fields{}}))
+	}
+
+	w.down = false
+	require.NoError(h.Fire(&logrus.Entry{Message: "m4", Data: logrus.Fields{}}))
+
+	expected := `{"level":"panic","msg":"m2"}
+{"level":"panic","msg":"m3"}
+{"level":"panic","msg":"m4"}
+`
+	assert.Equal(expected, w.String())
+	assert.Equal(uint64(1), h.Stats().Dropped)
+}
+
+func TestFireRetryBufferReconnect(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	addr := l.Addr().String()
+
+	_, conns := acceptLines(t, l)
+
+	// the hook tries to reconnect until it succeeds
+	hook, err := New("tcp", addr, &logrus.JSONFormatter{}, HookOptions{
+		RetryBufferSize: 10,
+		Backoff:         ConstantBackoff(10 * time.Millisecond),
+	})
+	require.NoError(err)
+	h := hook.(*Hook)
+	defer h.Close()
+
+	// kill the listener and the established connection
+	require.NoError(l.Close())
+	(<-conns).Close()
+
+	require.Eventually(func() bool {
+		require.NoError(h.Fire(&logrus.Entry{Message: "are you there?", Data: logrus.Fields{}}))
+		return !h.IsConnected()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the entries are kept for retry while reconnecting, they do not wait in the queue
+	for _, msg := range []string{"m1", "m2", "m3"} {
+		require.NoError(h.Fire(&logrus.Entry{Message: msg, Data: logrus.Fields{}}))
+	}
+	require.Eventually(func() bool { return len(h.logrusEntryFireChannel) == 0 }, time.Second, time.Millisecond)
+
+	l, err = net.Listen("tcp", addr)
+	require.NoError(err)
+	defer l.Close()
+
+	lines, _ := acceptLines(t, l)
+
+	// the entries are replayed in order once reconnected, without waiting for the next one
+	var received []string
+	for len(received) < 3 {
+		select {
+		case line := <-lines:
+			if !strings.Contains(line, "are you there?") {
+				received = append(received, line)
+			}
+		case <-time.After(5 * time.Second):
+			require.FailNow("expected the entries kept for retry to be replayed", "received %v", received)
+		}
+	}
+
+	for i, msg := range []string{"m1", "m2", "m3"} {
+		assert.Contains(received[i], fmt.Sprintf(`"msg":"%s"`, msg))
+	}
+}
+
+func TestFireWriteTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	// nothing is ever read from the other end of the pipe, the writes block like with a stalled Logstash
+	conn, stalled := net.Pipe()
+	defer conn.Close()
+	defer stalled.Close()
+
+	h := &Hook{
+		writer:    conn,
+		formatter: &logrus.JSONFormatter{},
+		opts:      HookOptions{WriteTimeout: 50 * time.Millisecond},
+	}
+
+	start := time.Now()
+	err := h.Fire(&logrus.Entry{Message: "never read", Data: logrus.Fields{}})
+
+	var netErr net.Error
+	if assert.ErrorAs(err, &netErr) {
+		assert.True(netErr.Timeout())
+	}
+	assert.Less(time.Since(start), time.Second)
+	assert.False(h.IsConnected())
+	assert.Equal(uint64(1), h.Stats().Failed)
+}
+
+func TestFireFallbackFormatter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := bytes.NewBuffer(nil)
+	h := Hook{
+		writer:    buffer,
+		formatter: FailFmt{},
+		opts:      HookOptions{FallbackFormatter: &logrus.JSONFormatter{DisableTimestamp: true}},
+	}
+
+	err := h.Fire(&logrus.Entry{Message: "my message", Data: logrus.Fields{}})
+	require.NoError(err)
+
+	assert.Equal(`{"_format_degraded":true,"level":"panic","msg":"my message"}`+"\n", buffer.String())
+}
+
+func TestDefaultFormatterWithOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Now()
+	formatter := DefaultFormatterWithOptions(logrus.Fields{}, logrus.FieldMap{logrus.FieldKeyLevel: "log.level"}, time.Kitchen)
+
+	res, err := formatter.Format(&logrus.Entry{
+		Message: "msg1",
+		Level:   logrus.WarnLevel,
+		Time:    now,
+		Data:    logrus.Fields{},
+	})
+	require.NoError(err)
+
+	expected := []string{
+		`"log.level":"warning"`,
+		`"message":"msg1"`,
+		`"@version":"1"`,
+		fmt.Sprintf(`"@timestamp":"%s"`, now.Format(time.Kitchen)),
+	}
+
+	for _, exp := range expected {
+		assert.Contains(string(res), exp)
+	}
+	assert.NotContains(string(res), `"level"`)
+}
+
+func TestDefaultFormatterWithEmptyOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Now()
+	formatter := DefaultFormatterWithOptions(nil, logrus.FieldMap{}, "")
+
+	res, err := formatter.Format(&logrus.Entry{Message: "msg1", Time: now, Data: logrus.Fields{}})
+	require.NoError(err)
+
+	assert.Contains(string(res), `"message":"msg1"`)
+	assert.Contains(string(res), fmt.Sprintf(`"@timestamp":"%s"`, now.Format(time.RFC3339Nano)))
+	assert.Contains(string(res), `"type":"log"`)
+}
+
+func TestLogstashFormatterWithBuffer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	entry := &logrus.Entry{
+		Message: "msg1",
+		Data:    logrus.Fields{},
+		Buffer:  bytes.NewBufferString("pre-rendered"),
+	}
+
+	res, err := LogstashFormatter{Formatter: &logrus.JSONFormatter{}, BufferKey: "rendered"}.Format(entry)
+	require.NoError(err)
+	assert.Contains(string(res), `"rendered":"pre-rendered"`)
+	assert.Contains(string(res), `"msg":"msg1"`)
+
+	res, err = LogstashFormatter{Formatter: &logrus.JSONFormatter{}, AppendBuffer: true}.Format(entry)
+	require.NoError(err)
+	assert.Contains(string(res), `"msg":"msg1 pre-rendered"`)
+	assert.NotContains(string(res), `"rendered"`)
+
+	entry.Buffer.Reset()
+	res, err = LogstashFormatter{Formatter: &logrus.JSONFormatter{}, BufferKey: "rendered", AppendBuffer: true}.Format(entry)
+	require.NoError(err)
+	assert.Contains(string(res), `"msg":"msg1"`)
+	assert.NotContains(string(res), `"rendered"`)
+}
+
+func TestLogstashFormatterCompactMessageWhitespace(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	entry := &logrus.Entry{
+		Message: "panic: oops\n\ngoroutine 1 [running]:\n\tmain.main()\n\t\t/app/main.go:12  ",
+		Data:    logrus.Fields{},
+	}
+
+	res, err := LogstashFormatter{Formatter: &logrus.JSONFormatter{}, CompactMessageWhitespace: true}.Format(entry)
+	require.NoError(err)
+	assert.Contains(string(res), `"msg":"panic: oops goroutine 1 [running]: main.main() /app/main.go:12"`)
+
+	res, err = LogstashFormatter{Formatter: &logrus.JSONFormatter{}}.Format(entry)
+	require.NoError(err)
+	assert.Contains(string(res), `\n\tmain.main()`, "multiline messages are preserved by default")
+}
+
+func TestLogstashFormatterMaxFieldValueBytes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	entry := &logrus.Entry{
+		Message: "msg1",
+		Data: logrus.Fields{
+			"query": "SELECT * FROM users WHERE id = 1",
+			"short": "ok",
+		},
+	}
+
+	res, err := LogstashFormatter{Formatter: &logrus.JSONFormatter{}, MaxFieldValueBytes: 8}.Format(entry)
+	require.NoError(err)
+	assert.Contains(string(res), "query=SELECT *"+TruncationMarker)
+	assert.Contains(string(res), "short=ok")
+	assert.Contains(string(res), `"msg":"msg1"`)
+}
+
+func TestTruncate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("hello", truncate("hello", 0))
+	assert.Equal("hello", truncate("hello", 5))
+	assert.Equal("hel"+TruncationMarker, truncate("hello", 3))
+	assert.Equal("h"+TruncationMarker, truncate("hé", 2), "UTF-8 characters must not be split")
+}
+
+func TestLogstashFormatterTimestampAliases(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Now()
+	formatter := DefaultFormatter(logrus.Fields{}).(LogstashFormatter)
+	formatter.TimestampAliases = []string{"timestamp", "event_time"}
+
+	res, err := formatter.Format(&logrus.Entry{Message: "msg1", Time: now, Data: logrus.Fields{}})
+	require.NoError(err)
+
+	var doc map[string]interface{}
+	require.NoError(json.Unmarshal(res, &doc))
+
+	expected := now.Format(time.RFC3339Nano)
+	assert.Equal(expected, doc["@timestamp"])
+	assert.Equal(expected, doc["timestamp"])
+	assert.Equal(expected, doc["event_time"])
+}
+
+func TestDefaultFormatterWithCancelledContext(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ContextKeyRuntimeCaller, &runtime.Frame{
+		File:     "main.go",
+		Line:     42,
+		Function: "main.main",
+	}))
+	cancel()
+
+	entry := &logrus.Entry{
+		Message: "msg1",
+		Logger:  logrus.New(),
+		Context: ctx,
+	}
+	entry.Logger.ReportCaller = true
+
+	formatter := DefaultFormatter(logrus.Fields{}).(LogstashFormatter)
+
+	res, err := formatter.Format(entry)
+	require.NoError(err)
+	assert.Contains(string(res), `"file":"main.go:42"`, "the caller is extracted regardless of the context by default")
+
+	formatter.SkipCancelledContext = true
+	res, err = formatter.Format(entry)
+	require.NoError(err)
+	assert.NotContains(string(res), `"file"`)
+	assert.NotContains(string(res), `"function"`)
+}
+
+func TestLogstashFormatterStructuredFields(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	entry := &logrus.Entry{
+		Message: "msg1",
+		Data:    logrus.Fields{"user": "alice", "attempt": 3, "type": "audit"},
+	}
+
+	formatter := DefaultFormatter(logrus.Fields{}).(LogstashFormatter)
+	formatter.StructuredFields = true
+
+	res, err := formatter.Format(entry)
+	require.NoError(err)
+
+	var doc map[string]interface{}
+	require.NoError(json.Unmarshal(res, &doc))
+
+	assert.Equal("alice", doc["user"])
+	assert.Equal("3", doc["attempt"])
+	assert.Equal("audit", doc["type"], "the fields of the entry are not overridden by the defaults")
+	assert.Equal("1", doc["@version"])
+	assert.NotContains(doc, "fields")
+
+	formatter.FieldsNamespace = "fields"
+	res, err = formatter.Format(entry)
+	require.NoError(err)
+
+	doc = nil
+	require.NoError(json.Unmarshal(res, &doc))
+
+	assert.Equal(map[string]interface{}{"user": "alice", "attempt": "3", "type": "audit"}, doc["fields"])
+	assert.Equal("log", doc["type"])
+	assert.NotContains(doc, "user")
+}
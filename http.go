@@ -0,0 +1,254 @@
+package logrustash
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHTTPContentType = "application/x-ndjson"
+	defaultHTTPTimeout     = 30 * time.Second
+
+	// maxHTTPErrorBody is the size of the response body kept in HTTPError.
+	maxHTTPErrorBody = 1024
+)
+
+// DefaultHTTPBackoff is the Backoff between the retries of HTTPWriter unless HTTPOptions.Backoff is set.
+var DefaultHTTPBackoff = ExponentialBackoff(100*time.Millisecond, 2, 5*time.Second, 0.2)
+
+// HTTPError is returned by HTTPWriter when the server answers with an unexpected status.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("unexpected http status %d: %s", e.StatusCode, e.Body)
+}
+
+// retryable reports whether the request may succeed if retried: too many requests,
+// request timeout and server errors.
+func (e *HTTPError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusRequestTimeout || e.StatusCode >= 500
+}
+
+// HTTPOptions configures HTTPWriter.
+type HTTPOptions struct {
+	// Client sends the requests, by default a client with its own pool of connections
+	// and a timeout of 30 seconds.
+	Client *http.Client
+	// Header is added to every request, e.g. an API key.
+	Header http.Header
+	// Username and Password, if set, authenticate the requests with basic auth.
+	Username string
+	Password string
+	// ContentType of the requests, "application/x-ndjson" by default.
+	ContentType string
+	// MaxRetries is the number of times a request is retried on network errors,
+	// 408, 429 and 5xx responses. The requests are not retried when zero.
+	MaxRetries int
+	// Backoff returns the time waited for before a retry, DefaultHTTPBackoff by default.
+	// The Retry-After header of the response takes precedence.
+	Backoff Backoff
+	// Compress gzips the body of the requests, with the Content-Encoding header.
+	Compress bool
+}
+
+// HTTPWriter POSTs every write, a single entry or a batch of newline-delimited entries,
+// to an HTTP(S) endpoint, e.g. the Logstash http input:
+//
+//	input { http { port => 8080 additional_codecs => { "application/x-ndjson" => "json_lines" } } }
+//
+// It is meant to be used with NewWithWriter or NewFromConn. It is not safe for concurrent use,
+// the hooks serialize the writes.
+type HTTPWriter struct {
+	url    string
+	opts   HTTPOptions
+	client *http.Client
+
+	// check, if set, validates the body of the successful responses, its errors are not retried
+	check func(body []byte) error
+	// gzipped is set when the data written is gzipped by the hook, see HookOptions.Compress
+	gzipped bool
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+// NewHTTPWriter returns a HTTPWriter posting to `endpoint`.
+func NewHTTPWriter(endpoint string, opts HTTPOptions) (*HTTPWriter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported url scheme %q", u.Scheme)
+	}
+
+	client := opts.Client
+	if client == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConnsPerHost = 4
+		client = &http.Client{Transport: transport, Timeout: defaultHTTPTimeout}
+	}
+
+	return &HTTPWriter{url: endpoint, opts: opts, client: client}, nil
+}
+
+// Write posts `data`, retrying according to HTTPOptions.MaxRetries. The data gzipped by the hook,
+// see HookOptions.Compress, is posted as is with the Content-Encoding header.
+func (w *HTTPWriter) Write(data []byte) (int, error) {
+	ctx, cancel := w.writeContext()
+	defer cancel()
+
+	var body []byte
+	var err error
+	if w.gzipped {
+		body, err = w.postEncodedWithRetries(ctx, data, "gzip")
+	} else {
+		body, err = w.postWithRetries(ctx, data)
+	}
+	if err == nil && w.check != nil {
+		err = w.check(body)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// writeContext returns the context of a write, done once the write deadline is exceeded.
+func (w *HTTPWriter) writeContext() (context.Context, context.CancelFunc) {
+	w.mu.Lock()
+	deadline := w.deadline
+	w.mu.Unlock()
+
+	if deadline.IsZero() {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithDeadline(context.Background(), deadline)
+}
+
+// backoff returns the Backoff between the retries.
+func (w *HTTPWriter) backoff() Backoff {
+	if w.opts.Backoff != nil {
+		return w.opts.Backoff
+	}
+
+	return DefaultHTTPBackoff
+}
+
+// postWithRetries posts `data`, gzipped if HTTPOptions.Compress is set, retrying according
+// to HTTPOptions.MaxRetries, and returns the body of the response.
+func (w *HTTPWriter) postWithRetries(ctx context.Context, data []byte) ([]byte, error) {
+	if !w.opts.Compress {
+		return w.postEncodedWithRetries(ctx, data, "")
+	}
+
+	compressed, err := gzipBytes(data, gzip.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.postEncodedWithRetries(ctx, compressed, "gzip")
+}
+
+// postEncodedWithRetries posts `data` encoded with `encoding`, if not empty, retrying according
+// to HTTPOptions.MaxRetries, and returns the body of the response.
+func (w *HTTPWriter) postEncodedWithRetries(ctx context.Context, data []byte, encoding string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		body, retryAfter, retry, err := w.post(ctx, data, encoding)
+		if err == nil {
+			return body, nil
+		}
+		if !retry || attempt >= w.opts.MaxRetries || ctx.Err() != nil {
+			return nil, err
+		}
+
+		delay := retryAfter
+		if delay <= 0 {
+			delay = w.backoff()(attempt + 1)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// post sends a single request of `data` encoded with `encoding`, if not empty, and returns the body
+// of the response. When it fails, it returns whether it may succeed if retried and the delay asked
+// by the Retry-After header if any.
+func (w *HTTPWriter) post(ctx context.Context, data []byte, encoding string) (body []byte, retryAfter time.Duration, retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	for k, values := range w.opts.Header {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	if req.Header.Get("Content-Type") == "" {
+		contentType := w.opts.ContentType
+		if contentType == "" {
+			contentType = defaultHTTPContentType
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	if w.opts.Username != "" || w.opts.Password != "" {
+		req.SetBasicAuth(w.opts.Username, w.opts.Password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, 0, true, err
+	}
+	defer resp.Body.Close()
+
+	// the body is read entirely for the connection to be re-used
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, true, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		httpErr := &HTTPError{StatusCode: resp.StatusCode, Body: string(body[:min(len(body), maxHTTPErrorBody)])}
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return nil, time.Duration(seconds) * time.Second, httpErr.retryable(), httpErr
+	}
+
+	return body, 0, false, nil
+}
+
+// SetWriteDeadline sets the time the writes, retries included, must be done by,
+// see HookOptions.WriteTimeout.
+func (w *HTTPWriter) SetWriteDeadline(t time.Time) error {
+	w.mu.Lock()
+	w.deadline = t
+	w.mu.Unlock()
+
+	return nil
+}
+
+// Close closes the idle connections of the client.
+func (w *HTTPWriter) Close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,186 @@
+package logrustash
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingHandler records the bodies of the requests it answers with the statuses of
+// `statuses` in order, then 200.
+type recordingHandler struct {
+	mu       sync.Mutex
+	statuses []int
+	bodies   []string
+	requests []*http.Request
+}
+
+func (h *recordingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.bodies = append(h.bodies, string(body))
+	h.requests = append(h.requests, r)
+	if len(h.statuses) > 0 {
+		w.WriteHeader(h.statuses[0])
+		h.statuses = h.statuses[1:]
+	}
+}
+
+func (h *recordingHandler) Bodies() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]string(nil), h.bodies...)
+}
+
+func TestNewHTTPWriter(t *testing.T) {
+	_, err := NewHTTPWriter("tcp://logstash:8080", HTTPOptions{})
+	assert.Error(t, err)
+
+	_, err = NewHTTPWriter("://", HTTPOptions{})
+	assert.Error(t, err)
+}
+
+func TestHTTPWriter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	handler := &recordingHandler{}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	w, err := NewHTTPWriter(ts.URL, HTTPOptions{
+		Header:   http.Header{"X-Api-Key": []string{"secret"}},
+		Username: "logstash",
+		Password: "changeme",
+	})
+	require.NoError(err)
+
+	hook, err := NewWithWriter(w, WithFormatter(&logrus.JSONFormatter{}), WithBatching(3, time.Hour))
+	require.NoError(err)
+
+	for _, msg := range []string{"m1", "m2", "m3", "m4"} {
+		require.NoError(hook.Fire(&logrus.Entry{Message: msg, Data: logrus.Fields{}}))
+	}
+	require.NoError(hook.(*Hook).Close())
+
+	bodies := handler.Bodies()
+	require.Len(bodies, 2)
+	assert.Equal(3, strings.Count(bodies[0], "\n"))
+	assert.Contains(bodies[1], `"msg":"m4"`)
+
+	r := handler.requests[0]
+	assert.Equal(http.MethodPost, r.Method)
+	assert.Equal("application/x-ndjson", r.Header.Get("Content-Type"))
+	assert.Equal("secret", r.Header.Get("X-Api-Key"))
+	username, password, ok := r.BasicAuth()
+	assert.True(ok)
+	assert.Equal("logstash", username)
+	assert.Equal("changeme", password)
+}
+
+func TestHTTPWriterRetries(t *testing.T) {
+	assert := assert.New(t)
+
+	handler := &recordingHandler{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	w, err := NewHTTPWriter(ts.URL, HTTPOptions{MaxRetries: 2, Backoff: ConstantBackoff(time.Millisecond)})
+	require.NoError(t, err)
+
+	n, err := w.Write([]byte("entry\n"))
+	assert.NoError(err)
+	assert.Equal(6, n)
+	assert.Len(handler.Bodies(), 3)
+
+	// the client errors are not retried
+	handler.mu.Lock()
+	handler.statuses = []int{http.StatusBadRequest}
+	handler.mu.Unlock()
+	_, err = w.Write([]byte("entry\n"))
+
+	var httpErr *HTTPError
+	assert.ErrorAs(err, &httpErr)
+	assert.Equal(http.StatusBadRequest, httpErr.StatusCode)
+	assert.Len(handler.Bodies(), 4)
+
+	// the retries stop once the write deadline is exceeded
+	var requests atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	w, err = NewHTTPWriter(failing.URL, HTTPOptions{MaxRetries: 1000, Backoff: ConstantBackoff(10 * time.Millisecond)})
+	require.NoError(t, err)
+	require.NoError(t, w.SetWriteDeadline(time.Now().Add(50*time.Millisecond)))
+
+	_, err = w.Write([]byte("entry\n"))
+	assert.Error(err)
+	assert.Less(requests.Load(), int32(100))
+	assert.NoError(w.Close())
+}
+
+func TestHTTPWriterCompress(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	handler := &recordingHandler{}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	gunzip := func(body string) string {
+		zr, err := gzip.NewReader(strings.NewReader(body))
+		require.NoError(err)
+
+		uncompressed, err := io.ReadAll(zr)
+		require.NoError(err)
+		return string(uncompressed)
+	}
+
+	// the writer compresses the requests
+	w, err := NewHTTPWriter(ts.URL, HTTPOptions{Compress: true})
+	require.NoError(err)
+
+	_, err = w.Write([]byte("entry\n"))
+	require.NoError(err)
+	assert.Equal("gzip", handler.requests[0].Header.Get("Content-Encoding"))
+	assert.Equal("entry\n", gunzip(handler.Bodies()[0]))
+
+	// the data compressed by the hook is posted as is
+	w, err = NewHTTPWriter(ts.URL, HTTPOptions{})
+	require.NoError(err)
+
+	hook, err := NewWithWriter(w, WithFormatter(&logrus.JSONFormatter{DisableTimestamp: true}), WithCompression(gzip.DefaultCompression), WithSynchronous())
+	require.NoError(err)
+	require.NoError(hook.Fire(&logrus.Entry{Message: "m1", Data: logrus.Fields{}}))
+	require.NoError(hook.(*Hook).Close())
+
+	assert.Equal("gzip", handler.requests[1].Header.Get("Content-Encoding"))
+	assert.Equal(`{"level":"panic","msg":"m1"}`+"\n", gunzip(handler.Bodies()[1]))
+
+	// the data not compressed by the hook has no encoding, even if it looks gzipped
+	w, err = NewHTTPWriter(ts.URL, HTTPOptions{})
+	require.NoError(err)
+
+	binary := string([]byte{0x1f, 0x8b, 0x00, 0x01})
+	_, err = w.Write([]byte(binary))
+	require.NoError(err)
+	assert.Empty(handler.requests[2].Header.Get("Content-Encoding"))
+	assert.Equal(binary, handler.Bodies()[2])
+}
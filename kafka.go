@@ -0,0 +1,834 @@
+package logrustash
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultKafkaClientID    = "logrustash"
+	defaultKafkaDialTimeout = 10 * time.Second
+	defaultKafkaTimeout     = 10 * time.Second
+
+	kafkaAPIProduce  = 0
+	kafkaAPIMetadata = 3
+
+	// kafkaSnappyBlockSize is the size of the blocks of the xerial snappy framing used by Kafka.
+	kafkaSnappyBlockSize = 32 << 10
+)
+
+// DefaultKafkaBackoff is the Backoff between the retries of KafkaWriter unless KafkaOptions.Backoff is set.
+var DefaultKafkaBackoff = ExponentialBackoff(100*time.Millisecond, 2, 5*time.Second, 0.2)
+
+var (
+	kafkaCRCTable     = crc32.MakeTable(crc32.Castagnoli)
+	kafkaSnappyHeader = []byte{0x82, 'S', 'N', 'A', 'P', 'P', 'Y', 0, 0, 0, 0, 1, 0, 0, 0, 1}
+)
+
+// KafkaAcks is the acknowledgment the brokers send once they wrote the records.
+type KafkaAcks int
+
+const (
+	// KafkaAcksLeader waits for the leader of the partition to write the records.
+	KafkaAcksLeader KafkaAcks = iota
+	// KafkaAcksAll waits for all the in-sync replicas of the partition to write the records.
+	KafkaAcksAll
+	// KafkaAcksNone does not wait for the records to be written, they may be lost.
+	KafkaAcksNone
+)
+
+// wire returns the acks of the produce requests.
+func (a KafkaAcks) wire() int16 {
+	switch a {
+	case KafkaAcksAll:
+		return -1
+	case KafkaAcksNone:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// KafkaCompression is the compression of the record batches.
+type KafkaCompression int8
+
+const (
+	KafkaCompressionNone KafkaCompression = iota
+	KafkaCompressionGzip
+	KafkaCompressionSnappy
+)
+
+// KafkaError is a Kafka protocol error returned by the brokers.
+type KafkaError struct {
+	Code int16
+}
+
+var kafkaErrors = map[int16]string{
+	2:  "corrupt message",
+	3:  "unknown topic or partition",
+	5:  "leader not available",
+	6:  "not leader for partition",
+	7:  "request timed out",
+	10: "message too large",
+	13: "network exception",
+	17: "invalid topic",
+	18: "record list too large",
+	19: "not enough replicas",
+	20: "not enough replicas after append",
+	29: "topic authorization failed",
+	76: "unsupported compression type",
+}
+
+func (e *KafkaError) Error() string {
+	if msg, ok := kafkaErrors[e.Code]; ok {
+		return "kafka: " + msg
+	}
+
+	return fmt.Sprintf("kafka: error code %d", e.Code)
+}
+
+// retryable reports whether the request may succeed if retried, once the metadata refreshed.
+func (e *KafkaError) retryable() bool {
+	switch e.Code {
+	case 2, 3, 5, 6, 7, 13, 19, 20:
+		return true
+	}
+
+	return false
+}
+
+// KafkaOptions configures the writer returned by NewKafkaWriter.
+type KafkaOptions struct {
+	// Brokers are the addresses of the brokers the metadata of the cluster are fetched from, e.g. "kafka:9092".
+	Brokers []string
+	// Topic is the topic the entries are published to.
+	Topic string
+	// KeyField, if set, is the field of the entries, formatted as JSON objects, whose value is the key
+	// of the records. The records of a key are published to the same partition, chosen as the default
+	// partitioner of the Java client does. The records without key are published to a partition
+	// chosen in turn for every write.
+	KeyField string
+	// Acks is the acknowledgment waited for, KafkaAcksLeader by default.
+	Acks KafkaAcks
+	// Compression of the record batches, none by default.
+	Compression KafkaCompression
+	// ClientID identifies the writer to the brokers, "logrustash" by default.
+	ClientID string
+	// TLS, if set, connects to the brokers over TLS.
+	TLS *tls.Config
+	// DialTimeout is the timeout of the connections to the brokers, 10 seconds by default.
+	DialTimeout time.Duration
+	// Timeout is the time the brokers wait for the acknowledgments of the replicas, 10 seconds by default.
+	// The requests time out after twice this time unless the hook sets a write deadline.
+	Timeout time.Duration
+	// MaxRetries is the number of times the records are published again on network errors and
+	// retryable Kafka errors, e.g. a leader change. They are not retried when zero.
+	MaxRetries int
+	// Backoff returns the time waited for before a retry, DefaultKafkaBackoff by default.
+	Backoff Backoff
+}
+
+// KafkaWriter publishes every write, a single entry or a batch of newline-delimited entries, as records
+// of a Kafka topic, e.g. consumed by the Logstash kafka input:
+//
+//	input { kafka { bootstrap_servers => "kafka:9092" topics => ["logs"] codec => json } }
+//
+// It speaks the Kafka protocol itself, fetching the leaders of the partitions from the brokers
+// and producing a record batch per partition. It supports neither idempotence nor transactions.
+// It is meant to be used with NewWithWriter. It is not safe for concurrent use, the hooks serialize the writes.
+type KafkaWriter struct {
+	opts KafkaOptions
+
+	conns map[string]*kafkaConn
+	// brokers are the addresses of the brokers by node ID, leaders the node ID of the leaders by partition
+	brokers    map[int32]string
+	partitions []int32
+	leaders    map[int32]int32
+	next       int
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+// kafkaConn is a connection to a broker.
+type kafkaConn struct {
+	net.Conn
+
+	r           *bufio.Reader
+	correlation int32
+}
+
+// kafkaRecord is a record to publish to the partition of its key.
+type kafkaRecord struct {
+	key   []byte
+	value []byte
+}
+
+// NewKafkaWriter returns a KafkaWriter publishing to `opts.Topic`. The brokers are connected to on the first write.
+func NewKafkaWriter(opts KafkaOptions) (*KafkaWriter, error) {
+	if len(opts.Brokers) == 0 {
+		return nil, errors.New("no kafka broker")
+	}
+	if opts.Topic == "" {
+		return nil, errors.New("no kafka topic")
+	}
+
+	return &KafkaWriter{opts: opts, conns: make(map[string]*kafkaConn)}, nil
+}
+
+// Write publishes the entries of `data`, one record per line, retrying according to KafkaOptions.MaxRetries.
+func (w *KafkaWriter) Write(data []byte) (int, error) {
+	pending := w.records(data)
+	if len(pending) == 0 {
+		return len(data), nil
+	}
+
+	deadline := w.writeDeadline()
+	for attempt := 0; ; attempt++ {
+		var err error
+		if w.leaders == nil {
+			err = w.refreshMetadata(deadline)
+		}
+		if err == nil {
+			pending, err = w.produce(pending, deadline)
+		}
+		if err == nil {
+			return len(data), nil
+		}
+
+		var kafkaErr *KafkaError
+		if errors.As(err, &kafkaErr) && !kafkaErr.retryable() || attempt >= w.opts.MaxRetries {
+			return 0, err
+		}
+
+		delay := w.backoff()(attempt + 1)
+		if time.Now().Add(delay).After(deadline) {
+			return 0, err
+		}
+
+		// the leaders may have changed
+		w.leaders = nil
+		time.Sleep(delay)
+	}
+}
+
+// records returns the records of the lines of `data`, keyed by KafkaOptions.KeyField.
+func (w *KafkaWriter) records(data []byte) []kafkaRecord {
+	var records []kafkaRecord
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		records = append(records, kafkaRecord{key: w.key(line), value: line})
+	}
+
+	return records
+}
+
+// key returns the value of KafkaOptions.KeyField in the JSON object `line`, nil if it is not in it.
+func (w *KafkaWriter) key(line []byte) []byte {
+	if w.opts.KeyField == "" {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return nil
+	}
+
+	raw, ok := fields[w.opts.KeyField]
+	if !ok || string(raw) == "null" {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return []byte(s)
+	}
+
+	return raw
+}
+
+// writeDeadline returns the time the write must be done by.
+func (w *KafkaWriter) writeDeadline() time.Time {
+	w.mu.Lock()
+	deadline := w.deadline
+	w.mu.Unlock()
+
+	if deadline.IsZero() {
+		deadline = time.Now().Add(2 * w.timeout())
+	}
+
+	return deadline
+}
+
+func (w *KafkaWriter) timeout() time.Duration {
+	if w.opts.Timeout > 0 {
+		return w.opts.Timeout
+	}
+
+	return defaultKafkaTimeout
+}
+
+func (w *KafkaWriter) backoff() Backoff {
+	if w.opts.Backoff != nil {
+		return w.opts.Backoff
+	}
+
+	return DefaultKafkaBackoff
+}
+
+// refreshMetadata fetches the brokers and the leaders of the partitions of the topic
+// from the first broker answering.
+func (w *KafkaWriter) refreshMetadata(deadline time.Time) error {
+	addrs := append([]string(nil), w.opts.Brokers...)
+	for _, addr := range w.brokers {
+		addrs = append(addrs, addr)
+	}
+
+	var err error
+	for _, addr := range addrs {
+		var resp []byte
+		resp, err = w.roundTrip(addr, kafkaAPIMetadata, 1, kafkaAppendArrayLen(nil, 1, func(b []byte, _ int) []byte {
+			return kafkaAppendString(b, w.opts.Topic)
+		}), deadline)
+		if err == nil {
+			err = w.parseMetadata(resp)
+		}
+
+		var kafkaErr *KafkaError
+		if err == nil || errors.As(err, &kafkaErr) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("failed to fetch the kafka metadata: %w", err)
+}
+
+// parseMetadata parses a metadata response of version 1.
+func (w *KafkaWriter) parseMetadata(resp []byte) error {
+	d := &kafkaDecoder{b: resp}
+
+	brokers := make(map[int32]string)
+	for n := d.arrayLen(); n > 0; n-- {
+		id, host, port := d.int32(), d.string(), d.int32()
+		d.string() // rack
+
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.int32() // controller
+
+	var partitions []int32
+	leaders := make(map[int32]int32)
+	var topicErr int16
+	for n := d.arrayLen(); n > 0; n-- {
+		code, name := d.int16(), d.string()
+		d.int8() // internal
+
+		for p := d.arrayLen(); p > 0; p-- {
+			d.int16() // error of the partition, e.g. its leader is not available
+			partition, leader := d.int32(), d.int32()
+			d.skipInt32s() // replicas
+			d.skipInt32s() // in-sync replicas
+
+			if name == w.opts.Topic {
+				partitions = append(partitions, partition)
+				if leader >= 0 {
+					leaders[partition] = leader
+				}
+			}
+		}
+
+		if name == w.opts.Topic {
+			topicErr = code
+		}
+	}
+
+	if d.err != nil {
+		return fmt.Errorf("invalid kafka metadata response: %w", d.err)
+	}
+	if topicErr != 0 {
+		return &KafkaError{Code: topicErr}
+	}
+	if len(partitions) == 0 {
+		return &KafkaError{Code: 3}
+	}
+
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+	w.brokers, w.partitions, w.leaders = brokers, partitions, leaders
+	return nil
+}
+
+// produce publishes the records to the leaders of their partitions and returns the records which
+// failed to be published with the first error.
+func (w *KafkaWriter) produce(records []kafkaRecord, deadline time.Time) ([]kafkaRecord, error) {
+	// the records without key go to the same partition, with a leader, chosen in turn
+	var available []int32
+	for _, p := range w.partitions {
+		if _, ok := w.leaders[p]; ok {
+			available = append(available, p)
+		}
+	}
+	if len(available) == 0 {
+		return records, &KafkaError{Code: 5}
+	}
+	sticky := available[w.next%len(available)]
+	w.next++
+
+	byPartition := make(map[int32][]kafkaRecord)
+	for _, r := range records {
+		partition := sticky
+		if r.key != nil {
+			partition = w.partitions[int(kafkaMurmur2(r.key)&0x7fffffff)%len(w.partitions)]
+		}
+
+		byPartition[partition] = append(byPartition[partition], r)
+	}
+
+	byLeader := make(map[int32][]int32)
+	var failed []kafkaRecord
+	var firstErr error
+	for partition, records := range byPartition {
+		leader, ok := w.leaders[partition]
+		if !ok {
+			failed = append(failed, records...)
+			firstErr = &KafkaError{Code: 5}
+			continue
+		}
+
+		byLeader[leader] = append(byLeader[leader], partition)
+	}
+
+	for leader, partitions := range byLeader {
+		if err := w.produceTo(leader, partitions, byPartition, deadline); err != nil {
+			var partitionErrs kafkaPartitionErrors
+			if errors.As(err, &partitionErrs) {
+				for partition, code := range partitionErrs {
+					failed = append(failed, byPartition[partition]...)
+					err = &KafkaError{Code: code}
+				}
+			} else {
+				for _, partition := range partitions {
+					failed = append(failed, byPartition[partition]...)
+				}
+			}
+
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return failed, firstErr
+}
+
+// kafkaPartitionErrors are the errors of the partitions of a produce request by partition.
+type kafkaPartitionErrors map[int32]int16
+
+func (e kafkaPartitionErrors) Error() string {
+	return fmt.Sprintf("kafka: %d partitions failed", len(e))
+}
+
+// produceTo sends a produce request of version 3 with the records of `partitions` to the broker `leader`.
+func (w *KafkaWriter) produceTo(leader int32, partitions []int32, records map[int32][]kafkaRecord, deadline time.Time) error {
+	addr, ok := w.brokers[leader]
+	if !ok {
+		return &KafkaError{Code: 5}
+	}
+
+	req := binary.BigEndian.AppendUint16(nil, 0xffff) // no transactional ID
+	req = binary.BigEndian.AppendUint16(req, uint16(w.opts.Acks.wire()))
+	req = binary.BigEndian.AppendUint32(req, uint32(w.timeout().Milliseconds()))
+
+	now := time.Now()
+	var err error
+	req = kafkaAppendArrayLen(req, 1, func(b []byte, _ int) []byte {
+		b = kafkaAppendString(b, w.opts.Topic)
+		return kafkaAppendArrayLen(b, len(partitions), func(b []byte, i int) []byte {
+			batch, batchErr := kafkaRecordBatch(records[partitions[i]], now, w.opts.Compression)
+			if batchErr != nil {
+				err = batchErr
+			}
+
+			b = binary.BigEndian.AppendUint32(b, uint32(partitions[i]))
+			b = binary.BigEndian.AppendUint32(b, uint32(len(batch)))
+			return append(b, batch...)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.roundTrip(addr, kafkaAPIProduce, 3, req, deadline)
+	if err != nil || w.opts.Acks == KafkaAcksNone {
+		return err
+	}
+
+	d := &kafkaDecoder{b: resp}
+	errs := make(kafkaPartitionErrors)
+	for n := d.arrayLen(); n > 0; n-- {
+		d.string() // topic
+		for p := d.arrayLen(); p > 0; p-- {
+			partition, code := d.int32(), d.int16()
+			d.int64() // base offset
+			d.int64() // log append time
+
+			if code != 0 {
+				errs[partition] = code
+			}
+		}
+	}
+
+	if d.err != nil {
+		return fmt.Errorf("invalid kafka produce response: %w", d.err)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// roundTrip sends the request `body` of the API `key` to the broker at `addr`, connecting to it
+// if needed, and returns the body of the response, nil if the produce requests are not acknowledged.
+// The connection is closed on errors.
+func (w *KafkaWriter) roundTrip(addr string, key, version int16, body []byte, deadline time.Time) ([]byte, error) {
+	conn, err := w.conn(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := conn.roundTrip(w.clientID(), key, version, body, deadline, key != kafkaAPIProduce || w.opts.Acks != KafkaAcksNone)
+	if err != nil {
+		conn.Close()
+		delete(w.conns, addr)
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (w *KafkaWriter) clientID() string {
+	if w.opts.ClientID != "" {
+		return w.opts.ClientID
+	}
+
+	return defaultKafkaClientID
+}
+
+// conn returns the connection to the broker at `addr`, connecting to it if needed.
+func (w *KafkaWriter) conn(addr string) (*kafkaConn, error) {
+	if conn, ok := w.conns[addr]; ok {
+		return conn, nil
+	}
+
+	dialTimeout := w.opts.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultKafkaDialTimeout
+	}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	var conn net.Conn
+	var err error
+	if w.opts.TLS != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, w.opts.TLS)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &kafkaConn{Conn: conn, r: bufio.NewReader(conn)}
+	w.conns[addr] = c
+	return c, nil
+}
+
+// roundTrip sends a request with a header of version 1 and reads its response if `wait` is set.
+func (c *kafkaConn) roundTrip(clientID string, key, version int16, body []byte, deadline time.Time, wait bool) ([]byte, error) {
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	c.correlation++
+	req := binary.BigEndian.AppendUint32(make([]byte, 0, len(body)+32), 0)
+	req = binary.BigEndian.AppendUint16(req, uint16(key))
+	req = binary.BigEndian.AppendUint16(req, uint16(version))
+	req = binary.BigEndian.AppendUint32(req, uint32(c.correlation))
+	req = kafkaAppendString(req, clientID)
+	req = append(req, body...)
+	binary.BigEndian.PutUint32(req, uint32(len(req)-4))
+
+	if _, err := c.Write(req); err != nil {
+		return nil, err
+	}
+	if !wait {
+		return nil, nil
+	}
+
+	var header [8]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return nil, err
+	}
+
+	resp := make([]byte, binary.BigEndian.Uint32(header[:4])-4)
+	if _, err := io.ReadFull(c.r, resp); err != nil {
+		return nil, err
+	}
+	if correlation := int32(binary.BigEndian.Uint32(header[4:])); correlation != c.correlation {
+		return nil, fmt.Errorf("unexpected kafka correlation ID %d, expected %d", correlation, c.correlation)
+	}
+
+	return resp, nil
+}
+
+// SetWriteDeadline sets the time the writes, retries included, must be done by,
+// see HookOptions.WriteTimeout.
+func (w *KafkaWriter) SetWriteDeadline(t time.Time) error {
+	w.mu.Lock()
+	w.deadline = t
+	w.mu.Unlock()
+
+	return nil
+}
+
+// Close closes the connections to the brokers.
+func (w *KafkaWriter) Close() error {
+	var err error
+	for addr, conn := range w.conns {
+		if closeErr := conn.Close(); err == nil {
+			err = closeErr
+		}
+		delete(w.conns, addr)
+	}
+
+	return err
+}
+
+// kafkaRecordBatch returns the record batch, of magic 2, of the records.
+func kafkaRecordBatch(records []kafkaRecord, now time.Time, compression KafkaCompression) ([]byte, error) {
+	var recs []byte
+	for i, r := range records {
+		rec := []byte{0}                  // attributes
+		rec = binary.AppendVarint(rec, 0) // timestamp delta
+		rec = binary.AppendVarint(rec, int64(i))
+		if r.key == nil {
+			rec = binary.AppendVarint(rec, -1)
+		} else {
+			rec = binary.AppendVarint(rec, int64(len(r.key)))
+			rec = append(rec, r.key...)
+		}
+		rec = binary.AppendVarint(rec, int64(len(r.value)))
+		rec = append(rec, r.value...)
+		rec = binary.AppendVarint(rec, 0) // headers
+
+		recs = binary.AppendVarint(recs, int64(len(rec)))
+		recs = append(recs, rec...)
+	}
+
+	switch compression {
+	case KafkaCompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(recs); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		recs = buf.Bytes()
+	case KafkaCompressionSnappy:
+		recs = kafkaSnappy(recs)
+	}
+
+	timestamp := uint64(now.UnixMilli())
+	body := binary.BigEndian.AppendUint16(nil, uint16(compression))
+	body = binary.BigEndian.AppendUint32(body, uint32(len(records)-1))
+	body = binary.BigEndian.AppendUint64(body, timestamp)
+	body = binary.BigEndian.AppendUint64(body, timestamp)
+	body = binary.BigEndian.AppendUint64(body, 0xffffffffffffffff) // producer ID
+	body = binary.BigEndian.AppendUint16(body, 0xffff)             // producer epoch
+	body = binary.BigEndian.AppendUint32(body, 0xffffffff)         // base sequence
+	body = binary.BigEndian.AppendUint32(body, uint32(len(records)))
+	body = append(body, recs...)
+
+	batch := binary.BigEndian.AppendUint64(make([]byte, 0, len(body)+21), 0) // base offset
+	batch = binary.BigEndian.AppendUint32(batch, uint32(len(body)+9))
+	batch = binary.BigEndian.AppendUint32(batch, 0xffffffff) // partition leader epoch
+	batch = append(batch, 2)                                 // magic
+	batch = binary.BigEndian.AppendUint32(batch, crc32.Checksum(body, kafkaCRCTable))
+	return append(batch, body...), nil
+}
+
+// kafkaSnappy compresses `data` in the xerial snappy framing of the Kafka clients.
+func kafkaSnappy(data []byte) []byte {
+	b := append([]byte(nil), kafkaSnappyHeader...)
+	for len(data) > 0 {
+		block := data[:min(len(data), kafkaSnappyBlockSize)]
+		data = data[len(block):]
+
+		encoded := snappyEncode(block)
+		b = binary.BigEndian.AppendUint32(b, uint32(len(encoded)))
+		b = append(b, encoded...)
+	}
+
+	return b
+}
+
+// kafkaMurmur2 is the murmur2 hash of the default partitioner of the Kafka Java client.
+func kafkaMurmur2(data []byte) uint32 {
+	const (
+		seed = 0x9747b28c
+		m    = 0x5bd1e995
+		r    = 24
+	)
+
+	h := uint32(seed) ^ uint32(len(data))
+	n := len(data) / 4 * 4
+	for i := 0; i < n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	switch len(data) % 4 {
+	case 3:
+		h ^= uint32(data[n+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[n+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[n])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
+
+// kafkaAppendString appends the string `s` prefixed by its 2-byte length.
+func kafkaAppendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// kafkaAppendArrayLen appends the length `n` of an array and its items appended by `item`.
+func kafkaAppendArrayLen(b []byte, n int, item func(b []byte, i int) []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(n))
+	for i := 0; i < n; i++ {
+		b = item(b, i)
+	}
+
+	return b
+}
+
+// kafkaDecoder decodes the fields of a Kafka message, the first error is kept in err.
+type kafkaDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	if b := d.next(1); b != nil {
+		return int8(b[0])
+	}
+
+	return 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+
+	return 0
+}
+
+// string decodes a string prefixed by its 2-byte length, a null string being empty.
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+
+	return string(d.next(int(n)))
+}
+
+// bytes decodes bytes prefixed by their 4-byte length.
+func (d *kafkaDecoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+
+	return d.next(int(n))
+}
+
+// arrayLen decodes the length of an array, a null array being empty.
+func (d *kafkaDecoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 {
+		return 0
+	}
+	if int(n) > len(d.b) && d.err == nil {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+
+	return int(n)
+}
+
+// skipInt32s skips an array of 4-byte integers.
+func (d *kafkaDecoder) skipInt32s() {
+	d.next(4 * d.arrayLen())
+}
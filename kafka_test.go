@@ -0,0 +1,355 @@
+package logrustash
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKafkaMurmur2(t *testing.T) {
+	// the test vectors of the Java client
+	tests := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+
+	for key, expected := range tests {
+		assert.Equal(t, expected, int32(kafkaMurmur2([]byte(key))), key)
+	}
+}
+
+// kafkaTestRecord is a record received by fakeKafka.
+type kafkaTestRecord struct {
+	partition   int32
+	compression int16
+	key         []byte
+	value       []byte
+}
+
+// fakeKafka is a single broker cluster, the leader of all the partitions of its topics.
+type fakeKafka struct {
+	t          *testing.T
+	l          net.Listener
+	partitions int
+
+	mu sync.Mutex
+	// produceErrs are answered to the next produce requests
+	produceErrs []int16
+	metadata    int
+
+	records chan kafkaTestRecord
+}
+
+func newFakeKafka(t *testing.T, partitions int) *fakeKafka {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	k := &fakeKafka{t: t, l: l, partitions: partitions, records: make(chan kafkaTestRecord, 64)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go k.serve(conn)
+		}
+	}()
+
+	return k
+}
+
+func (k *fakeKafka) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(r, req); err != nil {
+			return
+		}
+
+		d := &kafkaDecoder{b: req}
+		key, _, correlation := d.int16(), d.int16(), d.int32()
+		d.string() // client ID
+
+		var resp []byte
+		switch key {
+		case kafkaAPIMetadata:
+			resp = k.metadataResponse(d)
+		case kafkaAPIProduce:
+			if resp = k.produceResponse(d); resp == nil {
+				continue
+			}
+		default:
+			return
+		}
+
+		out := binary.BigEndian.AppendUint32(nil, uint32(len(resp)+4))
+		out = binary.BigEndian.AppendUint32(out, uint32(correlation))
+		if _, err := conn.Write(append(out, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+func (k *fakeKafka) metadataResponse(d *kafkaDecoder) []byte {
+	k.mu.Lock()
+	k.metadata++
+	k.mu.Unlock()
+
+	host, port, _ := net.SplitHostPort(k.l.Addr().String())
+	p, _ := strconv.Atoi(port)
+
+	resp := kafkaAppendArrayLen(nil, 1, func(b []byte, _ int) []byte {
+		b = binary.BigEndian.AppendUint32(b, 1)
+		b = kafkaAppendString(b, host)
+		b = binary.BigEndian.AppendUint32(b, uint32(p))
+		return binary.BigEndian.AppendUint16(b, 0xffff)
+	})
+	resp = binary.BigEndian.AppendUint32(resp, 1)
+
+	topics := make([]string, d.arrayLen())
+	for i := range topics {
+		topics[i] = d.string()
+	}
+
+	return kafkaAppendArrayLen(resp, len(topics), func(b []byte, i int) []byte {
+		b = binary.BigEndian.AppendUint16(b, 0)
+		b = kafkaAppendString(b, topics[i])
+		b = append(b, 0)
+		return kafkaAppendArrayLen(b, k.partitions, func(b []byte, p int) []byte {
+			b = binary.BigEndian.AppendUint16(b, 0)
+			b = binary.BigEndian.AppendUint32(b, uint32(p))
+			b = binary.BigEndian.AppendUint32(b, 1)
+			b = kafkaAppendArrayLen(b, 1, func(b []byte, _ int) []byte { return binary.BigEndian.AppendUint32(b, 1) })
+			return kafkaAppendArrayLen(b, 1, func(b []byte, _ int) []byte { return binary.BigEndian.AppendUint32(b, 1) })
+		})
+	})
+}
+
+func (k *fakeKafka) produceResponse(d *kafkaDecoder) []byte {
+	d.string() // transactional ID
+	acks := d.int16()
+	d.int32() // timeout
+
+	k.mu.Lock()
+	var code int16
+	if len(k.produceErrs) > 0 {
+		code, k.produceErrs = k.produceErrs[0], k.produceErrs[1:]
+	}
+	k.mu.Unlock()
+
+	type partitionResult struct {
+		topic     string
+		partition int32
+	}
+	var results []partitionResult
+	for n := d.arrayLen(); n > 0; n-- {
+		topic := d.string()
+		for p := d.arrayLen(); p > 0; p-- {
+			partition := d.int32()
+			batch := d.bytes()
+			results = append(results, partitionResult{topic, partition})
+
+			if code == 0 {
+				k.decodeBatch(partition, batch)
+			}
+		}
+	}
+	require.NoError(k.t, d.err)
+
+	if acks == 0 {
+		return nil
+	}
+
+	resp := kafkaAppendArrayLen(nil, len(results), func(b []byte, i int) []byte {
+		b = kafkaAppendString(b, results[i].topic)
+		return kafkaAppendArrayLen(b, 1, func(b []byte, _ int) []byte {
+			b = binary.BigEndian.AppendUint32(b, uint32(results[i].partition))
+			b = binary.BigEndian.AppendUint16(b, uint16(code))
+			b = binary.BigEndian.AppendUint64(b, 0)
+			return binary.BigEndian.AppendUint64(b, 0xffffffffffffffff)
+		})
+	})
+	return binary.BigEndian.AppendUint32(resp, 0)
+}
+
+func (k *fakeKafka) decodeBatch(partition int32, batch []byte) {
+	d := &kafkaDecoder{b: batch}
+	d.int64() // base offset
+	require.Equal(k.t, int32(len(batch)-12), d.int32())
+	d.int32() // partition leader epoch
+	require.Equal(k.t, int8(2), d.int8())
+	crc := uint32(d.int32())
+	require.Equal(k.t, crc32.Checksum(d.b, crc32.MakeTable(crc32.Castagnoli)), crc)
+
+	compression := d.int16()
+	d.next(4 + 8 + 8 + 8 + 2 + 4)
+	count := d.int32()
+	require.NoError(k.t, d.err)
+
+	recs := d.b
+	switch compression {
+	case 1:
+		zr, err := gzip.NewReader(bytes.NewReader(recs))
+		require.NoError(k.t, err)
+		recs, err = io.ReadAll(zr)
+		require.NoError(k.t, err)
+	case 2:
+		require.True(k.t, bytes.HasPrefix(recs, kafkaSnappyHeader))
+		var decoded []byte
+		for blocks := recs[len(kafkaSnappyHeader):]; len(blocks) > 0; {
+			n := binary.BigEndian.Uint32(blocks)
+			block, err := snappyDecode(blocks[4 : 4+n])
+			require.NoError(k.t, err)
+			decoded = append(decoded, block...)
+			blocks = blocks[4+n:]
+		}
+		recs = decoded
+	}
+
+	r := bytes.NewReader(recs)
+	varint := func() int64 {
+		v, err := binary.ReadVarint(r)
+		require.NoError(k.t, err)
+		return v
+	}
+	next := func(n int64) []byte {
+		if n < 0 {
+			return nil
+		}
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		require.NoError(k.t, err)
+		return b
+	}
+
+	for i := int32(0); i < count; i++ {
+		varint() // length
+		next(1)  // attributes
+		varint() // timestamp delta
+		require.Equal(k.t, int64(i), varint())
+		key := next(varint())
+		value := next(varint())
+		require.Equal(k.t, int64(0), varint())
+
+		k.records <- kafkaTestRecord{partition: partition, compression: compression, key: key, value: value}
+	}
+}
+
+func TestKafkaWriter(t *testing.T) {
+	for _, compression := range []KafkaCompression{KafkaCompressionNone, KafkaCompressionGzip, KafkaCompressionSnappy} {
+		t.Run(strconv.Itoa(int(compression)), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			k := newFakeKafka(t, 3)
+
+			w, err := NewKafkaWriter(KafkaOptions{
+				Brokers:     []string{k.l.Addr().String()},
+				Topic:       "logs",
+				KeyField:    "user",
+				Compression: compression,
+				Acks:        KafkaAcksAll,
+			})
+			require.NoError(err)
+
+			hook, err := NewWithWriter(w, WithFormatter(&logrus.JSONFormatter{}), WithSynchronous())
+			require.NoError(err)
+			defer hook.(*Hook).Close()
+
+			require.NoError(hook.Fire(&logrus.Entry{Message: "keyed", Data: logrus.Fields{"user": "alice"}}))
+			require.NoError(hook.Fire(&logrus.Entry{Message: "not keyed", Data: logrus.Fields{}}))
+
+			keyed, notKeyed := <-k.records, <-k.records
+			assert.Equal([]byte("alice"), keyed.key)
+			assert.Equal(int32(kafkaMurmur2([]byte("alice"))&0x7fffffff)%3, keyed.partition)
+			assert.Equal(int16(compression), keyed.compression)
+			assert.Contains(string(keyed.value), `"msg":"keyed"`)
+			assert.NotContains(string(keyed.value), "\n")
+
+			assert.Nil(notKeyed.key)
+			assert.Contains(string(notKeyed.value), `"msg":"not keyed"`)
+		})
+	}
+}
+
+func TestKafkaWriterBatch(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	k := newFakeKafka(t, 1)
+
+	w, err := NewKafkaWriter(KafkaOptions{Brokers: []string{k.l.Addr().String()}, Topic: "logs"})
+	require.NoError(err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("{\"n\":1}\n{\"n\":2}\n"))
+	require.NoError(err)
+
+	assert.Equal(`{"n":1}`, string((<-k.records).value))
+	assert.Equal(`{"n":2}`, string((<-k.records).value))
+}
+
+func TestKafkaWriterRetry(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	k := newFakeKafka(t, 1)
+	k.produceErrs = []int16{6}
+
+	w, err := NewKafkaWriter(KafkaOptions{
+		Brokers:    []string{k.l.Addr().String()},
+		Topic:      "logs",
+		MaxRetries: 1,
+		Backoff:    ConstantBackoff(time.Millisecond),
+	})
+	require.NoError(err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("{\"n\":1}\n"))
+	require.NoError(err)
+
+	assert.Equal(`{"n":1}`, string((<-k.records).value))
+	k.mu.Lock()
+	assert.Equal(2, k.metadata, "the metadata is refreshed before retrying")
+	k.mu.Unlock()
+
+	// the errors which are not retryable are returned
+	k.mu.Lock()
+	k.produceErrs = []int16{10}
+	k.mu.Unlock()
+
+	_, err = w.Write([]byte("{\"n\":2}\n"))
+	assert.Equal(&KafkaError{Code: 10}, err)
+	assert.EqualError(err, "kafka: message too large")
+}
+
+func TestNewKafkaWriter(t *testing.T) {
+	_, err := NewKafkaWriter(KafkaOptions{Topic: "logs"})
+	assert.Error(t, err)
+
+	_, err = NewKafkaWriter(KafkaOptions{Brokers: []string{"kafka:9092"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,465 @@
+package logrustash
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	kinesisMaxRecords       = 500
+	kinesisMaxRequestBytes  = 5 << 20
+	firehoseMaxRequestBytes = 4 << 20
+	kinesisContentType      = "application/x-amz-json-1.1"
+	kinesisPutRecordsTarget = "Kinesis_20131202.PutRecords"
+	firehosePutBatchTarget  = "Firehose_20150804.PutRecordBatch"
+	awsSignatureAlgorithm   = "AWS4-HMAC-SHA256"
+	awsSignatureTimeFormat  = "20060102T150405Z"
+	awsSignatureDateFormat  = "20060102"
+	awsSignatureTerminator  = "aws4_request"
+	awsSecurityTokenHeader  = "X-Amz-Security-Token"
+	awsDateHeader           = "X-Amz-Date"
+)
+
+// kinesisRetryableErrors are the error codes of the requests and the records which may succeed if retried.
+var kinesisRetryableErrors = []string{
+	"ProvisionedThroughputExceededException",
+	"ThrottlingException",
+	"LimitExceededException",
+	"ServiceUnavailableException",
+	"InternalFailure",
+}
+
+// AWSCredentials are the credentials signing the requests to AWS.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// AWSCredentialsFromEnv returns the credentials of the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+// and AWS_SESSION_TOKEN environment variables.
+func AWSCredentialsFromEnv(context.Context) (AWSCredentials, error) {
+	creds := AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return creds, errors.New("no aws credentials in the environment")
+	}
+
+	return creds, nil
+}
+
+// KinesisError is returned when records are still rejected once the retries are exhausted.
+type KinesisError struct {
+	// Failed is the number of records rejected, Code and Message the error of the first one.
+	Failed  int
+	Code    string
+	Message string
+}
+
+func (e *KinesisError) Error() string {
+	return fmt.Sprintf("%d records rejected: %s: %s", e.Failed, e.Code, e.Message)
+}
+
+// KinesisOptions configures the writer returned by NewKinesisWriter.
+type KinesisOptions struct {
+	// StreamName is the name of the Kinesis data stream, or of the Firehose delivery stream.
+	StreamName string
+	// Firehose puts the records to a Firehose delivery stream with PutRecordBatch instead of a data stream
+	// with PutRecords. The records are terminated by a newline, for the objects delivered to be newline-delimited.
+	Firehose bool
+	// Region of the stream, the AWS_REGION or AWS_DEFAULT_REGION environment variable by default.
+	Region string
+	// Endpoint, if set, replaces the endpoint of the region, e.g. of a VPC endpoint or LocalStack.
+	Endpoint string
+	// Credentials returns the credentials signing the requests, AWSCredentialsFromEnv by default.
+	// It is called for every request, for the credentials to be refreshed, e.g. by the AWS SDK.
+	Credentials func(ctx context.Context) (AWSCredentials, error)
+	// PartitionKeyField, if set, is the field of the entries, formatted as JSON objects, whose value
+	// is the partition key of the records of a data stream. The records without it get a random key,
+	// spreading them over the shards.
+	PartitionKeyField string
+	// Client sends the requests, by default a client with its own pool of connections and a timeout of 30 seconds.
+	Client *http.Client
+	// MaxRetries is the number of times the requests are retried on network errors, throttling and server
+	// errors, and the records rejected by the stream, e.g. over the throughput of their shard, put again.
+	MaxRetries int
+	// Backoff returns the time waited for before a retry, DefaultHTTPBackoff by default.
+	Backoff Backoff
+}
+
+// KinesisWriter puts the entries of every write, a single entry or a batch of newline-delimited entries,
+// to a Kinesis data stream or a Firehose delivery stream, e.g. consumed by the Logstash kinesis input.
+// The requests are signed with AWS Signature Version 4, the records split in requests within the limits
+// of the APIs. It is meant to be used with NewWithWriter. It is not safe for concurrent use,
+// the hooks serialize the writes.
+type KinesisWriter struct {
+	*HTTPWriter
+
+	kopts KinesisOptions
+
+	// failed is the data of the last write, which failed once its first `failedPut` bytes were put
+	failed    []byte
+	failedPut int
+}
+
+// kinesisRecord is a record of a PutRecords or PutRecordBatch request, Data being encoded in base64.
+type kinesisRecord struct {
+	Data         []byte
+	PartitionKey string `json:",omitempty"`
+}
+
+// NewKinesisWriter returns a KinesisWriter putting the records to `opts.StreamName`.
+func NewKinesisWriter(opts KinesisOptions) (*KinesisWriter, error) {
+	if opts.StreamName == "" {
+		return nil, errors.New("no kinesis stream name")
+	}
+
+	region := opts.Region
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region == "" {
+			region = os.Getenv(env)
+		}
+	}
+	if region == "" {
+		return nil, errors.New("no aws region")
+	}
+
+	service, target := "kinesis", kinesisPutRecordsTarget
+	if opts.Firehose {
+		service, target = "firehose", firehosePutBatchTarget
+	}
+
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com/", service, region)
+	}
+
+	credentials := opts.Credentials
+	if credentials == nil {
+		credentials = AWSCredentialsFromEnv
+	}
+
+	client := &http.Client{Timeout: defaultHTTPTimeout}
+	if opts.Client != nil {
+		*client = *opts.Client
+	}
+	transport := client.Transport
+	if transport == nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.MaxIdleConnsPerHost = 4
+		transport = t
+	}
+	client.Transport = &awsSigner{base: transport, credentials: credentials, region: region, service: service, now: time.Now}
+
+	w, err := NewHTTPWriter(endpoint, HTTPOptions{
+		Client:      client,
+		Header:      http.Header{"X-Amz-Target": {target}},
+		ContentType: kinesisContentType,
+		MaxRetries:  opts.MaxRetries,
+		Backoff:     opts.Backoff,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &KinesisWriter{HTTPWriter: w, kopts: opts}, nil
+}
+
+// Write puts the entries of `data`, one record per line. When a request fails once the records
+// of the previous ones were put, it returns the number of bytes of the entries put, and the write of
+// the same data, e.g. retried by the hook, resumes after them, so that they are not put twice.
+func (w *KinesisWriter) Write(data []byte) (int, error) {
+	ctx, cancel := w.writeContext()
+	defer cancel()
+
+	put := 0
+	if w.failed != nil && bytes.Equal(data, w.failed) {
+		put = w.failedPut
+	}
+	w.failed, w.failedPut = nil, 0
+
+	maxBytes := kinesisMaxRequestBytes
+	if w.kopts.Firehose {
+		maxBytes = firehoseMaxRequestBytes
+	}
+
+	var records []kinesisRecord
+	size, end := 0, put
+	for rest := data[put:]; len(rest) > 0; {
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line, rest = rest[:i], rest[i+1:]
+		} else {
+			rest = nil
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		record := w.record(line)
+		if recordSize := len(record.Data) + len(record.PartitionKey); len(records) == kinesisMaxRecords || size+recordSize > maxBytes && len(records) > 0 {
+			if err := w.put(ctx, records); err != nil {
+				return w.fail(data, put, err)
+			}
+			records, size, put = nil, 0, end
+		}
+
+		records = append(records, record)
+		size += len(record.Data) + len(record.PartitionKey)
+		end = len(data) - len(rest)
+	}
+
+	if len(records) > 0 {
+		if err := w.put(ctx, records); err != nil {
+			return w.fail(data, put, err)
+		}
+	}
+
+	return len(data), nil
+}
+
+// fail returns the outcome of the write of `data` which failed with `err` once its first `put` bytes
+// were put, remembering them for the write of the same data not to put them again.
+func (w *KinesisWriter) fail(data []byte, put int, err error) (int, error) {
+	if put > 0 {
+		w.failed, w.failedPut = append([]byte(nil), data...), put
+	}
+
+	return put, err
+}
+
+// record returns the record of the entry `line`.
+func (w *KinesisWriter) record(line []byte) kinesisRecord {
+	if w.kopts.Firehose {
+		return kinesisRecord{Data: append(line[:len(line):len(line)], '\n')}
+	}
+
+	var key string
+	if w.kopts.PartitionKeyField != "" {
+		var fields map[string]interface{}
+		if err := json.Unmarshal(line, &fields); err == nil {
+			if v, ok := fields[w.kopts.PartitionKeyField]; ok && v != nil {
+				key = fmt.Sprintf("%v", v)
+			}
+		}
+	}
+	if key == "" {
+		id := make([]byte, 16)
+		_, _ = rand.Read(id)
+		key = hex.EncodeToString(id)
+	}
+
+	// the partition keys are limited to 256 characters
+	return kinesisRecord{Data: line, PartitionKey: key[:min(len(key), 256)]}
+}
+
+// put puts the records in a request, putting the records rejected again according to KinesisOptions.MaxRetries.
+func (w *KinesisWriter) put(ctx context.Context, records []kinesisRecord) error {
+	for attempt := 0; ; attempt++ {
+		req := map[string]interface{}{"Records": records}
+		if w.kopts.Firehose {
+			req["DeliveryStreamName"] = w.kopts.StreamName
+		} else {
+			req["StreamName"] = w.kopts.StreamName
+		}
+
+		body, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+
+		var rejected *KinesisError
+		resp, err := w.postWithRetries(ctx, body)
+		if err == nil {
+			records, rejected, err = w.rejected(records, resp)
+		}
+
+		var httpErr *HTTPError
+		retry := rejected != nil || errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusBadRequest && kinesisRetryable(httpErr.Body)
+		if err == nil && rejected == nil {
+			return nil
+		}
+		if err == nil {
+			err = rejected
+		}
+		if !retry || attempt >= w.kopts.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(w.backoff()(attempt + 1)):
+		}
+	}
+}
+
+// rejected returns the records rejected according to the response `body` and the error of the first one,
+// nil if all were put. An error is returned if a record is rejected with an error which is not retryable.
+func (w *KinesisWriter) rejected(records []kinesisRecord, body []byte) ([]kinesisRecord, *KinesisError, error) {
+	var resp struct {
+		FailedRecordCount int
+		FailedPutCount    int
+		Records           []struct{ ErrorCode, ErrorMessage string }
+		RequestResponses  []struct{ ErrorCode, ErrorMessage string }
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, nil, fmt.Errorf("invalid kinesis response: %w", err)
+	}
+
+	results := resp.Records
+	if w.kopts.Firehose {
+		results = resp.RequestResponses
+	}
+	if resp.FailedRecordCount+resp.FailedPutCount == 0 {
+		return nil, nil, nil
+	}
+	if len(results) != len(records) {
+		return nil, nil, fmt.Errorf("invalid kinesis response: %d results for %d records", len(results), len(records))
+	}
+
+	var failed []kinesisRecord
+	var kinesisErr *KinesisError
+	for i, result := range results {
+		if result.ErrorCode == "" {
+			continue
+		}
+
+		failed = append(failed, records[i])
+		if kinesisErr == nil {
+			kinesisErr = &KinesisError{Code: result.ErrorCode, Message: result.ErrorMessage}
+		}
+		if !kinesisRetryable(result.ErrorCode) {
+			kinesisErr.Failed = resp.FailedRecordCount + resp.FailedPutCount
+			return nil, nil, kinesisErr
+		}
+	}
+
+	kinesisErr.Failed = len(failed)
+	return failed, kinesisErr, nil
+}
+
+// kinesisRetryable reports whether the error `s`, a code or the body of a response, may not happen if retried.
+func kinesisRetryable(s string) bool {
+	for _, code := range kinesisRetryableErrors {
+		if strings.Contains(s, code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// awsSigner signs the requests with AWS Signature Version 4 before sending them with `base`.
+type awsSigner struct {
+	base        http.RoundTripper
+	credentials func(ctx context.Context) (AWSCredentials, error)
+	region      string
+	service     string
+	now         func() time.Time
+}
+
+// RoundTrip signs a copy of the request and sends it.
+func (s *awsSigner) RoundTrip(req *http.Request) (*http.Response, error) {
+	creds, err := s.credentials(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	if req.GetBody != nil {
+		r, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		body, err = io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	signed := req.Clone(req.Context())
+	s.sign(signed, body, creds)
+	return s.base.RoundTrip(signed)
+}
+
+// sign adds the date, the security token if any, and the authorization headers to `req`,
+// signing its headers and its body.
+func (s *awsSigner) sign(req *http.Request, body []byte, creds AWSCredentials) {
+	now := s.now().UTC()
+	req.Header.Set(awsDateHeader, now.Format(awsSignatureTimeFormat))
+	if creds.SessionToken != "" {
+		req.Header.Set(awsSecurityTokenHeader, creds.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := strings.Join([]string{now.Format(awsSignatureDateFormat), s.region, s.service, awsSignatureTerminator}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{awsSignatureAlgorithm, now.Format(awsSignatureTimeFormat), scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{now.Format(awsSignatureDateFormat), s.region, s.service, awsSignatureTerminator} {
+		key = awsHMAC(key, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsSignatureAlgorithm, creds.AccessKeyID, scope, signedHeaders, hex.EncodeToString(awsHMAC(key, stringToSign))))
+}
+
+func awsHMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
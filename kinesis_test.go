@@ -0,0 +1,216 @@
+package logrustash
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAWSSigner(t *testing.T) {
+	// the get-vanilla case of the AWS Signature Version 4 test suite
+	s := &awsSigner{
+		region:  "us-east-1",
+		service: "service",
+		now:     func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) },
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+
+	s.sign(req, nil, AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"})
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+}
+
+func staticAWSCredentials(context.Context) (AWSCredentials, error) {
+	return AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "token"}, nil
+}
+
+// kinesisRequest is a PutRecords or PutRecordBatch request received by a test server.
+type kinesisRequest struct {
+	target string
+	auth   string
+	token  string
+	body   struct {
+		StreamName         string
+		DeliveryStreamName string
+		Records            []kinesisRecord
+	}
+}
+
+// kinesisHandler answers the requests with the responses in order, sending the requests to `requests`.
+func kinesisHandler(t *testing.T, requests chan<- kinesisRequest, responses ...func(w http.ResponseWriter, records int)) http.Handler {
+	n := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req kinesisRequest
+		req.target, req.auth, req.token = r.Header.Get("X-Amz-Target"), r.Header.Get("Authorization"), r.Header.Get("X-Amz-Security-Token")
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &req.body))
+		requests <- req
+
+		if n < len(responses) {
+			responses[n](w, len(req.body.Records))
+			n++
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"FailedRecordCount":0,"FailedPutCount":0}`))
+	})
+}
+
+func TestKinesisWriter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	requests := make(chan kinesisRequest, 16)
+	ts := httptest.NewServer(kinesisHandler(t, requests,
+		func(w http.ResponseWriter, records int) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ProvisionedThroughputExceededException","message":"Rate exceeded"}`))
+		},
+		func(w http.ResponseWriter, records int) {
+			_, _ = w.Write([]byte(`{"FailedRecordCount":1,"Records":[{"SequenceNumber":"1","ShardId":"shardId-0"},` +
+				`{"ErrorCode":"ProvisionedThroughputExceededException","ErrorMessage":"Rate exceeded for shard"}]}`))
+		},
+	))
+	defer ts.Close()
+
+	w, err := NewKinesisWriter(KinesisOptions{
+		StreamName:        "logs",
+		Region:            "eu-west-1",
+		Endpoint:          ts.URL,
+		Credentials:       staticAWSCredentials,
+		PartitionKeyField: "user",
+		MaxRetries:        2,
+		Backoff:           ConstantBackoff(time.Millisecond),
+	})
+	require.NoError(err)
+
+	_, err = w.Write([]byte("{\"user\":\"alice\",\"n\":1}\n{\"n\":2}\n"))
+	require.NoError(err)
+
+	throttled, partial, retried := <-requests, <-requests, <-requests
+	assert.Equal("Kinesis_20131202.PutRecords", throttled.target)
+	assert.True(strings.HasPrefix(throttled.auth, "AWS4-HMAC-SHA256 Credential=AKID/"), throttled.auth)
+	assert.Contains(throttled.auth, "/eu-west-1/kinesis/aws4_request")
+	assert.Equal("token", throttled.token)
+	assert.Equal("logs", throttled.body.StreamName)
+
+	require.Len(partial.body.Records, 2)
+	assert.Equal(`{"user":"alice","n":1}`, string(partial.body.Records[0].Data))
+	assert.Equal("alice", partial.body.Records[0].PartitionKey)
+	assert.Len(partial.body.Records[1].PartitionKey, 32)
+
+	// only the record rejected is put again
+	require.Len(retried.body.Records, 1)
+	assert.Equal(`{"n":2}`, string(retried.body.Records[0].Data))
+}
+
+func TestKinesisWriterRejected(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	requests := make(chan kinesisRequest, 16)
+	rejected := func(w http.ResponseWriter, records int) {
+		_, _ = w.Write([]byte(`{"FailedPutCount":1,"RequestResponses":[{"ErrorCode":"ServiceUnavailableException","ErrorMessage":"Slow down"}]}`))
+	}
+	ts := httptest.NewServer(kinesisHandler(t, requests, rejected, rejected))
+	defer ts.Close()
+
+	w, err := NewKinesisWriter(KinesisOptions{
+		StreamName:  "delivery",
+		Firehose:    true,
+		Region:      "eu-west-1",
+		Endpoint:    ts.URL,
+		Credentials: staticAWSCredentials,
+		MaxRetries:  1,
+		Backoff:     ConstantBackoff(time.Millisecond),
+	})
+	require.NoError(err)
+
+	hook, err := NewWithWriter(w, WithFormatter(&logrus.JSONFormatter{}), WithSynchronous())
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	err = hook.Fire(&logrus.Entry{Message: "rejected", Data: logrus.Fields{}})
+	assert.Equal(&KinesisError{Failed: 1, Code: "ServiceUnavailableException", Message: "Slow down"}, err)
+
+	req := <-requests
+	assert.Equal("Firehose_20150804.PutRecordBatch", req.target)
+	assert.Contains(req.auth, "/eu-west-1/firehose/aws4_request")
+	assert.Equal("delivery", req.body.DeliveryStreamName)
+	assert.True(strings.HasSuffix(string(req.body.Records[0].Data), "}\n"))
+	assert.Len(requests, 1)
+}
+
+func TestKinesisWriterSplitsRequests(t *testing.T) {
+	require := require.New(t)
+
+	requests := make(chan kinesisRequest, 16)
+	ts := httptest.NewServer(kinesisHandler(t, requests))
+	defer ts.Close()
+
+	w, err := NewKinesisWriter(KinesisOptions{StreamName: "logs", Region: "eu-west-1", Endpoint: ts.URL, Credentials: staticAWSCredentials})
+	require.NoError(err)
+
+	_, err = w.Write([]byte(strings.Repeat("{}\n", kinesisMaxRecords+1)))
+	require.NoError(err)
+
+	require.Len((<-requests).body.Records, kinesisMaxRecords)
+	require.Len((<-requests).body.Records, 1)
+
+	_, err = NewKinesisWriter(KinesisOptions{Region: "eu-west-1"})
+	require.Error(err)
+}
+
+func TestKinesisWriterPartialWrite(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	requests := make(chan kinesisRequest, 16)
+	ts := httptest.NewServer(kinesisHandler(t, requests,
+		func(w http.ResponseWriter, records int) {
+			_, _ = w.Write([]byte(`{"FailedRecordCount":0}`))
+		},
+		func(w http.ResponseWriter, records int) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"AccessDeniedException","message":"Denied"}`))
+		},
+	))
+	defer ts.Close()
+
+	w, err := NewKinesisWriter(KinesisOptions{StreamName: "logs", Region: "eu-west-1", Endpoint: ts.URL, Credentials: staticAWSCredentials})
+	require.NoError(err)
+
+	data := []byte(strings.Repeat("{}\n", kinesisMaxRecords) + "{\"n\":1}\n")
+
+	// the records of the first request were put
+	n, err := w.Write(data)
+	assert.Error(err)
+	assert.Equal(3*kinesisMaxRecords, n)
+	require.Len((<-requests).body.Records, kinesisMaxRecords)
+	require.Len((<-requests).body.Records, 1)
+
+	// the write retried resumes after them
+	n, err = w.Write(data)
+	require.NoError(err)
+	assert.Equal(len(data), n)
+
+	retried := <-requests
+	require.Len(retried.body.Records, 1)
+	assert.Equal(`{"n":1}`, string(retried.body.Records[0].Data))
+	assert.Empty(requests)
+}
@@ -0,0 +1,138 @@
+package logrustash
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The fields KubernetesMetadata is added under, following the Elastic Common Schema
+// and the fields of the kubernetes processor of Beats.
+const (
+	KubernetesKeyPodName      = "kubernetes.pod.name"
+	KubernetesKeyPodUID       = "kubernetes.pod.uid"
+	KubernetesKeyPodIP        = "kubernetes.pod.ip"
+	KubernetesKeyNamespace    = "kubernetes.namespace"
+	KubernetesKeyNodeName     = "kubernetes.node.name"
+	KubernetesKeyLabelsPrefix = "kubernetes.labels."
+)
+
+// KubernetesLabelsFile is the file of the labels of the pod read by DetectKubernetesMetadata,
+// as mounted by a downwardAPI volume with the "metadata.labels" field path.
+var KubernetesLabelsFile = "/etc/podinfo/labels"
+
+// kubernetesNamespaceFile is the file of the namespace of the pod mounted with the service account token.
+var kubernetesNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// KubernetesMetadata describes the Kubernetes pod the process is running in, it is added to every entry
+// with WithKubernetesMetadata or as one of HookOptions.Enrichers. The empty values are not added.
+type KubernetesMetadata struct {
+	PodName   string
+	PodUID    string
+	PodIP     string
+	Namespace string
+	NodeName  string
+	// Labels are added under KubernetesKeyLabelsPrefix, the dots of their keys being replaced
+	// by underscores as Beats do, e.g. "kubernetes.labels.app_kubernetes_io/name".
+	Labels map[string]string
+}
+
+// DetectKubernetesMetadata returns the metadata of the Kubernetes pod the process is running in,
+// as exposed by the Downward API:
+//   - the pod name from the POD_NAME or KUBERNETES_POD_NAME variables,
+//     the host name otherwise, which is the pod name
+//   - the pod UID and IP from the POD_UID and POD_IP variables
+//   - the namespace from the POD_NAMESPACE or KUBERNETES_NAMESPACE variables,
+//     the namespace of the service account otherwise
+//   - the node name from the NODE_NAME or KUBERNETES_NODE_NAME variables
+//   - the labels from KubernetesLabelsFile
+//
+// The variables are set by the pod spec, e.g.
+//
+//	env:
+//	- name: POD_NAME
+//	  valueFrom:
+//	    fieldRef:
+//	      fieldPath: metadata.name
+//
+// The metadata is empty when the process is not running in Kubernetes.
+func DetectKubernetesMetadata() KubernetesMetadata {
+	if _, ok := os.LookupEnv("KUBERNETES_SERVICE_HOST"); !ok {
+		return KubernetesMetadata{}
+	}
+
+	m := KubernetesMetadata{
+		PodName:   firstEnv("POD_NAME", "KUBERNETES_POD_NAME"),
+		PodUID:    firstEnv("POD_UID", "KUBERNETES_POD_UID"),
+		PodIP:     firstEnv("POD_IP", "KUBERNETES_POD_IP"),
+		Namespace: firstEnv("POD_NAMESPACE", "KUBERNETES_NAMESPACE"),
+		NodeName:  firstEnv("NODE_NAME", "KUBERNETES_NODE_NAME"),
+		Labels:    readKubernetesLabels(KubernetesLabelsFile),
+	}
+
+	if m.PodName == "" {
+		m.PodName, _ = os.Hostname()
+	}
+
+	if m.Namespace == "" {
+		if namespace, err := os.ReadFile(kubernetesNamespaceFile); err == nil {
+			m.Namespace = strings.TrimSpace(string(namespace))
+		}
+	}
+
+	return m
+}
+
+// readKubernetesLabels returns the labels of the downwardAPI file `path`, whose lines are `key="value"`,
+// nil if it can not be read.
+func readKubernetesLabels(path string) map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	labels := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || key == "" {
+			continue
+		}
+
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		labels[key] = value
+	}
+
+	return labels
+}
+
+// Fields returns the metadata as fields, without the empty values.
+func (m KubernetesMetadata) Fields() logrus.Fields {
+	fields := logrus.Fields{}
+	if m.PodName != "" {
+		fields[KubernetesKeyPodName] = m.PodName
+	}
+	if m.PodUID != "" {
+		fields[KubernetesKeyPodUID] = m.PodUID
+	}
+	if m.PodIP != "" {
+		fields[KubernetesKeyPodIP] = m.PodIP
+	}
+	if m.Namespace != "" {
+		fields[KubernetesKeyNamespace] = m.Namespace
+	}
+	if m.NodeName != "" {
+		fields[KubernetesKeyNodeName] = m.NodeName
+	}
+	for k, v := range m.Labels {
+		fields[KubernetesKeyLabelsPrefix+strings.ReplaceAll(k, ".", "_")] = v
+	}
+
+	return fields
+}
@@ -0,0 +1,99 @@
+package logrustash
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withKubernetesFiles makes DetectKubernetesMetadata read the labels and the namespace
+// from `labels` and `namespace` for the duration of the test.
+func withKubernetesFiles(t *testing.T, labels, namespace string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	labelsFile, namespaceFile := filepath.Join(dir, "labels"), filepath.Join(dir, "namespace")
+	require.NoError(t, os.WriteFile(labelsFile, []byte(labels), 0o600))
+	require.NoError(t, os.WriteFile(namespaceFile, []byte(namespace), 0o600))
+
+	prevLabels, prevNamespace := KubernetesLabelsFile, kubernetesNamespaceFile
+	KubernetesLabelsFile, kubernetesNamespaceFile = labelsFile, namespaceFile
+	t.Cleanup(func() {
+		KubernetesLabelsFile, kubernetesNamespaceFile = prevLabels, prevNamespace
+	})
+}
+
+func TestDetectKubernetesMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	withKubernetesFiles(t, "app=\"checkout\"\napp.kubernetes.io/version=\"1.2.3\"\n", "shop\n")
+
+	// restored once the test is over
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	os.Unsetenv("KUBERNETES_SERVICE_HOST")
+	assert.Equal(KubernetesMetadata{}, DetectKubernetesMetadata(), "not running in Kubernetes")
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+	t.Setenv("POD_NAME", "checkout-7d9f-x2x4z")
+	t.Setenv("POD_IP", "10.1.2.3")
+	t.Setenv("POD_NAMESPACE", "")
+	t.Setenv("KUBERNETES_NAMESPACE", "")
+	t.Setenv("NODE_NAME", "node-1")
+
+	m := DetectKubernetesMetadata()
+	assert.Equal("checkout-7d9f-x2x4z", m.PodName)
+	assert.Equal("10.1.2.3", m.PodIP)
+	assert.Equal("shop", m.Namespace, "the namespace of the service account")
+	assert.Equal("node-1", m.NodeName)
+	assert.Equal(map[string]string{"app": "checkout", "app.kubernetes.io/version": "1.2.3"}, m.Labels)
+
+	t.Setenv("POD_NAMESPACE", "payments")
+	t.Setenv("POD_NAME", "")
+	t.Setenv("KUBERNETES_POD_NAME", "")
+	hostname, _ := os.Hostname()
+
+	m = DetectKubernetesMetadata()
+	assert.Equal("payments", m.Namespace)
+	assert.Equal(hostname, m.PodName)
+}
+
+func TestKubernetesMetadataFields(t *testing.T) {
+	assert.Equal(t, logrus.Fields{
+		"kubernetes.pod.name":                      "checkout-7d9f-x2x4z",
+		"kubernetes.namespace":                     "shop",
+		"kubernetes.labels.app_kubernetes_io/name": "checkout",
+	}, KubernetesMetadata{
+		PodName:   "checkout-7d9f-x2x4z",
+		Namespace: "shop",
+		Labels:    map[string]string{"app.kubernetes.io/name": "checkout"},
+	}.Fields())
+}
+
+func TestWithKubernetesMetadata(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	withKubernetesFiles(t, "team=\"payments\"\n", "shop")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+	t.Setenv("POD_NAME", "checkout-7d9f-x2x4z")
+	t.Setenv("NODE_NAME", "node-1")
+
+	buffer := &safeBuffer{}
+	hook, err := NewWithWriter(buffer, WithKubernetesMetadata())
+	require.NoError(err)
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "msg1", Data: logrus.Fields{}}))
+	require.NoError(hook.(*Hook).Close())
+
+	var doc map[string]interface{}
+	require.NoError(json.Unmarshal([]byte(buffer.String()), &doc))
+
+	assert.Equal("checkout-7d9f-x2x4z", doc["kubernetes.pod.name"])
+	assert.Equal("node-1", doc["kubernetes.node.name"])
+	assert.Equal("payments", doc["kubernetes.labels.team"])
+}
@@ -0,0 +1,333 @@
+// Package logstashtest provides a Logstash server recording the lines it receives, for the tests
+// of the applications sending their logs with logrustash. The failures of Logstash can be simulated:
+// the connections can be dropped, the server stopped and started again, and the lines read slowly.
+package logstashtest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// DefaultTimeout is the time the assertions wait for the lines to be received.
+var DefaultTimeout = 5 * time.Second
+
+// maxLineBytes is the maximum size of the lines received over TCP.
+const maxLineBytes = 1 << 20
+
+// Server is a Logstash tcp or udp input recording the lines it receives, listening on
+// the loopback interface. It is safe for concurrent use.
+type Server struct {
+	network string
+	addr    string
+
+	mu       sync.Mutex
+	listener net.Listener
+	packet   net.PacketConn
+	conns    map[net.Conn]struct{}
+	accepted int
+	lines    []string
+	latency  time.Duration
+	// received is closed and replaced whenever a line is received
+	received chan struct{}
+	serving  sync.WaitGroup
+}
+
+// NewServer starts and returns a new TCP Server, the caller should call Close when finished.
+func NewServer() (*Server, error) {
+	return newServer("tcp")
+}
+
+// NewUDPServer starts and returns a new UDP Server, every datagram may hold several lines.
+// The caller should call Close when finished.
+func NewUDPServer() (*Server, error) {
+	return newServer("udp")
+}
+
+func newServer(network string) (*Server, error) {
+	s := &Server{
+		network:  network,
+		addr:     "127.0.0.1:0",
+		conns:    map[net.Conn]struct{}{},
+		received: make(chan struct{}),
+	}
+
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Network returns the network of the server, "tcp" or "udp".
+func (s *Server) Network() string {
+	return s.network
+}
+
+// Addr returns the address the server listens on, e.g. "127.0.0.1:54321", it does not change
+// when the server is stopped and started again.
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addr
+}
+
+// Start starts the server stopped by Stop, on the same address.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener != nil || s.packet != nil {
+		return errors.New("logstashtest: server already started")
+	}
+
+	if s.network == "udp" {
+		packet, err := net.ListenPacket("udp", s.addr)
+		if err != nil {
+			return err
+		}
+
+		s.packet = packet
+		s.addr = packet.LocalAddr().String()
+		s.serving.Add(1)
+		go s.servePackets(packet)
+
+		return nil
+	}
+
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	s.listener = l
+	s.addr = l.Addr().String()
+	s.serving.Add(1)
+	go s.accept(l)
+
+	return nil
+}
+
+// Stop stops the server as if Logstash was down, the connections are closed and the new ones refused
+// until Start is called. The lines received are kept.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	if s.listener != nil {
+		_ = s.listener.Close()
+		s.listener = nil
+	}
+	if s.packet != nil {
+		_ = s.packet.Close()
+		s.packet = nil
+	}
+	s.mu.Unlock()
+
+	s.Disconnect()
+	s.serving.Wait()
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	s.Stop()
+	return nil
+}
+
+// Disconnect closes the connections established, the server keeps accepting the new ones.
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+// SetLatency makes the server wait `latency` before reading every line, as a slow Logstash would.
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = latency
+}
+
+// Connections returns the number of connections the TCP server accepted.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.accepted
+}
+
+// Lines returns the lines received, without their newline.
+func (s *Server) Lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.lines...)
+}
+
+// Reset forgets the lines received.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lines = nil
+}
+
+// WaitLines waits until at least `n` lines were received and returns them,
+// it fails if they were not received within `timeout`.
+func (s *Server) WaitLines(n int, timeout time.Duration) ([]string, error) {
+	lines, ok := s.wait(timeout, func(lines []string) bool { return len(lines) >= n })
+	if !ok {
+		return lines, fmt.Errorf("logstashtest: received %d lines within %s, expected %d", len(lines), timeout, n)
+	}
+
+	return lines, nil
+}
+
+// AssertLines fails the test unless at least `n` lines are received within DefaultTimeout,
+// it returns the lines received.
+func (s *Server) AssertLines(t testing.TB, n int) []string {
+	t.Helper()
+
+	lines, err := s.WaitLines(n, DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return lines
+}
+
+// AssertReceived fails the test unless a line containing `substr` is received within DefaultTimeout,
+// it returns the first one.
+func (s *Server) AssertReceived(t testing.TB, substr string) string {
+	t.Helper()
+
+	var found string
+	if _, ok := s.wait(DefaultTimeout, func(lines []string) bool {
+		for _, line := range lines {
+			if strings.Contains(line, substr) {
+				found = line
+				return true
+			}
+		}
+		return false
+	}); !ok {
+		t.Fatalf("logstashtest: no line containing %q received within %s", substr, DefaultTimeout)
+	}
+
+	return found
+}
+
+// AssertNotReceived fails the test if a line containing `substr` was received.
+func (s *Server) AssertNotReceived(t testing.TB, substr string) {
+	t.Helper()
+
+	for _, line := range s.Lines() {
+		if strings.Contains(line, substr) {
+			t.Fatalf("logstashtest: unexpected line received: %s", line)
+		}
+	}
+}
+
+// wait waits until `done` is true for the lines received, it reports false if it is not within `timeout`.
+func (s *Server) wait(timeout time.Duration, done func(lines []string) bool) ([]string, bool) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		s.mu.Lock()
+		lines := append([]string(nil), s.lines...)
+		received := s.received
+		s.mu.Unlock()
+
+		if done(lines) {
+			return lines, true
+		}
+
+		select {
+		case <-received:
+		case <-deadline.C:
+			return lines, false
+		}
+	}
+}
+
+// record records the line `line`, once the latency elapsed.
+func (s *Server) record(line string) {
+	s.mu.Lock()
+	latency := s.latency
+	s.mu.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lines = append(s.lines, line)
+	close(s.received)
+	s.received = make(chan struct{})
+}
+
+// accept accepts the connections until the listener is closed.
+func (s *Server) accept(l net.Listener) {
+	defer s.serving.Done()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.accepted++
+		s.mu.Unlock()
+
+		s.serving.Add(1)
+		go s.serve(conn)
+	}
+}
+
+// serve records the lines received on the connection until it is closed.
+func (s *Server) serve(conn net.Conn) {
+	defer s.serving.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	for scanner.Scan() {
+		s.record(scanner.Text())
+	}
+}
+
+// servePackets records the lines of the datagrams received until the connection is closed.
+func (s *Server) servePackets(packet net.PacketConn) {
+	defer s.serving.Done()
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := packet.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		for _, line := range bytes.Split(bytes.TrimSuffix(buf[:n], []byte("\n")), []byte("\n")) {
+			s.record(string(line))
+		}
+	}
+}
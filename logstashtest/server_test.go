@@ -0,0 +1,132 @@
+package logstashtest_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	logrustash "github.com/nekomeowww/logrus-logstash-hook"
+	"github.com/nekomeowww/logrus-logstash-hook/logstashtest"
+)
+
+// newLogger returns a logger sending its entries to `s` synchronously.
+func newLogger(t *testing.T, s *logstashtest.Server) (*logrus.Logger, *logrustash.Hook) {
+	t.Helper()
+
+	hook, err := logrustash.NewWithOptions(s.Network(), s.Addr(),
+		logrustash.WithFormatter(&logrus.JSONFormatter{}),
+		logrustash.WithSynchronous(),
+		logrustash.WithBackoff(logrustash.ConstantBackoff(5*time.Millisecond)),
+		logrustash.WithDiagnostics(io.Discard),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = hook.(*logrustash.Hook).Close() })
+
+	log := logrus.New()
+	log.Out = io.Discard
+	log.Hooks.Add(hook)
+
+	return log, hook.(*logrustash.Hook)
+}
+
+func TestServer(t *testing.T) {
+	s, err := logstashtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	log, _ := newLogger(t, s)
+	log.Info("first")
+	log.Warn("second")
+
+	lines := s.AssertLines(t, 2)
+	assert.Contains(t, lines[0], "first")
+	assert.Contains(t, s.AssertReceived(t, "second"), `"level":"warning"`)
+	s.AssertNotReceived(t, "third")
+	assert.Equal(t, 1, s.Connections())
+
+	s.Reset()
+	assert.Empty(t, s.Lines())
+
+	_, err = s.WaitLines(1, 10*time.Millisecond)
+	assert.Error(t, err)
+}
+
+func TestServerDisconnect(t *testing.T) {
+	s, err := logstashtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	log, hook := newLogger(t, s)
+	log.Info("before")
+	s.AssertReceived(t, "before")
+
+	// the hook reconnects once writing fails
+	s.Disconnect()
+	require.Eventually(t, func() bool {
+		log.Info("after")
+		return s.Connections() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	s.AssertReceived(t, "after")
+	assert.True(t, hook.IsConnected())
+}
+
+func TestServerStopStart(t *testing.T) {
+	s, err := logstashtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	addr := s.Addr()
+	log, _ := newLogger(t, s)
+	log.Info("before")
+	s.AssertReceived(t, "before")
+
+	// Logstash is down for a while, the hook reconnects once it is back
+	s.Stop()
+	restarted := make(chan error, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		restarted <- s.Start()
+	}()
+
+	require.Eventually(t, func() bool {
+		log.Info("after")
+		return s.Connections() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, <-restarted)
+
+	s.AssertReceived(t, "after")
+	assert.Equal(t, addr, s.Addr())
+	assert.Error(t, s.Start(), "the server is already started")
+}
+
+func TestServerLatency(t *testing.T) {
+	s, err := logstashtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.SetLatency(50 * time.Millisecond)
+
+	log, _ := newLogger(t, s)
+	start := time.Now()
+	log.Info("slow")
+	s.AssertReceived(t, "slow")
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestUDPServer(t *testing.T) {
+	s, err := logstashtest.NewUDPServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	assert.Equal(t, "udp", s.Network())
+
+	log, _ := newLogger(t, s)
+	log.Info("datagram")
+	s.AssertReceived(t, "datagram")
+	assert.Zero(t, s.Connections())
+}
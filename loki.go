@@ -0,0 +1,258 @@
+package logrustash
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const lokiPushPath = "/loki/api/v1/push"
+
+// lokiInvalidLabel matches the characters not allowed in the names of the Loki labels.
+var lokiInvalidLabel = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// LokiFormatter formats the entries as Loki streams of a single entry, the labels of the stream
+// being taken from the fields of the entry. They are grouped by stream and pushed to Loki
+// by the writer of NewLokiWriter.
+type LokiFormatter struct {
+	// Formatter formats the lines, logrus.JSONFormatter by default.
+	Formatter logrus.Formatter
+	// Labels are the fields of the entries added as labels, "level" being the level of the entry
+	// unless it is a field. Only use fields of low cardinality, every set of labels being a stream.
+	Labels []string
+	// StaticLabels are added to every stream, e.g. {"app": "checkout"}.
+	StaticLabels map[string]string
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// Format formats the entry as a Loki stream.
+func (f LokiFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	formatter := f.Formatter
+	if formatter == nil {
+		formatter = &logrus.JSONFormatter{}
+	}
+
+	line, err := formatter.Format(e)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]string, len(f.StaticLabels)+len(f.Labels))
+	for k, v := range f.StaticLabels {
+		labels[lokiLabelName(k)] = v
+	}
+	for _, k := range f.Labels {
+		v, ok := e.Data[k]
+		switch {
+		case ok:
+			labels[lokiLabelName(k)] = fmt.Sprintf("%v", v)
+		case k == "level":
+			labels[k] = e.Level.String()
+		}
+	}
+
+	t := e.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	stream, err := json.Marshal(lokiStream{
+		Stream: labels,
+		Values: [][2]string{{strconv.FormatInt(t.UnixNano(), 10), string(bytes.TrimSuffix(line, []byte("\n")))}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(stream, '\n'), nil
+}
+
+// lokiLabelName returns `k` with the characters not allowed in label names replaced by "_".
+func lokiLabelName(k string) string {
+	k = lokiInvalidLabel.ReplaceAllString(k, "_")
+	if k != "" && k[0] >= '0' && k[0] <= '9' {
+		k = "_" + k
+	}
+
+	return k
+}
+
+// LokiOptions configures the writer returned by NewLokiWriter.
+type LokiOptions struct {
+	HTTPOptions
+
+	// Protobuf pushes the streams as snappy-compressed protobuf instead of JSON.
+	Protobuf bool
+	// TenantID, if set, is the tenant of the streams in a multi-tenant Loki.
+	TenantID string
+}
+
+// LokiWriter pushes the streams formatted by LokiFormatter to Loki, the streams written at once,
+// e.g. a batch, are grouped by labels in a single push request.
+type LokiWriter struct {
+	*HTTPWriter
+
+	protobuf bool
+}
+
+// NewLokiWriter returns a writer pushing the entries formatted by LokiFormatter to the Loki
+// at `endpoint`, e.g. "http://loki:3100".
+func NewLokiWriter(endpoint string, opts LokiOptions) (*LokiWriter, error) {
+	httpOpts := opts.HTTPOptions
+	httpOpts.ContentType = "application/json"
+	if opts.Protobuf {
+		httpOpts.ContentType = "application/x-protobuf"
+	}
+	if opts.TenantID != "" {
+		httpOpts.Header = httpOpts.Header.Clone()
+		if httpOpts.Header == nil {
+			httpOpts.Header = http.Header{}
+		}
+		httpOpts.Header.Set("X-Scope-OrgID", opts.TenantID)
+	}
+
+	w, err := NewHTTPWriter(strings.TrimSuffix(endpoint, "/")+lokiPushPath, httpOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LokiWriter{HTTPWriter: w, protobuf: opts.Protobuf}, nil
+}
+
+// Write pushes the streams of `data`, one per line.
+func (w *LokiWriter) Write(data []byte) (int, error) {
+	streams, err := groupLokiStreams(data)
+	if err != nil {
+		return 0, err
+	}
+
+	var body []byte
+	if w.protobuf {
+		body, err = encodeLokiProtobuf(streams)
+	} else {
+		body, err = json.Marshal(map[string][]*lokiStream{"streams": streams})
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := w.HTTPWriter.Write(body); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// groupLokiStreams parses the streams of `data`, one per line, merging the streams of the same labels.
+func groupLokiStreams(data []byte) ([]*lokiStream, error) {
+	var streams []*lokiStream
+	byLabels := make(map[string]*lokiStream)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var s lokiStream
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			return nil, fmt.Errorf("invalid loki stream: %w", err)
+		}
+
+		key := lokiLabels(s.Stream)
+		if existing, ok := byLabels[key]; ok {
+			existing.Values = append(existing.Values, s.Values...)
+			continue
+		}
+
+		byLabels[key] = &s
+		streams = append(streams, &s)
+	}
+
+	return streams, scanner.Err()
+}
+
+// lokiLabels returns the labels in the Prometheus text format used by Loki, e.g. `{app="checkout"}`.
+func lokiLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[k]))
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+// encodeLokiProtobuf encodes the streams as the snappy-compressed protobuf of a Loki PushRequest:
+//
+//	message PushRequest { repeated StreamAdapter streams = 1; }
+//	message StreamAdapter { string labels = 1; repeated EntryAdapter entries = 2; }
+//	message EntryAdapter { google.protobuf.Timestamp timestamp = 1; string line = 2; }
+func encodeLokiProtobuf(streams []*lokiStream) ([]byte, error) {
+	var req []byte
+	for _, s := range streams {
+		stream := protoAppendBytes(nil, 1, []byte(lokiLabels(s.Stream)))
+		for _, v := range s.Values {
+			ns, err := strconv.ParseInt(v[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid loki timestamp %q: %w", v[0], err)
+			}
+
+			var ts []byte
+			if seconds := ns / int64(time.Second); seconds != 0 {
+				ts = protoAppendVarint(ts, 1, uint64(seconds))
+			}
+			if nanos := ns % int64(time.Second); nanos != 0 {
+				ts = protoAppendVarint(ts, 2, uint64(nanos))
+			}
+
+			entry := protoAppendBytes(nil, 1, ts)
+			entry = protoAppendBytes(entry, 2, []byte(v[1]))
+			stream = protoAppendBytes(stream, 2, entry)
+		}
+
+		req = protoAppendBytes(req, 1, stream)
+	}
+
+	return snappyEncode(req), nil
+}
+
+// protoAppendVarint appends the varint field `num` of value `v` to `b`.
+func protoAppendVarint(b []byte, num int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+// protoAppendBytes appends the length-delimited field `num` of value `v` to `b`.
+func protoAppendBytes(b []byte, num int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
@@ -0,0 +1,158 @@
+package logrustash
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLokiFormatter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	entry := &logrus.Entry{
+		Message: "msg1",
+		Level:   logrus.WarnLevel,
+		Time:    time.Unix(1700000000, 42),
+		Data:    logrus.Fields{"service.name": "checkout", "user": "alice"},
+	}
+
+	res, err := LokiFormatter{
+		Formatter:    &logrus.JSONFormatter{DisableTimestamp: true},
+		Labels:       []string{"level", "service.name", "missing"},
+		StaticLabels: map[string]string{"env": "production"},
+	}.Format(entry)
+	require.NoError(err)
+
+	var stream lokiStream
+	require.NoError(json.Unmarshal(res, &stream))
+
+	assert.Equal(map[string]string{"env": "production", "level": "warning", "service_name": "checkout"}, stream.Stream)
+	assert.Equal([][2]string{{"1700000000000000042", `{"level":"warning","msg":"msg1","service.name":"checkout","user":"alice"}`}}, stream.Values)
+
+	assert.Equal("_1st", lokiLabelName("1st"))
+	assert.Equal(`{a="1", b="with \"quotes\""}`, lokiLabels(map[string]string{"b": `with "quotes"`, "a": "1"}))
+}
+
+// lokiPushHandler records the bodies of the push requests.
+func lokiPushHandler(t *testing.T, bodies chan<- []byte, contentType string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, lokiPushPath, r.URL.Path)
+		assert.Equal(t, contentType, r.Header.Get("Content-Type"))
+		assert.Equal(t, "tenant-1", r.Header.Get("X-Scope-OrgID"))
+
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func TestLokiWriter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	bodies := make(chan []byte, 1)
+	ts := httptest.NewServer(lokiPushHandler(t, bodies, "application/json"))
+	defer ts.Close()
+
+	w, err := NewLokiWriter(ts.URL, LokiOptions{TenantID: "tenant-1"})
+	require.NoError(err)
+
+	hook, err := NewWithWriter(w, WithFormatter(LokiFormatter{Labels: []string{"level"}}), WithBatching(3, time.Hour))
+	require.NoError(err)
+
+	for _, level := range []logrus.Level{logrus.InfoLevel, logrus.ErrorLevel, logrus.InfoLevel} {
+		require.NoError(hook.Fire(&logrus.Entry{Message: level.String(), Level: level, Data: logrus.Fields{}}))
+	}
+	require.NoError(hook.(*Hook).Close())
+
+	var push struct {
+		Streams []lokiStream `json:"streams"`
+	}
+	require.NoError(json.Unmarshal(<-bodies, &push))
+	require.Len(push.Streams, 2)
+
+	assert.Equal(map[string]string{"level": "info"}, push.Streams[0].Stream)
+	assert.Len(push.Streams[0].Values, 2)
+	assert.Equal(map[string]string{"level": "error"}, push.Streams[1].Stream)
+	assert.Len(push.Streams[1].Values, 1)
+}
+
+// protoFields returns the fields of the protobuf message `b` by number, the varints and
+// the 64-bit fields as uint64 and the length-delimited fields as []byte.
+func protoFields(t *testing.T, b []byte) map[int][]interface{} {
+	fields := make(map[int][]interface{})
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		require.Positive(t, n)
+		b = b[n:]
+
+		if key&7 == 1 {
+			require.GreaterOrEqual(t, len(b), 8)
+			fields[int(key>>3)] = append(fields[int(key>>3)], binary.LittleEndian.Uint64(b))
+			b = b[8:]
+			continue
+		}
+
+		v, n := binary.Uvarint(b)
+		require.Positive(t, n)
+		b = b[n:]
+
+		switch key & 7 {
+		case 0:
+			fields[int(key>>3)] = append(fields[int(key>>3)], v)
+		case 2:
+			fields[int(key>>3)] = append(fields[int(key>>3)], b[:v])
+			b = b[v:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+
+	return fields
+}
+
+func TestLokiWriterProtobuf(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	bodies := make(chan []byte, 1)
+	ts := httptest.NewServer(lokiPushHandler(t, bodies, "application/x-protobuf"))
+	defer ts.Close()
+
+	w, err := NewLokiWriter(ts.URL, LokiOptions{Protobuf: true, TenantID: "tenant-1"})
+	require.NoError(err)
+
+	formatter := LokiFormatter{Formatter: &logrus.TextFormatter{DisableTimestamp: true}, StaticLabels: map[string]string{"app": "checkout"}}
+	data, err := formatter.Format(&logrus.Entry{Message: "msg1", Level: logrus.InfoLevel, Time: time.Unix(1700000000, 5), Data: logrus.Fields{}})
+	require.NoError(err)
+
+	n, err := w.Write(data)
+	require.NoError(err)
+	assert.Equal(len(data), n)
+
+	req, err := snappyDecode(<-bodies)
+	require.NoError(err)
+
+	streams := protoFields(t, req)[1]
+	require.Len(streams, 1)
+
+	stream := protoFields(t, streams[0].([]byte))
+	assert.Equal([]byte(`{app="checkout"}`), stream[1][0])
+	require.Len(stream[2], 1)
+
+	entry := protoFields(t, stream[2][0].([]byte))
+	assert.Equal([]byte("level=info msg=msg1"), entry[2][0])
+
+	timestamp := protoFields(t, entry[1][0].([]byte))
+	assert.Equal(uint64(1700000000), timestamp[1][0])
+	assert.Equal(uint64(5), timestamp[2][0])
+}
@@ -0,0 +1,98 @@
+package logrustash
+
+import (
+	"os"
+	"path/filepath"
+	"runtime/debug"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The fields Metadata is added under, following the Elastic Common Schema.
+const (
+	MetadataKeyHostName       = "host.name"
+	MetadataKeyProcessPID     = "process.pid"
+	MetadataKeyServiceName    = "service.name"
+	MetadataKeyServiceVersion = "service.version"
+)
+
+// Metadata describes the process sending the entries, it is added to every entry
+// when set in HookOptions.Metadata. The empty values are not added.
+type Metadata struct {
+	HostName       string
+	PID            int
+	ServiceName    string
+	ServiceVersion string
+	Environment    string
+}
+
+// Enricher describes the environment the process is running in, e.g. KubernetesMetadata,
+// its fields are added to every entry when set in HookOptions.Enrichers.
+type Enricher interface {
+	// Fields returns the fields added to the entries, without the empty values.
+	Fields() logrus.Fields
+}
+
+// DetectMetadata returns the metadata of the current process:
+//   - the host name reported by the kernel
+//   - the process ID
+//   - the service name from the SERVICE_NAME or OTEL_SERVICE_NAME variables,
+//     the name of the executable otherwise
+//   - the service version from the SERVICE_VERSION variable, the version of the
+//     main module otherwise, if built from a tagged module
+//   - the environment detected by DetectEnvironment
+func DetectMetadata() Metadata {
+	m := Metadata{
+		PID:            os.Getpid(),
+		ServiceName:    firstEnv("SERVICE_NAME", "OTEL_SERVICE_NAME"),
+		ServiceVersion: firstEnv("SERVICE_VERSION"),
+		Environment:    DetectEnvironment(),
+	}
+
+	m.HostName, _ = os.Hostname()
+
+	if m.ServiceName == "" && len(os.Args) > 0 {
+		m.ServiceName = filepath.Base(os.Args[0])
+	}
+
+	if m.ServiceVersion == "" {
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "(devel)" {
+			m.ServiceVersion = info.Main.Version
+		}
+	}
+
+	return m
+}
+
+// firstEnv returns the value of the first of the environment variables `names` set.
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// Fields returns the metadata as fields, without the empty values.
+func (m Metadata) Fields() logrus.Fields {
+	fields := logrus.Fields{}
+	if m.HostName != "" {
+		fields[MetadataKeyHostName] = m.HostName
+	}
+	if m.PID != 0 {
+		fields[MetadataKeyProcessPID] = m.PID
+	}
+	if m.ServiceName != "" {
+		fields[MetadataKeyServiceName] = m.ServiceName
+	}
+	if m.ServiceVersion != "" {
+		fields[MetadataKeyServiceVersion] = m.ServiceVersion
+	}
+	if m.Environment != "" {
+		fields[EnvironmentKey] = m.Environment
+	}
+
+	return fields
+}
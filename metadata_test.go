@@ -0,0 +1,58 @@
+package logrustash
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Setenv("SERVICE_NAME", "")
+	t.Setenv("OTEL_SERVICE_NAME", "")
+	t.Setenv("SERVICE_VERSION", "1.2.3")
+	t.Setenv("DEPLOY_ENV", "staging")
+
+	hostname, _ := os.Hostname()
+
+	m := DetectMetadata()
+	assert.Equal(hostname, m.HostName)
+	assert.Equal(os.Getpid(), m.PID)
+	assert.Equal(filepath.Base(os.Args[0]), m.ServiceName)
+	assert.Equal("1.2.3", m.ServiceVersion)
+	assert.Equal("staging", m.Environment)
+
+	t.Setenv("OTEL_SERVICE_NAME", "checkout")
+	assert.Equal("checkout", DetectMetadata().ServiceName)
+}
+
+func TestMetadataFields(t *testing.T) {
+	assert.Equal(t, logrus.Fields{"host.name": "web-1", "service.name": "checkout"}, Metadata{HostName: "web-1", ServiceName: "checkout"}.Fields())
+}
+
+func TestWithMetadata(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := &safeBuffer{}
+	hook, err := NewWithWriter(buffer, WithMetadata(Metadata{HostName: "web-1", PID: 42, ServiceName: "checkout", ServiceVersion: "1.2.3", Environment: "production"}))
+	require.NoError(err)
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "msg1", Data: logrus.Fields{}}))
+	require.NoError(hook.(*Hook).Close())
+
+	var doc map[string]interface{}
+	require.NoError(json.Unmarshal([]byte(buffer.String()), &doc))
+
+	assert.Equal("web-1", doc["host.name"])
+	assert.Equal(float64(42), doc["process.pid"])
+	assert.Equal("checkout", doc["service.name"])
+	assert.Equal("1.2.3", doc["service.version"])
+	assert.Equal("production", doc["environment"])
+}
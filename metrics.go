@@ -0,0 +1,108 @@
+package logrustash
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// prometheusContentType is the content type of the Prometheus text exposition format.
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// prometheusMetric is a counter or gauge derived from the Stats of a hook.
+type prometheusMetric struct {
+	name  string
+	typ   string
+	help  string
+	value func(h *Hook, s Stats) float64
+}
+
+// prometheusMetrics are the metrics written by WritePrometheus, besides the send latency histogram.
+var prometheusMetrics = []prometheusMetric{
+	{"logstash_hook_entries_enqueued_total", "counter", "Entries accepted to be sent to Logstash.", func(_ *Hook, s Stats) float64 { return float64(s.Enqueued) }},
+	{"logstash_hook_entries_sent_total", "counter", "Entries written to Logstash successfully.", func(_ *Hook, s Stats) float64 { return float64(s.Sent) }},
+	{"logstash_hook_writes_failed_total", "counter", "Failed writes to Logstash.", func(_ *Hook, s Stats) float64 { return float64(s.Failed) }},
+	{"logstash_hook_entries_dropped_total", "counter", "Entries given up on and never delivered.", func(_ *Hook, s Stats) float64 { return float64(s.Dropped) }},
+	{"logstash_hook_entries_suppressed_total", "counter", "Dropped entries which were sampled out or rate limited.", func(_ *Hook, s Stats) float64 { return float64(s.Suppressed) }},
+	{"logstash_hook_reconnects_total", "counter", "Attempts made to reconnect to Logstash.", func(_ *Hook, s Stats) float64 { return float64(s.Reconnects) }},
+	{"logstash_hook_bytes_written_total", "counter", "Bytes written to Logstash.", func(_ *Hook, s Stats) float64 { return float64(s.BytesWritten) }},
+	{"logstash_hook_queue_depth", "gauge", "Entries waiting to be sent.", func(_ *Hook, s Stats) float64 { return float64(s.QueueDepth) }},
+	{"logstash_hook_queue_capacity", "gauge", "Entries which can wait to be sent before the overflow policy applies.", func(_ *Hook, s Stats) float64 { return float64(s.QueueCapacity) }},
+	{"logstash_hook_connected", "gauge", "Whether the hook is connected to Logstash.", func(h *Hook, _ Stats) float64 {
+		if h.IsConnected() {
+			return 1
+		}
+		return 0
+	}},
+}
+
+// WritePrometheus writes the statistics of the hooks in the Prometheus text exposition format,
+// the metrics of every hook being labelled with `hook` set to its key in `hooks`.
+func WritePrometheus(w io.Writer, hooks map[string]*Hook) error {
+	names := make([]string, 0, len(hooks))
+	for name := range hooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	stats := make([]Stats, len(names))
+	for i, name := range names {
+		stats[i] = hooks[name].Stats()
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, m := range prometheusMetrics {
+		writePrometheusHeader(bw, m.name, m.typ, m.help)
+		for i, name := range names {
+			writePrometheusSample(bw, m.name, name, "", m.value(hooks[name], stats[i]))
+		}
+	}
+
+	const latency = "logstash_hook_send_duration_seconds"
+	writePrometheusHeader(bw, latency, "histogram", "Time the writes to Logstash took.")
+	for i, name := range names {
+		l := stats[i].SendLatency
+
+		var cumulative uint64
+		for j, le := range l.Buckets {
+			cumulative += l.Counts[j]
+			writePrometheusSample(bw, latency+"_bucket", name, strconv.FormatFloat(le, 'g', -1, 64), float64(cumulative))
+		}
+		writePrometheusSample(bw, latency+"_bucket", name, "+Inf", float64(l.Count))
+		writePrometheusSample(bw, latency+"_sum", name, "", l.Sum.Seconds())
+		writePrometheusSample(bw, latency+"_count", name, "", float64(l.Count))
+	}
+
+	return bw.Flush()
+}
+
+// PrometheusHandler returns an http.Handler serving the statistics of the hooks as WritePrometheus
+// writes them, to be scraped by Prometheus.
+func PrometheusHandler(hooks map[string]*Hook) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", prometheusContentType)
+		_ = WritePrometheus(w, hooks)
+	})
+}
+
+// writePrometheusHeader writes the HELP and TYPE lines of the metric `name`.
+func writePrometheusHeader(w *bufio.Writer, name, typ, help string) {
+	_, _ = w.WriteString("# HELP " + name + " " + help + "\n")
+	_, _ = w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// writePrometheusSample writes a sample of the metric `name` for the hook `hook`,
+// with the `le` label of the histogram buckets if not empty.
+func writePrometheusSample(w *bufio.Writer, name, hook, le string, v float64) {
+	_, _ = w.WriteString(name + `{hook="` + prometheusLabelReplacer.Replace(hook) + `"`)
+	if le != "" {
+		_, _ = w.WriteString(`,le="` + le + `"`)
+	}
+	_, _ = w.WriteString("} " + strconv.FormatFloat(v, 'g', -1, 64) + "\n")
+}
+
+// prometheusLabelReplacer escapes the label values.
+var prometheusLabelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,51 @@
+package logrustash
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	app := &Hook{writer: bytes.NewBuffer(nil), formatter: &logrus.JSONFormatter{}, connected: true}
+	audit := &Hook{writer: FailWrite{}, formatter: &logrus.JSONFormatter{}}
+
+	require.NoError(app.Fire(&logrus.Entry{Message: "msg", Data: logrus.Fields{}}))
+	require.NoError(app.Fire(&logrus.Entry{Message: "msg", Data: logrus.Fields{}}))
+	require.Error(audit.Fire(&logrus.Entry{Message: "msg", Data: logrus.Fields{}}))
+
+	var b bytes.Buffer
+	require.NoError(WritePrometheus(&b, map[string]*Hook{"app": app, `au"dit`: audit}))
+	out := b.String()
+
+	assert.Contains(out, "# TYPE logstash_hook_entries_sent_total counter\n")
+	assert.Contains(out, "logstash_hook_entries_enqueued_total{hook=\"app\"} 2\n")
+	assert.Contains(out, "logstash_hook_entries_sent_total{hook=\"app\"} 2\n")
+	assert.Contains(out, "logstash_hook_writes_failed_total{hook=\"au\\\"dit\"} 1\n")
+	assert.Contains(out, "logstash_hook_connected{hook=\"app\"} 1\n")
+	assert.Contains(out, "logstash_hook_connected{hook=\"au\\\"dit\"} 0\n")
+	assert.Contains(out, "# TYPE logstash_hook_send_duration_seconds histogram\n")
+	assert.Contains(out, "logstash_hook_send_duration_seconds_bucket{hook=\"app\",le=\"+Inf\"} 2\n")
+	assert.Contains(out, "logstash_hook_send_duration_seconds_bucket{hook=\"app\",le=\"10\"} 2\n")
+	assert.Contains(out, "logstash_hook_send_duration_seconds_count{hook=\"app\"} 2\n")
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	h := &Hook{writer: bytes.NewBuffer(nil), formatter: &logrus.JSONFormatter{}}
+	require.NoError(t, h.Fire(&logrus.Entry{Message: "msg", Data: logrus.Fields{}}))
+
+	rec := httptest.NewRecorder()
+	PrometheusHandler(map[string]*Hook{"app": h}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, prometheusContentType, rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "logstash_hook_entries_sent_total{hook=\"app\"} 1\n")
+}
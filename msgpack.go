@@ -0,0 +1,264 @@
+package logrustash
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MsgpackFormatter formats the entries as MessagePack maps, for the Logstash inputs with the msgpack codec,
+// which are smaller and cheaper to parse than JSON. It lays the entries out as logrus.JSONFormatter does,
+// the entries are not delimited, e.g. as the Formatter of a LogstashFormatter, see DefaultMsgpackFormatter.
+type MsgpackFormatter struct {
+	// TimestampFormat is the layout of the time of the entries, time.RFC3339 by default.
+	TimestampFormat string
+	// DisableTimestamp omits the time of the entries.
+	DisableTimestamp bool
+	// FieldMap renames the default keys of the time, the message and the level, e.g.
+	// logrus.FieldMap{logrus.FieldKeyTime: "@timestamp", logrus.FieldKeyMsg: "message"}.
+	FieldMap logrus.FieldMap
+}
+
+// Format formats the entry as a MessagePack map.
+func (f *MsgpackFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	timeKey, msgKey, levelKey := f.key(logrus.FieldKeyTime), f.key(logrus.FieldKeyMsg), f.key(logrus.FieldKeyLevel)
+
+	data := make(logrus.Fields, len(e.Data)+3)
+	for k, v := range e.Data {
+		// the fields clashing with the default keys are prefixed as logrus.JSONFormatter does
+		if k == timeKey || k == msgKey || k == levelKey {
+			k = "fields." + k
+		}
+		data[k] = v
+	}
+
+	if !f.DisableTimestamp {
+		layout := f.TimestampFormat
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		data[timeKey] = e.Time.Format(layout)
+	}
+	data[msgKey] = e.Message
+	data[levelKey] = e.Level.String()
+
+	return msgpackAppendMap(nil, data), nil
+}
+
+// key returns the key of the default field `key` according to the FieldMap.
+func (f *MsgpackFormatter) key(key string) string {
+	for k, v := range f.FieldMap {
+		if string(k) == key {
+			return v
+		}
+	}
+
+	return key
+}
+
+// DefaultMsgpackFormatter returns a Logstash formatter like DefaultFormatter does,
+// the entries being MessagePack maps instead of JSON documents.
+func DefaultMsgpackFormatter(fields logrus.Fields) logrus.Formatter {
+	f := DefaultFormatter(fields).(LogstashFormatter)
+	jsonFormatter := f.Formatter.(*logrus.JSONFormatter)
+	f.Formatter = &MsgpackFormatter{
+		TimestampFormat: jsonFormatter.TimestampFormat,
+		FieldMap:        jsonFormatter.FieldMap,
+	}
+
+	return f
+}
+
+// msgpackAppend appends the MessagePack encoding of `v` to `b`. The values without
+// a MessagePack equivalent are encoded as they are serialized to JSON, or formatted
+// as strings with %v if they can not be. The keys of the maps are sorted.
+func msgpackAppend(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if v {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case string:
+		return msgpackAppendString(b, v)
+	case []byte:
+		return msgpackAppendBinary(b, v)
+	case float32:
+		return binary.BigEndian.AppendUint32(append(b, 0xca), math.Float32bits(v))
+	case float64:
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v))
+	case time.Time:
+		return msgpackAppendString(b, v.Format(time.RFC3339Nano))
+	case time.Duration:
+		return msgpackAppendString(b, v.String())
+	case error:
+		return msgpackAppendString(b, v.Error())
+	case json.Marshaler:
+		return msgpackAppendJSON(b, v)
+	case logrus.Fields:
+		return msgpackAppendMap(b, v)
+	case map[string]interface{}:
+		return msgpackAppendMap(b, v)
+	case []interface{}:
+		b = msgpackAppendArrayHeader(b, len(v))
+		for _, item := range v {
+			b = msgpackAppend(b, item)
+		}
+		return b
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return msgpackAppendInt(b, rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return msgpackAppendUint(b, rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return msgpackAppend(b, rv.Float())
+	case reflect.String:
+		return msgpackAppendString(b, rv.String())
+	case reflect.Bool:
+		return msgpackAppend(b, rv.Bool())
+	}
+
+	return msgpackAppendJSON(b, v)
+}
+
+// msgpackAppendJSON appends `v` as it is serialized to JSON, or formatted with %v if it can not be.
+func msgpackAppendJSON(b []byte, v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return msgpackAppendString(b, fmt.Sprintf("%v", v))
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return msgpackAppendString(b, fmt.Sprintf("%v", v))
+	}
+
+	return msgpackAppend(b, decoded)
+}
+
+// msgpackAppendMap appends the map `m`, sorted by key.
+func msgpackAppendMap[M ~map[string]interface{}](b []byte, m M) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b = msgpackAppendMapHeader(b, len(m))
+	for _, k := range keys {
+		b = msgpackAppendString(b, k)
+		b = msgpackAppend(b, m[k])
+	}
+
+	return b
+}
+
+func msgpackAppendInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return msgpackAppendUint(b, uint64(i))
+	case i >= -32:
+		return append(b, byte(i))
+	case i >= math.MinInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+	}
+}
+
+func msgpackAppendUint(b []byte, u uint64) []byte {
+	switch {
+	case u < 1<<7:
+		return append(b, byte(u))
+	case u <= math.MaxUint8:
+		return append(b, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(u))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), u)
+	}
+}
+
+func msgpackAppendString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+
+	return append(b, s...)
+}
+
+func msgpackAppendBinary(b []byte, data []byte) []byte {
+	switch n := len(data); {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+	}
+
+	return append(b, data...)
+}
+
+func msgpackAppendArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+func msgpackAppendMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+	}
+}
+
+// msgpackAppendExt appends the extension of type `typ` holding `data`, only the fixed
+// sizes used by this package are supported.
+func msgpackAppendExt(b []byte, typ int8, data []byte) []byte {
+	switch len(data) {
+	case 4:
+		b = append(b, 0xd6, byte(typ))
+	case 8:
+		b = append(b, 0xd7, byte(typ))
+	case 12:
+		b = append(b, 0xc7, 12, byte(typ))
+	default:
+		panic(fmt.Sprintf("unsupported msgpack ext size %d", len(data)))
+	}
+
+	return append(b, data...)
+}
@@ -0,0 +1,274 @@
+package logrustash
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// msgpackExt is a decoded MessagePack extension.
+type msgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+// msgpackDecode decodes the next MessagePack value of `r`, the integers as int64,
+// the maps as map[string]interface{} and the binaries as []byte.
+func msgpackDecode(r *bufio.Reader) (interface{}, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	readN := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+	readUint := func(size int) (uint64, error) {
+		b, err := readN(size)
+		if err != nil {
+			return 0, err
+		}
+		var u uint64
+		for _, c := range b {
+			u = u<<8 | uint64(c)
+		}
+		return u, nil
+	}
+	readArray := func(n int) (interface{}, error) {
+		a := make([]interface{}, n)
+		for i := range a {
+			if a[i], err = msgpackDecode(r); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	}
+	readMap := func(n int) (interface{}, error) {
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			k, err := msgpackDecode(r)
+			if err != nil {
+				return nil, err
+			}
+			if m[k.(string)], err = msgpackDecode(r); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	readExt := func(n int) (interface{}, error) {
+		typ, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		data, err := readN(n)
+		return msgpackExt{Type: int8(typ), Data: data}, err
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return readMap(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return readArray(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		b, err := readN(int(c & 0x1f))
+		return string(b), err
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readUint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return readN(int(n))
+	case 0xca:
+		u, err := readUint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := readUint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := readUint(1 << (c - 0xcc))
+		return int64(u), err
+	case 0xd0:
+		u, err := readUint(1)
+		return int64(int8(u)), err
+	case 0xd1:
+		u, err := readUint(2)
+		return int64(int16(u)), err
+	case 0xd2:
+		u, err := readUint(4)
+		return int64(int32(u)), err
+	case 0xd3:
+		u, err := readUint(8)
+		return int64(u), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return readExt(1 << (c - 0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := readUint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return readExt(int(n))
+	case 0xd9, 0xda, 0xdb:
+		n, err := readUint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		b, err := readN(int(n))
+		return string(b), err
+	case 0xdc, 0xdd:
+		n, err := readUint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return readArray(int(n))
+	case 0xde, 0xdf:
+		n, err := readUint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return readMap(int(n))
+	}
+
+	return nil, errors.New("unknown msgpack type")
+}
+
+func msgpackUnmarshal(t *testing.T, b []byte) interface{} {
+	r := bufio.NewReader(bytes.NewReader(b))
+	v, err := msgpackDecode(r)
+	require.NoError(t, err)
+
+	_, err = r.ReadByte()
+	require.ErrorIs(t, err, io.EOF, "trailing data")
+
+	return v
+}
+
+type jsonValue struct {
+	Name string `json:"name"`
+}
+
+func TestMsgpackAppend(t *testing.T) {
+	long := string(bytes.Repeat([]byte("a"), 300))
+	now := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	tests := []struct {
+		value    interface{}
+		expected interface{}
+	}{
+		{nil, nil},
+		{true, true},
+		{"short", "short"},
+		{long, long},
+		{[]byte{1, 2}, []byte{1, 2}},
+		{0, int64(0)},
+		{127, int64(127)},
+		{-1, int64(-1)},
+		{-32, int64(-32)},
+		{-33, int64(-33)},
+		{200, int64(200)},
+		{70000, int64(70000)},
+		{int64(-1) << 40, int64(-1) << 40},
+		{uint16(65535), int64(65535)},
+		{uint64(1) << 40, int64(1) << 40},
+		{1.5, 1.5},
+		{float32(2.5), 2.5},
+		{now, "2024-01-02T03:04:05.000000006Z"},
+		{time.Second, "1s"},
+		{errors.New("boom"), "boom"},
+		{jsonValue{Name: "value"}, map[string]interface{}{"name": "value"}},
+		{[]interface{}{1, "a"}, []interface{}{int64(1), "a"}},
+		{logrus.Fields{"b": 1, "a": "x"}, map[string]interface{}{"a": "x", "b": int64(1)}},
+		{[]string{"x", "y"}, []interface{}{"x", "y"}},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, msgpackUnmarshal(t, msgpackAppend(nil, test.value)), "%v", test.value)
+	}
+}
+
+func TestMsgpackAppendSortsKeys(t *testing.T) {
+	b := msgpackAppend(nil, map[string]interface{}{"b": 1, "a": 2, "c": 3})
+	assert.Equal(t, []byte{0x83, 0xa1, 'a', 2, 0xa1, 'b', 1, 0xa1, 'c', 3}, b)
+}
+
+func TestMsgpackAppendExt(t *testing.T) {
+	ext := msgpackUnmarshal(t, msgpackAppendExt(nil, 0, binary.BigEndian.AppendUint64(nil, 42)))
+	assert.Equal(t, msgpackExt{Type: 0, Data: binary.BigEndian.AppendUint64(nil, 42)}, ext)
+
+	ext = msgpackUnmarshal(t, msgpackAppendExt(nil, -1, make([]byte, 12)))
+	assert.Equal(t, msgpackExt{Type: -1, Data: make([]byte, 12)}, ext)
+}
+
+func TestMsgpackFormatter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	e := &logrus.Entry{
+		Time:    now,
+		Level:   logrus.WarnLevel,
+		Message: "hello",
+		Data:    logrus.Fields{"count": 3, "message": "clash", "err": errors.New("boom")},
+	}
+
+	t.Run("plain", func(t *testing.T) {
+		b, err := (&MsgpackFormatter{}).Format(e)
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]interface{}{
+			"time":    "2024-01-02T03:04:05Z",
+			"msg":     "hello",
+			"level":   "warning",
+			"count":   int64(3),
+			"message": "clash",
+			"err":     "boom",
+		}, msgpackUnmarshal(t, b))
+	})
+
+	t.Run("default logstash formatter", func(t *testing.T) {
+		b, err := DefaultMsgpackFormatter(logrus.Fields{"type": "app"}).Format(e)
+		require.NoError(t, err)
+
+		doc := msgpackUnmarshal(t, b).(map[string]interface{})
+		assert.Equal(t, "2024-01-02T03:04:05Z", doc["@timestamp"])
+		assert.Equal(t, "hello", doc["message"])
+		assert.Equal(t, "warning", doc["level"])
+		assert.Equal(t, "1", doc["@version"])
+		assert.Equal(t, "app", doc["type"])
+		assert.Contains(t, doc["fields"], "count=3")
+	})
+
+	t.Run("structured", func(t *testing.T) {
+		f := DefaultMsgpackFormatter(logrus.Fields{}).(LogstashFormatter)
+		f.PreserveTypes = true
+
+		b, err := f.Format(e)
+		require.NoError(t, err)
+
+		doc := msgpackUnmarshal(t, b).(map[string]interface{})
+		assert.Equal(t, int64(3), doc["count"])
+		assert.Equal(t, "hello", doc["message"])
+		assert.Equal(t, "clash", doc["fields.message"])
+	})
+}
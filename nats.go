@@ -0,0 +1,407 @@
+package logrustash
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultNATSDialTimeout = 10 * time.Second
+	defaultNATSTimeout     = 10 * time.Second
+)
+
+// ErrNATSNoResponders is returned when no JetStream stream captures the subject of the entries.
+var ErrNATSNoResponders = errors.New("nats: no responders, no stream captures the subject")
+
+// NATSError is an -ERR message of the NATS server, e.g. "Permissions Violation for Publish to logs".
+type NATSError string
+
+func (e NATSError) Error() string {
+	return "nats: " + string(e)
+}
+
+// JetStreamError is the error of a JetStream publish acknowledgment.
+type JetStreamError struct {
+	Code        int    `json:"code"`
+	ErrCode     int    `json:"err_code"`
+	Description string `json:"description"`
+}
+
+func (e *JetStreamError) Error() string {
+	return fmt.Sprintf("jetstream: %s (%d)", e.Description, e.Code)
+}
+
+// NATSOptions configures the writer returned by NewNATSWriter.
+type NATSOptions struct {
+	// Addr is the address of the NATS server, e.g. "nats:4222".
+	Addr string
+	// Subject is the subject the entries are published to.
+	Subject string
+	// JetStream waits for every entry to be acknowledged by the JetStream stream capturing the subject,
+	// for at-least-once delivery. A write is retried entirely, the entries already acknowledged included,
+	// if any of its entries is not acknowledged.
+	JetStream bool
+	// Token, or Username and Password, authenticate the connection.
+	Token    string
+	Username string
+	Password string
+	// Name is the name of the connection shown by the monitoring of the server.
+	Name string
+	// TLS, if set, upgrades the connection to TLS, it is upgraded anyway if the server requires it.
+	TLS *tls.Config
+	// DialTimeout is the timeout of the connection, its handshake included, 10 seconds by default.
+	DialTimeout time.Duration
+	// Timeout is the time waited for the server to process the entries, or the JetStream
+	// acknowledgments, unless the hook sets a write deadline, 10 seconds by default.
+	Timeout time.Duration
+}
+
+// NATSWriter publishes the entries of every write, a single entry or a batch of newline-delimited entries,
+// to a NATS subject, e.g. read by Logstash with the NATS input plugin. Every write is flushed with a PING
+// for the errors of the server, e.g. a permissions violation, to be returned.
+// The connection is re-established by the next write after an error.
+// It is meant to be used with NewWithWriter. It is safe for concurrent use.
+type NATSWriter struct {
+	opts NATSOptions
+
+	mu       sync.Mutex
+	conn     net.Conn
+	r        *bufio.Reader
+	inbox    string
+	deadline time.Time
+}
+
+// natsInfo is the part of the INFO message of the server used by the writer.
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+	Headers     bool `json:"headers"`
+}
+
+// NewNATSWriter returns a NATSWriter publishing to `opts.Subject`. The server is connected to on the first write.
+func NewNATSWriter(opts NATSOptions) (*NATSWriter, error) {
+	if opts.Addr == "" {
+		return nil, errors.New("no nats address")
+	}
+	if opts.Subject == "" || strings.ContainsAny(opts.Subject, " \t\r\n") {
+		return nil, fmt.Errorf("invalid nats subject %q", opts.Subject)
+	}
+
+	return &NATSWriter{opts: opts}, nil
+}
+
+// Write publishes the entries of `data`, one message per line.
+func (w *NATSWriter) Write(data []byte) (int, error) {
+	var msgs [][]byte
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			msgs = append(msgs, line)
+		}
+	}
+	if len(msgs) == 0 {
+		return len(data), nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := w.publish(msgs); err != nil {
+		var jsErr *JetStreamError
+		if !errors.As(err, &jsErr) && !errors.Is(err, ErrNATSNoResponders) {
+			w.closeConn()
+		}
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// publish publishes the messages and waits for the server to process them.
+func (w *NATSWriter) publish(msgs [][]byte) error {
+	deadline := w.deadline
+	if deadline.IsZero() {
+		deadline = time.Now().Add(w.timeout())
+	}
+	if err := w.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	var req []byte
+	for i, msg := range msgs {
+		req = append(req, "PUB "...)
+		req = append(req, w.opts.Subject...)
+		if w.opts.JetStream {
+			req = append(req, ' ')
+			req = append(req, w.inbox...)
+			req = append(req, '.')
+			req = strconv.AppendInt(req, int64(i), 10)
+		}
+		req = append(req, ' ')
+		req = strconv.AppendInt(req, int64(len(msg)), 10)
+		req = append(req, "\r\n"...)
+		req = append(req, msg...)
+		req = append(req, "\r\n"...)
+	}
+	req = append(req, "PING\r\n"...)
+
+	if _, err := w.conn.Write(req); err != nil {
+		return err
+	}
+
+	acks := 0
+	if w.opts.JetStream {
+		acks = len(msgs)
+	}
+
+	var ackErr error
+	for pong := false; !pong || acks > 0; {
+		op, args, payload, err := w.read()
+		if err != nil {
+			return err
+		}
+
+		switch op {
+		case "PONG":
+			pong = true
+		case "MSG", "HMSG":
+			if !strings.HasPrefix(args[0], w.inbox+".") {
+				continue
+			}
+
+			acks--
+			if err := jetStreamAck(op, payload, args); err != nil && ackErr == nil {
+				ackErr = err
+			}
+		}
+	}
+
+	return ackErr
+}
+
+// jetStreamAck returns the error of a JetStream publish acknowledgment, if any.
+func jetStreamAck(op string, payload []byte, args []string) error {
+	if op == "HMSG" {
+		hdrLen, _ := strconv.Atoi(args[len(args)-2])
+		if hdrLen > len(payload) {
+			hdrLen = len(payload)
+		}
+
+		status, _, _ := strings.Cut(string(payload[:hdrLen]), "\r\n")
+		if strings.HasPrefix(status, "NATS/1.0 503") {
+			return ErrNATSNoResponders
+		}
+		if len(bytes.TrimSpace(payload[hdrLen:])) == 0 {
+			return fmt.Errorf("unexpected jetstream acknowledgment %q", status)
+		}
+
+		payload = payload[hdrLen:]
+	}
+
+	var ack struct {
+		Stream string          `json:"stream"`
+		Error  *JetStreamError `json:"error"`
+	}
+	if err := json.Unmarshal(payload, &ack); err != nil {
+		return fmt.Errorf("invalid jetstream acknowledgment: %w", err)
+	}
+	if ack.Error != nil {
+		return ack.Error
+	}
+
+	return nil
+}
+
+// read reads the next message of the server, answering its PINGs and returning its -ERR messages as errors.
+// The payload of MSG and HMSG messages is returned with their arguments.
+func (w *NATSWriter) read() (string, []string, []byte, error) {
+	for {
+		line, err := w.r.ReadString('\n')
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		op, rest, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		switch strings.ToUpper(op) {
+		case "PING":
+			if _, err := io.WriteString(w.conn, "PONG\r\n"); err != nil {
+				return "", nil, nil, err
+			}
+		case "-ERR":
+			return "", nil, nil, NATSError(strings.Trim(rest, "'"))
+		case "+OK", "INFO":
+		case "MSG", "HMSG":
+			args := strings.Fields(rest)
+			if len(args) < 3 {
+				return "", nil, nil, fmt.Errorf("invalid nats message %q", line)
+			}
+
+			size, err := strconv.Atoi(args[len(args)-1])
+			if err != nil || size < 0 {
+				return "", nil, nil, fmt.Errorf("invalid nats message %q", line)
+			}
+
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(w.r, payload); err != nil {
+				return "", nil, nil, err
+			}
+
+			return strings.ToUpper(op), args, payload[:size], nil
+		default:
+			return strings.ToUpper(op), nil, nil, nil
+		}
+	}
+}
+
+// connect connects to the server, reads its INFO, sends the CONNECT, and subscribes to the inbox
+// of the JetStream acknowledgments if needed.
+func (w *NATSWriter) connect() error {
+	dialTimeout := w.opts.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultNATSDialTimeout
+	}
+
+	conn, err := net.DialTimeout("tcp", w.opts.Addr, dialTimeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(dialTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	w.conn, w.r = conn, bufio.NewReader(conn)
+	if err := w.handshake(); err != nil {
+		w.closeConn()
+		return fmt.Errorf("failed to connect to nats: %w", err)
+	}
+
+	return nil
+}
+
+func (w *NATSWriter) handshake() error {
+	line, err := w.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	var info natsInfo
+	payload, ok := strings.CutPrefix(strings.TrimSpace(line), "INFO ")
+	if !ok {
+		return fmt.Errorf("unexpected nats greeting %q", line)
+	}
+	if err := json.Unmarshal([]byte(payload), &info); err != nil {
+		return fmt.Errorf("invalid nats info: %w", err)
+	}
+
+	if w.opts.TLS != nil || info.TLSRequired {
+		cfg := w.opts.TLS.Clone()
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName, _, _ = net.SplitHostPort(w.opts.Addr)
+		}
+
+		tlsConn := tls.Client(w.conn, cfg)
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		w.conn, w.r = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	connect, err := json.Marshal(map[string]interface{}{
+		"verbose":       false,
+		"pedantic":      false,
+		"lang":          "go",
+		"version":       "logrustash",
+		"protocol":      1,
+		"name":          w.opts.Name,
+		"auth_token":    w.opts.Token,
+		"user":          w.opts.Username,
+		"pass":          w.opts.Password,
+		"headers":       info.Headers,
+		"no_responders": info.Headers,
+	})
+	if err != nil {
+		return err
+	}
+
+	req := "CONNECT " + string(connect) + "\r\n"
+	if w.opts.JetStream {
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+
+		w.inbox = "_INBOX." + hex.EncodeToString(id)
+		req += "SUB " + w.inbox + ".* 1\r\n"
+	}
+	req += "PING\r\n"
+
+	if _, err := io.WriteString(w.conn, req); err != nil {
+		return err
+	}
+
+	// the server answers the PING once the CONNECT is accepted, or sends an -ERR, e.g. "Authorization Violation"
+	for {
+		op, _, _, err := w.read()
+		if err != nil {
+			return err
+		}
+		if op == "PONG" {
+			return nil
+		}
+	}
+}
+
+func (w *NATSWriter) timeout() time.Duration {
+	if w.opts.Timeout > 0 {
+		return w.opts.Timeout
+	}
+
+	return defaultNATSTimeout
+}
+
+// closeConn closes the connection, the next write re-connects.
+func (w *NATSWriter) closeConn() {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn, w.r = nil, nil
+	}
+}
+
+// SetWriteDeadline sets the time the writes, acknowledgments included, must be done by,
+// see HookOptions.WriteTimeout.
+func (w *NATSWriter) SetWriteDeadline(t time.Time) error {
+	w.mu.Lock()
+	w.deadline = t
+	w.mu.Unlock()
+
+	return nil
+}
+
+// Close closes the connection.
+func (w *NATSWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.closeConn()
+	return nil
+}
@@ -0,0 +1,202 @@
+package logrustash
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNATS records the messages published to it, answering the publications with a reply
+// subject with the JetStream acknowledgment returned by `ack`, or no responders if it is empty.
+type fakeNATS struct {
+	l   net.Listener
+	ack func(subject, payload string) string
+
+	mu       sync.Mutex
+	connects []string
+	msgs     []string
+	// errOnPub, if set, is sent instead of processing the publications
+	errOnPub string
+}
+
+func newFakeNATS(t *testing.T, ack func(subject, payload string) string) *fakeNATS {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	n := &fakeNATS{l: l, ack: ack}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go n.serve(conn)
+		}
+	}()
+
+	return n
+}
+
+func (n *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, `INFO {"server_id":"test","headers":true,"max_payload":1048576}`+"\r\n"); err != nil {
+		return
+	}
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		op, rest, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch op {
+		case "CONNECT":
+			n.mu.Lock()
+			n.connects = append(n.connects, rest)
+			n.mu.Unlock()
+		case "PING":
+			_, err = io.WriteString(conn, "PONG\r\n")
+		case "PUB":
+			args := strings.Fields(rest)
+			size, _ := strconv.Atoi(args[len(args)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+
+			n.mu.Lock()
+			errOnPub := n.errOnPub
+			if errOnPub == "" {
+				n.msgs = append(n.msgs, args[0]+" "+string(payload[:size]))
+			}
+			n.mu.Unlock()
+
+			if errOnPub != "" {
+				_, err = io.WriteString(conn, "-ERR '"+errOnPub+"'\r\n")
+				break
+			}
+
+			if len(args) == 3 {
+				if ack := n.ack(args[0], string(payload[:size])); ack != "" {
+					_, err = fmt.Fprintf(conn, "MSG %s 1 %d\r\n%s\r\n", args[1], len(ack), ack)
+				} else {
+					// no stream captures the subject
+					_, err = fmt.Fprintf(conn, "HMSG %s 1 16 16\r\nNATS/1.0 503\r\n\r\n\r\n", args[1])
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (n *fakeNATS) published() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]string(nil), n.msgs...)
+}
+
+func TestNATSWriter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	n := newFakeNATS(t, nil)
+
+	w, err := NewNATSWriter(NATSOptions{Addr: n.l.Addr().String(), Subject: "logs", Token: "secret"})
+	require.NoError(err)
+
+	hook, err := NewWithWriter(w, WithFormatter(&logrus.JSONFormatter{}), WithSynchronous())
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "published", Data: logrus.Fields{}}))
+
+	msgs := n.published()
+	require.Len(msgs, 1)
+	assert.True(strings.HasPrefix(msgs[0], `logs {"level":"panic","msg":"published"`), msgs[0])
+
+	n.mu.Lock()
+	assert.Contains(n.connects[0], `"auth_token":"secret"`)
+	n.mu.Unlock()
+
+	_, err = w.Write([]byte("{\"n\":1}\n{\"n\":2}\n"))
+	require.NoError(err)
+	assert.Equal([]string{`logs {"n":1}`, `logs {"n":2}`}, n.published()[1:])
+}
+
+func TestNATSWriterError(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	n := newFakeNATS(t, nil)
+	n.errOnPub = "Permissions Violation for Publish to logs"
+
+	w, err := NewNATSWriter(NATSOptions{Addr: n.l.Addr().String(), Subject: "logs"})
+	require.NoError(err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("entry\n"))
+	assert.Equal(NATSError("Permissions Violation for Publish to logs"), err)
+
+	// the writer re-connects
+	n.mu.Lock()
+	n.errOnPub = ""
+	n.mu.Unlock()
+
+	_, err = w.Write([]byte("entry\n"))
+	require.NoError(err)
+	assert.Equal([]string{"logs entry"}, n.published())
+
+	_, err = NewNATSWriter(NATSOptions{Addr: n.l.Addr().String(), Subject: "invalid subject"})
+	assert.Error(err)
+}
+
+func TestNATSWriterJetStream(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	n := newFakeNATS(t, func(subject, payload string) string {
+		switch payload {
+		case "not captured":
+			return ""
+		case "rejected":
+			return `{"error":{"code":400,"err_code":10054,"description":"maximum messages exceeded"}}`
+		default:
+			return `{"stream":"LOGS","seq":1}`
+		}
+	})
+
+	w, err := NewNATSWriter(NATSOptions{Addr: n.l.Addr().String(), Subject: "logs", JetStream: true})
+	require.NoError(err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("first\nsecond\n"))
+	require.NoError(err)
+	assert.Equal([]string{"logs first", "logs second"}, n.published())
+
+	_, err = w.Write([]byte("rejected\nthird\n"))
+	assert.Equal(&JetStreamError{Code: 400, ErrCode: 10054, Description: "maximum messages exceeded"}, err)
+
+	// the connection is kept after a negative acknowledgment
+	_, err = w.Write([]byte("fourth\n"))
+	require.NoError(err)
+	assert.Equal("logs fourth", n.published()[4])
+
+	_, err = w.Write([]byte("not captured\n"))
+	assert.ErrorIs(err, ErrNATSNoResponders)
+}
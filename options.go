@@ -0,0 +1,667 @@
+package logrustash
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Option configures the hooks created by NewWithOptions.
+type Option func(*options)
+
+type options struct {
+	HookOptions
+
+	ctx       context.Context
+	formatter logrus.Formatter
+	failover  []string
+
+	// cloudMetadataTimeout, if set, is the time the cloud metadata is detected for, see WithCloudMetadata
+	cloudMetadataTimeout time.Duration
+}
+
+// NewWithOptions returns a new logrus.Hook for Logstash configured by `opts`.
+//
+// It is equivalent to New, except that every setting, including the formatter,
+// is given as an Option, by default the entries are formatted by DefaultFormatter.
+func NewWithOptions(protocol, addr string, opts ...Option) (logrus.Hook, error) {
+	if protocol == "" || addr == "" {
+		return nil, fmt.Errorf("protocol and addr must be set")
+	}
+
+	o := newOptions(opts...)
+	h, err := newHook(o.ctx, protocol, append([]string{addr}, o.failover...), o.formatter, o.HookOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// NewWithWriter returns a new logrus.Hook for Logstash which writes the entries to `w`,
+// e.g. a file, a pipe or a custom transport, configured by `opts`.
+//
+// It is equivalent to NewFromConn, except that every setting, including the formatter,
+// is given as an Option, by default the entries are formatted by DefaultFormatter.
+func NewWithWriter(w io.Writer, opts ...Option) (logrus.Hook, error) {
+	if w == nil {
+		return nil, fmt.Errorf("writer must be set")
+	}
+
+	o := newOptions(opts...)
+	h, err := newWriterHook(o.ctx, w, o.formatter, o.HookOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// newOptions applies `opts` over the defaults.
+func newOptions(opts ...Option) options {
+	o := options{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.formatter == nil {
+		o.formatter = DefaultFormatter(logrus.Fields{})
+	}
+
+	// detected once every option is applied, within the context of the hook
+	if o.cloudMetadataTimeout > 0 {
+		ctx, cancel := context.WithTimeout(o.ctx, o.cloudMetadataTimeout)
+		WithEnrichers(DetectCloudMetadata(ctx))(&o)
+		cancel()
+	}
+
+	return o
+}
+
+// WithHookOptions sets all the HookOptions at once, the options given after it
+// override the corresponding settings.
+func WithHookOptions(hookOpts HookOptions) Option {
+	return func(o *options) {
+		o.HookOptions = hookOpts
+	}
+}
+
+// WithContext makes the hook stop sending entries once `ctx` is done, see NewWithContext.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithFormatter sets the formatter of the entries, e.g. DefaultFormatter.
+func WithFormatter(f logrus.Formatter) Option {
+	return func(o *options) {
+		o.formatter = f
+	}
+}
+
+// WithFailover adds Logstash addresses the hook fails over to, see NewMulti.
+func WithFailover(addrs ...string) Option {
+	return func(o *options) {
+		o.failover = append(o.failover, addrs...)
+	}
+}
+
+// WithKeepAlive enables TCP keepalive with the given period,
+// the default period is used when it is zero.
+func WithKeepAlive(period time.Duration) Option {
+	return func(o *options) {
+		o.KeepAlive = true
+		o.KeepAlivePeriod = period
+	}
+}
+
+// WithBufferSize sets the number of entries which can be queued before being sent.
+func WithBufferSize(size int) Option {
+	return func(o *options) {
+		o.FireChannelBufferSize = size
+	}
+}
+
+// WithTLS wraps the connections in TLS configured by `config`.
+func WithTLS(config *tls.Config) Option {
+	return func(o *options) {
+		o.TLSConfig = config
+	}
+}
+
+// WithDialer establishes the connections with `d`.
+func WithDialer(d *net.Dialer) Option {
+	return func(o *options) {
+		o.DialFunc = d.DialContext
+	}
+}
+
+// WithDialFunc establishes the connections with `dial` instead of net.Dial.
+func WithDialFunc(dial func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return func(o *options) {
+		o.DialFunc = dial
+	}
+}
+
+// WithDialTimeout sets the time establishing a connection may take.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.DialTimeout = timeout
+	}
+}
+
+// WithLookupHost resolves the host of the addresses with `lookup`, e.g. a net.Resolver's LookupHost.
+func WithLookupHost(lookup func(ctx context.Context, host string) ([]string, error)) Option {
+	return func(o *options) {
+		o.LookupHost = lookup
+	}
+}
+
+// WithResolveInterval makes the hook resolve the host of its address again every `interval`,
+// and reconnect if the IP address it is connected to is no longer among the ones resolved.
+func WithResolveInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.ResolveInterval = interval
+	}
+}
+
+// WithBackoff sets the time waited for between the reconnection attempts.
+func WithBackoff(backoff Backoff) Option {
+	return func(o *options) {
+		o.Backoff = backoff
+	}
+}
+
+// WithMaxReconnectAttempts sets the number of attempts made to reconnect once the connection is lost.
+func WithMaxReconnectAttempts(n int) Option {
+	return func(o *options) {
+		o.MaxReconnectAttempts = n
+	}
+}
+
+// WithFailback makes the hook try to go back to its first address every `interval`
+// after it failed over to another one.
+func WithFailback(interval time.Duration) Option {
+	return func(o *options) {
+		o.FailbackInterval = interval
+	}
+}
+
+// WithWorkers sends the entries over `n` connections concurrently, see HookOptions.Workers.
+func WithWorkers(n int) Option {
+	return func(o *options) {
+		o.Workers = n
+	}
+}
+
+// WithLoadBalancing spreads the entries across the address of the hook and the ones added by WithFailover
+// according to `policy`, see HookOptions.LoadBalancing.
+func WithLoadBalancing(policy BalancePolicy) Option {
+	return func(o *options) {
+		o.LoadBalancing = policy
+	}
+}
+
+// WithFallbackWriter writes the entries which could not be sent since reconnecting failed to `w`.
+func WithFallbackWriter(w io.Writer) Option {
+	return func(o *options) {
+		o.FallbackWriter = w
+	}
+}
+
+// WithCircuitBreaker stops trying to send for `cooldown` after `threshold` consecutive failures to send
+// or to reconnect, the default cool-down is used when it is zero.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(o *options) {
+		o.CircuitBreakerThreshold = threshold
+		o.CircuitBreakerCooldown = cooldown
+	}
+}
+
+// WithReconnectTimeout sets the time the hook keeps trying to reconnect for.
+func WithReconnectTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.ReconnectTimeout = timeout
+	}
+}
+
+// WithWriteTimeout sets the time a write to the connection may take.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.WriteTimeout = timeout
+	}
+}
+
+// WithLevels sends the entries of the given levels only.
+func WithLevels(levels ...logrus.Level) Option {
+	return func(o *options) {
+		o.Levels = levels
+	}
+}
+
+// WithFilter sends the entries `filter` returns true for only, see HookOptions.Filter.
+func WithFilter(filter func(*logrus.Entry) bool) Option {
+	return func(o *options) {
+		o.Filter = filter
+	}
+}
+
+// WithStackTrace adds the stack trace of the goroutine logging the error, fatal and panic entries,
+// skipping `skip` frames besides the ones of logrus and of the hook, see HookOptions.StackTrace.
+func WithStackTrace(skip int) Option {
+	return func(o *options) {
+		o.StackTrace = true
+		o.StackTraceSkip = skip
+	}
+}
+
+// WithMinLevel sends the entries of `level` or more severe only, e.g. logrus.WarnLevel.
+func WithMinLevel(level logrus.Level) Option {
+	return func(o *options) {
+		o.Levels = nil
+		for _, l := range logrus.AllLevels {
+			if l <= level {
+				o.Levels = append(o.Levels, l)
+			}
+		}
+	}
+}
+
+// WithSentAt adds the time the entry is handed to the connection under `key`.
+func WithSentAt(key string) Option {
+	return func(o *options) {
+		o.SentAtKey = key
+	}
+}
+
+// WithMetadata adds the host, process and service metadata `m` to every entry,
+// e.g. WithMetadata(DetectMetadata()).
+func WithMetadata(m Metadata) Option {
+	return func(o *options) {
+		o.Metadata = &m
+	}
+}
+
+// WithEnrichers appends `enrichers` to the ones whose fields are added to every entry, see HookOptions.Enrichers.
+func WithEnrichers(enrichers ...Enricher) Option {
+	return func(o *options) {
+		o.Enrichers = append(append([]Enricher(nil), o.Enrichers...), enrichers...)
+	}
+}
+
+// WithKubernetesMetadata adds the metadata of the Kubernetes pod detected by DetectKubernetesMetadata
+// to every entry, nothing is added outside of Kubernetes.
+func WithKubernetesMetadata() Option {
+	return WithEnrichers(DetectKubernetesMetadata())
+}
+
+// WithContainerMetadata adds the ID and the image of the container detected by DetectContainerMetadata
+// to every entry, nothing is added outside of a container.
+func WithContainerMetadata() Option {
+	return WithEnrichers(DetectContainerMetadata())
+}
+
+// WithCloudMetadata adds the metadata of the cloud instance detected by DetectCloudMetadata within `timeout`
+// to every entry, the default timeout of a second is used when it is zero. The metadata services are queried
+// once, when the hook is created, nothing is added if none of them answers. The metadata is added after
+// the other enrichers, the query is canceled along with the context of the hook, see WithContext.
+func WithCloudMetadata(timeout time.Duration) Option {
+	if timeout == 0 {
+		timeout = defaultCloudMetadataTimeout
+	}
+
+	return func(o *options) {
+		o.cloudMetadataTimeout = timeout
+	}
+}
+
+// WithBuildInfo adds the version of the service, the VCS revision and the Go version of the binary
+// detected by DetectBuildInfo to every entry.
+func WithBuildInfo() Option {
+	return WithEnrichers(DetectBuildInfo())
+}
+
+// WithMiddleware appends `middleware` to the transformations applied to the entries before they are
+// formatted, see HookOptions.Middleware.
+func WithMiddleware(middleware ...func(*logrus.Entry) *logrus.Entry) Option {
+	return func(o *options) {
+		o.Middleware = append(append([]func(*logrus.Entry) *logrus.Entry(nil), o.Middleware...), middleware...)
+	}
+}
+
+// WithDynamicField adds the field `name` computed by `fn` for every entry right before it is formatted.
+func WithDynamicField(name string, fn func(*logrus.Entry) interface{}) Option {
+	return func(o *options) {
+		fields := make(map[string]func(*logrus.Entry) interface{}, len(o.DynamicFields)+1)
+		for k, v := range o.DynamicFields {
+			fields[k] = v
+		}
+		fields[name] = fn
+		o.DynamicFields = fields
+	}
+}
+
+// WithTraceContext adds the trace context `traceContext` returns for the context of the entries to them,
+// e.g. with OpenTelemetry:
+//
+//	logrustash.WithTraceContext(func(ctx context.Context) (logrustash.TraceContext, bool) {
+//		sc := trace.SpanContextFromContext(ctx)
+//		return logrustash.TraceContext{TraceID: sc.TraceID().String(), SpanID: sc.SpanID().String(), Flags: byte(sc.TraceFlags())}, sc.IsValid()
+//	})
+func WithTraceContext(traceContext func(ctx context.Context) (TraceContext, bool)) Option {
+	return func(o *options) {
+		o.TraceContext = traceContext
+	}
+}
+
+// WithIncludeFields sends only the given fields of the entry data.
+func WithIncludeFields(keys ...string) Option {
+	return func(o *options) {
+		o.IncludeFields = append(o.IncludeFields, keys...)
+	}
+}
+
+// WithExcludeFields removes the given fields of the entry data before the entry is formatted.
+func WithExcludeFields(keys ...string) Option {
+	return func(o *options) {
+		o.ExcludeFields = append(o.ExcludeFields, keys...)
+	}
+}
+
+// WithRedactor masks the sensitive values of the entries with `r` before they are formatted.
+func WithRedactor(r *Redactor) Option {
+	return func(o *options) {
+		o.Redactor = r
+	}
+}
+
+// WithRetryBuffer keeps up to `size` entries which failed to be sent for retry.
+func WithRetryBuffer(size int) Option {
+	return func(o *options) {
+		o.RetryBufferSize = size
+	}
+}
+
+// WithDiskQueue persists the entries which failed to be sent in `dir`, up to `maxBytes`
+// in segment files of `segmentBytes`, the defaults are used when they are zero.
+func WithDiskQueue(dir string, maxBytes, segmentBytes int64) Option {
+	return func(o *options) {
+		o.QueueDir = dir
+		o.QueueMaxBytes = maxBytes
+		o.QueueSegmentBytes = segmentBytes
+	}
+}
+
+// WithDeadLetter writes the entries given up on to `w`, see HookOptions.DeadLetter.
+func WithDeadLetter(w io.Writer) Option {
+	return func(o *options) {
+		o.DeadLetter = w
+	}
+}
+
+// WithFallbackFormatter sets the formatter of the entries the formatter fails to format.
+func WithFallbackFormatter(f logrus.Formatter) Option {
+	return func(o *options) {
+		o.FallbackFormatter = f
+	}
+}
+
+// WithRoutes sends the entries to the endpoint of `routes` selected by `route`.
+func WithRoutes(routes map[string]string, route func(*logrus.Entry) string) Option {
+	return func(o *options) {
+		o.Routes = routes
+		o.Route = route
+	}
+}
+
+// WithLevelRoutes sends the entries of the levels of `addrs` to the given Logstash addresses,
+// e.g. the errors to a high priority pipeline, the entries of the other levels are sent to
+// the hook's own address.
+func WithLevelRoutes(addrs map[logrus.Level]string) Option {
+	return func(o *options) {
+		// the levels sent to the same address share its route
+		o.Routes = make(map[string]string, len(addrs))
+		names := make(map[logrus.Level]string, len(addrs))
+		for level, addr := range addrs {
+			o.Routes[addr] = addr
+			names[level] = addr
+		}
+
+		o.Route = RouteByLevel(names)
+	}
+}
+
+// WithMaxEntriesPerSecond limits the rate of the entries sent to Logstash.
+func WithMaxEntriesPerSecond(n int) Option {
+	return func(o *options) {
+		o.MaxEntriesPerSecond = n
+	}
+}
+
+// WithRateLimit limits the rate of the entries sent to Logstash to `rate` entries per second,
+// with bursts of up to `burst` entries.
+func WithRateLimit(rate, burst int) Option {
+	return func(o *options) {
+		o.MaxEntriesPerSecond = rate
+		o.MaxEntriesBurst = burst
+	}
+}
+
+// WithSampleRate sends the entries with the probability `rate`, between 0 and 1.
+func WithSampleRate(rate float64) Option {
+	return func(o *options) {
+		o.SampleRate = rate
+	}
+}
+
+// WithBreadcrumbs keeps the last `size` entries of `level` or less severe as breadcrumbs,
+// the warning and more severe entries are always sent.
+func WithBreadcrumbs(size int, level logrus.Level) Option {
+	return func(o *options) {
+		o.BreadcrumbSize = size
+		o.BreadcrumbLevel = level
+	}
+}
+
+// WithSuppressRepeats suppresses repeated entries, summarizing them every `interval` when set.
+func WithSuppressRepeats(interval time.Duration) Option {
+	return func(o *options) {
+		o.SuppressRepeats = true
+		o.RepeatSummaryInterval = interval
+	}
+}
+
+// WithDedupWindow collapses the identical consecutive entries fired within `window`
+// into a single entry with a "repeat_count" field.
+func WithDedupWindow(window time.Duration) Option {
+	return func(o *options) {
+		o.DedupWindow = window
+	}
+}
+
+// WithGELF formats the entries as GELF messages with GELFFormatter and sends them over UDP
+// in chunks of `chunkSize` bytes, compressed with zlib if `compress` is set, e.g. for Graylog.
+// The default chunk size is used when it is zero.
+func WithGELF(chunkSize int, compress bool) Option {
+	return func(o *options) {
+		o.formatter = GELFFormatter{}
+		o.GELF = true
+		o.GELFChunkSize = chunkSize
+		o.GELFCompress = compress
+	}
+}
+
+// WithFluent formats the entries with FluentFormatter and sends them over the Fluentd forward
+// protocol with `tag`, waiting for every chunk to be acknowledged if `ack` is set.
+func WithFluent(tag string, ack bool) Option {
+	return func(o *options) {
+		o.formatter = FluentFormatter{}
+		o.FluentTag = tag
+		o.FluentAck = ack
+	}
+}
+
+// WithMsgpack formats the entries as MessagePack maps with DefaultMsgpackFormatter and `fields`,
+// for the Logstash inputs with the msgpack codec.
+func WithMsgpack(fields logrus.Fields) Option {
+	return func(o *options) {
+		o.formatter = DefaultMsgpackFormatter(fields)
+	}
+}
+
+// WithProtobuf formats the entries as LogEvent protobuf messages with a ProtobufFormatter of `schema`
+// and `fields`, delimited by their length, for the Logstash inputs with `codec => protobuf { delimited => true }`.
+func WithProtobuf(schema *ProtobufSchema, fields logrus.Fields) Option {
+	return func(o *options) {
+		o.formatter = ProtobufFormatter{Schema: schema, Fields: fields}
+		o.Framer = ProtobufDelimitedFramer
+	}
+}
+
+// WithSyslog formats the entries as RFC 5424 syslog messages with `formatter` and frames
+// them with OctetCountingFramer, to send them over TCP to a syslog input or collector.
+func WithSyslog(formatter SyslogFormatter) Option {
+	return func(o *options) {
+		o.formatter = formatter
+		o.Framer = OctetCountingFramer
+	}
+}
+
+// WithNDJSON frames the entries with NewlineFramer, so that every entry is a single line
+// terminated by a newline whatever the formatter, as expected by the json_lines codec.
+func WithNDJSON() Option {
+	return func(o *options) {
+		o.Framer = NewlineFramer
+	}
+}
+
+// WithFramer re-frames the formatted entries before they are written.
+func WithFramer(framer Framer) Option {
+	return func(o *options) {
+		o.Framer = framer
+	}
+}
+
+// WithMaxMessageBytes limits the size of the formatted entries to `max` bytes,
+// the larger ones are handled according to `policy`.
+func WithMaxMessageBytes(max int, policy OversizePolicy) Option {
+	return func(o *options) {
+		o.MaxMessageBytes = max
+		o.OversizePolicy = policy
+	}
+}
+
+// WithOnBackpressure calls `fn` when `highWaterMark` entries are queued,
+// the capacity of the queue is used when it is zero.
+func WithOnBackpressure(highWaterMark int, fn func(queueLen, queueCap int)) Option {
+	return func(o *options) {
+		o.BackpressureHighWaterMark = highWaterMark
+		o.OnBackpressure = fn
+	}
+}
+
+// WithConnectionCallbacks calls `onConnect` whenever a connection to Logstash is established,
+// `onDisconnect` when it is lost and `onReconnect` when the hook reconnected, any may be nil.
+func WithConnectionCallbacks(onConnect func(addr string), onDisconnect func(addr string, err error), onReconnect func(addr string, attempts int)) Option {
+	return func(o *options) {
+		o.OnConnect = onConnect
+		o.OnDisconnect = onDisconnect
+		o.OnReconnect = onReconnect
+	}
+}
+
+// WithErrorHandler calls `handler` with the errors which can not be returned to the caller
+// instead of printing them to stderr.
+func WithErrorHandler(handler func(err error, e *logrus.Entry)) Option {
+	return func(o *options) {
+		o.ErrorHandler = handler
+	}
+}
+
+// WithDiagnostics writes the hook's own diagnostic messages to `w` instead of stderr.
+func WithDiagnostics(w io.Writer) Option {
+	return func(o *options) {
+		o.Diagnostics = w
+	}
+}
+
+// WithBatching writes the formatted entries at once when `maxSize` of them are batched
+// or every `flushInterval`, the default interval is used when it is zero.
+func WithBatching(maxSize int, flushInterval time.Duration) Option {
+	return func(o *options) {
+		o.MaxBatchSize = maxSize
+		o.FlushInterval = flushInterval
+	}
+}
+
+// WithCompression gzips the data written with the given compression level, e.g. gzip.DefaultCompression.
+// See HookOptions.Compress for the writers supporting it.
+func WithCompression(level int) Option {
+	return func(o *options) {
+		o.Compress = true
+		o.CompressionLevel = &level
+	}
+}
+
+// WithOverflowPolicy sets what Fire does when the queue of entries is full.
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(o *options) {
+		o.OverflowPolicy = policy
+	}
+}
+
+// WithRingBuffer queues up to `size` entries in a ring buffer, once it is full the oldest entries
+// are overwritten by the new ones and counted as dropped, the recent entries being more valuable during
+// an outage. It is a shorthand for WithBufferSize and WithOverflowPolicy(OverflowDropOldest).
+func WithRingBuffer(size int) Option {
+	return func(o *options) {
+		o.FireChannelBufferSize = size
+		o.OverflowPolicy = OverflowDropOldest
+	}
+}
+
+// WithSynchronous makes Fire send the entries itself and return the delivery error,
+// see HookOptions.Synchronous.
+func WithSynchronous() Option {
+	return func(o *options) {
+		o.Synchronous = true
+	}
+}
+
+// WithContextAwareFire makes Fire stop waiting for an entry once its context is done,
+// see HookOptions.ContextAwareFire.
+func WithContextAwareFire() Option {
+	return func(o *options) {
+		o.ContextAwareFire = true
+	}
+}
+
+// WithLazyConnect defers dialing until the first entry is sent.
+func WithLazyConnect() Option {
+	return func(o *options) {
+		o.LazyConnect = true
+	}
+}
+
+// WithTargetLogger reports the hooks already registered on `logger`, refusing
+// to create a duplicate of one of them when `refuseDuplicate` is set.
+func WithTargetLogger(logger *logrus.Logger, refuseDuplicate bool) Option {
+	return func(o *options) {
+		o.TargetLogger = logger
+		o.RefuseDuplicate = refuseDuplicate
+	}
+}
+
+// WithRedial sets how the connection of a hook created by NewWithWriter is re-established
+// when writing to it fails.
+func WithRedial(redial func() (io.Writer, error)) Option {
+	return func(o *options) {
+		o.Redial = redial
+	}
+}
@@ -0,0 +1,247 @@
+package logrustash
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	lines, _ := acceptLines(t, l)
+
+	hook, err := NewWithOptions("tcp", l.Addr().String(),
+		WithFormatter(&logrus.JSONFormatter{}),
+		WithBufferSize(16),
+		WithKeepAlive(0),
+		WithSentAt("sent_at"),
+	)
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	h := hook.(*Hook)
+	assert.Equal(16, cap(h.logrusEntryFireChannel))
+	assert.True(h.opts.KeepAlive)
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "configured by options", Data: logrus.Fields{}}))
+
+	select {
+	case line := <-lines:
+		assert.Contains(line, `"msg":"configured by options"`)
+		assert.Contains(line, `"sent_at"`)
+	case <-time.After(time.Second):
+		t.Fatal("entry not received")
+	}
+
+	_, err = NewWithOptions("", "")
+	assert.Error(err)
+}
+
+func TestNewWithOptionsOverridesHookOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	hook, err := NewWithOptions("tcp", l.Addr().String(),
+		WithHookOptions(HookOptions{FireChannelBufferSize: 8, RetryBufferSize: 4}),
+		WithBufferSize(32),
+	)
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	h := hook.(*Hook)
+	assert.Equal(32, cap(h.logrusEntryFireChannel))
+	assert.Equal(4, h.opts.RetryBufferSize)
+	assert.IsType(LogstashFormatter{}, h.formatter)
+}
+
+func TestWithTLS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// borrow the certificate of a TLS test server, it is valid for 127.0.0.1
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: ts.TLS.Certificates})
+	require.NoError(err)
+	defer l.Close()
+
+	lines, _ := acceptLines(t, l)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+
+	hook, err := NewWithOptions("tcp", l.Addr().String(),
+		WithFormatter(&logrus.JSONFormatter{}),
+		WithTLS(&tls.Config{RootCAs: roots}),
+	)
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "sent over tls", Data: logrus.Fields{}}))
+
+	select {
+	case line := <-lines:
+		assert.Contains(line, `"msg":"sent over tls"`)
+	case <-time.After(time.Second):
+		t.Fatal("entry not received")
+	}
+
+	// a server whose certificate can not be verified is refused
+	untrusted, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: ts.TLS.Certificates})
+	require.NoError(err)
+	defer untrusted.Close()
+
+	acceptLines(t, untrusted)
+
+	_, err = NewWithOptions("tcp", untrusted.Addr().String(), WithTLS(&tls.Config{}))
+	assert.Error(err)
+}
+
+func TestWithDialFunc(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	lines, _ := acceptLines(t, l)
+
+	var dialed []string
+	dialer := &net.Dialer{LocalAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}}
+
+	hook, err := NewWithOptions("tcp", l.Addr().String(),
+		WithFormatter(&logrus.JSONFormatter{}),
+		WithDialFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = append(dialed, network+"://"+addr)
+			return dialer.DialContext(ctx, network, addr)
+		}),
+	)
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	assert.Equal([]string{"tcp://" + l.Addr().String()}, dialed)
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "dialed by a custom dialer", Data: logrus.Fields{}}))
+
+	select {
+	case line := <-lines:
+		assert.Contains(line, `"msg":"dialed by a custom dialer"`)
+	case <-time.After(time.Second):
+		t.Fatal("entry not received")
+	}
+
+	_, err = NewWithOptions("tcp", l.Addr().String(), WithDialer(&net.Dialer{LocalAddr: &net.UnixAddr{Name: "unusable"}}))
+	assert.Error(err)
+}
+
+func TestNewWithWriter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := &safeBuffer{}
+
+	hook, err := NewWithWriter(buffer, WithFormatter(&logrus.JSONFormatter{}))
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "written to any writer", Data: logrus.Fields{}}))
+	waitForWrite(t, buffer)
+
+	assert.Contains(buffer.String(), `"msg":"written to any writer"`)
+
+	_, err = NewWithWriter(nil)
+	assert.Error(err)
+}
+
+func TestWithDialTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	start := time.Now()
+	_, err := NewWithOptions("tcp", "logstash.invalid:5000",
+		WithDialTimeout(50*time.Millisecond),
+		WithDialFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			// a hung resolver
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}),
+	)
+
+	assert.ErrorIs(err, context.DeadlineExceeded)
+	assert.Less(time.Since(start), time.Second)
+}
+
+func TestWithLevels(t *testing.T) {
+	assert := assert.New(t)
+
+	hook, err := NewWithWriter(&safeBuffer{}, WithMinLevel(logrus.WarnLevel))
+	require.NoError(t, err)
+	defer hook.(*Hook).Close()
+
+	assert.Equal([]logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel}, hook.Levels())
+
+	hook, err = NewWithWriter(&safeBuffer{}, WithLevels(logrus.ErrorLevel, logrus.DebugLevel))
+	require.NoError(t, err)
+	defer hook.(*Hook).Close()
+
+	assert.Equal([]logrus.Level{logrus.ErrorLevel, logrus.DebugLevel}, hook.Levels())
+
+	// only the entries of the hook's levels are fired by logrus
+	buffer := &safeBuffer{}
+	hook, err = NewWithWriter(buffer, WithFormatter(&logrus.JSONFormatter{}), WithMinLevel(logrus.WarnLevel))
+	require.NoError(t, err)
+
+	log := logrus.New()
+	log.Out = &safeBuffer{}
+	log.Hooks.Add(hook)
+	log.Info("kept local")
+	log.Warn("shipped")
+	require.NoError(t, hook.(*Hook).Close())
+
+	assert.NotContains(buffer.String(), "kept local")
+	assert.Contains(buffer.String(), "shipped")
+}
+
+func TestWithFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	buffer := &safeBuffer{}
+	hook, err := NewWithWriter(buffer, WithFormatter(&logrus.JSONFormatter{}), WithFilter(func(e *logrus.Entry) bool {
+		return e.Data["path"] != "/healthz"
+	}))
+	require.NoError(t, err)
+
+	log := logrus.New()
+	log.Out = &safeBuffer{}
+	log.Hooks.Add(hook)
+	log.WithField("path", "/healthz").Info("health check")
+	log.WithField("path", "/orders").Info("order placed")
+	require.NoError(t, hook.(*Hook).Close())
+
+	assert.NotContains(buffer.String(), "health check")
+	assert.Contains(buffer.String(), "order placed")
+
+	stats := hook.(*Hook).Stats()
+	assert.Equal(uint64(1), stats.Enqueued)
+	assert.Zero(stats.Dropped)
+}
@@ -0,0 +1,73 @@
+package logrustash
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// OverflowPolicy is what Fire does with an entry when the queue of entries to be sent is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks Fire until there is room in the queue, it is the default.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the entry being fired.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest queued entry to make room for the entry being fired,
+	// the queue is a ring buffer Fire never blocks on, see WithRingBuffer.
+	OverflowDropOldest
+)
+
+// enqueue queues the entry to be sent according to the overflow policy,
+// the dropped entries are counted in the stats. With HookOptions.QueueDir, the entries
+// which overflow are persisted on disk instead of being dropped.
+func (h *Hook) enqueue(e *logrus.Entry) error {
+	switch h.opts.OverflowPolicy {
+	case OverflowDropNewest:
+		select {
+		case h.logrusEntryFireChannel <- e:
+		default:
+			if !h.spill(e) {
+				h.stats.dropped.Add(1)
+			}
+		}
+
+		return nil
+	case OverflowDropOldest:
+		for {
+			select {
+			case h.logrusEntryFireChannel <- e:
+				return nil
+			default:
+			}
+
+			// the sending goroutine may have taken the oldest entry in the meantime
+			select {
+			case oldest := <-h.logrusEntryFireChannel:
+				if !h.spill(oldest) {
+					h.stats.dropped.Add(1)
+				}
+			default:
+			}
+		}
+	}
+
+	done := h.entryDone(e)
+	if done != nil {
+		// queue the entry if there is room, even if its context is already done
+		select {
+		case h.logrusEntryFireChannel <- e:
+			return nil
+		default:
+		}
+	}
+
+	select {
+	case <-h.ctx.Done():
+		return ErrClosed
+	case <-done:
+		h.stats.dropped.Add(1)
+		return e.Context.Err()
+	case h.logrusEntryFireChannel <- e:
+		return nil
+	}
+}
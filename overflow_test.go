@@ -0,0 +1,102 @@
+package logrustash
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedWriter writes to its buffer once it is released.
+type gatedWriter struct {
+	safeBuffer
+	release chan struct{}
+}
+
+func (w *gatedWriter) Write(d []byte) (int, error) {
+	<-w.release
+	return w.safeBuffer.Write(d)
+}
+
+// fillQueue fires "m0" which blocks the sending goroutine, then as many entries
+// as the queue of the hook can hold and `n` more.
+func fillQueue(t *testing.T, hook *Hook, n int) {
+	t.Helper()
+
+	require.NoError(t, hook.Fire(&logrus.Entry{Message: "m0", Data: logrus.Fields{}}))
+	require.Eventually(t, func() bool { return len(hook.logrusEntryFireChannel) == 0 }, time.Second, time.Millisecond)
+
+	for i := 1; i <= cap(hook.logrusEntryFireChannel)+n; i++ {
+		require.NoError(t, hook.Fire(&logrus.Entry{Message: fmt.Sprintf("m%d", i), Data: logrus.Fields{}}))
+	}
+}
+
+func TestOverflowDropNewest(t *testing.T) {
+	assert := assert.New(t)
+
+	w := &gatedWriter{release: make(chan struct{})}
+	hook, err := NewWithWriter(w,
+		WithFormatter(&logrus.JSONFormatter{DisableTimestamp: true}),
+		WithBufferSize(2),
+		WithOverflowPolicy(OverflowDropNewest),
+	)
+	require.NoError(t, err)
+
+	fillQueue(t, hook.(*Hook), 2)
+	assert.Equal(uint64(2), hook.(*Hook).Stats().Dropped)
+
+	close(w.release)
+	require.NoError(t, hook.(*Hook).Close())
+
+	expected := `{"level":"panic","msg":"m0"}
+{"level":"panic","msg":"m1"}
+{"level":"panic","msg":"m2"}
+`
+	assert.Equal(expected, w.String())
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	assert := assert.New(t)
+
+	w := &gatedWriter{release: make(chan struct{})}
+	hook, err := NewWithWriter(w,
+		WithFormatter(&logrus.JSONFormatter{DisableTimestamp: true}),
+		WithBufferSize(2),
+		WithOverflowPolicy(OverflowDropOldest),
+	)
+	require.NoError(t, err)
+
+	fillQueue(t, hook.(*Hook), 2)
+	assert.Equal(uint64(2), hook.(*Hook).Stats().Dropped)
+
+	close(w.release)
+	require.NoError(t, hook.(*Hook).Close())
+
+	expected := `{"level":"panic","msg":"m0"}
+{"level":"panic","msg":"m3"}
+{"level":"panic","msg":"m4"}
+`
+	assert.Equal(expected, w.String())
+}
+
+func TestRingBuffer(t *testing.T) {
+	w := &gatedWriter{release: make(chan struct{})}
+	hook, err := NewWithWriter(w,
+		WithFormatter(&logrus.JSONFormatter{DisableTimestamp: true}),
+		WithRingBuffer(3),
+	)
+	require.NoError(t, err)
+
+	h := hook.(*Hook)
+	assert.Equal(t, 3, cap(h.logrusEntryFireChannel))
+	assert.Equal(t, OverflowDropOldest, h.opts.OverflowPolicy)
+
+	fillQueue(t, h, 1)
+	assert.Equal(t, uint64(1), h.Stats().Dropped)
+
+	close(w.release)
+	require.NoError(t, h.Close())
+}
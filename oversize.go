@@ -0,0 +1,171 @@
+package logrustash
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OversizePolicy is what is done with the entries larger than HookOptions.MaxMessageBytes.
+type OversizePolicy int
+
+const (
+	// OversizeTruncate truncates the message of the entry, appending TruncationMarker to it,
+	// it is the default. The entry is dropped if it is still too large without its message.
+	OversizeTruncate OversizePolicy = iota
+	// OversizeDrop drops the entry, it is written to HookOptions.DeadLetter if set.
+	OversizeDrop
+	// OversizeSplit splits the message of the entry across as many entries as needed, they have
+	// the fields of the entry and FieldKeySplitID, FieldKeyPart and FieldKeyParts to reassemble them.
+	OversizeSplit
+)
+
+// The fields added to the parts of an entry split by OversizeSplit.
+const (
+	// FieldKeySplitID is the random ID shared by the parts of an entry.
+	FieldKeySplitID = "_split_id"
+	// FieldKeyPart is the number of the part, starting from 1.
+	FieldKeyPart = "_part"
+	// FieldKeyParts is the number of parts of the entry.
+	FieldKeyParts = "_parts"
+)
+
+// ErrMessageTooLarge is reported when an entry is dropped since it is larger than HookOptions.MaxMessageBytes.
+var ErrMessageTooLarge = errors.New("logstash message too large")
+
+// fitMessage returns the formatted entries fitting in MaxMessageBytes the entry `e`, formatted
+// as `data`, is turned into according to the OversizePolicy.
+func (h *Hook) fitMessage(e *logrus.Entry, data []byte) ([][]byte, error) {
+	limit := h.opts.MaxMessageBytes
+	tooLarge := fmt.Errorf("%w: %d bytes, the maximum is %d", ErrMessageTooLarge, len(data), limit)
+
+	// the entries formatted by another logger, see WriteSyncer, can not be truncated or split
+	if _, ok := preformatted(e); ok {
+		return nil, tooLarge
+	}
+
+	switch h.opts.OversizePolicy {
+	case OversizeDrop:
+		return nil, tooLarge
+	case OversizeSplit:
+		parts, err := h.splitMessage(e)
+		if err != nil {
+			return nil, errors.Join(tooLarge, err)
+		}
+
+		return parts, nil
+	}
+
+	// the longest start of the message the entry fits with
+	var truncated []byte
+	var formatErr error
+	longestPrefix(e.Message, func(prefix string) bool {
+		ne := *e
+		ne.Message = prefix + TruncationMarker
+
+		data, err := h.format(&ne)
+		if err != nil {
+			formatErr = err
+			return false
+		}
+		if len(data) > limit {
+			return false
+		}
+
+		truncated = data
+		return true
+	})
+	if formatErr != nil {
+		return nil, formatErr
+	}
+	if truncated == nil {
+		return nil, tooLarge
+	}
+
+	return [][]byte{truncated}, nil
+}
+
+// splitMessage formats the parts of the message of `e` as entries fitting in MaxMessageBytes.
+func (h *Hook) splitMessage(e *logrus.Entry) ([][]byte, error) {
+	limit := h.opts.MaxMessageBytes
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	splitID := hex.EncodeToString(id)
+
+	part := func(message string, i, n int) ([]byte, error) {
+		ne := *e
+		ne.Message = message
+		return h.format(withFields(&ne, h.formatter, logrus.Fields{FieldKeySplitID: splitID, FieldKeyPart: i, FieldKeyParts: n}))
+	}
+
+	// the message is split into the longest chunks fitting, with the part numbers
+	// at their largest, then the parts are formatted with their actual numbers
+	var chunks []string
+	var formatErr error
+	for rest := e.Message; len(rest) > 0; {
+		n := longestPrefix(rest, func(prefix string) bool {
+			data, err := part(prefix, len(e.Message), len(e.Message))
+			if err != nil {
+				formatErr = err
+				return false
+			}
+
+			return len(data) <= limit
+		})
+		if formatErr != nil {
+			return nil, formatErr
+		}
+		if n == 0 {
+			return nil, errors.New("the entry does not fit without its message")
+		}
+
+		chunks = append(chunks, rest[:n])
+		rest = rest[n:]
+	}
+
+	parts := make([][]byte, 0, len(chunks))
+	for i, chunk := range chunks {
+		data, err := part(chunk, i+1, len(chunks))
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, data)
+	}
+
+	return parts, nil
+}
+
+// longestPrefix returns the length of the longest prefix of `s`, cut between two runes,
+// `fits` is true for, it is called with prefixes of increasing and decreasing lengths
+// and must be true up to some length and false above. It returns 0 if `fits` is false for all of them.
+func longestPrefix(s string, fits func(prefix string) bool) int {
+	best := 0
+	for lo, hi := 1, len(s); lo <= hi; {
+		mid := (lo + hi) / 2
+		cut := mid
+		for cut > 0 && cut < len(s) && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+
+		switch {
+		case cut <= best:
+			// there is no other cut up to mid
+			lo = mid + 1
+		case fits(s[:cut]):
+			best = cut
+			lo = mid + 1
+		default:
+			hi = mid - 1
+		}
+	}
+
+	return best
+}
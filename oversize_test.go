@@ -0,0 +1,124 @@
+package logrustash
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// oversizeHook returns a hook writing to `buffer` with MaxMessageBytes set to `max`.
+func oversizeHook(buffer, deadLetter *bytes.Buffer, max int, policy OversizePolicy) *Hook {
+	h := &Hook{
+		writer:    buffer,
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:      HookOptions{MaxMessageBytes: max, OversizePolicy: policy, Diagnostics: io.Discard},
+	}
+	if deadLetter != nil {
+		h.opts.DeadLetter = deadLetter
+	}
+
+	return h
+}
+
+// decodeLines decodes the lines of JSON of `data`.
+func decodeLines(t *testing.T, data []byte) []map[string]interface{} {
+	t.Helper()
+
+	var docs []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		assert.LessOrEqual(t, len(line)+1, 200)
+
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &doc))
+		docs = append(docs, doc)
+	}
+
+	return docs
+}
+
+func TestMaxMessageBytes(t *testing.T) {
+	message := strings.Repeat("héllo <world> ", 20)
+	entry := &logrus.Entry{Message: message, Level: logrus.InfoLevel, Data: logrus.Fields{"app": "test"}}
+
+	t.Run("small entries are untouched", func(t *testing.T) {
+		buffer := &bytes.Buffer{}
+		h := oversizeHook(buffer, nil, 200, OversizeDrop)
+
+		require.NoError(t, h.Fire(&logrus.Entry{Message: "short", Level: logrus.InfoLevel, Data: logrus.Fields{}}))
+		assert.Equal(t, "short", decodeLines(t, buffer.Bytes())[0]["msg"])
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		buffer := &bytes.Buffer{}
+		h := oversizeHook(buffer, nil, 200, OversizeTruncate)
+
+		require.NoError(t, h.Fire(entry))
+
+		docs := decodeLines(t, buffer.Bytes())
+		require.Len(t, docs, 1)
+		assert.Equal(t, "test", docs[0]["app"])
+		assert.True(t, strings.HasSuffix(docs[0]["msg"].(string), TruncationMarker))
+		assert.True(t, strings.HasPrefix(message, strings.TrimSuffix(docs[0]["msg"].(string), TruncationMarker)))
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		buffer, deadLetter := &bytes.Buffer{}, &bytes.Buffer{}
+		h := oversizeHook(buffer, deadLetter, 200, OversizeDrop)
+
+		assert.ErrorIs(t, h.Fire(entry), ErrMessageTooLarge)
+		assert.Empty(t, buffer.Bytes())
+
+		var letter DeadLetter
+		require.NoError(t, json.Unmarshal(deadLetter.Bytes(), &letter))
+		assert.Contains(t, letter.Reason, ErrMessageTooLarge.Error())
+		assert.Contains(t, string(letter.Payload), "héllo")
+	})
+
+	t.Run("split", func(t *testing.T) {
+		buffer := &bytes.Buffer{}
+		h := oversizeHook(buffer, nil, 200, OversizeSplit)
+
+		require.NoError(t, h.Fire(entry))
+
+		docs := decodeLines(t, buffer.Bytes())
+		require.Greater(t, len(docs), 1)
+
+		var reassembled string
+		for i, doc := range docs {
+			assert.Equal(t, "test", doc["app"])
+			assert.Equal(t, docs[0][FieldKeySplitID], doc[FieldKeySplitID])
+			assert.Equal(t, float64(i+1), doc[FieldKeyPart])
+			assert.Equal(t, float64(len(docs)), doc[FieldKeyParts])
+			reassembled += doc["msg"].(string)
+		}
+		assert.Equal(t, message, reassembled)
+	})
+
+	t.Run("too large without the message", func(t *testing.T) {
+		buffer := &bytes.Buffer{}
+		h := oversizeHook(buffer, nil, 200, OversizeTruncate)
+
+		err := h.Fire(&logrus.Entry{Message: "short", Level: logrus.InfoLevel, Data: logrus.Fields{"app": strings.Repeat("a", 200)}})
+		assert.ErrorIs(t, err, ErrMessageTooLarge)
+		assert.Empty(t, buffer.Bytes())
+	})
+}
+
+func TestLongestPrefix(t *testing.T) {
+	upTo := func(n int) func(string) bool {
+		return func(prefix string) bool { return len(prefix) <= n }
+	}
+
+	assert.Equal(t, 3, longestPrefix("abcde", upTo(3)))
+	assert.Equal(t, 5, longestPrefix("abcde", upTo(10)))
+	assert.Equal(t, 0, longestPrefix("abcde", upTo(0)))
+	assert.Equal(t, 1, longestPrefix("aéb", upTo(2)))
+	assert.Equal(t, 2, longestPrefix("éé", upTo(3)))
+	assert.Equal(t, 0, longestPrefix("", upTo(3)))
+}
@@ -0,0 +1,132 @@
+package logrustash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// pingReadWait is the time Ping waits for the connections to report they were closed by Logstash.
+const pingReadWait = 10 * time.Millisecond
+
+// Pinger is implemented by the writers which can check they are able to reach Logstash
+// without sending an entry, e.g. HTTPWriter. Ping probes the other connections by reading from them.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping checks the hook can reach Logstash, for the readiness probes to include the health of the logs:
+// it returns ErrClosed once the hook is closed, ErrNotConnected if it has no connection, or the error
+// probing the connection failed with. The connections are probed with Pinger if the writer implements it,
+// otherwise by reading from them, Logstash never writes to them but a closed connection reports so at once.
+// A hook whose probe failed is reconnected in the background if it can be.
+// A hook balancing the entries is healthy as long as any of its addresses is.
+func (h *Hook) Ping(ctx context.Context) error {
+	if h.balancer != nil {
+		var pingErr error
+		for _, m := range h.balancer.members {
+			err := m.Ping(ctx)
+			if err == nil {
+				return nil
+			}
+			pingErr = errors.Join(pingErr, err)
+		}
+
+		return pingErr
+	}
+
+	h.RLock()
+	w, gen, closed := h.writer, h.generation, h.connsClosed
+	h.RUnlock()
+
+	if closed {
+		return ErrClosed
+	}
+	if w == nil || !h.IsConnected() {
+		return ErrNotConnected
+	}
+
+	// the probe is not interleaved with the writes, which may read acknowledgments
+	h.writeMu.Lock()
+	err := ping(ctx, w)
+	h.writeMu.Unlock()
+	if err == nil {
+		return nil
+	}
+
+	// a hook which can not reconnect keeps writing to the writer, it may recover
+	if h.canReconnect() {
+		h.disconnected(gen, err)
+		h.probe()
+	}
+
+	return err
+}
+
+// ping probes the writer `w`.
+func ping(ctx context.Context, w io.Writer) error {
+	if p, ok := w.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+
+	conn, ok := w.(net.Conn)
+	if !ok {
+		// there is no way to probe the writer
+		return nil
+	}
+
+	deadline := time.Now().Add(pingReadWait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return err
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	_, err := conn.Read(make([]byte, 1))
+	var netErr net.Error
+	if err == nil || (errors.As(err, &netErr) && netErr.Timeout()) {
+		// the connection is still open
+		return ctx.Err()
+	}
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("connection closed by logstash: %w", err)
+	}
+
+	return err
+}
+
+// Ping checks the endpoint answers a HEAD request without a server error.
+func (w *HTTPWriter) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, w.url, nil)
+	if err != nil {
+		return err
+	}
+
+	for k, values := range w.opts.Header {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	if w.opts.Username != "" || w.opts.Password != "" {
+		req.SetBasicAuth(w.opts.Username, w.opts.Password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 500 {
+		return &HTTPError{StatusCode: resp.StatusCode}
+	}
+
+	return nil
+}
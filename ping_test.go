@@ -0,0 +1,86 @@
+package logrustash
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPing(t *testing.T) {
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	_, conns := acceptLines(t, l)
+
+	hook, err := NewMulti("tcp", []string{l.Addr().String()}, &logrus.JSONFormatter{}, HookOptions{
+		Synchronous: true,
+		Backoff:     ConstantBackoff(5 * time.Millisecond),
+	})
+	require.NoError(err)
+	h := hook.(*Hook)
+
+	require.NoError(h.Ping(context.Background()))
+
+	// Logstash closes the connection, the hook reconnects in the background
+	_, conns2 := acceptLines(t, l)
+	require.NoError((<-conns).Close())
+	require.Eventually(func() bool {
+		return h.Ping(context.Background()) != nil
+	}, time.Second, time.Millisecond)
+
+	select {
+	case <-conns2:
+	case <-time.After(time.Second):
+		require.FailNow("expected the hook to reconnect")
+	}
+	require.Eventually(func() bool {
+		return h.Ping(context.Background()) == nil
+	}, time.Second, time.Millisecond)
+
+	require.NoError(h.Close())
+	assert.ErrorIs(t, h.Ping(context.Background()), ErrClosed)
+}
+
+func TestPingNotConnected(t *testing.T) {
+	h := &Hook{formatter: &logrus.JSONFormatter{}}
+	assert.ErrorIs(t, h.Ping(context.Background()), ErrNotConnected)
+
+	// a writer which can not be probed is assumed healthy
+	h = &Hook{writer: bytes.NewBuffer(nil), formatter: &logrus.JSONFormatter{}, connected: true}
+	assert.NoError(t, h.Ping(context.Background()))
+}
+
+func TestHTTPWriterPing(t *testing.T) {
+	status := http.StatusOK
+	var method string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	w, err := NewHTTPWriter(ts.URL, HTTPOptions{})
+	require.NoError(t, err)
+
+	h := &Hook{writer: w, formatter: &logrus.JSONFormatter{}, connected: true}
+	assert.NoError(t, h.Ping(context.Background()))
+	assert.Equal(t, http.MethodHead, method)
+
+	status = http.StatusServiceUnavailable
+	err = h.Ping(context.Background())
+	var httpErr *HTTPError
+	require.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, http.StatusServiceUnavailable, httpErr.StatusCode)
+}
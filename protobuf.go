@@ -0,0 +1,267 @@
+package logrustash
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The numbers of the fields of the LogEvent message, see event.proto.
+const (
+	protoEventTimestamp = 1
+	protoEventMessage   = 2
+	protoEventLevel     = 3
+	protoEventFields    = 4
+
+	// protoMinSchemaField is the lowest number of the fields registered in a ProtobufSchema.
+	protoMinSchemaField = 16
+	protoMaxField       = 1<<29 - 1
+)
+
+// ProtobufType is the type of a field registered in a ProtobufSchema.
+type ProtobufType int
+
+const (
+	// ProtobufString is a string field, the values are formatted with %v.
+	ProtobufString ProtobufType = iota
+	// ProtobufInt64 is an int64 field, the values are integers, durations in nanoseconds or strings holding one.
+	ProtobufInt64
+	// ProtobufDouble is a double field, the values are numbers, durations in seconds or strings holding one.
+	ProtobufDouble
+	// ProtobufBool is a bool field, the values are booleans or strings holding one.
+	ProtobufBool
+)
+
+// ProtobufSchema is the registry of the fields of the entries mapped to typed fields of the LogEvent
+// message, declared in a copy of event.proto. It is safe for concurrent use.
+type ProtobufSchema struct {
+	mu     sync.RWMutex
+	fields map[string]protobufField
+}
+
+// protobufField is a field registered in a ProtobufSchema.
+type protobufField struct {
+	number int
+	typ    ProtobufType
+}
+
+// NewProtobufSchema returns an empty ProtobufSchema, all the fields of the entries being added
+// to the "fields" map of the events.
+func NewProtobufSchema() *ProtobufSchema {
+	return &ProtobufSchema{fields: map[string]protobufField{}}
+}
+
+// Register maps the field `field` of the entries to the field number `number` of type `typ`
+// of the LogEvent message, the numbers starting from 16. The values which can not be converted
+// to `typ` are added to the "fields" map instead.
+func (s *ProtobufSchema) Register(field string, number int, typ ProtobufType) error {
+	if number < protoMinSchemaField || number > protoMaxField || (number >= 19000 && number <= 19999) {
+		return fmt.Errorf("invalid protobuf field number %d for %q", number, field)
+	}
+	if typ < ProtobufString || typ > ProtobufBool {
+		return fmt.Errorf("invalid protobuf type %d for %q", typ, field)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, f := range s.fields {
+		if f.number == number && name != field {
+			return fmt.Errorf("protobuf field number %d already registered for %q", number, name)
+		}
+	}
+	s.fields[field] = protobufField{number: number, typ: typ}
+
+	return nil
+}
+
+// lookup returns the field registered for `field`, if any.
+func (s *ProtobufSchema) lookup(field string) (protobufField, bool) {
+	if s == nil {
+		return protobufField{}, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, ok := s.fields[field]
+	return f, ok
+}
+
+// ProtobufFormatter formats the entries as LogEvent protobuf messages, see event.proto, for the Logstash
+// inputs with the protobuf codec. The messages are not delimited, ProtobufDelimitedFramer prefixes them
+// with their length for the codec's `delimited => true` over TCP.
+type ProtobufFormatter struct {
+	// Schema, if set, maps fields of the entries to typed fields of the LogEvent message.
+	Schema *ProtobufSchema
+	// Fields are added to every event unless given in the entry data.
+	Fields logrus.Fields
+}
+
+// Format formats the entry as a LogEvent message.
+func (f ProtobufFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	data := make(logrus.Fields, len(f.Fields)+len(e.Data))
+	for k, v := range f.Fields {
+		data[k] = v
+	}
+	for k, v := range e.Data {
+		data[k] = v
+	}
+
+	var b []byte
+	if !e.Time.IsZero() {
+		b = protoAppendBytes(b, protoEventTimestamp, []byte(e.Time.Format(time.RFC3339Nano)))
+	}
+	if e.Message != "" {
+		b = protoAppendBytes(b, protoEventMessage, []byte(e.Message))
+	}
+	b = protoAppendBytes(b, protoEventLevel, []byte(e.Level.String()))
+
+	// the fields are sorted for the events to be reproducible
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if field, ok := f.Schema.lookup(k); ok {
+			if typed, ok := protoAppendTyped(b, field, data[k]); ok {
+				b = typed
+				continue
+			}
+		}
+
+		entry := protoAppendBytes(nil, 1, []byte(k))
+		entry = protoAppendBytes(entry, 2, []byte(protobufString(data[k])))
+		b = protoAppendBytes(b, protoEventFields, entry)
+	}
+
+	return b, nil
+}
+
+// ProtobufDelimitedFramer is a Framer prefixing every message formatted by ProtobufFormatter
+// with its length as a varint, as expected by the protobuf codec with `delimited => true`.
+// Unlike the other framers, it does not remove a trailing newline, which may be part of the message.
+func ProtobufDelimitedFramer(data []byte) []byte {
+	framed := binary.AppendUvarint(make([]byte, 0, len(data)+binary.MaxVarintLen32), uint64(len(data)))
+	return append(framed, data...)
+}
+
+// protoAppendTyped appends the value `v` as the typed field `field`, it reports false
+// if `v` can not be converted to the type of the field.
+func protoAppendTyped(b []byte, field protobufField, v interface{}) ([]byte, bool) {
+	switch field.typ {
+	case ProtobufInt64:
+		i, ok := protobufInt(v)
+		if !ok {
+			return b, false
+		}
+		return protoAppendVarint(b, field.number, uint64(i)), true
+	case ProtobufDouble:
+		d, ok := protobufDouble(v)
+		if !ok {
+			return b, false
+		}
+		return protoAppendFixed64(b, field.number, math.Float64bits(d)), true
+	case ProtobufBool:
+		var t bool
+		switch v := v.(type) {
+		case bool:
+			t = v
+		case string:
+			var err error
+			if t, err = strconv.ParseBool(v); err != nil {
+				return b, false
+			}
+		default:
+			return b, false
+		}
+		if !t {
+			return protoAppendVarint(b, field.number, 0), true
+		}
+		return protoAppendVarint(b, field.number, 1), true
+	}
+
+	return protoAppendBytes(b, field.number, []byte(protobufString(v))), true
+}
+
+// protobufString formats the value `v` of a field as a string.
+func protobufString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+
+	return fmt.Sprintf("%v", v)
+}
+
+// protobufInt converts the value `v` of a field to an integer.
+func protobufInt(v interface{}) (int64, bool) {
+	if s, ok := v.(string); ok {
+		i, err := strconv.ParseInt(s, 10, 64)
+		return i, err == nil
+	}
+	if d, ok := v.(time.Duration); ok {
+		return int64(d), true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, false
+		}
+		return int64(f), true
+	}
+
+	return 0, false
+}
+
+// protobufDouble converts the value `v` of a field to a floating-point number.
+func protobufDouble(v interface{}) (float64, bool) {
+	if s, ok := v.(string); ok {
+		f, err := strconv.ParseFloat(s, 64)
+		return f, err == nil
+	}
+	if d, ok := v.(time.Duration); ok {
+		return d.Seconds(), true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+
+	return 0, false
+}
+
+// protoAppendFixed64 appends the 64-bit field `num` of value `v` to `b`.
+func protoAppendFixed64(b []byte, num int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|1)
+	return binary.LittleEndian.AppendUint64(b, v)
+}
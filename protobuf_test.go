@@ -0,0 +1,94 @@
+package logrustash
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// protoMap returns the entries of the map<string, string> field `entries`.
+func protoMap(t *testing.T, entries []interface{}) map[string]string {
+	m := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		kv := protoFields(t, entry.([]byte))
+		m[string(kv[1][0].([]byte))] = string(kv[2][0].([]byte))
+	}
+
+	return m
+}
+
+func TestProtobufFormatter(t *testing.T) {
+	schema := NewProtobufSchema()
+	require.NoError(t, schema.Register("status", 16, ProtobufInt64))
+	require.NoError(t, schema.Register("duration", 17, ProtobufDouble))
+	require.NoError(t, schema.Register("cached", 18, ProtobufBool))
+	require.NoError(t, schema.Register("user", 19, ProtobufString))
+	require.NoError(t, schema.Register("retries", 20, ProtobufInt64))
+
+	f := ProtobufFormatter{Schema: schema, Fields: logrus.Fields{"type": "app"}}
+	b, err := f.Format(&logrus.Entry{
+		Time:    time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		Level:   logrus.ErrorLevel,
+		Message: "request failed",
+		Data: logrus.Fields{
+			"status":   "-503",
+			"duration": 1500 * time.Millisecond,
+			"cached":   true,
+			"user":     42,
+			"retries":  "many",
+			"err":      errors.New("boom"),
+		},
+	})
+	require.NoError(t, err)
+
+	fields := protoFields(t, b)
+	assert.Equal(t, []interface{}{[]byte("2024-01-02T03:04:05.000000006Z")}, fields[1])
+	assert.Equal(t, []interface{}{[]byte("request failed")}, fields[2])
+	assert.Equal(t, []interface{}{[]byte("error")}, fields[3])
+	assert.Equal(t, int64(-503), int64(fields[16][0].(uint64)))
+	assert.Equal(t, 1.5, math.Float64frombits(fields[17][0].(uint64)))
+	assert.Equal(t, []interface{}{uint64(1)}, fields[18])
+	assert.Equal(t, []interface{}{[]byte("42")}, fields[19])
+	assert.Nil(t, fields[20])
+
+	// the fields not registered, or not converted to their type, are strings of the map
+	assert.Equal(t, map[string]string{"type": "app", "err": "boom", "retries": "many"}, protoMap(t, fields[4]))
+}
+
+func TestProtobufFormatterWithoutSchema(t *testing.T) {
+	b, err := ProtobufFormatter{}.Format(&logrus.Entry{Level: logrus.InfoLevel, Data: logrus.Fields{"count": 3}})
+	require.NoError(t, err)
+
+	fields := protoFields(t, b)
+	assert.Nil(t, fields[1])
+	assert.Nil(t, fields[2])
+	assert.Equal(t, map[string]string{"count": "3"}, protoMap(t, fields[4]))
+}
+
+func TestProtobufSchemaRegister(t *testing.T) {
+	schema := NewProtobufSchema()
+	assert.Error(t, schema.Register("status", 4, ProtobufInt64))
+	assert.Error(t, schema.Register("status", 19500, ProtobufInt64))
+	assert.Error(t, schema.Register("status", 16, ProtobufType(42)))
+
+	require.NoError(t, schema.Register("status", 16, ProtobufInt64))
+	assert.Error(t, schema.Register("code", 16, ProtobufInt64))
+	// a field can be registered again
+	assert.NoError(t, schema.Register("status", 16, ProtobufString))
+}
+
+func TestProtobufDelimitedFramer(t *testing.T) {
+	// a message may end with a newline byte, it is kept
+	data := append(make([]byte, 299), '\n')
+
+	framed := ProtobufDelimitedFramer(data)
+	n, size := binary.Uvarint(framed)
+	assert.Equal(t, uint64(300), n)
+	assert.Equal(t, data, framed[size:])
+}
@@ -0,0 +1,96 @@
+package logrustash
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	l := newRateLimiter(10, 2)
+	l.now = func() time.Time { return now }
+	l.last = now
+
+	assert.True(l.allow())
+	assert.True(l.allow())
+	assert.False(l.allow(), "the burst is exhausted")
+
+	now = now.Add(100 * time.Millisecond)
+	assert.True(l.allow(), "a token is refilled every 100ms")
+	assert.False(l.allow())
+
+	now = now.Add(time.Hour)
+	assert.True(l.allow())
+	assert.True(l.allow())
+	assert.False(l.allow(), "the bucket never holds more than the burst")
+}
+
+func TestFireMaxEntriesPerSecond(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := bytes.NewBuffer(nil)
+	h := &Hook{
+		writer:    buffer,
+		formatter: &logrus.JSONFormatter{},
+		opts:      HookOptions{MaxEntriesPerSecond: 10},
+	}
+
+	for i := 0; i < 1000; i++ {
+		require.NoError(h.Fire(&logrus.Entry{Message: "hot path", Level: logrus.ErrorLevel, Data: logrus.Fields{}}))
+	}
+	require.NoError(h.Fire(&logrus.Entry{Message: "crash", Level: logrus.FatalLevel, Data: logrus.Fields{}}))
+
+	written := strings.Count(buffer.String(), "\n")
+	assert.LessOrEqual(written, 12)
+	assert.GreaterOrEqual(written, 11)
+	assert.Contains(buffer.String(), "crash")
+	assert.Equal(uint64(1001-written), h.Stats().Dropped)
+}
+
+func TestFireMaxEntriesBurst(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	h := &Hook{
+		writer:    buffer,
+		formatter: &logrus.JSONFormatter{},
+		opts:      HookOptions{MaxEntriesPerSecond: 1, MaxEntriesBurst: 5},
+	}
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, h.Fire(&logrus.Entry{Message: "burst", Level: logrus.InfoLevel, Data: logrus.Fields{}}))
+	}
+
+	assert.Equal(t, 5, strings.Count(buffer.String(), "\n"))
+	assert.Equal(t, uint64(5), h.Stats().Suppressed)
+}
+
+func TestFireSampleRate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := bytes.NewBuffer(nil)
+	h := &Hook{
+		writer:    buffer,
+		formatter: &logrus.JSONFormatter{},
+		opts:      HookOptions{SampleRate: 0.25},
+	}
+
+	for i := 0; i < 4000; i++ {
+		require.NoError(h.Fire(&logrus.Entry{Message: "sampled", Level: logrus.DebugLevel, Data: logrus.Fields{}}))
+	}
+	require.NoError(h.Fire(&logrus.Entry{Message: "crash", Level: logrus.PanicLevel, Data: logrus.Fields{}}))
+
+	written := strings.Count(buffer.String(), "\n")
+	assert.InDelta(1000, written, 200)
+	assert.Contains(buffer.String(), "crash")
+	assert.Equal(uint64(4001-written), h.Stats().Suppressed)
+	assert.Equal(h.Stats().Suppressed, h.Stats().Dropped)
+}
@@ -0,0 +1,137 @@
+package logrustash
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RedactedValue replaces the values masked by MaskFull.
+const RedactedValue = "[REDACTED]"
+
+// Mask is a masking strategy, it returns the masked form of a sensitive value.
+type Mask func(value string) string
+
+// MaskFull replaces the whole value by RedactedValue.
+func MaskFull(string) string {
+	return RedactedValue
+}
+
+// MaskPartial keeps the first and the last characters of the value, a quarter of it each
+// and 4 at most, replacing the others by '*', e.g. "alic*********.com" for "alice@example.com".
+// The values shorter than 4 characters are masked entirely.
+func MaskPartial(value string) string {
+	runes := []rune(value)
+	keep := min(len(runes)/4, 4)
+
+	masked := make([]rune, len(runes))
+	for i, r := range runes {
+		if i < keep || i >= len(runes)-keep {
+			masked[i] = r
+		} else {
+			masked[i] = '*'
+		}
+	}
+
+	return string(masked)
+}
+
+// MaskHash returns a Mask replacing the value by "sha256:" and the first 16 hex digits of its
+// HMAC-SHA256 keyed with `key`, so that the entries about the same value can be correlated
+// without revealing it. Without a key the hash of common values, e.g. emails, can be guessed.
+func MaskHash(key []byte) Mask {
+	return func(value string) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(value))
+
+		return "sha256:" + hex.EncodeToString(mac.Sum(nil))[:16]
+	}
+}
+
+// RedactRule masks the sensitive values of the entries with Mask.
+// Either Field or Pattern must be set.
+type RedactRule struct {
+	// Field, if set, is the key of the field whose whole value is masked, it is case-insensitive.
+	Field string
+	// Pattern, if set, masks its matches in the message and in the string values of every field.
+	Pattern *regexp.Regexp
+	// Mask is the masking strategy, MaskFull if nil.
+	Mask Mask
+}
+
+// Redactor masks the sensitive values of the entries according to its rules before they
+// are formatted. It is a FieldProcessor as well, to mask the fields of a LogstashFormatter.
+type Redactor struct {
+	fields   map[string]Mask
+	patterns []RedactRule
+}
+
+// NewRedactor returns a Redactor applying `rules`, the field rules are applied before the patterns.
+func NewRedactor(rules ...RedactRule) (*Redactor, error) {
+	r := &Redactor{fields: make(map[string]Mask)}
+	for _, rule := range rules {
+		if rule.Mask == nil {
+			rule.Mask = MaskFull
+		}
+
+		switch {
+		case rule.Field != "":
+			r.fields[strings.ToLower(rule.Field)] = rule.Mask
+		case rule.Pattern != nil:
+			r.patterns = append(r.patterns, rule)
+		default:
+			return nil, errors.New("redact rule without field nor pattern")
+		}
+	}
+
+	return r, nil
+}
+
+// Process masks the sensitive values of `fields`.
+func (r *Redactor) Process(fields logrus.Fields) logrus.Fields {
+	for k, v := range fields {
+		if mask, ok := r.fields[strings.ToLower(k)]; ok {
+			fields[k] = mask(fmt.Sprintf("%v", v))
+			continue
+		}
+
+		switch s := v.(type) {
+		case string:
+			fields[k] = r.redactString(s)
+		case error:
+			if redacted := r.redactString(s.Error()); redacted != s.Error() {
+				fields[k] = redacted
+			}
+		}
+	}
+
+	return fields
+}
+
+// Redact returns a copy of the entry `e` with the sensitive values of its message and data masked.
+func (r *Redactor) Redact(e *logrus.Entry) *logrus.Entry {
+	ne := *e
+	ne.Message = r.redactString(e.Message)
+	ne.Data = make(logrus.Fields, len(e.Data))
+	for k, v := range e.Data {
+		ne.Data[k] = v
+	}
+	ne.Data = r.Process(ne.Data)
+
+	return &ne
+}
+
+// redactString masks the matches of the patterns in `s`.
+func (r *Redactor) redactString(s string) string {
+	for _, rule := range r.patterns {
+		s = rule.Pattern.ReplaceAllStringFunc(s, rule.Mask)
+	}
+
+	return s
+}
@@ -0,0 +1,88 @@
+package logrustash
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var emailPattern = regexp.MustCompile(`[\w.+-]+@[\w-]+\.[\w.]+`)
+
+func TestMasks(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(RedactedValue, MaskFull("secret"))
+	assert.Equal("alic*********.com", MaskPartial("alice@example.com"))
+	assert.Equal("***", MaskPartial("abc"))
+	assert.Equal("t****s", MaskPartial("tokens"))
+
+	hash := MaskHash([]byte("key"))
+	assert.Equal(hash("alice@example.com"), hash("alice@example.com"))
+	assert.NotEqual(hash("alice@example.com"), hash("bob@example.com"))
+	assert.NotEqual(hash("alice@example.com"), MaskHash([]byte("other"))("alice@example.com"))
+	assert.Regexp(`^sha256:[0-9a-f]{16}$`, hash("alice@example.com"))
+}
+
+func TestNewRedactor(t *testing.T) {
+	_, err := NewRedactor(RedactRule{Mask: MaskPartial})
+	assert.Error(t, err)
+}
+
+func TestRedactor(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r, err := NewRedactor(
+		RedactRule{Field: "token"},
+		RedactRule{Field: "card", Mask: MaskPartial},
+		RedactRule{Pattern: emailPattern, Mask: MaskHash(nil)},
+	)
+	require.NoError(err)
+
+	entry := &logrus.Entry{
+		Message: "password reset for alice@example.com",
+		Data: logrus.Fields{
+			"Token": "abcdef",
+			"card":  4111111111111111,
+			"to":    "alice@example.com",
+			"error": errors.New("no mailbox bob@example.com"),
+			"count": 1,
+		},
+	}
+
+	redacted := r.Redact(entry)
+	hash := MaskHash(nil)("alice@example.com")
+
+	assert.Equal("password reset for "+hash, redacted.Message)
+	assert.Equal(RedactedValue, redacted.Data["Token"])
+	assert.Equal("4111********1111", redacted.Data["card"])
+	assert.Equal(hash, redacted.Data["to"])
+	assert.Equal("no mailbox "+MaskHash(nil)("bob@example.com"), redacted.Data["error"])
+	assert.Equal(1, redacted.Data["count"])
+	assert.Equal("abcdef", entry.Data["Token"], "the fired entry is left untouched")
+}
+
+func TestFireRedactor(t *testing.T) {
+	require := require.New(t)
+
+	r, err := NewRedactor(RedactRule{Field: "authorization"}, RedactRule{Pattern: emailPattern})
+	require.NoError(err)
+
+	buffer := bytes.NewBuffer(nil)
+	h := &Hook{
+		writer:    buffer,
+		formatter: DefaultFormatter(logrus.Fields{}),
+		opts:      HookOptions{Redactor: r},
+	}
+
+	require.NoError(h.Fire(&logrus.Entry{Message: "login alice@example.com", Data: logrus.Fields{"authorization": "Bearer abc"}}))
+
+	assert.NotContains(t, buffer.String(), "alice@example.com")
+	assert.NotContains(t, buffer.String(), "Bearer")
+	assert.Contains(t, buffer.String(), "authorization="+RedactedValue)
+}
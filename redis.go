@@ -0,0 +1,334 @@
+package logrustash
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRedisDialTimeout = 10 * time.Second
+	defaultRedisTimeout     = 10 * time.Second
+	defaultRedisPoolSize    = 2
+)
+
+// RedisError is an error reply of Redis, e.g. "WRONGTYPE Operation against a key holding the wrong kind of value".
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// RedisOptions configures the writer returned by NewRedisWriter.
+type RedisOptions struct {
+	// Addr is the address of Redis, e.g. "redis:6379".
+	Addr string
+	// Key is the list the entries are pushed to, or the channel they are published to if Publish is set.
+	Key string
+	// Publish publishes the entries to the channel Key instead of pushing them to the list Key.
+	Publish bool
+	// Username and Password, if set, authenticate the connections, Username requiring Redis 6 ACLs.
+	Username string
+	Password string
+	// DB is the database selected by the connections.
+	DB int
+	// TLS, if set, connects to Redis over TLS.
+	TLS *tls.Config
+	// DialTimeout is the timeout of the connections, 10 seconds by default.
+	DialTimeout time.Duration
+	// PoolSize is the number of idle connections kept for the next writes, 2 by default.
+	PoolSize int
+}
+
+// RedisWriter pushes every write, a single entry or a batch of newline-delimited entries, to a Redis list
+// with a single RPUSH, or publishes the entries to a Redis channel, e.g. read by the Logstash redis input:
+//
+//	input { redis { host => "redis" data_type => "list" key => "logstash" codec => json } }
+//
+// The connections are pooled, a write on a connection closed by Redis is retried once on a new connection.
+// It is meant to be used with NewWithWriter or NewFromConn. It is safe for concurrent use.
+type RedisWriter struct {
+	opts RedisOptions
+
+	mu       sync.Mutex
+	idle     []*redisConn
+	deadline time.Time
+	closed   bool
+}
+
+// redisConn is a connection to Redis.
+type redisConn struct {
+	net.Conn
+
+	r *bufio.Reader
+}
+
+// NewRedisWriter returns a RedisWriter pushing or publishing to `opts.Key`. Redis is connected to on the first write.
+func NewRedisWriter(opts RedisOptions) (*RedisWriter, error) {
+	if opts.Addr == "" {
+		return nil, errors.New("no redis address")
+	}
+	if opts.Key == "" {
+		return nil, errors.New("no redis key")
+	}
+
+	return &RedisWriter{opts: opts}, nil
+}
+
+// Write pushes or publishes the entries of `data`, one per line.
+func (w *RedisWriter) Write(data []byte) (int, error) {
+	var values [][]byte
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			values = append(values, line)
+		}
+	}
+	if len(values) == 0 {
+		return len(data), nil
+	}
+
+	var cmds [][][]byte
+	if w.opts.Publish {
+		for _, v := range values {
+			cmds = append(cmds, [][]byte{[]byte("PUBLISH"), []byte(w.opts.Key), v})
+		}
+	} else {
+		cmds = [][][]byte{append([][]byte{[]byte("RPUSH"), []byte(w.opts.Key)}, values...)}
+	}
+
+	conn, reused, err := w.get()
+	if err != nil {
+		return 0, err
+	}
+
+	err = conn.do(w.writeDeadline(), cmds...)
+	if err != nil && reused && !isRedisError(err) {
+		// the idle connection may have been closed by Redis, e.g. because of its timeout
+		conn.Close()
+		if conn, err = w.dial(); err != nil {
+			return 0, err
+		}
+		err = conn.do(w.writeDeadline(), cmds...)
+	}
+
+	if err != nil && !isRedisError(err) {
+		conn.Close()
+		return 0, err
+	}
+
+	w.put(conn)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// isRedisError reports whether `err` is an error reply, the connection being still usable.
+func isRedisError(err error) bool {
+	var redisErr RedisError
+	return errors.As(err, &redisErr)
+}
+
+// get returns an idle connection, or a new one, and whether it was idle.
+func (w *RedisWriter) get() (*redisConn, bool, error) {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil, false, net.ErrClosed
+	}
+	if n := len(w.idle); n > 0 {
+		conn := w.idle[n-1]
+		w.idle = w.idle[:n-1]
+		w.mu.Unlock()
+		return conn, true, nil
+	}
+	w.mu.Unlock()
+
+	conn, err := w.dial()
+	return conn, false, err
+}
+
+// put keeps the connection for the next writes, or closes it if the pool is full.
+func (w *RedisWriter) put(conn *redisConn) {
+	poolSize := w.opts.PoolSize
+	if poolSize <= 0 {
+		poolSize = defaultRedisPoolSize
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed || len(w.idle) >= poolSize {
+		conn.Close()
+		return
+	}
+
+	w.idle = append(w.idle, conn)
+}
+
+// dial connects to Redis, authenticating and selecting the database if needed.
+func (w *RedisWriter) dial() (*redisConn, error) {
+	dialTimeout := w.opts.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultRedisDialTimeout
+	}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	var conn net.Conn
+	var err error
+	if w.opts.TLS != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", w.opts.Addr, w.opts.TLS)
+	} else {
+		conn, err = dialer.Dial("tcp", w.opts.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &redisConn{Conn: conn, r: bufio.NewReader(conn)}
+
+	var cmds [][][]byte
+	switch {
+	case w.opts.Username != "":
+		cmds = append(cmds, [][]byte{[]byte("AUTH"), []byte(w.opts.Username), []byte(w.opts.Password)})
+	case w.opts.Password != "":
+		cmds = append(cmds, [][]byte{[]byte("AUTH"), []byte(w.opts.Password)})
+	}
+	if w.opts.DB != 0 {
+		cmds = append(cmds, [][]byte{[]byte("SELECT"), []byte(strconv.Itoa(w.opts.DB))})
+	}
+
+	if len(cmds) > 0 {
+		if err := c.do(time.Now().Add(dialTimeout), cmds...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to set up the redis connection: %w", err)
+		}
+	}
+
+	return c, nil
+}
+
+// writeDeadline returns the time the write must be done by.
+func (w *RedisWriter) writeDeadline() time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.deadline.IsZero() {
+		return time.Now().Add(defaultRedisTimeout)
+	}
+
+	return w.deadline
+}
+
+// SetWriteDeadline sets the time the writes must be done by, see HookOptions.WriteTimeout.
+func (w *RedisWriter) SetWriteDeadline(t time.Time) error {
+	w.mu.Lock()
+	w.deadline = t
+	w.mu.Unlock()
+
+	return nil
+}
+
+// Close closes the idle connections, the connections in use are closed once their write is done.
+func (w *RedisWriter) Close() error {
+	w.mu.Lock()
+	idle := w.idle
+	w.idle = nil
+	w.closed = true
+	w.mu.Unlock()
+
+	for _, conn := range idle {
+		conn.Close()
+	}
+
+	return nil
+}
+
+// do sends the commands at once and reads their replies, returning the first error reply as a RedisError.
+func (c *redisConn) do(deadline time.Time, cmds ...[][]byte) error {
+	if err := c.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	var req []byte
+	for _, args := range cmds {
+		req = append(req, '*')
+		req = strconv.AppendInt(req, int64(len(args)), 10)
+		req = append(req, "\r\n"...)
+		for _, arg := range args {
+			req = append(req, '$')
+			req = strconv.AppendInt(req, int64(len(arg)), 10)
+			req = append(req, "\r\n"...)
+			req = append(req, arg...)
+			req = append(req, "\r\n"...)
+		}
+	}
+
+	if _, err := c.Write(req); err != nil {
+		return err
+	}
+
+	var replyErr error
+	for range cmds {
+		if err := c.readReply(); err != nil {
+			if !isRedisError(err) {
+				return err
+			}
+			if replyErr == nil {
+				replyErr = err
+			}
+		}
+	}
+
+	return replyErr
+}
+
+// readReply reads and discards a reply, returning a RedisError if it is an error reply.
+func (c *redisConn) readReply() error {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return fmt.Errorf("invalid redis reply %q", line)
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return RedisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("invalid redis reply %q", line)
+		}
+		if n < 0 {
+			return nil
+		}
+		_, err = io.CopyN(io.Discard, c.r, int64(n)+2)
+		return err
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("invalid redis reply %q", line)
+		}
+		for i := 0; i < n; i++ {
+			if err := c.readReply(); err != nil && !isRedisError(err) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("invalid redis reply %q", line)
+}
@@ -0,0 +1,219 @@
+package logrustash
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis records the commands it receives, answering them with `reply`.
+type fakeRedis struct {
+	l     net.Listener
+	reply func(cmd []string) string
+
+	mu          sync.Mutex
+	cmds        [][]string
+	connections int
+	// closeAfter, if positive, is the number of commands after which the connections are closed
+	closeAfter int
+}
+
+func newFakeRedis(t *testing.T, reply func(cmd []string) string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	r := &fakeRedis{l: l, reply: reply}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			r.mu.Lock()
+			r.connections++
+			r.mu.Unlock()
+
+			go r.serve(conn)
+		}
+	}()
+
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+
+	br := bufio.NewReader(conn)
+	for served := 0; ; served++ {
+		r.mu.Lock()
+		closeAfter := r.closeAfter
+		r.mu.Unlock()
+		if closeAfter > 0 && served == closeAfter {
+			return
+		}
+
+		cmd, err := readRedisCommand(br)
+		if err != nil {
+			return
+		}
+
+		r.mu.Lock()
+		r.cmds = append(r.cmds, cmd)
+		r.mu.Unlock()
+
+		if _, err := io.WriteString(conn, r.reply(cmd)); err != nil {
+			return
+		}
+	}
+}
+
+func (r *fakeRedis) commands() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([][]string(nil), r.cmds...)
+}
+
+func (r *fakeRedis) connectionCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.connections
+}
+
+func readRedisCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	cmd := make([]string, n)
+	for i := range cmd {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		cmd[i] = string(arg[:size])
+	}
+
+	return cmd, nil
+}
+
+func okReply([]string) string { return "+OK\r\n" }
+
+func TestRedisWriter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r := newFakeRedis(t, okReply)
+
+	w, err := NewRedisWriter(RedisOptions{Addr: r.l.Addr().String(), Key: "logstash", Password: "secret", DB: 2})
+	require.NoError(err)
+
+	hook, err := NewWithWriter(w, WithFormatter(&logrus.JSONFormatter{}), WithSynchronous())
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "pushed", Data: logrus.Fields{}}))
+
+	cmds := r.commands()
+	require.Len(cmds, 3)
+	assert.Equal([]string{"AUTH", "secret"}, cmds[0])
+	assert.Equal([]string{"SELECT", "2"}, cmds[1])
+	assert.Equal("RPUSH", cmds[2][0])
+	assert.Equal("logstash", cmds[2][1])
+	assert.Contains(cmds[2][2], `"msg":"pushed"`)
+	assert.NotContains(cmds[2][2], "\n")
+
+	// the connection is re-used
+	require.NoError(hook.Fire(&logrus.Entry{Message: "pushed again", Data: logrus.Fields{}}))
+	assert.Len(r.commands(), 4)
+	assert.Equal(1, r.connectionCount())
+}
+
+func TestRedisWriterBatch(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r := newFakeRedis(t, func([]string) string { return ":1\r\n" })
+
+	w, err := NewRedisWriter(RedisOptions{Addr: r.l.Addr().String(), Key: "logstash"})
+	require.NoError(err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("{\"n\":1}\n{\"n\":2}\n"))
+	require.NoError(err)
+	assert.Equal([][]string{{"RPUSH", "logstash", `{"n":1}`, `{"n":2}`}}, r.commands())
+
+	w.opts.Publish = true
+	_, err = w.Write([]byte("{\"n\":3}\n{\"n\":4}\n"))
+	require.NoError(err)
+	assert.Equal([][]string{{"PUBLISH", "logstash", `{"n":3}`}, {"PUBLISH", "logstash", `{"n":4}`}}, r.commands()[1:])
+}
+
+func TestRedisWriterReconnects(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r := newFakeRedis(t, okReply)
+	r.mu.Lock()
+	r.closeAfter = 1
+	r.mu.Unlock()
+
+	w, err := NewRedisWriter(RedisOptions{Addr: r.l.Addr().String(), Key: "logstash"})
+	require.NoError(err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("first\n"))
+	require.NoError(err)
+
+	// wait for the idle connection to be closed by the server
+	time.Sleep(50 * time.Millisecond)
+
+	_, err = w.Write([]byte("second\n"))
+	require.NoError(err)
+
+	assert.Equal([][]string{{"RPUSH", "logstash", "first"}, {"RPUSH", "logstash", "second"}}, r.commands())
+	assert.Equal(2, r.connectionCount())
+}
+
+func TestRedisWriterErrorReply(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r := newFakeRedis(t, func([]string) string {
+		return "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+	})
+
+	w, err := NewRedisWriter(RedisOptions{Addr: r.l.Addr().String(), Key: "logstash"})
+	require.NoError(err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("entry\n"))
+	assert.Equal(RedisError("WRONGTYPE Operation against a key holding the wrong kind of value"), err)
+
+	// the connection is still usable after an error reply
+	_, err = w.Write([]byte("entry\n"))
+	assert.Error(err)
+	assert.Equal(1, r.connectionCount())
+
+	_, err = NewRedisWriter(RedisOptions{Key: "logstash"})
+	assert.Error(err)
+}
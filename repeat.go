@@ -0,0 +1,167 @@
+package logrustash
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FieldKeyRepeated is the field holding the number of repeats suppressed by HookOptions.SuppressRepeats.
+const FieldKeyRepeated = "repeated"
+
+// repeats tracks the consecutive repeats of an entry.
+type repeats struct {
+	mu    sync.Mutex
+	key   string
+	count int
+	last  *logrus.Entry
+}
+
+// repeatKey returns the key identifying identical entries: the same level, message and fields.
+func repeatKey(e *logrus.Entry) string {
+	keys := make([]string, 0, len(e.Data))
+	for k := range e.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\x00%s", e.Level, e.Message)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\x00%s=%v", k, e.Data[k])
+	}
+
+	return b.String()
+}
+
+// suppressRepeat reports whether the entry repeats the previous one and must be suppressed.
+// When the entry differs from the previous one, the summary of the previous repeats
+// is returned, if there were any.
+func (h *Hook) suppressRepeat(e *logrus.Entry) (summary *logrus.Entry, suppressed bool) {
+	key := repeatKey(e)
+
+	h.repeats.mu.Lock()
+	defer h.repeats.mu.Unlock()
+
+	if key == h.repeats.key {
+		h.repeats.count++
+		// logrus re-uses the entry once the hooks are fired
+		h.repeats.last = cloneEntry(e)
+		return nil, true
+	}
+
+	summary = h.repeatSummaryLocked()
+	h.repeats.key = key
+	return summary, false
+}
+
+// repeatSummaryLocked returns the last repeated entry with the number of repeats
+// in the "repeated" field and resets the count, h.repeats must be locked.
+// It returns nil if there were no repeats.
+func (h *Hook) repeatSummaryLocked() *logrus.Entry {
+	if h.repeats.count == 0 {
+		return nil
+	}
+
+	summary := withFields(h.repeats.last, h.formatter, logrus.Fields{FieldKeyRepeated: h.repeats.count})
+	h.repeats.count = 0
+	h.repeats.last = nil
+
+	return summary
+}
+
+// flushRepeats sends the summary of the repeats suppressed so far, if any.
+func (h *Hook) flushRepeats() {
+	h.repeats.mu.Lock()
+	summary := h.repeatSummaryLocked()
+	h.repeats.mu.Unlock()
+
+	if summary == nil {
+		return
+	}
+
+	if err := h.deliver(summary); err != nil {
+		h.stats.dropped.Add(1)
+		h.reportError(err, summary)
+	}
+}
+
+// FieldKeyRepeatCount is the field holding the number of occurrences of an entry collapsed by HookOptions.DedupWindow.
+const FieldKeyRepeatCount = "repeat_count"
+
+// dedup holds back the last entry while identical entries are fired within HookOptions.DedupWindow.
+type dedup struct {
+	mu    sync.Mutex
+	key   string
+	held  *logrus.Entry
+	count int
+	since time.Time
+}
+
+// dedupEntry holds back the entry until the window is over or a different entry is fired.
+// It returns the entry previously held back, annotated with its number of occurrences,
+// when it has to be sent now, nil otherwise.
+func (h *Hook) dedupEntry(e *logrus.Entry) *logrus.Entry {
+	key := repeatKey(e)
+	now := time.Now()
+
+	h.dedup.mu.Lock()
+	defer h.dedup.mu.Unlock()
+
+	if h.dedup.held != nil && key == h.dedup.key && now.Sub(h.dedup.since) < h.opts.DedupWindow {
+		h.dedup.count++
+		return nil
+	}
+
+	held := h.dedupReleaseLocked()
+	h.dedup.key = key
+	// logrus re-uses the entry once the hooks are fired
+	h.dedup.held = cloneEntry(e)
+	h.dedup.count = 1
+	h.dedup.since = now
+
+	return held
+}
+
+// dedupReleaseLocked returns the entry held back, with the number of occurrences in the
+// "repeat_count" field if it was repeated, and forgets it, h.dedup must be locked.
+// It returns nil if no entry is held back.
+func (h *Hook) dedupReleaseLocked() *logrus.Entry {
+	held := h.dedup.held
+	if held == nil {
+		return nil
+	}
+
+	if h.dedup.count > 1 {
+		held = withFields(held, h.formatter, logrus.Fields{FieldKeyRepeatCount: h.dedup.count})
+	}
+	h.dedup.key = ""
+	h.dedup.held = nil
+	h.dedup.count = 0
+
+	return held
+}
+
+// flushDedup sends the entry held back by the dedup window once the window is over,
+// or right away if `force` is set.
+func (h *Hook) flushDedup(force bool) {
+	h.dedup.mu.Lock()
+	var held *logrus.Entry
+	if force || time.Since(h.dedup.since) >= h.opts.DedupWindow {
+		held = h.dedupReleaseLocked()
+	}
+	h.dedup.mu.Unlock()
+
+	if held == nil {
+		return
+	}
+
+	if err := h.deliver(held); err != nil {
+		h.stats.dropped.Add(1)
+		h.reportError(err, held)
+	}
+}
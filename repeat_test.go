@@ -0,0 +1,124 @@
+package logrustash
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFireSuppressRepeats(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := bytes.NewBuffer(nil)
+	h := &Hook{
+		writer:    buffer,
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:      HookOptions{SuppressRepeats: true},
+	}
+
+	for _, msg := range []string{"retrying", "retrying", "retrying", "giving up", "retrying"} {
+		require.NoError(h.Fire(&logrus.Entry{Message: msg, Level: logrus.ErrorLevel, Data: logrus.Fields{"attempt": "n"}}))
+	}
+
+	expected := `{"attempt":"n","level":"error","msg":"retrying"}
+{"attempt":"n","level":"error","msg":"retrying","repeated":2}
+{"attempt":"n","level":"error","msg":"giving up"}
+{"attempt":"n","level":"error","msg":"retrying"}
+`
+	assert.Equal(expected, buffer.String())
+}
+
+func TestFireSuppressRepeatsDifferentFields(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	h := &Hook{
+		writer:    buffer,
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:      HookOptions{SuppressRepeats: true},
+	}
+
+	require.NoError(t, h.Fire(&logrus.Entry{Message: "retrying", Data: logrus.Fields{"attempt": 1}}))
+	require.NoError(t, h.Fire(&logrus.Entry{Message: "retrying", Data: logrus.Fields{"attempt": 2}}))
+
+	assert.Equal(t, 2, bytes.Count(buffer.Bytes(), []byte("\n")))
+}
+
+func TestRepeatSummaryInterval(t *testing.T) {
+	require := require.New(t)
+
+	buffer := &safeBuffer{}
+	hook, err := NewFromConn(buffer, DefaultFormatter(logrus.Fields{}), HookOptions{
+		SuppressRepeats:       true,
+		RepeatSummaryInterval: 10 * time.Millisecond,
+	})
+	require.NoError(err)
+
+	for i := 0; i < 4; i++ {
+		require.NoError(hook.Fire(&logrus.Entry{Message: "retrying", Data: logrus.Fields{}}))
+	}
+
+	require.Eventually(func() bool {
+		return bytes.Contains([]byte(buffer.String()), []byte(`"repeated":3`))
+	}, time.Second, time.Millisecond)
+}
+
+func TestFireDedupWindow(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := bytes.NewBuffer(nil)
+	h := &Hook{
+		writer:    buffer,
+		formatter: &logrus.JSONFormatter{DisableTimestamp: true},
+		opts:      HookOptions{DedupWindow: time.Minute},
+	}
+
+	for _, msg := range []string{"retrying", "retrying", "retrying", "giving up", "retrying"} {
+		require.NoError(h.Fire(&logrus.Entry{Message: msg, Level: logrus.ErrorLevel, Data: logrus.Fields{"attempt": "n"}}))
+	}
+
+	// the last entry is held back until the window is over
+	expected := `{"attempt":"n","level":"error","msg":"retrying","repeat_count":3}
+{"attempt":"n","level":"error","msg":"giving up"}
+`
+	assert.Equal(expected, buffer.String())
+
+	h.flushDedup(true)
+	assert.Contains(buffer.String(), `{"attempt":"n","level":"error","msg":"retrying"}`)
+}
+
+func TestDedupWindow(t *testing.T) {
+	require := require.New(t)
+
+	buffer := &safeBuffer{}
+	hook, err := NewWithWriter(buffer, WithFormatter(&logrus.JSONFormatter{}), WithDedupWindow(20*time.Millisecond))
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	for i := 0; i < 1000; i++ {
+		require.NoError(hook.Fire(&logrus.Entry{Message: "retrying", Data: logrus.Fields{}}))
+	}
+
+	// the entries are sent once the window is over, without waiting for a different entry
+	require.Eventually(func() bool {
+		return bytes.Contains([]byte(buffer.String()), []byte(`"msg":"retrying"`))
+	}, time.Second, time.Millisecond)
+	require.Less(bytes.Count([]byte(buffer.String()), []byte("\n")), 1000)
+}
+
+func TestDedupWindowFlushedOnClose(t *testing.T) {
+	buffer := &safeBuffer{}
+	hook, err := NewWithWriter(buffer, WithFormatter(&logrus.JSONFormatter{}), WithDedupWindow(time.Hour))
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, hook.Fire(&logrus.Entry{Message: "retrying", Data: logrus.Fields{}}))
+	}
+	require.NoError(t, hook.(*Hook).Close())
+
+	assert.Contains(t, buffer.String(), `"repeat_count":3`)
+}
@@ -0,0 +1,142 @@
+package logrustash
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// defaultResolveTimeout is the time a lookup of ResolveInterval may take when DialTimeout is not set.
+const defaultResolveTimeout = 5 * time.Second
+
+// lookupHost resolves `host` with HookOptions.LookupHost, or the default resolver.
+func (h *Hook) lookupHost(ctx context.Context, host string) ([]string, error) {
+	if h.opts.LookupHost != nil {
+		return h.opts.LookupHost(ctx, host)
+	}
+
+	return net.DefaultResolver.LookupHost(ctx, host)
+}
+
+// dialResolved returns a dial function resolving the host of the address with HookOptions.LookupHost
+// on every call, then dialing its addresses in turn with `dial` until one succeeds.
+func (h *Hook) dialResolved(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+
+		ips, err := h.lookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) == 0 {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+
+		var dialErr error
+		for _, ip := range ips {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			dialErr = errors.Join(dialErr, err)
+		}
+
+		return nil, dialErr
+	}
+}
+
+// startResolve calls checkResolved in a goroutine, unless a check is already in progress.
+func (h *Hook) startResolve() {
+	if !h.resolving.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer h.resolving.Store(false)
+		h.checkResolved()
+	}()
+}
+
+// checkResolved re-resolves the host of the address in use, and reconnects if the connection
+// is established with an IP address the host no longer resolves to, e.g. the Logstash pod behind
+// a Kubernetes Service was replaced. The connection is kept if the lookup fails.
+func (h *Hook) checkResolved() {
+	h.RLock()
+	w, gen, index := h.writer, h.generation, h.addrIndex
+	h.RUnlock()
+	if len(h.addrs) == 0 {
+		return
+	}
+
+	conn, ok := w.(interface{ RemoteAddr() net.Addr })
+	if !ok {
+		return
+	}
+
+	addr := h.addrs[index]
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return
+	}
+
+	timeout := h.opts.DialTimeout
+	if timeout <= 0 {
+		timeout = defaultResolveTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ips, err := h.lookupHost(ctx, host)
+	if err != nil {
+		h.diagnosef("failed to resolve logstash at %s, error: %v\n", addr, err)
+		return
+	}
+
+	remote := remoteIP(conn.RemoteAddr())
+	if remote == nil || lo.ContainsBy(ips, func(ip string) bool { return remote.Equal(net.ParseIP(ip)) }) {
+		return
+	}
+
+	h.diagnosef("logstash at %s no longer resolves to %s, reconnecting...\n", addr, remote)
+	if !h.redial(index, gen) {
+		// the connection is replaced by the next send failing
+		h.diagnosef("failed to reconnect to logstash at %s\n", addr)
+	}
+}
+
+// resolveIfDue starts re-resolving if ResolveInterval elapsed since the last check,
+// for the synchronous hooks which have no goroutine to check periodically.
+func (h *Hook) resolveIfDue() {
+	if h.opts.ResolveInterval <= 0 || len(h.addrs) == 0 {
+		return
+	}
+
+	if due(&h.nextResolve, h.opts.ResolveInterval) {
+		h.startResolve()
+	}
+}
+
+// remoteIP returns the IP address of a remote address, nil if it has none.
+func remoteIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	case nil:
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+
+	return net.ParseIP(host)
+}
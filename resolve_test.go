@@ -0,0 +1,161 @@
+package logrustash
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeResolver resolves every host to the IP addresses it is given.
+type fakeResolver struct {
+	mu      sync.Mutex
+	ips     []string
+	lookups int
+}
+
+func (r *fakeResolver) set(ips ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ips = ips
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lookups++
+	return append([]string(nil), r.ips...), nil
+}
+
+func TestResolveInterval(t *testing.T) {
+	require := require.New(t)
+
+	l1, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l1.Close()
+
+	port := strconv.Itoa(l1.Addr().(*net.TCPAddr).Port)
+	l2, err := net.Listen("tcp", net.JoinHostPort("127.0.0.2", port))
+	if err != nil {
+		t.Skipf("127.0.0.2 is not available: %v", err)
+	}
+	defer l2.Close()
+
+	lines1, _ := acceptLines(t, l1)
+	lines2, _ := acceptLines(t, l2)
+
+	resolver := &fakeResolver{ips: []string{"127.0.0.1"}}
+
+	log := logrus.New()
+	log.Out = io.Discard
+
+	hook, err := NewWithOptions("tcp", net.JoinHostPort("logstash.test", port),
+		WithLookupHost(resolver.LookupHost),
+		WithResolveInterval(10*time.Millisecond),
+		WithFormatter(&logrus.JSONFormatter{}),
+	)
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+	log.Hooks.Add(hook)
+
+	log.Info("first")
+	select {
+	case line := <-lines1:
+		assert.Contains(t, line, "first")
+	case <-time.After(time.Second):
+		require.FailNow("expected the first entry on the first listener")
+	}
+
+	// the service moved to another IP address, the first one still accepting connections
+	resolver.set("127.0.0.2")
+
+	require.Eventually(func() bool {
+		log.Info("second")
+
+		select {
+		case line := <-lines2:
+			return assert.Contains(t, line, "second")
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestLookupHostOnReconnect(t *testing.T) {
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	lines, conns := acceptLines(t, l)
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+
+	resolver := &fakeResolver{ips: []string{"127.0.0.1"}}
+
+	log := logrus.New()
+	log.Out = io.Discard
+
+	hook, err := NewWithOptions("tcp", net.JoinHostPort("logstash.test", port),
+		WithLookupHost(resolver.LookupHost),
+		WithBackoff(ConstantBackoff(time.Millisecond)),
+		WithSynchronous(),
+		WithFormatter(&logrus.JSONFormatter{}),
+	)
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+	log.Hooks.Add(hook)
+
+	log.Info("first")
+	assert.Contains(t, <-lines, "first")
+
+	(<-conns).Close()
+	lines, _ = acceptLines(t, l)
+
+	require.Eventually(func() bool {
+		log.Info("second")
+
+		select {
+		case line := <-lines:
+			return assert.Contains(t, line, "second")
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, time.Millisecond)
+
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+	assert.GreaterOrEqual(t, resolver.lookups, 2)
+}
+
+func TestDialResolvedTriesEveryAddress(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	// an unused port on another IP address
+	dead, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("127.0.0.2 is not available: %v", err)
+	}
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	dead.Close()
+
+	resolver := &fakeResolver{ips: []string{"127.0.0.2", "127.0.0.1"}}
+	h := &Hook{protocol: "tcp", opts: HookOptions{LookupHost: resolver.LookupHost}}
+
+	conn, err := h.dial(net.JoinHostPort("logstash.test", port))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	assert.Equal(t, l.Addr().String(), conn.RemoteAddr().String())
+}
@@ -0,0 +1,14 @@
+package logrustash
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// RouteByLevel returns a HookOptions.Route selecting the endpoint of the entries by their level,
+// e.g. map[logrus.Level]string{logrus.ErrorLevel: "priority"}, the entries of the levels
+// missing from `names` are sent to the hook's own address.
+func RouteByLevel(names map[logrus.Level]string) func(*logrus.Entry) string {
+	return func(e *logrus.Entry) string {
+		return names[e.Level]
+	}
+}
@@ -0,0 +1,66 @@
+package logrustash
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteByLevel(t *testing.T) {
+	route := RouteByLevel(map[logrus.Level]string{logrus.ErrorLevel: "priority"})
+
+	assert.Equal(t, "priority", route(&logrus.Entry{Level: logrus.ErrorLevel}))
+	assert.Empty(t, route(&logrus.Entry{Level: logrus.InfoLevel}))
+}
+
+func TestWithLevelRoutes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	bulkListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer bulkListener.Close()
+
+	priorityListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer priorityListener.Close()
+
+	bulkLines, _ := acceptLines(t, bulkListener)
+	priorityLines, _ := acceptLines(t, priorityListener)
+
+	hook, err := NewWithOptions("tcp", bulkListener.Addr().String(),
+		WithFormatter(&logrus.JSONFormatter{}),
+		WithLevelRoutes(map[logrus.Level]string{
+			logrus.FatalLevel: priorityListener.Addr().String(),
+			logrus.ErrorLevel: priorityListener.Addr().String(),
+		}),
+	)
+	require.NoError(err)
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "request served", Level: logrus.InfoLevel, Data: logrus.Fields{}}))
+	require.NoError(hook.Fire(&logrus.Entry{Message: "request failed", Level: logrus.ErrorLevel, Data: logrus.Fields{}}))
+
+	// the entries queued for the routes are sent on close
+	require.NoError(hook.(*Hook).Close())
+
+	for _, expected := range []struct {
+		lines <-chan string
+		msg   string
+	}{
+		{bulkLines, "request served"},
+		{priorityLines, "request failed"},
+	} {
+		select {
+		case line := <-expected.lines:
+			assert.Contains(line, expected.msg)
+		case <-time.After(time.Second):
+			t.Fatalf("%q not received", expected.msg)
+		}
+	}
+
+	assert.Equal(uint64(2), hook.(*Hook).Stats().Sent)
+}
@@ -0,0 +1,134 @@
+//go:build linux
+
+package logrustash
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// dialSCTP connects to `addr` over a one-to-one SCTP association, every write being sent as an SCTP message.
+// The network is "sctp", "sctp4" or "sctp6".
+func dialSCTP(ctx context.Context, network, addr string) (net.Conn, error) {
+	ip, port, err := resolveSCTPAddr(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	family := syscall.AF_INET6
+	var sa syscall.Sockaddr
+	if ip4 := ip.To4(); ip4 != nil {
+		family = syscall.AF_INET
+		sa4 := &syscall.SockaddrInet4{Port: port}
+		copy(sa4.Addr[:], ip4)
+		sa = sa4
+	} else {
+		sa6 := &syscall.SockaddrInet6{Port: port}
+		copy(sa6.Addr[:], ip.To16())
+		sa = sa6
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, syscall.IPPROTO_SCTP)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: os.NewSyscallError("socket", err)}
+	}
+
+	if err := syscall.Connect(fd, sa); err != nil && err != syscall.EINPROGRESS {
+		syscall.Close(fd)
+		return nil, &net.OpError{Op: "dial", Net: network, Err: os.NewSyscallError("connect", err)}
+	}
+
+	// the connection is established asynchronously, once the socket is writable
+	f := os.NewFile(uintptr(fd), "sctp")
+	conn, err := net.FileConn(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := waitSCTPConnect(ctx, conn); err != nil {
+		conn.Close()
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+
+	return conn, nil
+}
+
+// resolveSCTPAddr returns the IP address, of the family of `network`, and the port of `addr`.
+func resolveSCTPAddr(ctx context.Context, network, addr string) (net.IP, int, error) {
+	host, service, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	port, err := strconv.Atoi(service)
+	if err != nil {
+		if port, err = net.DefaultResolver.LookupPort(ctx, "tcp", service); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, ip := range ips {
+		switch {
+		case network == "sctp4" && ip.IP.To4() == nil:
+		case network == "sctp6" && ip.IP.To4() != nil:
+		default:
+			return ip.IP, port, nil
+		}
+	}
+
+	return nil, 0, fmt.Errorf("no %s address for %s", network, host)
+}
+
+// waitSCTPConnect waits for the asynchronous connection of `conn` to be established or to fail.
+func waitSCTPConnect(ctx context.Context, conn net.Conn) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+		defer conn.SetWriteDeadline(time.Time{})
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetWriteDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	rc, err := conn.(syscall.Conn).SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var connErr error
+	err = rc.Write(func(fd uintptr) bool {
+		errno, err := syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_ERROR)
+		switch {
+		case err != nil:
+			connErr = os.NewSyscallError("getsockopt", err)
+		case errno != 0:
+			connErr = os.NewSyscallError("connect", syscall.Errno(errno))
+		default:
+			if _, err := syscall.Getpeername(int(fd)); err == syscall.ENOTCONN {
+				// still connecting
+				return false
+			}
+		}
+
+		return true
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	return connErr
+}
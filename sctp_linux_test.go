@@ -0,0 +1,77 @@
+//go:build linux
+
+package logrustash
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listenSCTP listens on a one-to-one SCTP socket of the loopback, skipping the test if the kernel
+// does not support SCTP, and returns its port and the messages it receives.
+func listenSCTP(t *testing.T) (int, <-chan string) {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, syscall.IPPROTO_SCTP)
+	if errors.Is(err, syscall.EPROTONOSUPPORT) || errors.Is(err, syscall.ESOCKTNOSUPPORT) {
+		t.Skip("sctp is not supported by the kernel")
+	}
+	require.NoError(t, err)
+
+	l := os.NewFile(uintptr(fd), "sctp listener")
+	t.Cleanup(func() { l.Close() })
+
+	require.NoError(t, syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}))
+	require.NoError(t, syscall.Listen(fd, 1))
+
+	sa, err := syscall.Getsockname(fd)
+	require.NoError(t, err)
+
+	msgs := make(chan string, 16)
+	go func() {
+		conn, _, err := syscall.Accept(fd)
+		if err != nil {
+			return
+		}
+		defer syscall.Close(conn)
+
+		buf := make([]byte, 64<<10)
+		for {
+			n, err := syscall.Read(conn, buf)
+			if err != nil || n == 0 {
+				return
+			}
+			msgs <- string(buf[:n])
+		}
+	}()
+
+	return sa.(*syscall.SockaddrInet4).Port, msgs
+}
+
+func TestSCTP(t *testing.T) {
+	port, msgs := listenSCTP(t)
+
+	hook, err := NewWithOptions("sctp", "127.0.0.1:"+strconv.Itoa(port), WithFormatter(&logrus.JSONFormatter{}))
+	require.NoError(t, err)
+	defer hook.(*Hook).Close()
+
+	require.NoError(t, hook.Fire(&logrus.Entry{Message: "sent over sctp", Data: logrus.Fields{}}))
+
+	select {
+	case msg := <-msgs:
+		assert.Contains(t, msg, `"msg":"sent over sctp"`)
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+}
+
+func TestSCTPDialError(t *testing.T) {
+	_, err := NewWithOptions("sctp6", "127.0.0.1:1", WithDialTimeout(time.Second))
+	assert.Error(t, err)
+}
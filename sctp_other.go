@@ -0,0 +1,15 @@
+//go:build !linux
+
+package logrustash
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// dialSCTP returns an error, SCTP being only supported on Linux.
+func dialSCTP(ctx context.Context, network, addr string) (net.Conn, error) {
+	return nil, &net.OpError{Op: "dial", Net: network, Err: fmt.Errorf("sctp is not supported on %s", runtime.GOOS)}
+}
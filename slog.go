@@ -0,0 +1,153 @@
+package logrustash
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"slices"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SlogHandlerOptions are the options of a slog.Handler returned by NewSlogHandler.
+type SlogHandlerOptions struct {
+	// Level is the minimum level of the records handled, slog.LevelInfo by default.
+	// The levels of the hook, see HookOptions.Levels, apply as well.
+	Level slog.Leveler
+	// AddSource reports the caller of the records, as logrus does with ReportCaller.
+	AddSource bool
+}
+
+// slogHandler is a slog.Handler firing the records as logrus entries with a Hook.
+type slogHandler struct {
+	hook   *Hook
+	opts   SlogHandlerOptions
+	logger *logrus.Logger
+	attrs  logrus.Fields
+	prefix string
+}
+
+// NewSlogHandler returns a slog.Handler sending the records with the hook `hook`, through the same queue,
+// formatter and connection as the entries fired by logrus, so both can be used during a migration.
+// The records are fired as logrus entries, their attributes are fields, the attributes of the groups
+// being prefixed by the name of the group and a dot, e.g. "request.method".
+func NewSlogHandler(hook *Hook, opts *SlogHandlerOptions) slog.Handler {
+	h := &slogHandler{hook: hook, attrs: logrus.Fields{}}
+	if opts != nil {
+		h.opts = *opts
+	}
+
+	// logrus reports the callers of the entries of a logger with ReportCaller only
+	h.logger = logrus.New()
+	h.logger.ReportCaller = h.opts.AddSource
+
+	return h
+}
+
+// Enabled reports whether the records of level `level` are handled.
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+
+	return level >= minLevel && slices.Contains(h.hook.Levels(), logrusLevel(level))
+}
+
+// Handle fires the record as a logrus entry.
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	e := &logrus.Entry{
+		Logger:  h.logger,
+		Data:    make(logrus.Fields, len(h.attrs)+r.NumAttrs()),
+		Time:    r.Time,
+		Level:   logrusLevel(r.Level),
+		Message: r.Message,
+		Context: ctx,
+	}
+
+	for k, v := range h.attrs {
+		e.Data[k] = v
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		addSlogAttr(e.Data, h.prefix, attr)
+		return true
+	})
+
+	if h.opts.AddSource && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		e.Caller = &frame
+	}
+
+	return h.hook.Fire(e)
+}
+
+// WithAttrs returns a handler adding `attrs` to the records.
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	nh := h.clone()
+	for _, attr := range attrs {
+		addSlogAttr(nh.attrs, nh.prefix, attr)
+	}
+
+	return nh
+}
+
+// WithGroup returns a handler prefixing the attributes of the records by `name`.
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	nh := h.clone()
+	nh.prefix += name + "."
+
+	return nh
+}
+
+// clone returns a copy of the handler which does not share its attributes.
+func (h *slogHandler) clone() *slogHandler {
+	nh := *h
+	nh.attrs = make(logrus.Fields, len(h.attrs))
+	for k, v := range h.attrs {
+		nh.attrs[k] = v
+	}
+
+	return &nh
+}
+
+// addSlogAttr adds the attribute `attr` to `fields`, prefixing its key by `prefix`.
+func addSlogAttr(fields logrus.Fields, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		// the attributes of a group without a key are inlined
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, a := range attr.Value.Group() {
+			addSlogAttr(fields, prefix, a)
+		}
+
+		return
+	}
+
+	fields[prefix+attr.Key] = attr.Value.Any()
+}
+
+// logrusLevel returns the logrus level of the slog level `level`.
+func logrusLevel(level slog.Level) logrus.Level {
+	switch {
+	case level >= slog.LevelError:
+		return logrus.ErrorLevel
+	case level >= slog.LevelWarn:
+		return logrus.WarnLevel
+	case level >= slog.LevelInfo:
+		return logrus.InfoLevel
+	case level >= slog.LevelDebug:
+		return logrus.DebugLevel
+	}
+
+	return logrus.TraceLevel
+}
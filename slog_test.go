@@ -0,0 +1,89 @@
+package logrustash
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlogHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := &safeBuffer{}
+	hook, err := NewWithWriter(buffer, WithFormatter(&logrus.JSONFormatter{}), WithSynchronous())
+	require.NoError(err)
+
+	log := slog.New(NewSlogHandler(hook.(*Hook), nil)).With("service", "checkout")
+	log.Debug("hidden")
+	log.WithGroup("request").With("method", "POST").Warn("slow request",
+		"duration", 2*time.Second,
+		slog.Group("user", "id", 42),
+		slog.Group("", "inlined", true),
+	)
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	require.Len(lines, 1)
+
+	var doc map[string]interface{}
+	require.NoError(json.Unmarshal([]byte(lines[0]), &doc))
+	assert.Equal("slow request", doc["msg"])
+	assert.Equal("warning", doc["level"])
+	assert.Equal("checkout", doc["service"])
+	assert.Equal("POST", doc["request.method"])
+	assert.Equal(float64(2*time.Second), doc["request.duration"])
+	assert.Equal(float64(42), doc["request.user.id"])
+	assert.Equal(true, doc["request.inlined"])
+	assert.NotContains(doc, "file")
+}
+
+func TestSlogHandlerEnabled(t *testing.T) {
+	hook, err := NewWithWriter(&safeBuffer{}, WithMinLevel(logrus.WarnLevel))
+	require.NoError(t, err)
+	defer hook.(*Hook).Close()
+
+	h := NewSlogHandler(hook.(*Hook), &SlogHandlerOptions{Level: slog.LevelDebug})
+	assert.False(t, h.Enabled(context.Background(), slog.LevelInfo), "the levels of the hook apply")
+	assert.True(t, h.Enabled(context.Background(), slog.LevelWarn))
+	assert.True(t, h.Enabled(context.Background(), slog.LevelError+4))
+
+	hook, err = NewWithWriter(&safeBuffer{})
+	require.NoError(t, err)
+	defer hook.(*Hook).Close()
+
+	h = NewSlogHandler(hook.(*Hook), &SlogHandlerOptions{Level: slog.LevelDebug})
+	assert.True(t, h.Enabled(context.Background(), slog.LevelDebug))
+	assert.False(t, h.Enabled(context.Background(), slog.LevelDebug-1))
+}
+
+func TestSlogHandlerSource(t *testing.T) {
+	buffer := &safeBuffer{}
+	hook, err := NewWithWriter(buffer, WithSynchronous(), WithStackTrace(0))
+	require.NoError(t, err)
+
+	log := slog.New(NewSlogHandler(hook.(*Hook), &SlogHandlerOptions{AddSource: true}))
+	log.Error("failed")
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(buffer.String()), &doc))
+	assert.Equal(t, "github.com/nekomeowww/logrus-logstash-hook.TestSlogHandlerSource", doc["function"])
+	assert.Contains(t, doc["file"], "slog_test.go:")
+
+	trace, _ := doc[FieldKeyStackTrace].(string)
+	assert.True(t, strings.HasPrefix(trace, "github.com/nekomeowww/logrus-logstash-hook.TestSlogHandlerSource()\n\t"), trace)
+}
+
+func TestLogrusLevel(t *testing.T) {
+	assert.Equal(t, logrus.TraceLevel, logrusLevel(slog.LevelDebug-4))
+	assert.Equal(t, logrus.DebugLevel, logrusLevel(slog.LevelDebug))
+	assert.Equal(t, logrus.InfoLevel, logrusLevel(slog.LevelInfo+1))
+	assert.Equal(t, logrus.WarnLevel, logrusLevel(slog.LevelWarn))
+	assert.Equal(t, logrus.ErrorLevel, logrusLevel(slog.LevelError+4))
+}
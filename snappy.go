@@ -0,0 +1,87 @@
+package logrustash
+
+import (
+	"encoding/binary"
+)
+
+const (
+	snappyTagLiteral = 0x00
+	snappyTagCopy2   = 0x02
+
+	snappyMinMatch  = 4
+	snappyMaxOffset = 1<<16 - 1
+	snappyTableBits = 14
+)
+
+// snappyEncode compresses `src` in the snappy block format, e.g. for the Loki push API.
+// It is a simple greedy encoder, compressing less than the reference implementation
+// but producing blocks any snappy decoder reads.
+func snappyEncode(src []byte) []byte {
+	dst := binary.AppendUvarint(make([]byte, 0, len(src)/2+16), uint64(len(src)))
+
+	var table [1 << snappyTableBits]int32
+	literalStart := 0
+	for i := 0; i+snappyMinMatch <= len(src); {
+		h := snappyHash(binary.LittleEndian.Uint32(src[i:]))
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+
+		if candidate < 0 || i-candidate > snappyMaxOffset ||
+			binary.LittleEndian.Uint32(src[candidate:]) != binary.LittleEndian.Uint32(src[i:]) {
+			i++
+			continue
+		}
+
+		length := snappyMinMatch
+		for i+length < len(src) && src[candidate+length] == src[i+length] {
+			length++
+		}
+
+		dst = snappyAppendLiteral(dst, src[literalStart:i])
+		dst = snappyAppendCopy(dst, i-candidate, length)
+		i += length
+		literalStart = i
+	}
+
+	return snappyAppendLiteral(dst, src[literalStart:])
+}
+
+// snappyHash returns the index of the 4 bytes `u` in the table of the previous positions.
+func snappyHash(u uint32) uint32 {
+	return (u * 0x1e35a7bd) >> (32 - snappyTableBits)
+}
+
+// snappyAppendLiteral appends the literal element of `lit` to `dst`.
+func snappyAppendLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+
+	n := uint32(len(lit) - 1)
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2|snappyTagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|snappyTagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|snappyTagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+
+	return append(dst, lit...)
+}
+
+// snappyAppendCopy appends the copy elements of `length` bytes at `offset` to `dst`,
+// a copy element holding 64 bytes at most.
+func snappyAppendCopy(dst []byte, offset, length int) []byte {
+	for length > 0 {
+		n := min(length, 64)
+		dst = append(dst, byte(n-1)<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+		length -= n
+	}
+
+	return dst
+}
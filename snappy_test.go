@@ -0,0 +1,92 @@
+package logrustash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// snappyDecode decompresses a snappy block.
+func snappyDecode(src []byte) ([]byte, error) {
+	n, read := binary.Uvarint(src)
+	if read <= 0 {
+		return nil, errors.New("invalid length")
+	}
+	src = src[read:]
+
+	dst := make([]byte, 0, n)
+	for len(src) > 0 {
+		tag := src[0]
+		switch tag & 0x03 {
+		case snappyTagLiteral:
+			length := int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				extra := length - 59
+				length = 0
+				for i := 0; i < extra; i++ {
+					length |= int(src[i]) << (8 * i)
+				}
+				src = src[extra:]
+			}
+			length++
+			if length > len(src) {
+				return nil, errors.New("literal out of range")
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+		case snappyTagCopy2:
+			length := int(tag>>2) + 1
+			offset := int(src[1]) | int(src[2])<<8
+			src = src[3:]
+			if offset == 0 || offset > len(dst) {
+				return nil, errors.New("copy out of range")
+			}
+			for i := 0; i < length; i++ {
+				dst = append(dst, dst[len(dst)-offset])
+			}
+		default:
+			return nil, errors.New("unexpected tag")
+		}
+	}
+
+	if uint64(len(dst)) != n {
+		return nil, errors.New("length mismatch")
+	}
+
+	return dst, nil
+}
+
+func TestSnappyEncode(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	testCases := map[string][]byte{
+		"empty":        {},
+		"short":        []byte("abc"),
+		"repeated":     []byte(strings.Repeat(`{"level":"info","msg":"retrying"}`, 1000)),
+		"overlapping":  bytes.Repeat([]byte{'a'}, 1000),
+		"random":       random,
+		"long literal": append(append([]byte(nil), random[:70000]...), random[:70000]...),
+	}
+
+	for name, src := range testCases {
+		t.Run(name, func(t *testing.T) {
+			encoded := snappyEncode(src)
+
+			decoded, err := snappyDecode(encoded)
+			require.NoError(t, err)
+			assert.Equal(t, src, append([]byte{}, decoded...))
+
+			if name == "repeated" {
+				assert.Less(t, len(encoded), len(src)/10)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package logrustash
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	splunkHECEventPath = "/services/collector/event"
+	splunkHECAckPath   = "/services/collector/ack"
+
+	defaultSplunkHECAckTimeout  = 30 * time.Second
+	defaultSplunkHECAckInterval = 100 * time.Millisecond
+)
+
+// ErrSplunkHECAckTimeout is returned when Splunk did not acknowledge the events in time.
+var ErrSplunkHECAckTimeout = errors.New("splunk hec events not acknowledged in time")
+
+// SplunkHECFormatter wraps the entries formatted by Formatter in the event envelope of
+// the Splunk HTTP Event Collector, the entries batched by the hook being sent at once.
+type SplunkHECFormatter struct {
+	// Formatter formats the "event" of the envelope, logrus.JSONFormatter by default.
+	// The events which are not JSON are sent as strings.
+	Formatter logrus.Formatter
+	// Host is the "host" of the events, the host name reported by the kernel by default.
+	Host string
+	// Source, SourceType and Index, if set, are the "source", "sourcetype" and "index" of the events.
+	Source     string
+	SourceType string
+	Index      string
+}
+
+type splunkHECEvent struct {
+	Time       float64     `json:"time"`
+	Host       string      `json:"host,omitempty"`
+	Source     string      `json:"source,omitempty"`
+	SourceType string      `json:"sourcetype,omitempty"`
+	Index      string      `json:"index,omitempty"`
+	Event      interface{} `json:"event"`
+}
+
+// Format formats the entry as a HEC event.
+func (f SplunkHECFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	formatter := f.Formatter
+	if formatter == nil {
+		formatter = &logrus.JSONFormatter{}
+	}
+
+	data, err := formatter.Format(e)
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimSpace(data)
+	var event interface{} = string(data)
+	if json.Valid(data) {
+		event = json.RawMessage(data)
+	}
+
+	host := f.Host
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+
+	t := e.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	envelope, err := json.Marshal(splunkHECEvent{
+		Time:       float64(t.Unix()) + float64(t.Nanosecond())/float64(time.Second),
+		Host:       host,
+		Source:     f.Source,
+		SourceType: f.SourceType,
+		Index:      f.Index,
+		Event:      event,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(envelope, '\n'), nil
+}
+
+// SplunkHECOptions configures the writer returned by NewSplunkHECWriter.
+type SplunkHECOptions struct {
+	HTTPOptions
+
+	// Channel, if set, is the channel of the requests, it enables waiting for the events
+	// to be acknowledged when indexer acknowledgment is enabled on the HEC token.
+	Channel string
+	// AckTimeout is the time waited for the events to be acknowledged, 30 seconds by default.
+	AckTimeout time.Duration
+	// AckInterval is the interval the acknowledgment is polled at, 100 milliseconds by default.
+	AckInterval time.Duration
+}
+
+type splunkHECResponse struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID *int64 `json:"ackId"`
+}
+
+// NewSplunkHECWriter returns a HTTPWriter sending the events formatted by SplunkHECFormatter
+// to the HTTP Event Collector at `endpoint`, e.g. "https://splunk.example.com:8088",
+// authenticated with `token`. Each write is checked against the response of the collector
+// and, if a Channel is set, returns once the events are acknowledged.
+func NewSplunkHECWriter(endpoint, token string, opts SplunkHECOptions) (*HTTPWriter, error) {
+	endpoint = strings.TrimSuffix(endpoint, "/")
+
+	httpOpts := opts.HTTPOptions
+	httpOpts.Header = httpOpts.Header.Clone()
+	if httpOpts.Header == nil {
+		httpOpts.Header = http.Header{}
+	}
+	httpOpts.Header.Set("Authorization", "Splunk "+token)
+	if opts.Channel != "" {
+		httpOpts.Header.Set("X-Splunk-Request-Channel", opts.Channel)
+	}
+	if httpOpts.ContentType == "" {
+		httpOpts.ContentType = "application/json"
+	}
+
+	w, err := NewHTTPWriter(endpoint+splunkHECEventPath, httpOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	w.check = func(body []byte) error {
+		var resp splunkHECResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return fmt.Errorf("invalid splunk hec response: %w", err)
+		}
+		if resp.Code != 0 {
+			return fmt.Errorf("splunk hec error %d: %s", resp.Code, resp.Text)
+		}
+
+		if opts.Channel == "" || resp.AckID == nil {
+			return nil
+		}
+
+		return waitSplunkHECAck(w, endpoint+splunkHECAckPath, *resp.AckID, opts)
+	}
+
+	return w, nil
+}
+
+// waitSplunkHECAck polls the acknowledgment endpoint until the events of `ackID` are indexed.
+func waitSplunkHECAck(w *HTTPWriter, ackURL string, ackID int64, opts SplunkHECOptions) error {
+	timeout, interval := opts.AckTimeout, opts.AckInterval
+	if timeout <= 0 {
+		timeout = defaultSplunkHECAckTimeout
+	}
+	if interval <= 0 {
+		interval = defaultSplunkHECAckInterval
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query, err := json.Marshal(map[string][]int64{"acks": {ackID}})
+	if err != nil {
+		return err
+	}
+
+	// the acknowledgment is queried with the credentials and channel of the events
+	ackWriter := &HTTPWriter{url: ackURL, opts: w.opts, client: w.client}
+
+	for {
+		body, _, _, err := ackWriter.post(ctx, query, "")
+		if ctx.Err() != nil {
+			return ErrSplunkHECAckTimeout
+		}
+		if err != nil {
+			return err
+		}
+
+		var resp struct {
+			Acks map[string]bool `json:"acks"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return fmt.Errorf("invalid splunk hec ack response: %w", err)
+		}
+		if resp.Acks[strconv.FormatInt(ackID, 10)] {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ErrSplunkHECAckTimeout
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package logrustash
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplunkHECFormatter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	entry := &logrus.Entry{Message: "msg1", Level: logrus.InfoLevel, Time: time.Unix(1700000000, 250000000), Data: logrus.Fields{"user": "alice"}}
+
+	res, err := SplunkHECFormatter{Host: "web-1", SourceType: "_json", Index: "main"}.Format(entry)
+	require.NoError(err)
+
+	var envelope map[string]interface{}
+	require.NoError(json.Unmarshal(res, &envelope))
+
+	assert.Equal(1700000000.25, envelope["time"])
+	assert.Equal("web-1", envelope["host"])
+	assert.Equal("_json", envelope["sourcetype"])
+	assert.Equal("main", envelope["index"])
+	assert.NotContains(envelope, "source")
+	assert.Equal("msg1", envelope["event"].(map[string]interface{})["msg"])
+	assert.Equal("alice", envelope["event"].(map[string]interface{})["user"])
+
+	res, err = SplunkHECFormatter{Formatter: &logrus.TextFormatter{DisableTimestamp: true}}.Format(entry)
+	require.NoError(err)
+
+	envelope = nil
+	require.NoError(json.Unmarshal(res, &envelope))
+	assert.Equal("level=info msg=msg1 user=alice", envelope["event"])
+}
+
+func TestSplunkHECWriter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var mu sync.Mutex
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(splunkHECEventPath, r.URL.Path)
+		assert.Equal("Splunk token", r.Header.Get("Authorization"))
+
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+
+		if strings.Contains(string(body), "invalid") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"text":"Invalid data format","code":6}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"text":"Success","code":0}`))
+	}))
+	defer ts.Close()
+
+	w, err := NewSplunkHECWriter(ts.URL+"/", "token", SplunkHECOptions{})
+	require.NoError(err)
+
+	hook, err := NewWithWriter(w, WithFormatter(SplunkHECFormatter{}), WithBatching(2, time.Hour))
+	require.NoError(err)
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "m1", Data: logrus.Fields{}}))
+	require.NoError(hook.Fire(&logrus.Entry{Message: "m2", Data: logrus.Fields{}}))
+	require.NoError(hook.(*Hook).Close())
+
+	mu.Lock()
+	require.Len(bodies, 1)
+	assert.Equal(2, strings.Count(bodies[0], `"event"`))
+	mu.Unlock()
+
+	_, err = w.Write([]byte(`{"event":"invalid"}`))
+	assert.ErrorContains(err, "Invalid data format")
+}
+
+func TestSplunkHECWriterAck(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var mu sync.Mutex
+	polls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("channel-1", r.Header.Get("X-Splunk-Request-Channel"))
+
+		switch r.URL.Path {
+		case splunkHECEventPath:
+			_, _ = w.Write([]byte(`{"text":"Success","code":0,"ackId":7}`))
+		case splunkHECAckPath:
+			body, _ := io.ReadAll(r.Body)
+			assert.JSONEq(`{"acks":[7]}`, string(body))
+
+			mu.Lock()
+			polls++
+			acked := polls >= 3
+			mu.Unlock()
+
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"acks": map[string]bool{"7": acked}})
+		}
+	}))
+	defer ts.Close()
+
+	w, err := NewSplunkHECWriter(ts.URL, "token", SplunkHECOptions{Channel: "channel-1", AckInterval: time.Millisecond})
+	require.NoError(err)
+
+	_, err = w.Write([]byte(`{"event":"m1"}`))
+	require.NoError(err)
+	assert.Equal(3, polls)
+
+	w, err = NewSplunkHECWriter(ts.URL, "token", SplunkHECOptions{Channel: "channel-1", AckInterval: time.Millisecond, AckTimeout: time.Nanosecond})
+	require.NoError(err)
+
+	mu.Lock()
+	polls = -1000
+	mu.Unlock()
+
+	_, err = w.Write([]byte(`{"event":"m1"}`))
+	assert.ErrorIs(err, ErrSplunkHECAckTimeout)
+}
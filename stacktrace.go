@@ -0,0 +1,80 @@
+package logrustash
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/sirupsen/logrus"
+)
+
+// FieldKeyStackTrace is the field HookOptions.StackTrace adds the stack trace of the entries under,
+// as named by the Elastic Common Schema.
+const FieldKeyStackTrace = "error.stack_trace"
+
+// maxStackDepth is the maximum number of frames of the stack traces.
+const maxStackDepth = 64
+
+// loggingFuncPrefixes are the prefixes of the functions called to log an entry, logrus and slog ones
+// and the ones of the Hook and of the slog handler firing it.
+var loggingFuncPrefixes = []string{
+	"github.com/sirupsen/logrus.",
+	"log/slog.",
+	reflect.TypeOf(Hook{}).PkgPath() + ".(*Hook).",
+	reflect.TypeOf(Hook{}).PkgPath() + ".(*slogHandler).",
+}
+
+// withStackTrace returns the entry `e` with the stack trace of the goroutine which logged it,
+// unless it already has one.
+func (h *Hook) withStackTrace(e *logrus.Entry) *logrus.Entry {
+	if _, ok := e.Data[FieldKeyStackTrace]; ok {
+		return e
+	}
+
+	return withFields(e, h.formatter, logrus.Fields{FieldKeyStackTrace: stackTrace(h.opts.StackTraceSkip)})
+}
+
+// stackTrace returns the stack trace of the calling goroutine, formatted as by runtime/debug.Stack,
+// from the function which logged the entry, skipping the frames of logrus, slog and of the hook,
+// and `skip` more frames, e.g. the ones of a logging helper.
+func stackTrace(skip int) string {
+	skip = max(skip, 0)
+	pcs := make([]uintptr, maxStackDepth+skip)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+
+	var b strings.Builder
+	logged := false
+	for {
+		frame, more := frames.Next()
+
+		// the frames up to the call to logrus
+		if !logged && (frame.Function == "" || lo.ContainsBy(loggingFuncPrefixes, func(prefix string) bool {
+			return strings.HasPrefix(frame.Function, prefix)
+		})) {
+			if !more {
+				break
+			}
+			continue
+		}
+		logged = true
+
+		if skip > 0 {
+			skip--
+		} else {
+			b.WriteString(frame.Function)
+			b.WriteString("()\n\t")
+			b.WriteString(frame.File)
+			b.WriteByte(':')
+			b.WriteString(strconv.Itoa(frame.Line))
+			b.WriteByte('\n')
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	return b.String()
+}
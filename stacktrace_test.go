@@ -0,0 +1,71 @@
+package logrustash
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// logError logs an error entry, as a logging helper would.
+func logError(log *logrus.Logger, msg string) {
+	log.Error(msg)
+}
+
+func TestStackTrace(t *testing.T) {
+	for _, formatter := range []logrus.Formatter{DefaultFormatter(logrus.Fields{}), &logrus.JSONFormatter{}} {
+		buffer := &safeBuffer{}
+		hook, err := NewWithWriter(buffer, WithFormatter(formatter), WithSynchronous(), WithStackTrace(0))
+		require.NoError(t, err)
+
+		log := logrus.New()
+		log.Out = &safeBuffer{}
+		log.Hooks.Add(hook)
+		log.Error("failed")
+		log.Warn("warned")
+		log.WithField(FieldKeyStackTrace, "kept").Error("traced")
+
+		lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+		require.Len(t, lines, 3)
+
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &doc))
+		trace, _ := doc[FieldKeyStackTrace].(string)
+		assert.True(t, strings.HasPrefix(trace, "github.com/nekomeowww/logrus-logstash-hook.TestStackTrace()\n\t"), trace)
+		assert.Contains(t, trace, "stacktrace_test.go:")
+		assert.NotContains(t, trace, "sirupsen/logrus")
+
+		doc = nil
+		require.NoError(t, json.Unmarshal([]byte(lines[1]), &doc))
+		assert.NotContains(t, doc, FieldKeyStackTrace)
+
+		doc = nil
+		require.NoError(t, json.Unmarshal([]byte(lines[2]), &doc))
+		if _, ok := formatter.(*logrus.JSONFormatter); ok {
+			assert.Equal(t, "kept", doc[FieldKeyStackTrace])
+		} else {
+			assert.Contains(t, doc["fields"], FieldKeyStackTrace+"=kept")
+		}
+	}
+}
+
+func TestStackTraceSkip(t *testing.T) {
+	buffer := &safeBuffer{}
+	hook, err := NewWithWriter(buffer, WithFormatter(&logrus.JSONFormatter{}), WithStackTrace(1))
+	require.NoError(t, err)
+
+	log := logrus.New()
+	log.Out = &safeBuffer{}
+	log.Hooks.Add(hook)
+	logError(log, "failed")
+	require.NoError(t, hook.(*Hook).Close())
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(buffer.String()), &doc))
+	trace, _ := doc[FieldKeyStackTrace].(string)
+	assert.True(t, strings.HasPrefix(trace, "github.com/nekomeowww/logrus-logstash-hook.TestStackTraceSkip()\n\t"), trace)
+	assert.NotContains(t, trace, "logError")
+}
@@ -0,0 +1,152 @@
+package logrustash
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// sendLatencyBuckets are the upper bounds, in seconds, of the buckets of Stats.SendLatency.
+var sendLatencyBuckets = [...]float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Stats is a snapshot of the counters of a Hook.
+type Stats struct {
+	// Enqueued is the number of entries accepted by Fire to be sent.
+	Enqueued uint64
+	// Sent is the number of entries written to Logstash successfully.
+	Sent uint64
+	// Failed is the number of failed writes to Logstash.
+	Failed uint64
+	// Reconnects is the number of attempts made to reconnect to Logstash.
+	Reconnects uint64
+	// Dropped is the number of entries which were given up on and never delivered.
+	Dropped uint64
+	// Suppressed is the number of the dropped entries which were sampled out, rate limited
+	// or dropped by HookOptions.Middleware.
+	Suppressed uint64
+	// BytesWritten is the number of bytes written to Logstash.
+	BytesWritten uint64
+	// QueueDepth is the number of entries waiting to be sent.
+	QueueDepth int
+	// QueueCapacity is the number of entries which can wait to be sent before
+	// the OverflowPolicy applies.
+	QueueCapacity int
+	// SendLatency is the distribution of the time the writes to Logstash took.
+	SendLatency LatencyHistogram
+}
+
+// LatencyHistogram is the distribution of durations across buckets.
+type LatencyHistogram struct {
+	// Buckets are the upper bounds of the buckets, in seconds.
+	Buckets []float64
+	// Counts are the number of durations of every bucket, not cumulative, followed by
+	// the number of the durations longer than the last bucket.
+	Counts []uint64
+	// Count is the number of durations.
+	Count uint64
+	// Sum is the sum of the durations.
+	Sum time.Duration
+}
+
+// add returns the sum of the distributions of l and o.
+func (l LatencyHistogram) add(o LatencyHistogram) LatencyHistogram {
+	counts := make([]uint64, len(sendLatencyBuckets)+1)
+	for i := range counts {
+		if i < len(l.Counts) {
+			counts[i] += l.Counts[i]
+		}
+		if i < len(o.Counts) {
+			counts[i] += o.Counts[i]
+		}
+	}
+
+	return LatencyHistogram{Buckets: sendLatencyBuckets[:], Counts: counts, Count: l.Count + o.Count, Sum: l.Sum + o.Sum}
+}
+
+// histogram records the durations across sendLatencyBuckets atomically.
+type histogram struct {
+	counts [len(sendLatencyBuckets) + 1]atomic.Uint64
+	count  atomic.Uint64
+	sum    atomic.Int64
+}
+
+// observe records the duration `d`.
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(sendLatencyBuckets) && d.Seconds() > sendLatencyBuckets[i] {
+		i++
+	}
+
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+// snapshot returns the current distribution.
+func (h *histogram) snapshot() LatencyHistogram {
+	counts := make([]uint64, len(sendLatencyBuckets)+1)
+	for i := range counts {
+		counts[i] = h.counts[i].Load()
+	}
+
+	return LatencyHistogram{Buckets: sendLatencyBuckets[:], Counts: counts, Count: h.count.Load(), Sum: time.Duration(h.sum.Load())}
+}
+
+// stats holds the counters of a Hook, all of them are updated atomically.
+type stats struct {
+	enqueued     atomic.Uint64
+	sent         atomic.Uint64
+	failed       atomic.Uint64
+	reconnects   atomic.Uint64
+	dropped      atomic.Uint64
+	suppressed   atomic.Uint64
+	bytesWritten atomic.Uint64
+	sendLatency  histogram
+}
+
+// snapshot returns the current values of the counters.
+func (s *stats) snapshot() Stats {
+	return Stats{
+		Enqueued:     s.enqueued.Load(),
+		Sent:         s.sent.Load(),
+		Failed:       s.failed.Load(),
+		Reconnects:   s.reconnects.Load(),
+		Dropped:      s.dropped.Load(),
+		Suppressed:   s.suppressed.Load(),
+		BytesWritten: s.bytesWritten.Load(),
+		SendLatency:  s.sendLatency.snapshot(),
+	}
+}
+
+// add returns the sum of the counters of s and o.
+func (s Stats) add(o Stats) Stats {
+	return Stats{
+		Enqueued:      s.Enqueued + o.Enqueued,
+		Sent:          s.Sent + o.Sent,
+		Failed:        s.Failed + o.Failed,
+		Reconnects:    s.Reconnects + o.Reconnects,
+		Dropped:       s.Dropped + o.Dropped,
+		Suppressed:    s.Suppressed + o.Suppressed,
+		BytesWritten:  s.BytesWritten + o.BytesWritten,
+		QueueDepth:    s.QueueDepth + o.QueueDepth,
+		QueueCapacity: s.QueueCapacity + o.QueueCapacity,
+		SendLatency:   s.SendLatency.add(o.SendLatency),
+	}
+}
+
+// Stats returns a snapshot of the hook's counters, including the ones of the
+// endpoints entries are routed or balanced to. It is safe to call concurrently.
+func (h *Hook) Stats() Stats {
+	s := h.stats.snapshot()
+	s.QueueDepth = len(h.logrusEntryFireChannel)
+	s.QueueCapacity = cap(h.logrusEntryFireChannel)
+	for _, route := range h.routes {
+		s = s.add(route.Stats())
+	}
+	if h.balancer != nil {
+		for _, m := range h.balancer.members {
+			s = s.add(m.Stats())
+		}
+	}
+
+	return s
+}
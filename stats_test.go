@@ -0,0 +1,86 @@
+package logrustash
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buffer := bytes.NewBuffer(nil)
+	h := &Hook{
+		writer:    buffer,
+		formatter: &logrus.JSONFormatter{},
+	}
+
+	for i := 0; i < 3; i++ {
+		require.NoError(h.Fire(&logrus.Entry{Message: "msg", Data: logrus.Fields{}}))
+	}
+
+	stats := h.Stats()
+	assert.Equal(uint64(3), stats.Enqueued)
+	assert.Equal(uint64(3), stats.Sent)
+	assert.Equal(uint64(3), stats.SendLatency.Count)
+	assert.Len(stats.SendLatency.Counts, len(stats.SendLatency.Buckets)+1)
+	assert.Equal(uint64(buffer.Len()), stats.BytesWritten)
+	assert.Zero(stats.Failed)
+	assert.Zero(stats.Reconnects)
+	assert.Zero(stats.Dropped)
+}
+
+func TestStatsFailed(t *testing.T) {
+	h := &Hook{
+		writer:    FailWrite{},
+		formatter: &logrus.JSONFormatter{},
+	}
+
+	require.Error(t, h.Fire(&logrus.Entry{Data: logrus.Fields{}}))
+
+	stats := h.Stats()
+	assert.Equal(t, uint64(1), stats.Failed)
+	assert.Zero(t, stats.Sent)
+}
+
+func TestStatsQueueDepth(t *testing.T) {
+	assert := assert.New(t)
+
+	w := &gatedWriter{release: make(chan struct{})}
+	hook, err := NewWithWriter(w, WithBufferSize(4))
+	require.NoError(t, err)
+
+	// "m0" blocks the sending goroutine, the other entries are queued
+	fillQueue(t, hook.(*Hook), 0)
+
+	stats := hook.(*Hook).Stats()
+	assert.Equal(4, stats.QueueDepth)
+	assert.Equal(4, stats.QueueCapacity)
+
+	close(w.release)
+	require.NoError(t, hook.(*Hook).Close())
+	assert.Zero(hook.(*Hook).Stats().QueueDepth)
+}
+
+func TestHistogram(t *testing.T) {
+	var h histogram
+	h.observe(500 * time.Microsecond)
+	h.observe(time.Millisecond)
+	h.observe(30 * time.Millisecond)
+	h.observe(time.Minute)
+
+	l := h.snapshot()
+	assert.Equal(t, uint64(4), l.Count)
+	assert.Equal(t, time.Minute+31500*time.Microsecond, l.Sum)
+	assert.Equal(t, []uint64{2, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1}, l.Counts)
+
+	sum := l.add(l)
+	assert.Equal(t, uint64(8), sum.Count)
+	assert.Equal(t, []uint64{4, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 2}, sum.Counts)
+	assert.Equal(t, l.Buckets, sum.Buckets)
+}
@@ -0,0 +1,171 @@
+package logrustash
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultSyslogStructuredDataID is the SD-ID of the structured data element
+	// holding the fields of the entries formatted by SyslogFormatter.
+	DefaultSyslogStructuredDataID = "fields@32473"
+
+	// SyslogFacilityUser is the syslog facility of the user-level messages.
+	SyslogFacilityUser = 1
+
+	syslogTimestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+	syslogNil             = "-"
+)
+
+// syslogSeverities maps the logrus levels to the syslog severities.
+var syslogSeverities = map[logrus.Level]int{
+	logrus.PanicLevel: 1,
+	logrus.FatalLevel: 2,
+	logrus.ErrorLevel: 3,
+	logrus.WarnLevel:  4,
+	logrus.InfoLevel:  6,
+	logrus.DebugLevel: 7,
+	logrus.TraceLevel: 7,
+}
+
+// SyslogFormatter formats the entries as RFC 5424 syslog messages, the fields of the entry
+// being the parameters of a structured data element, e.g. for the Logstash syslog input.
+//
+// The entries are terminated by a newline like the logrus formatters, use
+// OctetCountingFramer to send them over TCP.
+type SyslogFormatter struct {
+	// Facility is the syslog facility of the messages, SyslogFacilityUser by default.
+	Facility int
+	// Hostname is the HOSTNAME of the messages, the host name reported by the kernel by default.
+	Hostname string
+	// AppName is the APP-NAME of the messages, the name of the executable by default.
+	AppName string
+	// ProcID is the PROCID of the messages, the process ID by default.
+	ProcID string
+	// MsgID, if set, is the MSGID of the messages.
+	MsgID string
+	// StructuredDataID is the SD-ID of the element holding the fields, DefaultSyslogStructuredDataID by default.
+	StructuredDataID string
+}
+
+// Format formats the entry as a RFC 5424 syslog message.
+func (f SyslogFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	facility := f.Facility
+	if facility == 0 {
+		facility = SyslogFacilityUser
+	}
+	if facility < 0 || facility > 23 {
+		return nil, fmt.Errorf("invalid syslog facility %d", facility)
+	}
+
+	hostname := f.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	appName := f.AppName
+	if appName == "" && len(os.Args) > 0 {
+		appName = os.Args[0][strings.LastIndexAny(os.Args[0], `/\`)+1:]
+	}
+	procID := f.ProcID
+	if procID == "" {
+		procID = strconv.Itoa(os.Getpid())
+	}
+
+	t := e.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s %s ",
+		facility*8+syslogSeverities[e.Level],
+		t.Format(syslogTimestampFormat),
+		syslogHeaderField(hostname, 255),
+		syslogHeaderField(appName, 48),
+		syslogHeaderField(procID, 128),
+		syslogHeaderField(f.MsgID, 32),
+	)
+
+	f.writeStructuredData(&b, e.Data)
+
+	if e.Message != "" {
+		b.WriteByte(' ')
+		b.WriteString(e.Message)
+	}
+	b.WriteByte('\n')
+
+	return b.Bytes(), nil
+}
+
+// writeStructuredData writes the fields as a structured data element, or the nil value without fields.
+func (f SyslogFormatter) writeStructuredData(b *bytes.Buffer, fields logrus.Fields) {
+	if len(fields) == 0 {
+		b.WriteString(syslogNil)
+		return
+	}
+
+	id := f.StructuredDataID
+	if id == "" {
+		id = DefaultSyslogStructuredDataID
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b.WriteByte('[')
+	b.WriteString(syslogName(id, 32))
+	for _, k := range keys {
+		v := fields[k]
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+
+		fmt.Fprintf(b, ` %s="%s"`, syslogName(k, 32), syslogParamEscaper.Replace(fmt.Sprintf("%v", v)))
+	}
+	b.WriteByte(']')
+}
+
+// syslogParamEscaper escapes the characters not allowed in the values of the structured data parameters.
+var syslogParamEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// syslogHeaderField returns `s` as a header field of at most `max` printable ASCII characters,
+// the other characters being replaced by "_", or the nil value if `s` is empty.
+func syslogHeaderField(s string, max int) string {
+	if s == "" {
+		return syslogNil
+	}
+
+	return syslogPrintable(s, max, "")
+}
+
+// syslogName returns `s` as a SD-NAME of at most `max` characters.
+func syslogName(s string, max int) string {
+	return syslogPrintable(s, max, `= ]"`)
+}
+
+// syslogPrintable replaces the characters of `s` which are not printable ASCII or are in `exclude`
+// with "_" and truncates it to `max` characters.
+func syslogPrintable(s string, max int, exclude string) string {
+	b := []byte(s)
+	if len(b) > max {
+		b = b[:max]
+	}
+
+	for i, c := range b {
+		if c < 33 || c > 126 || strings.IndexByte(exclude, c) >= 0 {
+			b[i] = '_'
+		}
+	}
+
+	return string(b)
+}
@@ -0,0 +1,105 @@
+package logrustash
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyslogFormatter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	entry := &logrus.Entry{
+		Message: "request failed",
+		Level:   logrus.ErrorLevel,
+		Time:    time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC),
+		Data: logrus.Fields{
+			"status":    500,
+			"err":       errors.New(`bad "quote" ] \ here`),
+			"user name": "alice",
+		},
+	}
+
+	res, err := SyslogFormatter{Facility: 16, Hostname: "web-1", AppName: "checkout", ProcID: "42", MsgID: "HTTP"}.Format(entry)
+	require.NoError(err)
+
+	expected := `<131>1 2024-01-02T03:04:05.000006Z web-1 checkout 42 HTTP [fields@32473 err="bad \"quote\" \] \\ here" status="500" user_name="alice"] request failed` + "\n"
+	assert.Equal(expected, string(res))
+
+	// the header fields are detected, sanitized or nil
+	res, err = SyslogFormatter{Hostname: "my host"}.Format(&logrus.Entry{Level: logrus.InfoLevel, Time: entry.Time})
+	require.NoError(err)
+
+	header := strings.Fields(string(res))
+	require.Len(header, 7)
+	assert.Equal("<14>1", header[0])
+	assert.Equal("my_host", header[2])
+	assert.Equal(syslogHeaderField(filepath.Base(os.Args[0]), 48), header[3])
+	assert.Equal(strconv.Itoa(os.Getpid()), header[4])
+	assert.Equal([]string{"-", "-"}, header[5:])
+
+	_, err = SyslogFormatter{Facility: 24}.Format(entry)
+	assert.Error(err)
+}
+
+func TestWithSyslog(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	frames := make(chan string, 2)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		for {
+			length, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+
+			n, _ := strconv.Atoi(strings.TrimSpace(length))
+			frame := make([]byte, n)
+			if _, err := io.ReadFull(r, frame); err != nil {
+				return
+			}
+			frames <- string(frame)
+		}
+	}()
+
+	hook, err := NewWithOptions("tcp", l.Addr().String(), WithSyslog(SyslogFormatter{AppName: "checkout"}))
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	require.NoError(hook.Fire(&logrus.Entry{Message: "multi\nline", Level: logrus.WarnLevel, Data: logrus.Fields{}}))
+	require.NoError(hook.Fire(&logrus.Entry{Message: "second", Level: logrus.InfoLevel, Data: logrus.Fields{}}))
+
+	for _, expected := range []string{"<12>1 ", "<14>1 "} {
+		select {
+		case frame := <-frames:
+			assert.True(strings.HasPrefix(frame, expected), frame)
+			assert.Contains(frame, " checkout ")
+		case <-time.After(time.Second):
+			t.Fatal("entry not received")
+		}
+	}
+}
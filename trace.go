@@ -0,0 +1,83 @@
+package logrustash
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The fields added to the entries by HookOptions.TraceContext, as named by the Elastic Common Schema.
+const (
+	FieldKeyTraceID    = "trace.id"
+	FieldKeySpanID     = "span.id"
+	FieldKeyTraceFlags = "trace.flags"
+)
+
+// TraceContext is the trace context of an entry, e.g. the one of the OpenTelemetry span of its context.
+type TraceContext struct {
+	// TraceID is the 32 hex characters ID of the trace.
+	TraceID string
+	// SpanID is the 16 hex characters ID of the span.
+	SpanID string
+	// Flags are the W3C trace flags, 0x01 if the trace is sampled.
+	Flags byte
+}
+
+// ParseTraceparent parses the value of a W3C traceparent header, e.g.
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01". It reports false if it is invalid.
+func ParseTraceparent(traceparent string) (TraceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return TraceContext{}, false
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return TraceContext{}, false
+	}
+
+	tc := TraceContext{TraceID: parts[1], SpanID: parts[2], Flags: flags[0]}
+	if !tc.valid() {
+		return TraceContext{}, false
+	}
+
+	return tc, true
+}
+
+// valid reports whether the IDs are made of lowercase hex characters of the right length, and not all zeros.
+func (tc TraceContext) valid() bool {
+	return validTraceID(tc.TraceID, 32) && validTraceID(tc.SpanID, 16)
+}
+
+func validTraceID(id string, length int) bool {
+	if len(id) != length || strings.Trim(id, "0") == "" {
+		return false
+	}
+
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// traceFields returns the fields of the trace context of the entry, nil if it has none.
+func (h *Hook) traceFields(e *logrus.Entry) logrus.Fields {
+	if h.opts.TraceContext == nil || e.Context == nil {
+		return nil
+	}
+
+	tc, ok := h.opts.TraceContext(e.Context)
+	if !ok || !tc.valid() {
+		return nil
+	}
+
+	return logrus.Fields{
+		FieldKeyTraceID:    tc.TraceID,
+		FieldKeySpanID:     tc.SpanID,
+		FieldKeyTraceFlags: hex.EncodeToString([]byte{tc.Flags}),
+	}
+}
@@ -0,0 +1,79 @@
+package logrustash
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type traceparentKey struct{}
+
+// traceparentContext returns the trace context of the traceparent held by the context.
+func traceparentContext(ctx context.Context) (TraceContext, bool) {
+	traceparent, _ := ctx.Value(traceparentKey{}).(string)
+	return ParseTraceparent(traceparent)
+}
+
+func TestTraceContext(t *testing.T) {
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	for name, formatter := range map[string]logrus.Formatter{
+		"json":     &logrus.JSONFormatter{},
+		"logstash": DefaultFormatter(logrus.Fields{}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			h := &Hook{writer: buffer, formatter: formatter, opts: HookOptions{TraceContext: traceparentContext}}
+
+			ctx := context.WithValue(context.Background(), traceparentKey{}, traceparent)
+			require.NoError(t, h.Fire(&logrus.Entry{Message: "traced", Context: ctx, Data: logrus.Fields{}}))
+			require.NoError(t, h.Fire(&logrus.Entry{Message: "untraced", Context: context.Background(), Data: logrus.Fields{}}))
+			require.NoError(t, h.Fire(&logrus.Entry{Message: "no context", Data: logrus.Fields{}}))
+
+			var docs []map[string]interface{}
+			for _, line := range bytes.Split(bytes.TrimSpace(buffer.Bytes()), []byte("\n")) {
+				var doc map[string]interface{}
+				require.NoError(t, json.Unmarshal(line, &doc))
+				docs = append(docs, doc)
+			}
+			require.Len(t, docs, 3)
+
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", docs[0][FieldKeyTraceID])
+			assert.Equal(t, "00f067aa0ba902b7", docs[0][FieldKeySpanID])
+			assert.Equal(t, "01", docs[0][FieldKeyTraceFlags])
+			for _, doc := range docs[1:] {
+				assert.NotContains(t, doc, FieldKeyTraceID)
+				assert.NotContains(t, doc, FieldKeySpanID)
+			}
+		})
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tc, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.True(t, ok)
+	assert.Equal(t, TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}, tc)
+
+	// future versions may have more parts
+	_, ok = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	assert.True(t, ok)
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		_, ok := ParseTraceparent(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
@@ -0,0 +1,53 @@
+package logrustash
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// typedValue returns the value `v` of a field as LogstashFormatter.PreserveTypes emits it:
+//
+//   - nil, booleans, integers and finite floats are kept as they are
+//   - strings are kept, truncated to `max` bytes if positive
+//   - time.Time is kept, it is serialized as RFC 3339 with nanoseconds
+//   - time.Duration is formatted by its String method, e.g. "1.5s"
+//   - errors are replaced by their message, truncated to `max` bytes
+//   - NaN and infinite floats are formatted as strings, e.g. "NaN" or "+Inf"
+//   - any other value (structs, maps, slices, json.Marshaler) is kept if it can be
+//     serialized to JSON, otherwise it is formatted as a string with %v
+func typedValue(v interface{}, max int) interface{} {
+	switch v := v.(type) {
+	case nil, bool, time.Time:
+		return v
+	case string:
+		return truncate(v, max)
+	case time.Duration:
+		return v.String()
+	case error:
+		return truncate(v.Error(), max)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v
+	case reflect.Float32, reflect.Float64:
+		if f := rv.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Sprintf("%v", v)
+		}
+
+		return v
+	case reflect.String:
+		return truncate(rv.String(), max)
+	}
+
+	if _, err := json.Marshal(v); err != nil {
+		return truncate(fmt.Sprintf("%v", v), max)
+	}
+
+	return v
+}
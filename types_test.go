@@ -0,0 +1,82 @@
+package logrustash
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedValue(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	type level string
+
+	assert.Nil(typedValue(nil, 0))
+	assert.Equal(true, typedValue(true, 0))
+	assert.Equal(42, typedValue(42, 0))
+	assert.Equal(uint8(7), typedValue(uint8(7), 0))
+	assert.Equal(1.5, typedValue(1.5, 0))
+	assert.Equal("NaN", typedValue(math.NaN(), 0))
+	assert.Equal("+Inf", typedValue(math.Inf(1), 0))
+	assert.Equal(now, typedValue(now, 0))
+	assert.Equal("1.5s", typedValue(1500*time.Millisecond, 0))
+	assert.Equal("boom", typedValue(errors.New("boom"), 0))
+	assert.Equal("hel"+TruncationMarker, typedValue("hello", 3))
+	assert.Equal("hel"+TruncationMarker, typedValue(level("hello"), 3))
+	assert.Equal([]int{1, 2}, typedValue([]int{1, 2}, 0))
+	assert.Equal(map[string]int{"a": 1}, typedValue(map[string]int{"a": 1}, 0))
+
+	ch := make(chan int)
+	assert.IsType("", typedValue(ch, 0), "values which can not be serialized are formatted as strings")
+	assert.IsType("", typedValue(map[string]interface{}{"f": func() {}}, 0))
+}
+
+func TestLogstashFormatterPreserveTypes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	entry := &logrus.Entry{
+		Message: "msg1",
+		Data: logrus.Fields{
+			"attempt": 3,
+			"ratio":   0.5,
+			"retry":   true,
+			"at":      now,
+			"err":     errors.New("boom"),
+			"invalid": math.Inf(-1),
+		},
+	}
+
+	formatter := DefaultFormatter(logrus.Fields{}).(LogstashFormatter)
+	formatter.PreserveTypes = true
+
+	res, err := formatter.Format(entry)
+	require.NoError(err)
+
+	var doc map[string]interface{}
+	require.NoError(json.Unmarshal(res, &doc))
+
+	assert.Equal(float64(3), doc["attempt"])
+	assert.Equal(0.5, doc["ratio"])
+	assert.Equal(true, doc["retry"])
+	assert.Equal("2024-01-02T03:04:05.000000006Z", doc["at"])
+	assert.Equal("boom", doc["err"])
+	assert.Equal("-Inf", doc["invalid"])
+
+	formatter.FieldsNamespace = "fields"
+	res, err = formatter.Format(entry)
+	require.NoError(err)
+
+	doc = nil
+	require.NoError(json.Unmarshal(res, &doc))
+	require.IsType(map[string]interface{}{}, doc["fields"])
+	assert.Equal(float64(3), doc["fields"].(map[string]interface{})["attempt"])
+}
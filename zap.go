@@ -0,0 +1,82 @@
+package logrustash
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// syncTimeout is how long WriteSyncer.Sync waits for the entries to be sent.
+const syncTimeout = 5 * time.Second
+
+// contextKeyPreformatted holds the bytes of an entry already formatted, e.g. by zap.
+type contextKeyPreformatted struct{}
+
+// WriteSyncer writes the entries formatted by another logger with a Hook, through its queue, batching,
+// connection, retries and fallbacks, e.g. so zap and logrus share the same connection to Logstash.
+// It implements zapcore.WriteSyncer without depending on zap:
+//
+//	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), logrustash.NewWriteSyncer(hook), zap.InfoLevel)
+//
+// Every line written is sent as an entry, as it is: the formatter and the options adding fields
+// to the entries do not apply. The lines larger than HookOptions.MaxMessageBytes are dropped,
+// they can not be truncated or split.
+type WriteSyncer struct {
+	hook *Hook
+}
+
+// NewWriteSyncer returns a WriteSyncer writing with the hook `hook`.
+func NewWriteSyncer(hook *Hook) *WriteSyncer {
+	return &WriteSyncer{hook: hook}
+}
+
+// Write fires every line of `data` as an entry.
+func (w *WriteSyncer) Write(data []byte) (int, error) {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		// the line is kept after Write returns, while the caller re-uses its buffer
+		line = append(append(make([]byte, 0, len(line)+1), line...), '\n')
+
+		e := &logrus.Entry{
+			Data:    logrus.Fields{},
+			Time:    time.Now(),
+			Level:   logrus.InfoLevel,
+			Message: string(line[:len(line)-1]),
+			Context: context.WithValue(context.Background(), contextKeyPreformatted{}, line),
+		}
+		if err := w.hook.Fire(e); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Sync waits for the entries written so far, and the other entries queued or batched by the hook,
+// to be sent. It gives up after five seconds, e.g. while the hook is reconnecting.
+func (w *WriteSyncer) Sync() error {
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+
+	if err := w.hook.sync(ctx); err != nil {
+		return fmt.Errorf("failed to sync the entries: %w", err)
+	}
+
+	return nil
+}
+
+// preformatted returns the bytes of the entry `e` if it is already formatted.
+func preformatted(e *logrus.Entry) ([]byte, bool) {
+	if e.Context == nil {
+		return nil, false
+	}
+
+	data, ok := e.Context.Value(contextKeyPreformatted{}).([]byte)
+	return data, ok
+}
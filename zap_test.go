@@ -0,0 +1,95 @@
+package logrustash
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSyncer(t *testing.T) {
+	require := require.New(t)
+
+	buffer := &safeBuffer{}
+	hook, err := NewWithWriter(buffer, WithFormatter(&logrus.JSONFormatter{}), WithSentAt("sent_at"))
+	require.NoError(err)
+
+	w := NewWriteSyncer(hook.(*Hook))
+
+	line := []byte(`{"level":"info","msg":"from zap"}` + "\n")
+	n, err := w.Write(line)
+	require.NoError(err)
+	require.Equal(len(line), n)
+
+	// zap re-uses its buffers once Write returns
+	copy(line, `{"level":"warn","msg":"reused..."}`)
+
+	_, err = w.Write([]byte(`{"msg":"first"}` + "\n\n" + `{"msg":"second"}`))
+	require.NoError(err)
+	require.NoError(w.Sync())
+	require.NoError(hook.(*Hook).Close())
+
+	expected := `{"level":"info","msg":"from zap"}
+{"msg":"first"}
+{"msg":"second"}
+`
+	assert.Equal(t, expected, buffer.String())
+	assert.Equal(t, uint64(3), hook.(*Hook).Stats().Sent)
+}
+
+func TestWriteSyncerSync(t *testing.T) {
+	require := require.New(t)
+
+	buffer := &safeBuffer{}
+	hook, err := NewWithWriter(buffer, WithBatching(10, time.Hour))
+	require.NoError(err)
+	defer hook.(*Hook).Close()
+
+	w := NewWriteSyncer(hook.(*Hook))
+	for _, msg := range []string{"first", "second"} {
+		_, err = w.Write([]byte(`{"msg":"` + msg + `"}` + "\n"))
+		require.NoError(err)
+	}
+
+	// the entries are still queued or batched until synced
+	require.NoError(w.Sync())
+	assert.Equal(t, `{"msg":"first"}`+"\n"+`{"msg":"second"}`+"\n", buffer.String())
+}
+
+func TestWriteSyncerMaxMessageBytes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	for _, policy := range []OversizePolicy{OversizeTruncate, OversizeSplit} {
+		buffer, deadLetters := &safeBuffer{}, &bytes.Buffer{}
+		hook, err := NewWithWriter(buffer, WithMaxMessageBytes(32, policy), WithDeadLetter(deadLetters), WithSynchronous())
+		require.NoError(err)
+
+		w := NewWriteSyncer(hook.(*Hook))
+		_, err = w.Write([]byte(`{"msg":"small"}` + "\n"))
+		require.NoError(err)
+
+		line := `{"msg":"` + strings.Repeat("x", 64) + `"}` + "\n"
+		_, err = w.Write([]byte(line))
+		assert.ErrorIs(err, ErrMessageTooLarge)
+		require.NoError(hook.(*Hook).Close())
+
+		assert.Equal(`{"msg":"small"}`+"\n", buffer.String())
+		letters := readDeadLetters(t, deadLetters)
+		require.Len(letters, 1)
+		assert.Equal(line, string(letters[0].Payload))
+	}
+}
+
+func TestWriteSyncerClosed(t *testing.T) {
+	hook, err := NewWithWriter(&safeBuffer{})
+	require.NoError(t, err)
+	require.NoError(t, hook.(*Hook).Close())
+
+	_, err = NewWriteSyncer(hook.(*Hook)).Write([]byte("{}\n"))
+	assert.ErrorIs(t, err, ErrClosed)
+}